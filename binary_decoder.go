@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/binary"
 	"io"
+	"math"
 	"strconv"
 )
 
@@ -13,7 +14,8 @@ const (
 
 // BinaryDecoder reads and decodes binary-encoded KeyValue nodes from an input stream.
 type BinaryDecoder struct {
-	r *bufio.Reader
+	r   *bufio.Reader
+	off int64
 }
 
 // NewBinaryDecoder returns a new binary decoder that reads from r.
@@ -23,17 +25,33 @@ func NewBinaryDecoder(r io.Reader) *BinaryDecoder {
 
 // Decode reads the next binary-encoded KeyValue node from its input and stores it in the value
 // pointed to by kv.
+//
+// Returns io.EOF if the input is at its end, or a *BinaryFormatError if the input is malformed
+// (including truncated input).
 func (d *BinaryDecoder) Decode(kv KeyValue) error {
+	return d.decode(kv, true)
+}
+
+func (d *BinaryDecoder) decode(kv KeyValue, top bool) error {
 	var (
-		typ   Type
 		value string
 		err   error
 	)
 
-	typ, err = d.readType()
+	b, err := d.readByte()
 
 	if err != nil {
-		return err
+		if top && err == io.EOF {
+			return err
+		}
+
+		return d.formatError(0, err)
+	}
+
+	typ := TypeFromByte(b)
+
+	if typ == TypeInvalid {
+		return &BinaryFormatError{Offset: d.off - 1, Type: b, Err: ErrInvalidType}
 	}
 
 	kv.SetType(typ)
@@ -45,7 +63,7 @@ func (d *BinaryDecoder) Decode(kv KeyValue) error {
 	key, err := d.readString()
 
 	if err != nil {
-		return err
+		return d.formatError(b, err)
 	}
 
 	kv.SetKey(key)
@@ -59,48 +77,46 @@ func (d *BinaryDecoder) Decode(kv KeyValue) error {
 		}
 
 		kv.SetChildren(children...)
-	case TypeString:
-		if value, err = d.readString(); err != nil {
-			return err
-		}
 
-		kv.SetValue(value)
+		return nil
+	case TypeString:
+		value, err = d.readString()
 	case TypeInt32, TypeColor, TypePointer:
-		if value, err = d.readInt32String(); err != nil {
-			return err
-		}
-
-		kv.SetValue(value)
+		value, err = d.readInt32String()
 	case TypeInt64:
-		if value, err = d.readInt64String(); err != nil {
-			return err
-		}
-
-		kv.SetValue(value)
+		value, err = d.readInt64String()
 	case TypeUint64:
-		if value, err = d.readUint64String(); err != nil {
-			return err
-		}
-
-		kv.SetValue(value)
+		value, err = d.readUint64String()
 	case TypeFloat32:
-		if value, err = d.readFloat32String(); err != nil {
-			return err
-		}
+		value, err = d.readFloat32String()
+	}
 
-		kv.SetValue(value)
+	if err != nil {
+		return d.formatError(b, err)
 	}
 
+	kv.SetValue(value)
+
 	return nil
 }
 
+// formatError wraps a read error in a BinaryFormatError, reporting a premature end of input as
+// io.ErrUnexpectedEOF.
+func (d *BinaryDecoder) formatError(typ byte, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return &BinaryFormatError{Offset: d.off, Type: typ, Err: err}
+}
+
 func (d *BinaryDecoder) readObject() ([]KeyValue, error) {
 	var kvs []KeyValue
 
 	for {
 		kv := NewKeyValueEmpty()
 
-		if err := d.Decode(kv); err != nil {
+		if err := d.decode(kv, false); err != nil {
 			return nil, err
 		}
 
@@ -114,18 +130,21 @@ func (d *BinaryDecoder) readObject() ([]KeyValue, error) {
 	return kvs, nil
 }
 
-func (d *BinaryDecoder) readType() (Type, error) {
+func (d *BinaryDecoder) readByte() (byte, error) {
 	b, err := d.r.ReadByte()
 
 	if err != nil {
 		return 0, err
 	}
 
-	return TypeFromByte(b), nil
+	d.off++
+
+	return b, nil
 }
 
 func (d *BinaryDecoder) readString() (string, error) {
 	s, err := d.r.ReadString(binaryDelimString)
+	d.off += int64(len(s))
 
 	if err != nil {
 		return "", err
@@ -134,30 +153,57 @@ func (d *BinaryDecoder) readString() (string, error) {
 	return s[:len(s)-1], nil
 }
 
+func (d *BinaryDecoder) readFull(buf []byte) error {
+	n, err := io.ReadFull(d.r, buf)
+	d.off += int64(n)
+
+	return err
+}
+
+func (d *BinaryDecoder) readUint32() (uint32, error) {
+	var buf [4]byte
+
+	if err := d.readFull(buf[:]); err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(buf[:]), nil
+}
+
+func (d *BinaryDecoder) readUint64() (uint64, error) {
+	var buf [8]byte
+
+	if err := d.readFull(buf[:]); err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(buf[:]), nil
+}
+
 func (d *BinaryDecoder) readInt64String() (string, error) {
-	var n int64
+	n, err := d.readUint64()
 
-	if err := binary.Read(d.r, binary.LittleEndian, &n); err != nil {
+	if err != nil {
 		return "", err
 	}
 
-	return strconv.FormatInt(n, 10), nil
+	return strconv.FormatInt(int64(n), 10), nil
 }
 
 func (d *BinaryDecoder) readInt32String() (string, error) {
-	var n int32
+	n, err := d.readUint32()
 
-	if err := binary.Read(d.r, binary.LittleEndian, &n); err != nil {
+	if err != nil {
 		return "", err
 	}
 
-	return strconv.FormatInt(int64(n), 10), nil
+	return strconv.FormatInt(int64(int32(n)), 10), nil
 }
 
 func (d *BinaryDecoder) readUint64String() (string, error) {
-	var n uint64
+	n, err := d.readUint64()
 
-	if err := binary.Read(d.r, binary.LittleEndian, &n); err != nil {
+	if err != nil {
 		return "", err
 	}
 
@@ -165,11 +211,11 @@ func (d *BinaryDecoder) readUint64String() (string, error) {
 }
 
 func (d *BinaryDecoder) readFloat32String() (string, error) {
-	var n float32
+	n, err := d.readUint32()
 
-	if err := binary.Read(d.r, binary.LittleEndian, &n); err != nil {
+	if err != nil {
 		return "", err
 	}
 
-	return strconv.FormatFloat(float64(n), 'f', -1, 32), nil
+	return strconv.FormatFloat(float64(math.Float32frombits(n)), 'f', -1, 32), nil
 }
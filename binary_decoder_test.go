@@ -2,6 +2,8 @@ package kv_test
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -34,6 +36,11 @@ func (s *BinaryDecoderSuite) TestDecode() {
 			Expected: kv.NewKeyValueEmpty(),
 			Err:      "EOF",
 		},
+		{
+			Data:     []byte{0x09},
+			Expected: kv.NewKeyValueEmpty(),
+			Err:      "kv: offset 0: invalid type byte 0x09",
+		},
 		{
 			Data:     []byte{kv.TypeEnd.Byte()},
 			Expected: kv.NewKeyValue(kv.TypeEnd, "", "", nil),
@@ -41,22 +48,22 @@ func (s *BinaryDecoderSuite) TestDecode() {
 		{
 			Data:     []byte{kv.TypeString.Byte()},
 			Expected: kv.NewKeyValue(kv.TypeString, "", "", nil),
-			Err:      "EOF",
+			Err:      "kv: offset 1: unexpected EOF",
 		},
 		{
 			Data:     []byte{kv.TypeString.Byte(), 'K'},
 			Expected: kv.NewKeyValue(kv.TypeString, "", "", nil),
-			Err:      "EOF",
+			Err:      "kv: offset 2: unexpected EOF",
 		},
 		{
 			Data:     []byte{kv.TypeString.Byte(), 'K', 0x00},
 			Expected: kv.NewKeyValue(kv.TypeString, "K", "", nil),
-			Err:      "EOF",
+			Err:      "kv: offset 3: unexpected EOF",
 		},
 		{
 			Data:     []byte{kv.TypeString.Byte(), 'K', 0x00, 'S'},
 			Expected: kv.NewKeyValue(kv.TypeString, "K", "", nil),
-			Err:      "EOF",
+			Err:      "kv: offset 4: unexpected EOF",
 		},
 		{
 			Data:     []byte{kv.TypeString.Byte(), 'K', 0x00, 'S', 0x00},
@@ -65,7 +72,7 @@ func (s *BinaryDecoderSuite) TestDecode() {
 		{
 			Data:     []byte{kv.TypeInt32.Byte(), 'K', 0x00, 0x01, 0x00, 0x00},
 			Expected: kv.NewKeyValue(kv.TypeInt32, "K", "", nil),
-			Err:      "unexpected EOF",
+			Err:      "kv: offset 6: unexpected EOF",
 		},
 		{
 			Data: []byte{
@@ -82,7 +89,7 @@ func (s *BinaryDecoderSuite) TestDecode() {
 				0x01, 's', 0x00, 'S',
 			},
 			Expected: kv.NewKeyValue(kv.TypeObject, "K", "", nil),
-			Err:      "EOF",
+			Err:      "kv: offset 7: unexpected EOF",
 		},
 		{
 			Data: []byte{
@@ -167,3 +174,29 @@ func (s *BinaryDecoderSuite) TestDecode() {
 		s.RequireEqualKeyValuef(expected, actual, "test case %d", testCaseIdx)
 	}
 }
+
+func (s *BinaryDecoderSuite) TestDecodeErrors() {
+	require := s.Require()
+
+	var formatErr *kv.BinaryFormatError
+
+	data := []byte{kv.TypeObject.Byte(), 'K', 0x00, 0x0b}
+	err := kv.NewBinaryDecoder(bytes.NewReader(data)).Decode(kv.NewKeyValueEmpty())
+
+	require.True(errors.As(err, &formatErr))
+	require.True(errors.Is(err, kv.ErrInvalidType))
+	require.EqualValues(3, formatErr.Offset)
+	require.EqualValues(0x0b, formatErr.Type)
+
+	data = []byte{kv.TypeUint64.Byte(), 'K', 0x00, 0x01}
+	err = kv.NewBinaryDecoder(bytes.NewReader(data)).Decode(kv.NewKeyValueEmpty())
+
+	require.True(errors.As(err, &formatErr))
+	require.True(errors.Is(err, io.ErrUnexpectedEOF))
+	require.EqualValues(4, formatErr.Offset)
+	require.Equal(kv.TypeUint64.Byte(), formatErr.Type)
+
+	err = kv.NewBinaryDecoder(bytes.NewReader(nil)).Decode(kv.NewKeyValueEmpty())
+
+	require.Equal(io.EOF, err)
+}
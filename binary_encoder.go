@@ -3,7 +3,6 @@ package kv
 import (
 	"bufio"
 	"encoding/binary"
-	"fmt"
 	"io"
 )
 
@@ -19,9 +18,9 @@ func NewBinaryEncoder(w io.Writer) *BinaryEncoder {
 
 // Encode writes the KeyValue binary encoding of kv to the stream.
 func (e *BinaryEncoder) Encode(kv KeyValue) error {
-	switch kv.Type() {
-	case TypeInvalid, TypeEnd, TypeWString:
-		return fmt.Errorf("kv: cannot encode node of type %s", kv.Type())
+	switch t := kv.Type(); {
+	case t == TypeEnd, t == TypeWString, TypeFromByte(t.Byte()) != t:
+		return newUnsupportedTypeError(kv)
 	}
 
 	var err error
@@ -2,6 +2,8 @@ package kv_test
 
 import (
 	"bytes"
+	"errors"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -41,6 +43,11 @@ func (s *BinaryEncoderSuite) TestEncode() {
 			Expected: nil,
 			Err:      "kv: cannot encode node of type Invalid",
 		},
+		{
+			Subject:  kv.NewKeyValueInt32("K", "abc", nil),
+			Expected: nil,
+			Err:      `kv: cannot convert Value "abc" to Int32: strconv.ParseInt: parsing "abc": invalid syntax`,
+		},
 		{
 			Subject:  kv.NewKeyValueString("K", "S", nil),
 			Expected: []byte{kv.TypeString.Byte(), 'K', 0x00, 'S', 0x00},
@@ -175,3 +182,33 @@ func (s *BinaryEncoderSuite) TestEncode() {
 		require.Equalf(expected, actual, "test case %d", testCaseIdx)
 	}
 }
+
+func (s *BinaryEncoderSuite) TestEncodeErrors() {
+	require := s.Require()
+	enc := kv.NewBinaryEncoder(&bytes.Buffer{})
+
+	var typeErr *kv.TypeError
+
+	err := enc.Encode(kv.NewKeyValue(kv.TypeWString, "K", "", nil))
+
+	require.True(errors.As(err, &typeErr))
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+	require.Equal(kv.OpEncode, typeErr.Op)
+	require.Equal("K", typeErr.Key)
+	require.Equal(kv.TypeWString, typeErr.Type)
+
+	for _, t := range []kv.Type{kv.TypeNull, kv.TypeBool, kv.TypeDouble, kv.TypeArray, kv.TypeBinary} {
+		err = enc.Encode(kv.NewKeyValueRoot("K").AddChild(kv.NewKeyValue(t, "C", "", nil)))
+
+		require.Truef(errors.Is(err, kv.ErrUnsupportedType), "type %s", t)
+		require.EqualErrorf(err, "kv: cannot encode node of type "+t.String(), "type %s", t)
+	}
+
+	err = enc.Encode(kv.NewKeyValueFloat32("K", "1.2.3", nil))
+
+	require.True(errors.As(err, &typeErr))
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+	require.True(errors.Is(err, strconv.ErrSyntax))
+	require.Equal(kv.OpConvert, typeErr.Op)
+	require.Equal("1.2.3", typeErr.Value)
+}
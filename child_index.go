@@ -0,0 +1,70 @@
+package kv
+
+// childIndexThreshold is the minimum number of children of a node for child lookups to build and
+// use a key index, below which a linear scan is faster.
+const childIndexThreshold = 16
+
+// childIndex maps (possibly folded) keys to the child nodes with that key, in order.
+type childIndex struct {
+	mode     KeyMode
+	children map[string][]KeyValue
+}
+
+func newChildIndex(children []KeyValue, mode KeyMode) *childIndex {
+	idx := &childIndex{
+		mode:     mode,
+		children: make(map[string][]KeyValue, len(children)),
+	}
+
+	for _, c := range children {
+		idx.add(c)
+	}
+
+	return idx
+}
+
+func (idx *childIndex) add(c KeyValue) {
+	key := idx.mode.fold(c.Key())
+	idx.children[key] = append(idx.children[key], c)
+}
+
+func (idx *childIndex) lookup(key string) []KeyValue {
+	return idx.children[idx.mode.fold(key)]
+}
+
+// childIndex returns the key index of the node's children for the given mode, building it if
+// needed, or nil if the index is disabled or the node has too few children to be indexed.
+//
+// Lookups only read the children, so concurrent lookups may build separate indexes, the last one
+// being kept.
+func (kv *keyValue) childIndex(mode KeyMode) *childIndex {
+	if kv.noIndex || len(kv.children) < childIndexThreshold {
+		return nil
+	}
+
+	idx, _ := kv.index.Load().(*childIndex)
+
+	if idx == nil || idx.mode != mode {
+		idx = newChildIndex(kv.children, mode)
+		kv.index.Store(idx)
+	}
+
+	return idx
+}
+
+// resetChildIndex discards the key index, to be rebuilt by the next lookup.
+func (kv *keyValue) resetChildIndex() {
+	if idx, _ := kv.index.Load().(*childIndex); idx != nil {
+		kv.index.Store((*childIndex)(nil))
+	}
+}
+
+func (kv *keyValue) SetChildIndex(enabled bool) KeyValue {
+	kv.noIndex = !enabled
+
+	if !enabled {
+		kv.resetChildIndex()
+	}
+
+	return kv
+}
@@ -0,0 +1,111 @@
+// Command kvgen generates Go types from sample KeyValue files.
+//
+// Usage:
+//
+//   kvgen [flags] file...
+//
+// Files are decoded as binary KeyValues if they start with a binary type byte, otherwise as text,
+// with numeric fields typed after their values. The shapes of all files are merged into a type
+// hierarchy (see structgen.Generator), whose declarations are written with "kv" struct tags, to be
+// used with kv.Unmarshal. The flags are:
+//
+//   -o file
+//     write the output to file instead of the standard output
+//   -pkg name
+//     package of the output (default "main")
+//   -type name
+//     name of the root type (default derived from the key of the first file's root node)
+//   -min-map-keys n
+//     minimum number of dynamic keys of an Object node to be typed as a map (default 5)
+//
+// For example, with go generate:
+//
+//   //go:generate kvgen -pkg heroes -type Heroes -o heroes_kv.go npc_heroes.txt
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/13k/kv-go"
+	"github.com/13k/kv-go/structgen"
+)
+
+func main() {
+	output := flag.String("o", "", "write the output to `file` instead of the standard output")
+	pkg := flag.String("pkg", "main", "package `name` of the output")
+	typ := flag.String("type", "", "`name` of the root type (default derived from the root key)")
+	minMapKeys := flag.Int("min-map-keys", structgen.DefaultMinMapKeys,
+		"minimum number of dynamic keys of an Object node to be typed as a map")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: kvgen [flags] file...\n\n")
+		flag.PrintDefaults()
+	}
+
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*output, *pkg, *typ, *minMapKeys, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "kvgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(output, pkg, typ string, minMapKeys int, files []string) error {
+	g := structgen.New(pkg).Type(typ).MinMapKeys(minMapKeys)
+
+	for _, name := range files {
+		root, err := decodeFile(name)
+
+		if err != nil {
+			return err
+		}
+
+		g.Add(root)
+	}
+
+	src, err := g.Generate()
+
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+
+	return ioutil.WriteFile(output, src, 0o644) //nolint:gosec
+}
+
+// decodeFile decodes the KeyValue file with the given name, detecting its encoding like
+// kv.Unmarshal.
+func decodeFile(name string) (kv.KeyValue, error) {
+	data, err := ioutil.ReadFile(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	root := kv.NewKeyValueEmpty()
+
+	if len(data) > 0 && data[0] <= kv.TypeEnd.Byte() {
+		err = kv.NewBinaryDecoder(bytes.NewReader(data)).Decode(root)
+	} else {
+		err = kv.NewTextDecoder(bytes.NewReader(data)).InferTypes().Decode(root)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return root, nil
+}
@@ -0,0 +1,404 @@
+package kv
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ChangeType represents the kind of a Change.
+type ChangeType uint8
+
+// Change types.
+const (
+	// ChangeAdd means that a node was added.
+	ChangeAdd ChangeType = iota + 1
+	// ChangeRemove means that a node was removed.
+	ChangeRemove
+	// ChangeModify means that a node's type, value or flag changed.
+	ChangeModify
+)
+
+var changeTypeNames = [...]string{
+	ChangeAdd:    "add",
+	ChangeRemove: "remove",
+	ChangeModify: "modify",
+}
+
+var changeTypeSymbols = [...]string{
+	ChangeAdd:    "+",
+	ChangeRemove: "-",
+	ChangeModify: "~",
+}
+
+// String returns the change type name.
+func (t ChangeType) String() string {
+	if t > 0 && int(t) < len(changeTypeNames) {
+		return changeTypeNames[t]
+	}
+
+	return "ChangeType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// DiffKey is a segment of a Change path: the key of a node and, to tell apart nodes with duplicate
+// keys, its (zero-based) occurrence among the children of its parent with the same key.
+//
+// Elements of Array nodes are referenced by their indexes, as keys.
+type DiffKey struct {
+	Key        string
+	Occurrence int
+}
+
+// Change is a difference between two KeyValue trees.
+type Change struct {
+	// Type is the kind of change.
+	Type ChangeType
+	// Path is the path of the changed node, relative to the root of the trees.
+	Path []DiffKey
+	// Old is the node in the old tree, or nil for ChangeAdd.
+	Old KeyValue
+	// New is the node in the new tree, or nil for ChangeRemove.
+	New KeyValue
+}
+
+// PathString returns the path of the changed node, in the format of ParsePath with the occurrence
+// of duplicate keys in brackets, like in `npc_dota_hero_axe/Ability1[1]`.
+func (c Change) PathString() string {
+	return formatDiffPath(c.Path)
+}
+
+// formatDiffPath returns the path of keys in the format of ParsePath, with the occurrence of
+// duplicate keys in brackets.
+func formatDiffPath(keys []DiffKey) string {
+	var b strings.Builder
+
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(pathSeparator)
+		}
+
+		b.WriteString(pathEscaper.Replace(k.Key))
+
+		if k.Occurrence > 0 {
+			b.WriteByte('[')
+			b.WriteString(strconv.Itoa(k.Occurrence))
+			b.WriteByte(']')
+		}
+	}
+
+	return b.String()
+}
+
+// String returns a text rendering of the change, like:
+//
+//   + npc_dota_hero_axe/Ability7 = "axe_culling_blade"
+//   - npc_dota_hero_axe/Ability6 = "axe_counter_helix"
+//   ~ npc_dota_hero_axe/AttackRate: "1.7" -> "1.6"
+func (c Change) String() string {
+	var b strings.Builder
+
+	b.WriteString(c.Type.symbol())
+	b.WriteByte(' ')
+	b.WriteString(c.PathString())
+
+	switch c.Type {
+	case ChangeAdd:
+		b.WriteString(" = ")
+		b.WriteString(formatDiffValue(c.New, false))
+	case ChangeRemove:
+		b.WriteString(" = ")
+		b.WriteString(formatDiffValue(c.Old, false))
+	case ChangeModify:
+		withType := c.Old.Type() != c.New.Type()
+
+		b.WriteString(": ")
+		b.WriteString(formatDiffValue(c.Old, withType))
+		b.WriteString(" -> ")
+		b.WriteString(formatDiffValue(c.New, withType))
+	}
+
+	return b.String()
+}
+
+func (t ChangeType) symbol() string {
+	if t > 0 && int(t) < len(changeTypeSymbols) {
+		return changeTypeSymbols[t]
+	}
+
+	return "?"
+}
+
+func formatDiffValue(kv KeyValue, withType bool) string {
+	var s string
+
+	switch kv.Type() {
+	case TypeObject:
+		s = "{...}"
+	case TypeArray:
+		s = "[...]"
+	case TypeNull:
+		s = "null"
+	default:
+		s = strconv.Quote(kv.Value())
+	}
+
+	if kv.Flag() != FlagNone {
+		s = kv.Flag().String() + ":" + s
+	}
+
+	if withType {
+		s += " (" + kv.Type().String() + ")"
+	}
+
+	return s
+}
+
+// ChangeSet is a list of changes between two KeyValue trees, as returned by Diff.
+type ChangeSet []Change
+
+// String returns a text rendering of the changes, one per line.
+func (cs ChangeSet) String() string {
+	var b strings.Builder
+
+	for _, c := range cs {
+		b.WriteString(c.String())
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+// Diff compares the KeyValue trees a and b and returns the changes from a to b.
+//
+// The children of Object nodes are matched by key (compared according to the KeyMode of a), with
+// nodes with duplicate keys matched by their order among the nodes with the same key, so reordering
+// nodes with different keys is not a change. The children of Array nodes are matched by index.
+//
+// Matched nodes with different types, values or flags are reported as a single ChangeModify, while
+// matched Object and Array nodes are compared recursively. Unmatched nodes are reported as a
+// ChangeRemove or ChangeAdd of the whole subtree.
+//
+// The changes reference the nodes of a and b, so modifying the trees modifies the changes.
+func Diff(a, b KeyValue) ChangeSet {
+	var cs ChangeSet
+
+	diffNode(&cs, nil, a, b, a.KeyMode())
+
+	return cs
+}
+
+func diffNode(cs *ChangeSet, path []DiffKey, a, b KeyValue, mode KeyMode) {
+	if a.Type() != b.Type() || a.Flag() != b.Flag() {
+		*cs = append(*cs, Change{Type: ChangeModify, Path: path, Old: a, New: b})
+		return
+	}
+
+	switch a.Type() {
+	case TypeObject:
+		diffObject(cs, path, a, b, mode)
+	case TypeArray:
+		diffArray(cs, path, a, b, mode)
+	default:
+		if a.Value() != b.Value() {
+			*cs = append(*cs, Change{Type: ChangeModify, Path: path, Old: a, New: b})
+		}
+	}
+}
+
+func diffObject(cs *ChangeSet, path []DiffKey, a, b KeyValue, mode KeyMode) {
+	type occurrence struct {
+		key string
+		n   int
+	}
+
+	index := func(kv KeyValue) ([]occurrence, map[occurrence]KeyValue) {
+		counts := map[string]int{}
+		occurrences := make([]occurrence, len(kv.Children()))
+		nodes := make(map[occurrence]KeyValue, len(kv.Children()))
+
+		for i, c := range kv.Children() {
+			key := mode.fold(c.Key())
+			occurrences[i] = occurrence{key: key, n: counts[key]}
+			nodes[occurrences[i]] = c
+			counts[key]++
+		}
+
+		return occurrences, nodes
+	}
+
+	aOccurrences, aNodes := index(a)
+	bOccurrences, bNodes := index(b)
+
+	for i, c := range a.Children() {
+		o := aOccurrences[i]
+		childPath := appendDiffKey(path, DiffKey{Key: c.Key(), Occurrence: o.n})
+
+		if d, ok := bNodes[o]; ok {
+			diffNode(cs, childPath, c, d, mode)
+		} else {
+			*cs = append(*cs, Change{Type: ChangeRemove, Path: childPath, Old: c})
+		}
+	}
+
+	for i, d := range b.Children() {
+		o := bOccurrences[i]
+
+		if _, ok := aNodes[o]; !ok {
+			childPath := appendDiffKey(path, DiffKey{Key: d.Key(), Occurrence: o.n})
+			*cs = append(*cs, Change{Type: ChangeAdd, Path: childPath, New: d})
+		}
+	}
+}
+
+func diffArray(cs *ChangeSet, path []DiffKey, a, b KeyValue, mode KeyMode) {
+	ac, bc := a.Children(), b.Children()
+
+	for i, c := range ac {
+		childPath := appendDiffKey(path, DiffKey{Key: strconv.Itoa(i)})
+
+		if i < len(bc) {
+			diffNode(cs, childPath, c, bc[i], mode)
+		} else {
+			*cs = append(*cs, Change{Type: ChangeRemove, Path: childPath, Old: c})
+		}
+	}
+
+	for i := len(ac); i < len(bc); i++ {
+		childPath := appendDiffKey(path, DiffKey{Key: strconv.Itoa(i)})
+		*cs = append(*cs, Change{Type: ChangeAdd, Path: childPath, New: bc[i]})
+	}
+}
+
+func appendDiffKey(path []DiffKey, key DiffKey) []DiffKey {
+	return append(append(make([]DiffKey, 0, len(path)+1), path...), key)
+}
+
+// Apply applies the changes to kv, as a patch.
+//
+// The nodes removed or modified by the changes must exist in kv and be equal (see Equal) to the
+// nodes of the old tree, and the nodes added must not exist. Added and modified nodes are copied
+// from the new tree, with added nodes appended to the children of their parent nodes.
+//
+// Returns a *PathError if a change doesn't apply, with ErrNotFound for missing nodes and
+// ErrConflict for changed or existing nodes, in which case kv is left unchanged.
+func (cs ChangeSet) Apply(kv KeyValue) error {
+	type target struct {
+		parent KeyValue
+		node   KeyValue
+	}
+
+	targets := make([]target, len(cs))
+	mode := kv.KeyMode()
+
+	for i, c := range cs {
+		conflict := func(key string) error {
+			return &PathError{Op: OpPatch, Path: c.PathString(), Key: key, Err: ErrConflict}
+		}
+
+		if len(c.Path) == 0 {
+			if c.Type != ChangeModify {
+				return &PathError{Op: OpPatch, Path: c.PathString(), Err: ErrInvalidPath}
+			}
+
+			if !equalNode(kv, c.Old, 0) {
+				return conflict(kv.Key())
+			}
+
+			targets[i] = target{node: kv}
+
+			continue
+		}
+
+		last := len(c.Path) - 1
+		parent, err := resolveDiffPath(kv, c, c.Path[:last])
+
+		if err != nil {
+			return err
+		}
+
+		node, err := diffChild(parent, c.Path[last], mode)
+
+		if err != nil {
+			return &PathError{Op: OpPatch, Path: c.PathString(), Key: parentDiffKey(kv, c.Path, last), Err: err}
+		}
+
+		key := c.Path[last].Key
+
+		switch {
+		case c.Type == ChangeAdd && node != nil:
+			return conflict(key)
+		case c.Type != ChangeAdd && node == nil:
+			return &PathError{Op: OpPatch, Path: c.PathString(), Key: key, Err: ErrNotFound}
+		case c.Type != ChangeAdd && !equalNode(node, c.Old, 0):
+			return conflict(key)
+		}
+
+		targets[i] = target{parent: parent, node: node}
+	}
+
+	for i, c := range cs {
+		t := targets[i]
+
+		switch c.Type {
+		case ChangeAdd:
+			t.parent.AddChild(cloneNode(c.New))
+		case ChangeRemove:
+			t.parent.RemoveChild(t.node)
+		case ChangeModify:
+			assignNode(t.node, c.New)
+		}
+	}
+
+	return nil
+}
+
+// resolveDiffPath returns the node referenced by path.
+func resolveDiffPath(kv KeyValue, c Change, path []DiffKey) (KeyValue, error) {
+	node := kv
+	mode := kv.KeyMode()
+
+	for i, key := range path {
+		child, err := diffChild(node, key, mode)
+
+		if err != nil {
+			return nil, &PathError{Op: OpPatch, Path: c.PathString(), Key: parentDiffKey(kv, path, i), Err: err}
+		}
+
+		if child == nil {
+			return nil, &PathError{Op: OpPatch, Path: c.PathString(), Key: key.Key, Err: ErrNotFound}
+		}
+
+		node = child
+	}
+
+	return node, nil
+}
+
+// diffChild returns the child of kv referenced by key, nil if the child doesn't exist, or an error
+// if kv is neither an Object nor an Array.
+func diffChild(kv KeyValue, key DiffKey, mode KeyMode) (KeyValue, error) {
+	if kv.Type() != TypeObject {
+		return pathChild(kv, key.Key)
+	}
+
+	n := 0
+
+	for _, c := range kv.Children() {
+		if mode.Equal(c.Key(), key.Key) {
+			if n == key.Occurrence {
+				return c, nil
+			}
+
+			n++
+		}
+	}
+
+	return nil, nil
+}
+
+func parentDiffKey(kv KeyValue, path []DiffKey, i int) string {
+	if i == 0 {
+		return kv.Key()
+	}
+
+	return path[i-1].Key
+}
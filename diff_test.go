@@ -0,0 +1,232 @@
+package kv_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestDiff(t *testing.T) {
+	suite.Run(t, &DiffSuite{})
+}
+
+type DiffSuite struct {
+	Suite
+}
+
+func (s *DiffSuite) old() kv.KeyValue {
+	return kv.NewKeyValueRoot("DOTAHeroes").
+		AddString("Version", "1").
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+			AddString("Model", "models/heroes/axe/axe.vmdl").
+			AddString("AttackRate", "1.7").
+			AddString("Ability1", "axe_berserkers_call").
+			AddString("Ability6", "axe_counter_helix").
+			AddString("Bot", "1").
+			AddString("Bot", "2").
+			AddChild(kv.NewKeyValueArray("Roles", nil).
+				AddString("", "Initiator").
+				AddString("", "Durable").
+				AddString("", "Disabler"))).
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_sven", nil).
+			AddString("Model", "models/heroes/sven/sven.vmdl"))
+}
+
+func (s *DiffSuite) new() kv.KeyValue {
+	return kv.NewKeyValueRoot("DOTAHeroes").
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+			AddString("Ability1", "axe_berserkers_call").
+			AddString("Model", "models/heroes/axe/axe.vmdl").
+			AddFloat32("AttackRate", "1.6").
+			AddString("Ability7", "axe_culling_blade").
+			AddString("Bot", "1").
+			AddString("Bot", "3").
+			AddString("Bot", "4").
+			AddChild(kv.NewKeyValueArray("Roles", nil).
+				AddString("", "Initiator").
+				AddString("", "Carry"))).
+		AddString("Version", "2").
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_zuus", nil).
+			AddString("Model", "models/heroes/zeus/zeus.vmdl"))
+}
+
+func (s *DiffSuite) TestDiff() {
+	require := s.Require()
+	cs := kv.Diff(s.old(), s.new())
+
+	expected := `~ Version: "1" -> "2"
+~ npc_dota_hero_axe/AttackRate: "1.7" (String) -> "1.6" (Float32)
+- npc_dota_hero_axe/Ability6 = "axe_counter_helix"
+~ npc_dota_hero_axe/Bot[1]: "2" -> "3"
+~ npc_dota_hero_axe/Roles/1: "Durable" -> "Carry"
+- npc_dota_hero_axe/Roles/2 = "Disabler"
++ npc_dota_hero_axe/Ability7 = "axe_culling_blade"
++ npc_dota_hero_axe/Bot[2] = "4"
+- npc_dota_hero_sven = {...}
++ npc_dota_hero_zuus = {...}
+`
+
+	require.Equal(expected, cs.String())
+
+	require.Equal(kv.ChangeRemove, cs[2].Type)
+	require.Equal([]kv.DiffKey{{Key: "npc_dota_hero_axe"}, {Key: "Ability6"}}, cs[2].Path)
+	require.Equal("axe_counter_helix", cs[2].Old.Value())
+	require.Nil(cs[2].New)
+
+	require.Equal(kv.ChangeModify, cs[3].Type)
+	require.Equal([]kv.DiffKey{{Key: "npc_dota_hero_axe"}, {Key: "Bot", Occurrence: 1}}, cs[3].Path)
+
+	require.Equal(kv.ChangeAdd, cs[9].Type)
+	require.Nil(cs[9].Old)
+	require.Equal("npc_dota_hero_zuus", cs[9].New.Key())
+
+	require.Equal("add", kv.ChangeAdd.String())
+	require.Equal("remove", kv.ChangeRemove.String())
+	require.Equal("modify", kv.ChangeModify.String())
+	require.Equal("ChangeType(0)", kv.ChangeType(0).String())
+}
+
+func (s *DiffSuite) TestDiffEqual() {
+	require := s.Require()
+
+	require.Empty(kv.Diff(s.old(), s.old()))
+
+	// reordering nodes with different keys is not a change
+	reordered := s.old()
+	reordered.MoveChild(0, 2)
+	reordered.Child("npc_dota_hero_axe").MoveChild(0, 4)
+
+	require.Empty(kv.Diff(s.old(), reordered))
+
+	// reordering nodes with duplicate keys is
+	reordered.Child("npc_dota_hero_axe").MoveChild(5, 3)
+
+	require.Equal(`~ npc_dota_hero_axe/Bot: "1" -> "2"
+~ npc_dota_hero_axe/Bot[1]: "2" -> "1"
+`, kv.Diff(s.old(), reordered).String())
+}
+
+func (s *DiffSuite) TestDiffRoot() {
+	require := s.Require()
+	cs := kv.Diff(kv.NewKeyValueRoot("A"), kv.NewKeyValueString("A", "a", nil))
+
+	require.Equal("~ : {...} (Object) -> \"a\" (String)\n", cs.String())
+}
+
+func (s *DiffSuite) TestDiffKeyMode() {
+	require := s.Require()
+	old := s.old().SetKeyMode(kv.KeyModeCaseInsensitive)
+	renamed := s.old()
+
+	renamed.Child("npc_dota_hero_axe").SetKey("NPC_Dota_Hero_Axe").Child("Model").SetKey("model")
+
+	require.Empty(kv.Diff(old, renamed))
+	require.Len(kv.Diff(s.old(), renamed), 2)
+}
+
+func (s *DiffSuite) TestDiffFlags() {
+	require := s.Require()
+	a := kv.NewKeyValueRoot("").AddString("Model", "axe.vmdl").AddBinary("Data", "00ff").AddNull("N")
+	b := kv.NewKeyValueRoot("").AddString("Model", "axe.vmdl").AddBinary("Data", "00fe").AddInt32("N", "1")
+
+	b.Child("Model").SetFlag(kv.FlagResource)
+
+	require.Equal(`~ Model: "axe.vmdl" -> resource:"axe.vmdl"
+~ Data: "00ff" -> "00fe"
+~ N: null (Null) -> "1" (Int32)
+`, kv.Diff(a, b).String())
+}
+
+func (s *DiffSuite) TestApply() {
+	require := s.Require()
+	cs := kv.Diff(s.old(), s.new())
+	target := s.old()
+
+	require.NoError(cs.Apply(target))
+	require.True(kv.Equal(s.new(), target, kv.EqualIgnoreOrder))
+	require.Empty(kv.Diff(target, s.new()))
+
+	for _, c := range target.Child("npc_dota_hero_axe").Children() {
+		require.Equal(target.Child("npc_dota_hero_axe"), c.Parent())
+	}
+
+	// added nodes are copies
+	target.Child("npc_dota_hero_zuus").Child("Model").SetValue("zeus.vmdl")
+
+	require.Equal("models/heroes/zeus/zeus.vmdl", cs[9].New.Child("Model").Value())
+
+	// a patch applies to other trees with the same changed nodes
+	other := s.old()
+	other.AddString("Extra", "1")
+	other.Child("npc_dota_hero_axe").AddString("Ability2", "axe_battle_hunger")
+
+	require.NoError(cs.Apply(other))
+	require.Equal("axe_battle_hunger", other.Child("npc_dota_hero_axe").Child("Ability2").Value())
+	require.Equal("axe_culling_blade", other.Child("npc_dota_hero_axe").Child("Ability7").Value())
+
+	// root changes
+	root := kv.NewKeyValueRoot("A")
+
+	require.NoError(kv.Diff(kv.NewKeyValueRoot("A"), kv.NewKeyValueString("A", "a", nil)).Apply(root))
+	require.Equal(kv.TypeString, root.Type())
+	require.Equal("a", root.Value())
+}
+
+func (s *DiffSuite) TestApplyErrors() {
+	require := s.Require()
+	cs := kv.Diff(s.old(), s.new())
+
+	testCases := []struct {
+		Name   string
+		Modify func(kv.KeyValue)
+		Err    string
+		Target error
+	}{
+		{
+			Name:   "Modified",
+			Modify: func(root kv.KeyValue) { root.Child("npc_dota_hero_axe").Child("AttackRate").SetValue("1.5") },
+			Err:    `kv: cannot patch "npc_dota_hero_axe/AttackRate": key "AttackRate": conflict`,
+			Target: kv.ErrConflict,
+		},
+		{
+			Name: "Missing",
+			Modify: func(root kv.KeyValue) {
+				root.Child("npc_dota_hero_axe").RemoveChild(root.Child("npc_dota_hero_axe").Child("Ability6"))
+			},
+			Err:    `kv: cannot patch "npc_dota_hero_axe/Ability6": key "Ability6": not found`,
+			Target: kv.ErrNotFound,
+		},
+		{
+			Name:   "MissingParent",
+			Modify: func(root kv.KeyValue) { root.RemoveChild(root.Child("npc_dota_hero_axe")) },
+			Err:    `kv: cannot patch "npc_dota_hero_axe/AttackRate": key "npc_dota_hero_axe": not found`,
+			Target: kv.ErrNotFound,
+		},
+		{
+			Name:   "Existing",
+			Modify: func(root kv.KeyValue) { root.AddString("npc_dota_hero_zuus", "") },
+			Err:    `kv: cannot patch "npc_dota_hero_zuus": key "npc_dota_hero_zuus": conflict`,
+			Target: kv.ErrConflict,
+		},
+		{
+			Name:   "NotObject",
+			Modify: func(root kv.KeyValue) { root.Child("npc_dota_hero_axe").SetType(kv.TypeString) },
+			Err:    `kv: cannot patch "npc_dota_hero_axe/AttackRate": key "npc_dota_hero_axe": not an object`,
+			Target: kv.ErrNotObject,
+		},
+	}
+
+	for _, testCase := range testCases {
+		target := s.old()
+		testCase.Modify(target)
+		snapshot := target.Clone()
+		err := cs.Apply(target)
+
+		require.EqualErrorf(err, testCase.Err, "case %s", testCase.Name)
+		require.Truef(errors.Is(err, testCase.Target), "case %s", testCase.Name)
+		require.Truef(kv.Equal(snapshot, target), "case %s", testCase.Name)
+	}
+}
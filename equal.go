@@ -0,0 +1,153 @@
+package kv
+
+import (
+	"bytes"
+	"strings"
+)
+
+// EqualOption represents options of Equal, as bit flags.
+type EqualOption uint8
+
+// Equal options.
+const (
+	// EqualIgnoreOrder compares children regardless of their order.
+	EqualIgnoreOrder EqualOption = 1 << iota
+	// EqualIgnoreKeyCase compares keys under Unicode case-folding.
+	EqualIgnoreKeyCase
+	// EqualNumeric compares the values of numeric, Bool and Binary nodes by their typed values
+	// instead of their text, so that "1.0" equals "1" for Float32 nodes, "true" equals "1" for Bool
+	// nodes and "FF" equals "ff" for Binary nodes. Values that can't be parsed as the node's type
+	// are compared as text.
+	EqualNumeric
+)
+
+// Equal reports whether the KeyValue trees a and b are structurally equal: nodes have equal types,
+// keys, values and flags, and equal children.
+//
+// Parents, source positions and source text are not compared. Options change how nodes are compared
+// and can be combined.
+func Equal(a, b KeyValue, opts ...EqualOption) bool {
+	var o EqualOption
+
+	for _, opt := range opts {
+		o |= opt
+	}
+
+	return equal(a, b, o)
+}
+
+func equal(a, b KeyValue, opts EqualOption) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return equalKeys(a.Key(), b.Key(), opts) && equalNode(a, b, opts)
+}
+
+// equalNode compares nodes a and b, except for their keys.
+func equalNode(a, b KeyValue, opts EqualOption) bool {
+	if a.Type() != b.Type() || a.Flag() != b.Flag() {
+		return false
+	}
+
+	if !equalValues(a, b, opts) {
+		return false
+	}
+
+	ac, bc := a.Children(), b.Children()
+
+	if len(ac) != len(bc) {
+		return false
+	}
+
+	if opts&EqualIgnoreOrder == 0 {
+		for i := range ac {
+			if !equal(ac[i], bc[i], opts) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	matched := make([]bool, len(bc))
+
+	for _, c := range ac {
+		found := false
+
+		for j, d := range bc {
+			if !matched[j] && equal(c, d, opts) {
+				matched[j], found = true, true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalKeys(a, b string, opts EqualOption) bool {
+	if opts&EqualIgnoreKeyCase != 0 {
+		return strings.EqualFold(a, b)
+	}
+
+	return a == b
+}
+
+// equalValues compares the values of nodes a and b, of the same type.
+func equalValues(a, b KeyValue, opts EqualOption) bool {
+	if a.Value() == b.Value() {
+		return true
+	}
+
+	if opts&EqualNumeric == 0 {
+		return false
+	}
+
+	switch a.Type() {
+	case TypeInt32:
+		return equalTyped(a, b, func(kv KeyValue) (interface{}, error) { return kv.AsInt32() })
+	case TypeColor:
+		return equalTyped(a, b, func(kv KeyValue) (interface{}, error) { return kv.AsColor() })
+	case TypePointer:
+		return equalTyped(a, b, func(kv KeyValue) (interface{}, error) { return kv.AsPointer() })
+	case TypeInt64:
+		return equalTyped(a, b, func(kv KeyValue) (interface{}, error) { return kv.AsInt64() })
+	case TypeUint64:
+		return equalTyped(a, b, func(kv KeyValue) (interface{}, error) { return kv.AsUint64() })
+	case TypeFloat32:
+		return equalTyped(a, b, func(kv KeyValue) (interface{}, error) { return kv.AsFloat32() })
+	case TypeDouble:
+		return equalTyped(a, b, func(kv KeyValue) (interface{}, error) { return kv.AsDouble() })
+	case TypeBool:
+		return equalTyped(a, b, func(kv KeyValue) (interface{}, error) { return kv.AsBool() })
+	case TypeBinary:
+		av, aerr := a.AsBinary()
+		bv, berr := b.AsBinary()
+
+		return aerr == nil && berr == nil && bytes.Equal(av, bv)
+	default:
+		return false
+	}
+}
+
+// equalTyped compares the values of nodes a and b, converted by as.
+func equalTyped(a, b KeyValue, as func(KeyValue) (interface{}, error)) bool {
+	av, err := as(a)
+
+	if err != nil {
+		return false
+	}
+
+	bv, err := as(b)
+
+	if err != nil {
+		return false
+	}
+
+	return av == bv
+}
@@ -0,0 +1,145 @@
+package kv_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestEqual(t *testing.T) {
+	suite.Run(t, &EqualSuite{})
+}
+
+type EqualSuite struct {
+	Suite
+}
+
+func (s *EqualSuite) subject() kv.KeyValue {
+	return kv.NewKeyValueRoot("DOTAHeroes").
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+			AddString("Model", "models/heroes/axe/axe.vmdl").
+			AddFloat32("AttackRate", "1.7").
+			AddInt32("ArmorPhysical", "1").
+			AddBool("Enabled", "true").
+			AddBinary("Data", "00ff").
+			AddChild(kv.NewKeyValueArray("Roles", nil).
+				AddString("", "Initiator").
+				AddString("", "Durable")))
+}
+
+func (s *EqualSuite) TestEqual() {
+	require := s.Require()
+
+	require.True(kv.Equal(s.subject(), s.subject()))
+	require.True(kv.Equal(nil, nil))
+	require.False(kv.Equal(s.subject(), nil))
+	require.False(kv.Equal(nil, s.subject()))
+
+	testCases := []struct {
+		Name   string
+		Modify func(kv.KeyValue)
+	}{
+		{Name: "Key", Modify: func(root kv.KeyValue) { root.SetKey("Heroes") }},
+		{Name: "Type", Modify: func(root kv.KeyValue) { root.Child("npc_dota_hero_axe").Child("Model").SetType(kv.TypeInt32) }},    //nolint:lll
+		{Name: "Value", Modify: func(root kv.KeyValue) { root.Child("npc_dota_hero_axe").Child("Model").SetValue("axe.vmdl") }},    //nolint:lll
+		{Name: "Flag", Modify: func(root kv.KeyValue) { root.Child("npc_dota_hero_axe").Child("Model").SetFlag(kv.FlagResource) }}, //nolint:lll
+		{Name: "MissingChild", Modify: func(root kv.KeyValue) { root.Child("npc_dota_hero_axe").RemoveIndex(0) }},
+		{Name: "ExtraChild", Modify: func(root kv.KeyValue) { root.Child("npc_dota_hero_axe").AddString("Name", "Axe") }},
+		{Name: "Order", Modify: func(root kv.KeyValue) { root.Child("npc_dota_hero_axe").MoveChild(0, 1) }},
+	}
+
+	for _, testCase := range testCases {
+		other := s.subject()
+		testCase.Modify(other)
+
+		require.Falsef(kv.Equal(s.subject(), other), "case %s", testCase.Name)
+	}
+
+	// positions and source text are not compared
+	other := s.subject()
+	other.SetPosition(kv.Position{Line: 1, Column: 1}, kv.Position{Line: 2, Column: 1})
+
+	require.True(kv.Equal(s.subject(), other))
+}
+
+func (s *EqualSuite) TestEqualIgnoreOrder() {
+	require := s.Require()
+	other := s.subject()
+
+	other.Child("npc_dota_hero_axe").MoveChild(0, 3)
+	other.Child("npc_dota_hero_axe").Child("Roles").MoveChild(0, 1)
+
+	require.False(kv.Equal(s.subject(), other))
+	require.True(kv.Equal(s.subject(), other, kv.EqualIgnoreOrder))
+
+	// duplicate keys are matched one to one
+	a := kv.NewKeyValueRoot("").AddString("A", "1").AddString("A", "1").AddString("A", "2")
+	b := kv.NewKeyValueRoot("").AddString("A", "2").AddString("A", "1").AddString("A", "2")
+
+	require.False(kv.Equal(a, b, kv.EqualIgnoreOrder))
+
+	b.Index(2).SetValue("1")
+
+	require.True(kv.Equal(a, b, kv.EqualIgnoreOrder))
+}
+
+func (s *EqualSuite) TestEqualIgnoreKeyCase() {
+	require := s.Require()
+	other := s.subject()
+
+	other.Child("npc_dota_hero_axe").SetKey("NPC_Dota_Hero_Axe").Child("Model").SetKey("model")
+
+	require.False(kv.Equal(s.subject(), other))
+	require.True(kv.Equal(s.subject(), other, kv.EqualIgnoreKeyCase))
+	require.True(kv.Equal(s.subject(), other, kv.EqualIgnoreKeyCase|kv.EqualIgnoreOrder))
+
+	other.Index(0).MoveChild(0, 2)
+
+	require.False(kv.Equal(s.subject(), other, kv.EqualIgnoreKeyCase))
+	require.True(kv.Equal(s.subject(), other, kv.EqualIgnoreKeyCase, kv.EqualIgnoreOrder))
+}
+
+func (s *EqualSuite) TestEqualNumeric() {
+	require := s.Require()
+
+	testCases := []struct {
+		Type  kv.Type
+		A     string
+		B     string
+		Equal bool
+	}{
+		{Type: kv.TypeFloat32, A: "1.0", B: "1", Equal: true},
+		{Type: kv.TypeFloat32, A: "1.5", B: "1.50", Equal: true},
+		{Type: kv.TypeFloat32, A: "1.5", B: "1.6", Equal: false},
+		{Type: kv.TypeDouble, A: "1e3", B: "1000", Equal: true},
+		{Type: kv.TypeInt32, A: "+1", B: "1", Equal: true},
+		{Type: kv.TypeInt64, A: "007", B: "7", Equal: true},
+		{Type: kv.TypeUint64, A: "10", B: "010", Equal: true},
+		{Type: kv.TypeColor, A: "-1", B: "-01", Equal: true},
+		{Type: kv.TypePointer, A: "2", B: "3", Equal: false},
+		{Type: kv.TypeBool, A: "true", B: "1", Equal: true},
+		{Type: kv.TypeBinary, A: "FF", B: "ff", Equal: true},
+		{Type: kv.TypeFloat32, A: "x", B: "x", Equal: true},
+		{Type: kv.TypeFloat32, A: "x", B: "1", Equal: false},
+		{Type: kv.TypeString, A: "1.0", B: "1", Equal: false},
+	}
+
+	for _, testCase := range testCases {
+		a := kv.NewKeyValue(testCase.Type, "K", testCase.A, nil)
+		b := kv.NewKeyValue(testCase.Type, "K", testCase.B, nil)
+
+		require.Equalf(testCase.Equal, kv.Equal(a, b, kv.EqualNumeric), "%s %q %q", testCase.Type, testCase.A, testCase.B)
+
+		if testCase.A != testCase.B {
+			require.Falsef(kv.Equal(a, b), "%s %q %q", testCase.Type, testCase.A, testCase.B)
+		}
+	}
+
+	// types are always compared
+	a := kv.NewKeyValueInt32("K", "1", nil)
+	b := kv.NewKeyValueInt64("K", "1", nil)
+
+	require.False(kv.Equal(a, b, kv.EqualNumeric))
+}
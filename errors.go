@@ -0,0 +1,368 @@
+package kv
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/13k/kv-go/internal/errlist"
+	"github.com/13k/kv-go/parser"
+)
+
+// SyntaxError describes a syntax error in text-encoded input.
+type SyntaxError = parser.SyntaxError
+
+// ErrorList is a list of syntax errors, returned by TextDecoder.Decode when recovering from errors.
+type ErrorList = parser.ErrorList
+
+// Sentinel errors, for use with errors.Is.
+var (
+	// ErrUnexpectedEOF means that the text input ended in the middle of a node.
+	ErrUnexpectedEOF = parser.ErrUnexpectedEOF
+	// ErrUnexpectedToken means that a token was found where it's not allowed in the text input.
+	ErrUnexpectedToken = parser.ErrUnexpectedToken
+	// ErrInvalidToken means that the text input contains a malformed token.
+	ErrInvalidToken = parser.ErrInvalidToken
+	// ErrInvalidCondition means that a conditional expression in the text input is malformed.
+	ErrInvalidCondition = parser.ErrInvalidCondition
+	// ErrDirectiveCycle means that `#base` or `#include` directives reference each other in a cycle.
+	ErrDirectiveCycle = errors.New("directive cycle")
+	// ErrInvalidType means that the binary input contains an invalid type byte.
+	ErrInvalidType = errors.New("invalid type")
+	// ErrTypeMismatch means that a node's value was accessed as a type other than the node's type.
+	ErrTypeMismatch = errors.New("type mismatch")
+	// ErrInvalidValue means that a node's value cannot be parsed as the node's type.
+	ErrInvalidValue = errors.New("invalid value")
+	// ErrUnsupportedType means that a node's type cannot be encoded in the output format.
+	ErrUnsupportedType = errors.New("unsupported type")
+	// ErrUnsupportedFormat means that the binary input is in an unknown or unsupported format,
+	// encoding or compression method.
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	// ErrUnsupportedVersion means that the binary input is in a known format, but in a version of the
+	// format that is not supported.
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	// ErrMalformed means that the binary input is inconsistent, like invalid compressed data or
+	// references to missing strings, or that annotated JSON input doesn't describe valid nodes.
+	ErrMalformed = errors.New("malformed data")
+	// ErrInvalidTarget means that Unmarshal was given a nil or non-pointer value.
+	ErrInvalidTarget = errors.New("invalid target")
+	// ErrInvalidPath means that a path is malformed, like a path ending in an escape character.
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrNotFound means that a path references a node that doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrNotObject means that a path traverses a node that is neither an Object nor an Array.
+	ErrNotObject = errors.New("not an object")
+	// ErrConflict means that a patch doesn't apply to a tree, because the tree doesn't have the
+	// nodes changed by the patch or they differ from the patched tree.
+	ErrConflict = errors.New("conflict")
+	// ErrInvalidQuery means that a query is malformed.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrInvalidSchema means that the KeyValue representation of a schema is malformed.
+	ErrInvalidSchema = errors.New("invalid schema")
+)
+
+// DirectiveError describes a failure resolving a `#base` or `#include` directive.
+type DirectiveError struct {
+	// Pos is the position of the directive.
+	Pos Position
+	// Directive is the directive name, as found in the input.
+	Directive string
+	// Name is the resolved name of the referenced file.
+	Name string
+	// Chain is the chain of resolved file names leading to the error, for cycles.
+	Chain []string
+	// Err is the underlying error, ErrDirectiveCycle for cycles.
+	Err error
+}
+
+func (e *DirectiveError) Error() string {
+	if e.Err == ErrDirectiveCycle {
+		chain := strings.Join(e.Chain, " -> ")
+		return fmt.Sprintf("kv: %s: %s cycle: %s -> %s", e.Pos, e.Directive, chain, e.Name)
+	}
+
+	return fmt.Sprintf("kv: %s: %s %q: %v", e.Pos, e.Directive, e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DirectiveError) Unwrap() error {
+	return e.Err
+}
+
+// BinaryFormatError describes malformed binary-encoded input.
+type BinaryFormatError struct {
+	// Offset is the byte offset in the input where the error was detected. For errors in compressed
+	// KeyValues3 data, the offset is relative to the decompressed data.
+	Offset int64
+	// Type is the type byte of the node being decoded.
+	Type byte
+	// Err is the underlying error, either a sentinel (ErrInvalidType, ErrUnsupportedFormat,
+	// ErrUnsupportedVersion, ErrMalformed) or an I/O error (io.ErrUnexpectedEOF for truncated input).
+	Err error
+}
+
+func (e *BinaryFormatError) Error() string {
+	if e.Err == ErrInvalidType {
+		return fmt.Sprintf("kv: offset %d: %s byte 0x%02x", e.Offset, e.Err, e.Type)
+	}
+
+	return fmt.Sprintf("kv: offset %d: %v", e.Offset, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *BinaryFormatError) Unwrap() error {
+	return e.Err
+}
+
+// Operations reported by TypeError, MarshalError and PathError.
+const (
+	OpConvert   = "convert"
+	OpSet       = "set"
+	OpEncode    = "encode"
+	OpMarshal   = "marshal"
+	OpUnmarshal = "unmarshal"
+	OpGet       = "get"
+	OpDelete    = "delete"
+	OpPatch     = "patch"
+)
+
+// TypeError describes a node value that cannot be accessed or encoded as a given type.
+type TypeError struct {
+	// Op is the failed operation (OpConvert, OpSet or OpEncode).
+	Op string
+	// Key is the node's key.
+	Key string
+	// Type is the node's type.
+	Type Type
+	// Target is the type the value was accessed as, for OpConvert and OpSet.
+	Target Type
+	// Value is the node's value, for invalid values.
+	Value string
+	// Err is the underlying error, either a sentinel (ErrTypeMismatch, ErrUnsupportedType) or, for
+	// invalid values, a *strconv.NumError (or a hex decoding error for Binary values, or an error
+	// for NaN and infinite values which can't be encoded).
+	Err error
+}
+
+func (e *TypeError) Error() string {
+	switch {
+	case e.Err == ErrUnsupportedType:
+		return fmt.Sprintf("kv: cannot %s node of type %s", e.Op, e.Type)
+	case e.Op == OpSet:
+		return fmt.Sprintf("kv: cannot set Value of type %s with value of type %s", e.Type, e.Target)
+	case e.Err == ErrTypeMismatch:
+		return fmt.Sprintf("kv: cannot %s Value of type %s to %s", e.Op, e.Type, e.Target)
+	default:
+		return fmt.Sprintf("kv: cannot %s Value %q to %s: %v", e.Op, e.Value, e.Target, e.Err)
+	}
+}
+
+func newUnsupportedTypeError(kv KeyValue) *TypeError {
+	return &TypeError{Op: OpEncode, Key: kv.Key(), Type: kv.Type(), Err: ErrUnsupportedType}
+}
+
+func newInvalidValueError(kv KeyValue, op string, err error) *TypeError {
+	return &TypeError{Op: op, Key: kv.Key(), Type: kv.Type(), Target: kv.Type(), Value: kv.Value(), Err: err}
+}
+
+// Unwrap returns the underlying error.
+func (e *TypeError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is ErrInvalidValue, in addition to the underlying error.
+func (e *TypeError) Is(target error) bool {
+	return target == ErrInvalidValue && isInvalidValue(e.Err)
+}
+
+// MarshalError describes a Go value that cannot be marshaled to a KeyValue node, or a KeyValue node
+// that cannot be unmarshaled into a Go value.
+type MarshalError struct {
+	// Op is the failed operation (OpMarshal or OpUnmarshal).
+	Op string
+	// Key is the node's key, or the struct field's name when marshaling.
+	Key string
+	// Type is the node's type, when unmarshaling.
+	Type Type
+	// GoType is the Go type of the value.
+	GoType reflect.Type
+	// Value is the node's value, for invalid values.
+	Value string
+	// Err is the underlying error, either a sentinel (ErrTypeMismatch, ErrUnsupportedType,
+	// ErrInvalidTarget) or, for invalid values, a parsing error.
+	Err error
+}
+
+func (e *MarshalError) Error() string {
+	switch {
+	case e.Err == ErrInvalidTarget:
+		return fmt.Sprintf("kv: cannot %s into Go value of type %v: %v", e.Op, e.GoType, e.Err)
+	case e.Op == OpMarshal:
+		return fmt.Sprintf("kv: cannot %s Go value of type %v", e.Op, e.GoType)
+	case e.Err == ErrTypeMismatch, e.Err == ErrUnsupportedType:
+		return fmt.Sprintf(
+			"kv: cannot %s node %q of type %s into Go value of type %v",
+			e.Op, e.Key, e.Type, e.GoType,
+		)
+	default:
+		return fmt.Sprintf("kv: cannot %s Value %q into Go value of type %v: %v", e.Op, e.Value, e.GoType, e.Err)
+	}
+}
+
+// Unwrap returns the underlying error.
+func (e *MarshalError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is ErrInvalidValue, in addition to the underlying error.
+func (e *MarshalError) Is(target error) bool {
+	return target == ErrInvalidValue && isInvalidValue(e.Err)
+}
+
+// errNonFinite means that a NaN or infinite floating point value cannot be encoded in the output
+// format.
+var errNonFinite = errors.New("non-finite number")
+
+// errUnknownFlag means that a node has a Flag without name, which cannot be encoded.
+var errUnknownFlag = errors.New("unknown flag")
+
+func isInvalidValue(err error) bool {
+	var (
+		numErr *strconv.NumError
+		hexErr hex.InvalidByteError
+	)
+
+	return errors.As(err, &numErr) || errors.As(err, &hexErr) || errors.Is(err, hex.ErrLength) ||
+		err == errNonFinite || errors.Is(err, errUnknownFlag)
+}
+
+// PathError describes a failure resolving a path.
+type PathError struct {
+	// Op is the failed operation (OpGet, OpSet, OpDelete or OpPatch).
+	Op string
+	// Path is the path being resolved.
+	Path string
+	// Key is the (unescaped) path segment where resolution failed.
+	Key string
+	// Err is the underlying error, one of ErrInvalidPath, ErrNotFound, ErrNotObject or ErrConflict.
+	Err error
+}
+
+func (e *PathError) Error() string {
+	if e.Err == ErrInvalidPath {
+		return fmt.Sprintf("kv: cannot %s %q: %v", e.Op, e.Path, e.Err)
+	}
+
+	return fmt.Sprintf("kv: cannot %s %q: key %q: %v", e.Op, e.Path, e.Key, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+// QueryError describes a malformed query.
+type QueryError struct {
+	// Query is the source text of the query.
+	Query string
+	// Offset is the byte offset in the query where the error was detected.
+	Offset int
+	// Msg describes the error.
+	Msg string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("kv: %v %q: offset %d: %s", ErrInvalidQuery, e.Query, e.Offset, e.Msg)
+}
+
+// Unwrap returns ErrInvalidQuery.
+func (e *QueryError) Unwrap() error {
+	return ErrInvalidQuery
+}
+
+// JSONError describes type-annotated JSON input that doesn't describe valid nodes.
+type JSONError struct {
+	// Path is the path of the node being decoded, in the format of ParsePath.
+	Path string
+	// Msg describes the error.
+	Msg string
+	// Err is the underlying error, ErrInvalidType for invalid types or ErrMalformed otherwise.
+	Err error
+}
+
+func (e *JSONError) Error() string {
+	return fmt.Sprintf("kv: json: node %q: %v: %s", e.Path, e.Err, e.Msg)
+}
+
+// Unwrap returns the underlying error.
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaError describes a malformed KeyValue representation of a schema.
+type SchemaError struct {
+	// Path is the path of the malformed node, relative to the schema's root node.
+	Path string
+	// Msg describes the error.
+	Msg string
+}
+
+func newSchemaError(keys []string, format string, args ...interface{}) *SchemaError {
+	return &SchemaError{Path: JoinPath(keys...), Msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("kv: %v: node %q: %s", ErrInvalidSchema, e.Path, e.Msg)
+}
+
+// Unwrap returns ErrInvalidSchema.
+func (e *SchemaError) Unwrap() error {
+	return ErrInvalidSchema
+}
+
+// ValidationError describes a node that doesn't conform to a schema.
+type ValidationError struct {
+	// Path is the path of the node, relative to the validated root node.
+	Path string
+	// Pos is the source position of the node, if decoded from text.
+	Pos Position
+	// Msg describes the violation.
+	Msg string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Pos.IsValid() {
+		return fmt.Sprintf("kv: %s: node %q: %s", e.Pos, e.Path, e.Msg)
+	}
+
+	return fmt.Sprintf("kv: node %q: %s", e.Path, e.Msg)
+}
+
+// ValidationErrorList is a list of validation errors, returned by Schema.Validate.
+type ValidationErrorList []*ValidationError
+
+func (l *ValidationErrorList) add(kv KeyValue, keys []string, msg string) {
+	*l = append(*l, &ValidationError{Path: JoinPath(keys...), Pos: kv.Position(), Msg: msg})
+}
+
+func (l ValidationErrorList) Error() string {
+	return errlist.Error(len(l), l.at)
+}
+
+// Is reports whether any error in the list matches target.
+func (l ValidationErrorList) Is(target error) bool {
+	return errlist.Is(len(l), l.at, target)
+}
+
+// As finds the first error in the list that matches target, and if so, sets target to that error
+// value and returns true.
+func (l ValidationErrorList) As(target interface{}) bool {
+	return errlist.As(len(l), l.at, target)
+}
+
+func (l ValidationErrorList) at(i int) error {
+	return l[i]
+}
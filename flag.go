@@ -0,0 +1,53 @@
+package kv
+
+import "strconv"
+
+// Flag represents a KeyValues3 value flag, like "resource" in `resource:"particles/x.vpcf"`.
+type Flag uint8
+
+// KeyValues3 value flags.
+const (
+	FlagNone Flag = iota
+	FlagResource
+	FlagResourceName
+	FlagPanorama
+	FlagSoundEvent
+	FlagSubClass
+)
+
+var flagNames = [...]string{
+	FlagNone:         "",
+	FlagResource:     "resource",
+	FlagResourceName: "resource_name",
+	FlagPanorama:     "panorama",
+	FlagSoundEvent:   "soundevent",
+	FlagSubClass:     "subclass",
+}
+
+// FlagFromString converts a flag name, as written in KeyValues3 text format, to a Flag.
+//
+// Returns FlagNone and false if the given name is not a valid flag.
+func FlagFromString(s string) (Flag, bool) {
+	for f, name := range flagNames {
+		if name == s && s != "" {
+			return Flag(f), true
+		}
+	}
+
+	return FlagNone, false
+}
+
+// String returns the flag name, as written in KeyValues3 text format.
+//
+// Unknown flags are formatted as "Flag(N)", which is not a valid flag name and cannot be encoded.
+func (f Flag) String() string {
+	if int(f) < len(flagNames) {
+		return flagNames[f]
+	}
+
+	return "Flag(" + strconv.Itoa(int(f)) + ")"
+}
+
+func (f Flag) known() bool {
+	return int(f) < len(flagNames)
+}
@@ -0,0 +1,49 @@
+// Package errlist implements the error methods shared by the error list types.
+//
+// The lists implement Is and As explicitly, instead of Unwrap() []error, which errors.Is and
+// errors.As only support since Go 1.20.
+//
+// Lists are passed as their length n and a function returning the error at an index, so that the
+// list types don't need to be converted to []error.
+package errlist
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error returns the message of a list of errors: the message of the first error, followed by the
+// number of other errors.
+func Error(n int, at func(int) error) string {
+	switch n {
+	case 0:
+		return "no errors"
+	case 1:
+		return at(0).Error()
+	}
+
+	return fmt.Sprintf("%s (and %d more errors)", at(0), n-1)
+}
+
+// Is reports whether any error in the list matches target.
+func Is(n int, at func(int) error, target error) bool {
+	for i := 0; i < n; i++ {
+		if errors.Is(at(i), target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error in the list that matches target, and if so, sets target to that error
+// value and returns true.
+func As(n int, at func(int) error, target interface{}) bool {
+	for i := 0; i < n; i++ {
+		if errors.As(at(i), target) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,29 @@
+//go:build go1.18
+// +build go1.18
+
+package lz4_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/13k/kv-go/internal/lz4"
+)
+
+func FuzzDecompress(f *testing.F) {
+	data, err := ioutil.ReadFile("testdata/gameinfo.gi.lz4")
+
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Add(data, uint32(1<<20))
+
+	f.Fuzz(func(t *testing.T, data []byte, size uint32) {
+		actual, err := lz4.Decompress(data, int(size))
+
+		if err == nil && len(actual) != int(size) {
+			t.Fatalf("decompressed %d bytes, expected %d", len(actual), size)
+		}
+	})
+}
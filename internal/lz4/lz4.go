@@ -0,0 +1,126 @@
+// Package lz4 implements decompression of the LZ4 block format.
+//
+// It only covers what the KeyValues3 binary decoder needs, which is decompressing a single block
+// whose decompressed size is known in advance. It's written here instead of depending on an LZ4
+// library because the kv package only depends on the standard library, and block decompression
+// alone is short.
+//
+// Limitations: the LZ4 frame format (with its magic number, block checksums and linked blocks) is
+// not supported, nor are dictionaries or streaming.
+//
+// https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md
+package lz4
+
+import (
+	"errors"
+)
+
+const (
+	minMatch     = 4
+	lengthMask   = 0x0f
+	lengthExtend = 0xff
+	// maxExpansion is the maximum ratio of decompressed to compressed size: every extended length
+	// byte adds at most 255 bytes of output.
+	maxExpansion = 255
+)
+
+var (
+	// ErrCorrupt means that the input is not a valid LZ4 block.
+	ErrCorrupt = errors.New("lz4: corrupt input")
+	// ErrSize means that the decompressed data does not have the expected size.
+	ErrSize = errors.New("lz4: decompressed size mismatch")
+)
+
+// Decompress decompresses an LZ4 block whose decompressed data has the given size.
+//
+// Returns ErrSize without allocating if size exceeds the largest possible decompressed size of src.
+func Decompress(src []byte, size int) ([]byte, error) {
+	if size < 0 || size > maxExpansion*len(src) {
+		return nil, ErrSize
+	}
+
+	dst := make([]byte, 0, size)
+	i := 0
+
+	for i < len(src) {
+		token := src[i]
+		i++
+
+		// literals
+		n, next, ok := readLength(src, i, int(token>>4))
+
+		if !ok || next+n > len(src) {
+			return nil, ErrCorrupt
+		}
+
+		if len(dst)+n > size {
+			return nil, ErrSize
+		}
+
+		i = next
+		dst = append(dst, src[i:i+n]...)
+		i += n
+
+		// the last sequence has no match
+		if i == len(src) {
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, ErrCorrupt
+		}
+
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+
+		if offset == 0 || offset > len(dst) {
+			return nil, ErrCorrupt
+		}
+
+		n, i, ok = readLength(src, i, int(token&lengthMask))
+
+		if !ok {
+			return nil, ErrCorrupt
+		}
+
+		n += minMatch
+
+		if len(dst)+n > size {
+			return nil, ErrSize
+		}
+
+		// the match may overlap the bytes being written
+		pos := len(dst) - offset
+
+		for j := 0; j < n; j++ {
+			dst = append(dst, dst[pos+j])
+		}
+	}
+
+	if len(dst) != size {
+		return nil, ErrSize
+	}
+
+	return dst, nil
+}
+
+// readLength reads the extended length following a token length field.
+func readLength(src []byte, i, n int) (int, int, bool) {
+	if n != lengthMask {
+		return n, i, true
+	}
+
+	for {
+		if i >= len(src) {
+			return 0, i, false
+		}
+
+		b := src[i]
+		i++
+		n += int(b)
+
+		if b != lengthExtend {
+			return n, i, true
+		}
+	}
+}
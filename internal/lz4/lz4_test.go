@@ -0,0 +1,190 @@
+package lz4_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go/internal/lz4"
+)
+
+func TestLZ4(t *testing.T) {
+	suite.Run(t, &LZ4Suite{})
+}
+
+type LZ4Suite struct {
+	suite.Suite
+}
+
+func (s *LZ4Suite) readFile(path ...string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join(path...))
+
+	s.Require().NoError(err)
+
+	return data
+}
+
+func (s *LZ4Suite) TestDecompress() {
+	require := s.Require()
+
+	for _, name := range []string{"gameinfo.gi", "addon_english.txt"} {
+		expected := s.readFile("..", "..", "testdata", name)
+		actual, err := lz4.Decompress(s.readFile("testdata", name+".lz4"), len(expected))
+
+		require.NoErrorf(err, "fixture %s", name)
+		require.Equalf(expected, actual, "fixture %s", name)
+	}
+}
+
+func (s *LZ4Suite) TestDecompressSequences() {
+	require := s.Require()
+
+	testCases := []struct {
+		TestName string
+		Data     []byte
+		Expected string
+	}{
+		{
+			TestName: "Empty",
+			Data:     nil,
+			Expected: "",
+		},
+		{
+			TestName: "Literals",
+			Data:     []byte{0x50, 'h', 'e', 'l', 'l', 'o'},
+			Expected: "hello",
+		},
+		{
+			TestName: "Match",
+			Data:     []byte{0x30, 'a', 'b', 'c', 0x03, 0x00, 0x10, 'd'},
+			Expected: "abcabcad",
+		},
+		{
+			TestName: "OverlappingMatch",
+			Data:     []byte{0x16, 'a', 0x01, 0x00, 0x00},
+			Expected: "aaaaaaaaaaa",
+		},
+		{
+			TestName: "ExtendedLength",
+			Data:     append([]byte{0xf0, 0x00}, "abcdefghijklmno"...),
+			Expected: "abcdefghijklmno",
+		},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := lz4.Decompress(testCase.Data, len(testCase.Expected))
+
+		require.NoErrorf(err, "case %s", testCase.TestName)
+		require.Equalf(testCase.Expected, string(actual), "case %s", testCase.TestName)
+	}
+}
+
+func (s *LZ4Suite) TestDecompressErrors() {
+	require := s.Require()
+
+	testCases := []struct {
+		TestName string
+		Data     []byte
+		Size     int
+		Err      error
+	}{
+		{
+			TestName: "TruncatedLiterals",
+			Data:     []byte{0x50, 'h', 'e'},
+			Size:     5,
+			Err:      lz4.ErrCorrupt,
+		},
+		{
+			TestName: "TruncatedLength",
+			Data:     []byte{0xf0, 0xff},
+			Size:     270,
+			Err:      lz4.ErrCorrupt,
+		},
+		{
+			TestName: "TruncatedOffset",
+			Data:     []byte{0x10, 'a', 0x01},
+			Size:     5,
+			Err:      lz4.ErrCorrupt,
+		},
+		{
+			TestName: "ZeroOffset",
+			Data:     []byte{0x10, 'a', 0x00, 0x00, 0x00},
+			Size:     5,
+			Err:      lz4.ErrCorrupt,
+		},
+		{
+			TestName: "OffsetBeforeStart",
+			Data:     []byte{0x10, 'a', 0x02, 0x00, 0x00},
+			Size:     5,
+			Err:      lz4.ErrCorrupt,
+		},
+		{
+			TestName: "NegativeSize",
+			Data:     []byte{0x10, 'a'},
+			Size:     -1,
+			Err:      lz4.ErrSize,
+		},
+		{
+			TestName: "OversizedSize",
+			Data:     []byte{0x10, 'a'},
+			Size:     255*2 + 1,
+			Err:      lz4.ErrSize,
+		},
+		{
+			TestName: "LiteralsExceedSize",
+			Data:     []byte{0x50, 'h', 'e', 'l', 'l', 'o'},
+			Size:     4,
+			Err:      lz4.ErrSize,
+		},
+		{
+			TestName: "MatchExceedsSize",
+			Data:     []byte{0x16, 'a', 0x01, 0x00, 0x00},
+			Size:     10,
+			Err:      lz4.ErrSize,
+		},
+		{
+			TestName: "SizeMismatch",
+			Data:     []byte{0x50, 'h', 'e', 'l', 'l', 'o'},
+			Size:     6,
+			Err:      lz4.ErrSize,
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, err := lz4.Decompress(testCase.Data, testCase.Size)
+
+		require.Truef(errors.Is(err, testCase.Err), "case %s: %v", testCase.TestName, err)
+	}
+}
+
+func (s *LZ4Suite) TestDecompressTruncated() {
+	require := s.Require()
+	plain := s.readFile("..", "..", "testdata", "gameinfo.gi")
+	data := s.readFile("testdata", "gameinfo.gi.lz4")
+
+	for n := 0; n < len(data); n++ {
+		_, err := lz4.Decompress(data[:n], len(plain))
+
+		require.Errorf(err, "length %d", n)
+	}
+}
+
+func (s *LZ4Suite) TestDecompressCorrupt() {
+	require := s.Require()
+	plain := s.readFile("..", "..", "testdata", "gameinfo.gi")
+	data := s.readFile("testdata", "gameinfo.gi.lz4")
+
+	for i := 0; i < len(data); i++ {
+		corrupt := append([]byte(nil), data...)
+		corrupt[i] ^= 0xff
+
+		actual, err := lz4.Decompress(corrupt, len(plain))
+
+		if err == nil {
+			require.Lenf(actual, len(plain), "offset %d", i)
+		}
+	}
+}
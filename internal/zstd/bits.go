@@ -0,0 +1,109 @@
+package zstd
+
+import (
+	"math/bits"
+)
+
+// forwardBitReader reads bits from the least significant bit of the first byte onwards.
+type forwardBitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *forwardBitReader) peek(n int) int {
+	v := 0
+
+	for j := 0; j < n; j++ {
+		bit := r.pos + j
+
+		if bit/8 < len(r.data) {
+			v |= int((r.data[bit/8]>>(bit%8))&1) << j
+		}
+	}
+
+	return v
+}
+
+func (r *forwardBitReader) skip(n int) {
+	r.pos += n
+}
+
+func (r *forwardBitReader) read(n int) int {
+	v := r.peek(n)
+	r.skip(n)
+
+	return v
+}
+
+// overflow reports whether more bits were read than available.
+func (r *forwardBitReader) overflow() bool {
+	return r.pos > len(r.data)*8
+}
+
+// size returns the number of bytes read.
+func (r *forwardBitReader) size() int {
+	return (r.pos + 7) / 8
+}
+
+// backwardBitReader reads bits from the most significant bit of the last byte backwards, after the
+// padding terminated by the highest set bit.
+//
+// Reading past the beginning of the data returns zero bits and makes the number of remaining bits
+// negative.
+type backwardBitReader struct {
+	data []byte
+	bits int
+}
+
+func newBackwardBitReader(data []byte) (*backwardBitReader, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, ErrCorrupt
+	}
+
+	last := data[len(data)-1]
+
+	return &backwardBitReader{data: data, bits: (len(data)-1)*8 + bits.Len8(last) - 1}, nil
+}
+
+// peek returns the next n bits, n <= 32.
+func (r *backwardBitReader) peek(n int) int {
+	if n == 0 {
+		return 0
+	}
+
+	lo := r.bits - n
+	shift := 0
+
+	if lo < 0 {
+		shift = -lo
+		lo = 0
+	}
+
+	count := r.bits - lo
+
+	if count <= 0 {
+		return 0
+	}
+
+	var v uint64
+
+	for i := (r.bits+7)/8 - 1; i >= lo/8; i-- {
+		v = v<<8 | uint64(r.data[i])
+	}
+
+	v >>= uint(lo % 8)
+	v &= 1<<uint(count) - 1
+
+	return int(v << uint(shift))
+}
+
+func (r *backwardBitReader) skip(n int) {
+	r.bits -= n
+}
+
+func (r *backwardBitReader) read(n int) int {
+	v := r.peek(n)
+	r.skip(n)
+
+	return v
+}
@@ -0,0 +1,375 @@
+package zstd
+
+const (
+	literalsRaw        = 0
+	literalsRLE        = 1
+	literalsCompressed = 2
+	literalsTreeless   = 3
+
+	modePredefined = 0
+	modeRLE        = 1
+	modeCompressed = 2
+	modeRepeat     = 3
+
+	maxLLSymbol      = 35
+	maxMLSymbol      = 52
+	maxOFSymbol      = 31
+	maxLLAccuracyLog = 9
+	maxMLAccuracyLog = 9
+	maxOFAccuracyLog = 8
+
+	longSequencesBase = 0x7f00
+)
+
+var (
+	llDefaultProbs = []int{
+		4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1,
+		2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1,
+		-1, -1, -1, -1,
+	}
+	mlDefaultProbs = []int{
+		1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1,
+		-1, -1, -1, -1, -1,
+	}
+	ofDefaultProbs = []int{
+		1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1,
+		1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1,
+	}
+
+	llDefaultTable = mustFSETable(llDefaultProbs, 6)
+	mlDefaultTable = mustFSETable(mlDefaultProbs, 6)
+	ofDefaultTable = mustFSETable(ofDefaultProbs, 5)
+
+	llBase = [maxLLSymbol + 1]int{
+		0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536,
+	}
+	llBits = [maxLLSymbol + 1]int{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16,
+	}
+	mlBase = [maxMLSymbol + 1]int{
+		3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539,
+	}
+	mlBits = [maxMLSymbol + 1]int{
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16,
+	}
+)
+
+func mustFSETable(probs []int, accuracyLog int) *fseTable {
+	t, err := newFSETable(probs, accuracyLog)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+// decodeLiterals decodes the literals section of a compressed block and returns the literals and
+// the section size.
+func (d *frameDecoder) decodeLiterals(src []byte) ([]byte, int, error) {
+	if len(src) == 0 {
+		return nil, 0, ErrCorrupt
+	}
+
+	blockType := src[0] & 0x03
+	sizeFormat := (src[0] >> 2) & 0x03
+
+	switch blockType {
+	case literalsRaw, literalsRLE:
+		var size, headerSize int
+
+		switch sizeFormat {
+		case 0, 2:
+			size, headerSize = int(src[0]>>3), 1
+		case 1:
+			headerSize = 2
+		case 3:
+			headerSize = 3
+		}
+
+		if headerSize > len(src) {
+			return nil, 0, ErrCorrupt
+		}
+
+		switch sizeFormat {
+		case 1:
+			size = int(src[0]>>4) | int(src[1])<<4
+		case 3:
+			size = int(src[0]>>4) | int(src[1])<<4 | int(src[2])<<12
+		}
+
+		if blockType == literalsRLE {
+			if headerSize+1 > len(src) {
+				return nil, 0, ErrCorrupt
+			}
+
+			literals := make([]byte, size)
+
+			for i := range literals {
+				literals[i] = src[headerSize]
+			}
+
+			return literals, headerSize + 1, nil
+		}
+
+		if headerSize+size > len(src) {
+			return nil, 0, ErrCorrupt
+		}
+
+		return src[headerSize : headerSize+size], headerSize + size, nil
+	}
+
+	streams := huffmanFourStreams
+	headerSize, sizeBits := 3, 10
+
+	switch sizeFormat {
+	case 0:
+		streams = 1
+	case 2:
+		headerSize, sizeBits = 4, 14
+	case 3:
+		headerSize, sizeBits = 5, 18
+	}
+
+	if headerSize > len(src) {
+		return nil, 0, ErrCorrupt
+	}
+
+	var header uint64
+
+	for i := headerSize - 1; i >= 0; i-- {
+		header = header<<8 | uint64(src[i])
+	}
+
+	mask := uint64(1)<<uint(sizeBits) - 1
+	size := int((header >> 4) & mask)
+	compressedSize := int((header >> uint(4+sizeBits)) & mask)
+
+	if headerSize+compressedSize > len(src) {
+		return nil, 0, ErrCorrupt
+	}
+
+	data := src[headerSize : headerSize+compressedSize]
+
+	if blockType == literalsCompressed {
+		t, n, err := readHuffmanTable(data)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		d.huffman = t
+		data = data[n:]
+	} else if d.huffman == nil {
+		return nil, 0, ErrCorrupt
+	}
+
+	literals, err := d.huffman.decode(data, size, streams)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return literals, headerSize + compressedSize, nil
+}
+
+// decodeSequences decodes the sequences section of a compressed block and executes the sequences.
+func (d *frameDecoder) decodeSequences(src, literals []byte) error {
+	if len(src) == 0 {
+		return ErrCorrupt
+	}
+
+	count, i := int(src[0]), 1
+
+	switch {
+	case count == 0:
+		if err := d.reserve(len(literals)); err != nil {
+			return err
+		}
+
+		d.out = append(d.out, literals...)
+
+		return nil
+	case count < 128:
+	case count < 255:
+		if len(src) < 2 {
+			return ErrCorrupt
+		}
+
+		count, i = (count-128)<<8|int(src[1]), 2
+	default:
+		if len(src) < 3 {
+			return ErrCorrupt
+		}
+
+		count, i = int(src[1])|int(src[2])<<8+longSequencesBase, 3
+	}
+
+	if i >= len(src) {
+		return ErrCorrupt
+	}
+
+	modes := src[i]
+	i++
+
+	if modes&0x03 != 0 {
+		return ErrCorrupt
+	}
+
+	tables := []struct {
+		table     **fseTable
+		mode      byte
+		defaults  *fseTable
+		maxLog    int
+		maxSymbol int
+	}{
+		{&d.llTable, modes >> 6, llDefaultTable, maxLLAccuracyLog, maxLLSymbol},
+		{&d.ofTable, (modes >> 4) & 0x03, ofDefaultTable, maxOFAccuracyLog, maxOFSymbol},
+		{&d.mlTable, (modes >> 2) & 0x03, mlDefaultTable, maxMLAccuracyLog, maxMLSymbol},
+	}
+
+	for _, t := range tables {
+		switch t.mode {
+		case modePredefined:
+			*t.table = t.defaults
+		case modeRLE:
+			if i >= len(src) || int(src[i]) > t.maxSymbol {
+				return ErrCorrupt
+			}
+
+			*t.table = newRLETable(src[i])
+			i++
+		case modeCompressed:
+			table, n, err := readFSETable(src[i:], t.maxLog, t.maxSymbol)
+
+			if err != nil {
+				return err
+			}
+
+			*t.table = table
+			i += n
+		case modeRepeat:
+			if *t.table == nil {
+				return ErrCorrupt
+			}
+		}
+	}
+
+	r, err := newBackwardBitReader(src[i:])
+
+	if err != nil {
+		return err
+	}
+
+	ll, of, ml := d.llTable, d.ofTable, d.mlTable
+	llState := r.read(ll.accuracyLog)
+	ofState := r.read(of.accuracyLog)
+	mlState := r.read(ml.accuracyLog)
+	pos := 0
+
+	for s := 0; s < count; s++ {
+		llCode := ll.entries[llState].symbol
+		ofCode := of.entries[ofState].symbol
+		mlCode := ml.entries[mlState].symbol
+
+		if int(llCode) > maxLLSymbol || int(ofCode) > maxOFSymbol || int(mlCode) > maxMLSymbol {
+			return ErrCorrupt
+		}
+
+		offsetValue := 1<<ofCode + r.read(int(ofCode))
+		matchLength := mlBase[mlCode] + r.read(mlBits[mlCode])
+		literalsLength := llBase[llCode] + r.read(llBits[llCode])
+
+		if s < count-1 {
+			llState = ll.next(llState, r)
+			mlState = ml.next(mlState, r)
+			ofState = of.next(ofState, r)
+		}
+
+		if r.bits < 0 || pos+literalsLength > len(literals) {
+			return ErrCorrupt
+		}
+
+		if err := d.reserve(literalsLength + matchLength); err != nil {
+			return err
+		}
+
+		d.out = append(d.out, literals[pos:pos+literalsLength]...)
+		pos += literalsLength
+
+		offset := d.offset(offsetValue, literalsLength)
+
+		if offset <= 0 || offset > len(d.out)-d.start {
+			return ErrCorrupt
+		}
+
+		// the match may overlap the bytes being written
+		from := len(d.out) - offset
+
+		for j := 0; j < matchLength; j++ {
+			d.out = append(d.out, d.out[from+j])
+		}
+	}
+
+	if r.bits != 0 {
+		return ErrCorrupt
+	}
+
+	if err := d.reserve(len(literals) - pos); err != nil {
+		return err
+	}
+
+	d.out = append(d.out, literals[pos:]...)
+
+	return nil
+}
+
+// offset returns the match offset for an offset value, updating the repeated offsets.
+func (d *frameDecoder) offset(value, literalsLength int) int {
+	if value > 3 {
+		offset := value - 3
+		d.reps = [3]int{offset, d.reps[0], d.reps[1]}
+
+		return offset
+	}
+
+	i := value - 1
+
+	if literalsLength == 0 {
+		i++
+	}
+
+	var offset int
+
+	switch i {
+	case 0:
+		return d.reps[0]
+	case 1:
+		offset = d.reps[1]
+		d.reps[1] = d.reps[0]
+	case 2:
+		offset = d.reps[2]
+		d.reps[2] = d.reps[1]
+		d.reps[1] = d.reps[0]
+	default:
+		offset = d.reps[0] - 1
+		d.reps[2] = d.reps[1]
+		d.reps[1] = d.reps[0]
+	}
+
+	d.reps[0] = offset
+
+	return offset
+}
@@ -0,0 +1,166 @@
+package zstd
+
+import (
+	"math/bits"
+)
+
+const (
+	minAccuracyLog = 5
+)
+
+type fseEntry struct {
+	symbol uint8
+	nbBits uint8
+	base   uint16
+}
+
+// fseTable is an FSE decoding table, indexed by state.
+type fseTable struct {
+	accuracyLog int
+	entries     []fseEntry
+}
+
+// next returns the state following the given state.
+func (t *fseTable) next(state int, r *backwardBitReader) int {
+	e := t.entries[state]
+	return int(e.base) + r.read(int(e.nbBits))
+}
+
+// newRLETable returns a table that always decodes the given symbol.
+func newRLETable(symbol uint8) *fseTable {
+	return &fseTable{entries: []fseEntry{{symbol: symbol}}}
+}
+
+// readFSETable reads an FSE table description and returns the table and the description size.
+func readFSETable(src []byte, maxLog, maxSymbol int) (*fseTable, int, error) {
+	if len(src) == 0 {
+		return nil, 0, ErrCorrupt
+	}
+
+	r := &forwardBitReader{data: src}
+	accuracyLog := r.read(4) + minAccuracyLog
+
+	if accuracyLog > maxLog {
+		return nil, 0, ErrCorrupt
+	}
+
+	size := 1 << accuracyLog
+	remaining := size + 1
+	threshold := size
+	nbBits := accuracyLog + 1
+
+	var probs []int
+
+	for remaining > 1 {
+		if len(probs) > maxSymbol {
+			return nil, 0, ErrCorrupt
+		}
+
+		max := 2*threshold - 1 - remaining
+		count := r.peek(nbBits - 1)
+
+		if count < max {
+			r.skip(nbBits - 1)
+		} else {
+			count = r.read(nbBits)
+
+			if count >= threshold {
+				count -= max
+			}
+		}
+
+		prob := count - 1
+
+		if prob < 0 {
+			remaining += prob
+		} else {
+			remaining -= prob
+		}
+
+		probs = append(probs, prob)
+
+		if prob == 0 {
+			for {
+				repeat := r.read(2)
+
+				for j := 0; j < repeat; j++ {
+					probs = append(probs, 0)
+				}
+
+				if repeat != 3 {
+					break
+				}
+			}
+		}
+
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+
+		if r.overflow() {
+			return nil, 0, ErrCorrupt
+		}
+	}
+
+	if remaining != 1 || len(probs) > maxSymbol+1 {
+		return nil, 0, ErrCorrupt
+	}
+
+	t, err := newFSETable(probs, accuracyLog)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return t, r.size(), nil
+}
+
+// newFSETable builds a decoding table from the normalized symbol probabilities.
+func newFSETable(probs []int, accuracyLog int) (*fseTable, error) {
+	size := 1 << accuracyLog
+	entries := make([]fseEntry, size)
+	next := make([]int, len(probs))
+	high := size - 1
+
+	// "less than 1" probabilities take the last states
+	for s, p := range probs {
+		if p == -1 {
+			entries[high].symbol = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = p
+		}
+	}
+
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	pos := 0
+
+	for s, p := range probs {
+		for j := 0; j < p; j++ {
+			entries[pos].symbol = uint8(s)
+			pos = (pos + step) & mask
+
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+
+	if pos != 0 {
+		return nil, ErrCorrupt
+	}
+
+	for i := range entries {
+		e := &entries[i]
+		state := next[e.symbol]
+		next[e.symbol]++
+
+		e.nbBits = uint8(accuracyLog - (bits.Len(uint(state)) - 1))
+		e.base = uint16(state<<e.nbBits - size)
+	}
+
+	return &fseTable{accuracyLog: accuracyLog, entries: entries}, nil
+}
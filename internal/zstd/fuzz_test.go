@@ -0,0 +1,34 @@
+//go:build go1.18
+// +build go1.18
+
+package zstd_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/13k/kv-go/internal/zstd"
+)
+
+func FuzzDecompress(f *testing.F) {
+	for _, name := range []string{"testdata/gameinfo.gi.zst"} {
+		data, err := ioutil.ReadFile(name)
+
+		if err != nil {
+			f.Fatal(err)
+		}
+
+		f.Add(data, uint32(1<<20))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, size uint32) {
+		// bound the output size, as the KV3 decoder does with the size from the header
+		size %= 1 << 24
+
+		actual, err := zstd.Decompress(data, int(size))
+
+		if err == nil && len(actual) != int(size) {
+			t.Fatalf("decompressed %d bytes, expected %d", len(actual), size)
+		}
+	})
+}
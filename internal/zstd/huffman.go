@@ -0,0 +1,252 @@
+package zstd
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	maxHuffmanBits        = 11
+	maxWeightAccuracyLog  = 6
+	maxWeightSymbol       = maxHuffmanBits + 1
+	maxHuffmanSymbols     = 256
+	directWeightsMinimum  = 128
+	huffmanJumpTableSize  = 6
+	huffmanFourStreams    = 4
+	directWeightsBaseSize = 127
+)
+
+type huffmanEntry struct {
+	symbol uint8
+	nbBits uint8
+}
+
+// huffmanTable is a Huffman decoding table, indexed by the next maxBits bits.
+type huffmanTable struct {
+	maxBits int
+	entries []huffmanEntry
+}
+
+// readHuffmanTable reads a Huffman tree description and returns the table and the description
+// size.
+func readHuffmanTable(src []byte) (*huffmanTable, int, error) {
+	if len(src) == 0 {
+		return nil, 0, ErrCorrupt
+	}
+
+	header := int(src[0])
+	size := 1
+
+	var weights []uint8
+
+	if header < directWeightsMinimum {
+		size += header
+
+		if size > len(src) {
+			return nil, 0, ErrCorrupt
+		}
+
+		w, err := decodeHuffmanWeights(src[1:size])
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		weights = w
+	} else {
+		count := header - directWeightsBaseSize
+		size += (count + 1) / 2
+
+		if size > len(src) {
+			return nil, 0, ErrCorrupt
+		}
+
+		for j := 0; j < count; j++ {
+			b := src[1+j/2]
+
+			if j%2 == 0 {
+				weights = append(weights, b>>4)
+			} else {
+				weights = append(weights, b&0x0f)
+			}
+		}
+	}
+
+	t, err := newHuffmanTable(weights)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return t, size, nil
+}
+
+// decodeHuffmanWeights decodes FSE-compressed Huffman weights.
+func decodeHuffmanWeights(src []byte) ([]uint8, error) {
+	t, n, err := readFSETable(src, maxWeightAccuracyLog, maxWeightSymbol)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newBackwardBitReader(src[n:])
+
+	if err != nil {
+		return nil, err
+	}
+
+	state1 := r.read(t.accuracyLog)
+	state2 := r.read(t.accuracyLog)
+
+	var weights []uint8
+
+	// the two states are interleaved, decoding ends when reading past the beginning of the stream
+	for len(weights) < maxHuffmanSymbols {
+		weights = append(weights, t.entries[state1].symbol)
+		state1 = t.next(state1, r)
+
+		if r.bits < 0 {
+			weights = append(weights, t.entries[state2].symbol)
+			return weights, nil
+		}
+
+		weights = append(weights, t.entries[state2].symbol)
+		state2 = t.next(state2, r)
+
+		if r.bits < 0 {
+			weights = append(weights, t.entries[state1].symbol)
+			return weights, nil
+		}
+	}
+
+	return nil, ErrCorrupt
+}
+
+// newHuffmanTable builds a decoding table from the symbol weights, where the weight of the last
+// symbol is implied.
+func newHuffmanTable(weights []uint8) (*huffmanTable, error) {
+	if len(weights) >= maxHuffmanSymbols {
+		return nil, ErrCorrupt
+	}
+
+	total := 0
+
+	for _, w := range weights {
+		if w > maxHuffmanBits {
+			return nil, ErrCorrupt
+		}
+
+		if w > 0 {
+			total += 1 << (w - 1)
+		}
+	}
+
+	if total == 0 {
+		return nil, ErrCorrupt
+	}
+
+	maxBits := bits.Len(uint(total))
+	rest := 1<<maxBits - total
+
+	if maxBits > maxHuffmanBits || rest&(rest-1) != 0 {
+		return nil, ErrCorrupt
+	}
+
+	weights = append(weights, uint8(bits.Len(uint(rest))))
+
+	// symbols take 2^(weight-1) entries each, by increasing weight then increasing symbol
+	var starts [maxHuffmanBits + 2]int
+
+	for _, w := range weights {
+		if w > 0 {
+			starts[w+1] += 1 << (w - 1)
+		}
+	}
+
+	for w := 1; w < len(starts); w++ {
+		starts[w] += starts[w-1]
+	}
+
+	entries := make([]huffmanEntry, 1<<maxBits)
+
+	for s, w := range weights {
+		if w == 0 {
+			continue
+		}
+
+		e := huffmanEntry{symbol: uint8(s), nbBits: uint8(maxBits + 1 - int(w))}
+
+		for j := 0; j < 1<<(w-1); j++ {
+			entries[starts[w]+j] = e
+		}
+
+		starts[w] += 1 << (w - 1)
+	}
+
+	return &huffmanTable{maxBits: maxBits, entries: entries}, nil
+}
+
+// decode decodes size symbols from the given number of streams (1 or 4).
+func (t *huffmanTable) decode(src []byte, size, streams int) ([]byte, error) {
+	out := make([]byte, 0, size)
+
+	if streams == 1 {
+		return t.decodeStream(out, src, size)
+	}
+
+	if len(src) < huffmanJumpTableSize {
+		return nil, ErrCorrupt
+	}
+
+	sizes := [huffmanFourStreams]int{
+		int(binary.LittleEndian.Uint16(src)),
+		int(binary.LittleEndian.Uint16(src[2:])),
+		int(binary.LittleEndian.Uint16(src[4:])),
+	}
+
+	src = src[huffmanJumpTableSize:]
+	sizes[3] = len(src) - sizes[0] - sizes[1] - sizes[2]
+	segment := (size + 3) / 4
+
+	if sizes[3] < 0 || size < 3*segment {
+		return nil, ErrCorrupt
+	}
+
+	for i, n := range sizes {
+		count := segment
+
+		if i == huffmanFourStreams-1 {
+			count = size - 3*segment
+		}
+
+		var err error
+
+		if out, err = t.decodeStream(out, src[:n], count); err != nil {
+			return nil, err
+		}
+
+		src = src[n:]
+	}
+
+	return out, nil
+}
+
+func (t *huffmanTable) decodeStream(out, src []byte, count int) ([]byte, error) {
+	r, err := newBackwardBitReader(src)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for j := 0; j < count; j++ {
+		e := t.entries[r.peek(t.maxBits)]
+		out = append(out, e.symbol)
+		r.skip(int(e.nbBits))
+	}
+
+	if r.bits != 0 {
+		return nil, ErrCorrupt
+	}
+
+	return out, nil
+}
@@ -0,0 +1,234 @@
+// Package zstd implements decompression of the Zstandard format.
+//
+// It only covers what the KeyValues3 binary decoder needs, which is decompressing a buffer whose
+// decompressed size is known in advance. It's written here instead of depending on a Zstandard
+// library because the kv package only depends on the standard library, and the maintained Go
+// implementations require Go versions newer than the Go 1.14 the module supports.
+//
+// Limitations: dictionaries are not supported (ErrUnsupported), content checksums are not
+// verified, there is no streaming API (the whole output is kept in memory, so window sizes are
+// ignored) and decompression is not optimized for speed.
+//
+// https://datatracker.ietf.org/doc/html/rfc8878
+package zstd
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	frameMagic         = 0xfd2fb528
+	skippableMagic     = 0x184d2a50
+	skippableMagicMask = 0xfffffff0
+
+	blockRaw        = 0
+	blockRLE        = 1
+	blockCompressed = 2
+
+	blockHeaderSize = 3
+	checksumSize    = 4
+)
+
+var (
+	// ErrCorrupt means that the input is not valid Zstandard data.
+	ErrCorrupt = errors.New("zstd: corrupt input")
+	// ErrUnsupported means that the input uses a dictionary.
+	ErrUnsupported = errors.New("zstd: dictionaries are not supported")
+	// ErrSize means that the decompressed data does not have the expected size.
+	ErrSize = errors.New("zstd: decompressed size mismatch")
+)
+
+// Decompress decompresses all the frames in src, whose decompressed data has the given size.
+//
+// Returns ErrSize as soon as the decompressed data would exceed size, so corrupt or crafted input
+// can't make it allocate more than size bytes.
+func Decompress(src []byte, size int) ([]byte, error) {
+	var dst []byte
+
+	for len(src) > 0 {
+		if len(src) < 4 {
+			return nil, ErrCorrupt
+		}
+
+		magic := binary.LittleEndian.Uint32(src)
+
+		if magic&skippableMagicMask == skippableMagic {
+			if len(src) < 8 {
+				return nil, ErrCorrupt
+			}
+
+			size := int(binary.LittleEndian.Uint32(src[4:]))
+
+			if size > len(src)-8 {
+				return nil, ErrCorrupt
+			}
+
+			src = src[8+size:]
+
+			continue
+		}
+
+		if magic != frameMagic {
+			return nil, ErrCorrupt
+		}
+
+		d := &frameDecoder{out: dst, start: len(dst), limit: size, reps: [3]int{1, 4, 8}}
+		n, err := d.decode(src[4:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		dst = d.out
+		src = src[4+n:]
+	}
+
+	if len(dst) != size {
+		return nil, ErrSize
+	}
+
+	return dst, nil
+}
+
+// frameDecoder holds the state of a frame being decoded.
+type frameDecoder struct {
+	out   []byte
+	start int
+	limit int
+	reps  [3]int
+
+	huffman *huffmanTable
+	llTable *fseTable
+	ofTable *fseTable
+	mlTable *fseTable
+}
+
+// decode decodes a frame, following the magic number, and returns the size of the frame.
+func (d *frameDecoder) decode(src []byte) (int, error) {
+	if len(src) < 1 {
+		return 0, ErrCorrupt
+	}
+
+	fhd := src[0]
+	i := 1
+
+	fcsFlag := fhd >> 6
+	singleSegment := fhd&0x20 != 0
+	reserved := fhd&0x08 != 0
+	hasChecksum := fhd&0x04 != 0
+	dictFlag := fhd & 0x03
+
+	if reserved {
+		return 0, ErrCorrupt
+	}
+
+	if !singleSegment {
+		// window descriptor, unused since the whole output is kept in memory
+		i++
+	}
+
+	dictSize := [...]int{0, 1, 2, 4}[dictFlag]
+	fcsSize := [...]int{0, 2, 4, 8}[fcsFlag]
+
+	if fcsFlag == 0 && singleSegment {
+		fcsSize = 1
+	}
+
+	if i+dictSize+fcsSize > len(src) {
+		return 0, ErrCorrupt
+	}
+
+	for j := 0; j < dictSize; j++ {
+		if src[i+j] != 0 {
+			return 0, ErrUnsupported
+		}
+	}
+
+	i += dictSize + fcsSize
+
+	for {
+		if i+blockHeaderSize > len(src) {
+			return 0, ErrCorrupt
+		}
+
+		header := uint32(src[i]) | uint32(src[i+1])<<8 | uint32(src[i+2])<<16
+		i += blockHeaderSize
+
+		last := header&1 != 0
+		size := int(header >> 3)
+
+		switch (header >> 1) & 0x03 {
+		case blockRaw:
+			if i+size > len(src) {
+				return 0, ErrCorrupt
+			}
+
+			if err := d.reserve(size); err != nil {
+				return 0, err
+			}
+
+			d.out = append(d.out, src[i:i+size]...)
+			i += size
+		case blockRLE:
+			if i+1 > len(src) {
+				return 0, ErrCorrupt
+			}
+
+			if err := d.reserve(size); err != nil {
+				return 0, err
+			}
+
+			for j := 0; j < size; j++ {
+				d.out = append(d.out, src[i])
+			}
+
+			i++
+		case blockCompressed:
+			if i+size > len(src) {
+				return 0, ErrCorrupt
+			}
+
+			if err := d.decodeBlock(src[i : i+size]); err != nil {
+				return 0, err
+			}
+
+			i += size
+		default:
+			return 0, ErrCorrupt
+		}
+
+		if last {
+			break
+		}
+	}
+
+	if hasChecksum {
+		if i+checksumSize > len(src) {
+			return 0, ErrCorrupt
+		}
+
+		i += checksumSize
+	}
+
+	return i, nil
+}
+
+// reserve returns ErrSize if writing n more bytes would exceed the size limit.
+func (d *frameDecoder) reserve(n int) error {
+	if n > d.limit-len(d.out) {
+		return ErrSize
+	}
+
+	return nil
+}
+
+func (d *frameDecoder) decodeBlock(src []byte) error {
+	literals, n, err := d.decodeLiterals(src)
+
+	if err != nil {
+		return err
+	}
+
+	return d.decodeSequences(src[n:], literals)
+}
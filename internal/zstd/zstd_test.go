@@ -0,0 +1,210 @@
+package zstd_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go/internal/zstd"
+)
+
+func TestZstd(t *testing.T) {
+	suite.Run(t, &ZstdSuite{})
+}
+
+type ZstdSuite struct {
+	suite.Suite
+}
+
+func (s *ZstdSuite) readFile(path ...string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join(path...))
+
+	s.Require().NoError(err)
+
+	return data
+}
+
+// frame returns a single segment frame with a 1-byte content size and the given blocks.
+func frame(blocks ...[]byte) []byte {
+	data := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x20, 0x00}
+
+	for _, b := range blocks {
+		data = append(data, b...)
+	}
+
+	return data
+}
+
+// block returns a block header followed by data.
+func block(last bool, typ, size int, data ...byte) []byte {
+	header := uint32(size<<3 | typ<<1)
+
+	if last {
+		header |= 1
+	}
+
+	return append([]byte{byte(header), byte(header >> 8), byte(header >> 16)}, data...)
+}
+
+func (s *ZstdSuite) TestDecompress() {
+	require := s.Require()
+
+	for _, name := range []string{"npc_heroes.txt", "gameinfo.gi"} {
+		expected := s.readFile("..", "..", "testdata", name)
+		actual, err := zstd.Decompress(s.readFile("testdata", name+".zst"), len(expected))
+
+		require.NoErrorf(err, "fixture %s", name)
+		require.Equalf(expected, actual, "fixture %s", name)
+	}
+}
+
+func (s *ZstdSuite) TestDecompressBlocks() {
+	require := s.Require()
+
+	skippable := []byte{0x50, 0x2a, 0x4d, 0x18, 0x02, 0x00, 0x00, 0x00, 0xff, 0xff}
+
+	testCases := []struct {
+		TestName string
+		Data     []byte
+		Expected string
+	}{
+		{
+			TestName: "Empty",
+			Data:     nil,
+			Expected: "",
+		},
+		{
+			TestName: "Raw",
+			Data:     frame(block(false, 0, 3, 'a', 'b', 'c'), block(true, 0, 2, 'd', 'e')),
+			Expected: "abcde",
+		},
+		{
+			TestName: "RLE",
+			Data:     frame(block(true, 1, 4, 'x')),
+			Expected: "xxxx",
+		},
+		{
+			TestName: "MultipleFrames",
+			Data: append(append(frame(block(true, 0, 1, 'a')), skippable...),
+				frame(block(true, 1, 2, 'b'))...),
+			Expected: "abb",
+		},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := zstd.Decompress(testCase.Data, len(testCase.Expected))
+
+		require.NoErrorf(err, "case %s", testCase.TestName)
+		require.Equalf(testCase.Expected, string(actual), "case %s", testCase.TestName)
+	}
+}
+
+func (s *ZstdSuite) TestDecompressErrors() {
+	require := s.Require()
+
+	testCases := []struct {
+		TestName string
+		Data     []byte
+		Size     int
+		Err      error
+	}{
+		{
+			TestName: "InvalidMagic",
+			Data:     []byte{0x28, 0xb5, 0x2f, 0xfe, 0x20, 0x00},
+			Err:      zstd.ErrCorrupt,
+		},
+		{
+			TestName: "ShortMagic",
+			Data:     []byte{0x28, 0xb5},
+			Err:      zstd.ErrCorrupt,
+		},
+		{
+			TestName: "MissingBlock",
+			Data:     frame(),
+			Err:      zstd.ErrCorrupt,
+		},
+		{
+			TestName: "TruncatedRawBlock",
+			Data:     frame(block(true, 0, 3, 'a')),
+			Size:     3,
+			Err:      zstd.ErrCorrupt,
+		},
+		{
+			TestName: "ReservedBlockType",
+			Data:     frame(block(true, 3, 0)),
+			Err:      zstd.ErrCorrupt,
+		},
+		{
+			TestName: "Dictionary",
+			Data:     []byte{0x28, 0xb5, 0x2f, 0xfd, 0x21, 0x01, 0x00},
+			Err:      zstd.ErrUnsupported,
+		},
+		{
+			TestName: "SizeExceeded",
+			Data:     frame(block(true, 1, 1<<20, 'x')),
+			Size:     16,
+			Err:      zstd.ErrSize,
+		},
+		{
+			TestName: "SizeMismatch",
+			Data:     frame(block(true, 1, 4, 'x')),
+			Size:     5,
+			Err:      zstd.ErrSize,
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, err := zstd.Decompress(testCase.Data, testCase.Size)
+
+		require.Truef(errors.Is(err, testCase.Err), "case %s: %v", testCase.TestName, err)
+	}
+}
+
+func (s *ZstdSuite) TestDecompressLimit() {
+	require := s.Require()
+
+	// a frame of RLE blocks of the maximum size, decompressing to gigabytes
+	data := frame()
+
+	for i := 0; i < 1000; i++ {
+		data = append(data, block(false, 1, 1<<21-1, 'x')...)
+	}
+
+	data = append(data, block(true, 1, 1, 'x')...)
+
+	_, err := zstd.Decompress(data, 1<<20)
+
+	require.True(errors.Is(err, zstd.ErrSize))
+}
+
+func (s *ZstdSuite) TestDecompressTruncated() {
+	require := s.Require()
+	plain := s.readFile("..", "..", "testdata", "gameinfo.gi")
+	data := s.readFile("testdata", "gameinfo.gi.zst")
+
+	for n := 0; n < len(data); n++ {
+		_, err := zstd.Decompress(data[:n], len(plain))
+
+		require.Errorf(err, "length %d", n)
+	}
+}
+
+func (s *ZstdSuite) TestDecompressCorrupt() {
+	require := s.Require()
+	plain := s.readFile("..", "..", "testdata", "gameinfo.gi")
+	data := s.readFile("testdata", "gameinfo.gi.zst")
+
+	for i := 0; i < len(data); i++ {
+		corrupt := append([]byte(nil), data...)
+		corrupt[i] ^= 0xff
+
+		actual, err := zstd.Decompress(corrupt, len(plain))
+
+		if err == nil {
+			require.Lenf(actual, len(plain), "offset %d", i)
+		}
+	}
+}
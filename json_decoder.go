@@ -0,0 +1,322 @@
+package kv
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// JSONDecoder reads and decodes JSON values from an input stream into KeyValue nodes.
+type JSONDecoder struct {
+	dec        *json.Decoder
+	duplicates JSONDuplicates
+	annotated  bool
+}
+
+// NewJSONDecoder returns a new JSON decoder that reads from r.
+func NewJSONDecoder(r io.Reader) *JSONDecoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	return &JSONDecoder{dec: dec}
+}
+
+// Duplicates sets the policy for nodes with duplicate keys, matching the policy used to encode the
+// input, and returns the receiver.
+func (d *JSONDecoder) Duplicates(p JSONDuplicates) *JSONDecoder {
+	d.duplicates = p
+	return d
+}
+
+// Annotated makes the decoder read nodes in the type-annotated form written by
+// JSONEncoder.Annotated and returns the receiver.
+func (d *JSONDecoder) Annotated() *JSONDecoder {
+	d.annotated = true
+	return d
+}
+
+// jsonMember is a member of a JSON object, decoded in order.
+type jsonMember struct {
+	key   string
+	value interface{}
+}
+
+// Decode reads the next JSON value from its input and stores it in the node pointed to by kv.
+//
+// Objects are decoded as TypeObject nodes and arrays as TypeArray nodes, with elements as children
+// with empty keys. Strings are decoded as TypeString, booleans as TypeBool, null as TypeNull,
+// floating point numbers as TypeDouble and integers as TypeInt64 (or TypeUint64, if too large for
+// an int64). Number values keep their text from the input. The root node has an empty key.
+//
+// With JSONDuplicatesArray, the elements of a non-empty array in an object member are decoded as
+// nodes with duplicate keys. With JSONDuplicatesLastWins, only the last of object members with the
+// same name is decoded. With JSONDuplicatesPairs, arrays of [key, value] pairs are decoded as
+// Object nodes.
+//
+// In the annotated form, nodes are decoded exactly as encoded, and a *JSONError is returned for
+// nodes with invalid types or flags.
+func (d *JSONDecoder) Decode(kv KeyValue) error {
+	v, err := readJSONValue(d.dec)
+
+	if err != nil {
+		return err
+	}
+
+	if d.annotated {
+		return decodeJSONNode(kv, v, "")
+	}
+
+	kv.SetKey("")
+	d.decodeValue(kv, v)
+
+	return nil
+}
+
+// readJSONValue reads the next JSON value, keeping the order and duplicates of object members.
+//
+// Objects are returned as []jsonMember, arrays as []interface{} and numbers as json.Number.
+func readJSONValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		members := []jsonMember{}
+
+		for dec.More() {
+			key, err := dec.Token()
+
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := readJSONValue(dec)
+
+			if err != nil {
+				return nil, err
+			}
+
+			members = append(members, jsonMember{key: key.(string), value: value})
+		}
+
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		return members, nil
+	case json.Delim('['):
+		elements := []interface{}{}
+
+		for dec.More() {
+			value, err := readJSONValue(dec)
+
+			if err != nil {
+				return nil, err
+			}
+
+			elements = append(elements, value)
+		}
+
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+
+		return elements, nil
+	default:
+		return tok, nil
+	}
+}
+
+func (d *JSONDecoder) decodeValue(kv KeyValue, v interface{}) {
+	kv.SetChildren().SetFlag(FlagNone).SetValue("")
+
+	switch v := v.(type) {
+	case nil:
+		kv.SetType(TypeNull)
+	case string:
+		kv.SetType(TypeString).SetValue(v)
+	case bool:
+		kv.SetType(TypeBool).SetValue(strconv.FormatBool(v))
+	case json.Number:
+		kv.SetType(jsonNumberType(v)).SetValue(v.String())
+	case []jsonMember:
+		kv.SetType(TypeObject)
+		d.decodeMembers(kv, v)
+	case []interface{}:
+		if pairs, ok := d.pairs(v); ok {
+			kv.SetType(TypeObject)
+			d.decodeMembers(kv, pairs)
+
+			return
+		}
+
+		kv.SetType(TypeArray)
+
+		for _, e := range v {
+			d.decodeValue(kv.NewChild(), e)
+		}
+	}
+}
+
+func (d *JSONDecoder) decodeMembers(kv KeyValue, members []jsonMember) {
+	if d.duplicates == JSONDuplicatesLastWins {
+		var keys []string
+
+		last := map[string]interface{}{}
+
+		for _, m := range members {
+			if _, ok := last[m.key]; !ok {
+				keys = append(keys, m.key)
+			}
+
+			last[m.key] = m.value
+		}
+
+		for _, key := range keys {
+			d.decodeValue(kv.NewChild().SetKey(key), last[key])
+		}
+
+		return
+	}
+
+	for _, m := range members {
+		elements, ok := m.value.([]interface{})
+
+		if ok && len(elements) > 0 && d.duplicates == JSONDuplicatesArray {
+			for _, e := range elements {
+				d.decodeValue(kv.NewChild().SetKey(m.key), e)
+			}
+
+			continue
+		}
+
+		d.decodeValue(kv.NewChild().SetKey(m.key), m.value)
+	}
+}
+
+// pairs returns the members represented by a non-empty array of [key, value] pairs, with
+// JSONDuplicatesPairs.
+func (d *JSONDecoder) pairs(elements []interface{}) ([]jsonMember, bool) {
+	if d.duplicates != JSONDuplicatesPairs || len(elements) == 0 {
+		return nil, false
+	}
+
+	members := make([]jsonMember, len(elements))
+
+	for i, e := range elements {
+		pair, ok := e.([]interface{})
+
+		if !ok || len(pair) != 2 {
+			return nil, false
+		}
+
+		key, ok := pair[0].(string)
+
+		if !ok {
+			return nil, false
+		}
+
+		members[i] = jsonMember{key: key, value: pair[1]}
+	}
+
+	return members, true
+}
+
+func jsonNumberType(n json.Number) Type {
+	s := n.String()
+
+	if strings.ContainsAny(s, ".eE") {
+		return TypeDouble
+	}
+
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return TypeInt64
+	}
+
+	if _, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return TypeUint64
+	}
+
+	return TypeDouble
+}
+
+// decodeJSONNode decodes a node in type-annotated form. Path is the path of the node's parent.
+func decodeJSONNode(kv KeyValue, v interface{}, path string) error {
+	members, ok := v.([]jsonMember)
+
+	if !ok {
+		return &JSONError{Path: path, Msg: "node is not an object", Err: ErrMalformed}
+	}
+
+	var (
+		node     jsonNode
+		children []interface{}
+		typed    bool
+	)
+
+	for _, m := range members {
+		var ok bool
+
+		switch m.key {
+		case "key":
+			node.Key, ok = m.value.(string)
+		case "type":
+			node.Type, ok = m.value.(string)
+			typed = ok
+		case "flag":
+			node.Flag, ok = m.value.(string)
+		case "value":
+			node.Value, ok = m.value.(string)
+		case "children":
+			children, ok = m.value.([]interface{})
+		default:
+			return &JSONError{Path: path, Msg: "unknown field " + strconv.Quote(m.key), Err: ErrMalformed}
+		}
+
+		if !ok {
+			return &JSONError{Path: path, Msg: "invalid field " + strconv.Quote(m.key), Err: ErrMalformed}
+		}
+	}
+
+	path = joinJSONPath(path, node.Key)
+
+	if !typed {
+		return &JSONError{Path: path, Msg: "missing type", Err: ErrMalformed}
+	}
+
+	t, ok := TypeFromString(node.Type)
+
+	if !ok {
+		return &JSONError{Path: path, Msg: strconv.Quote(node.Type), Err: ErrInvalidType}
+	}
+
+	flag := FlagNone
+
+	if node.Flag != "" {
+		if flag, ok = FlagFromString(node.Flag); !ok {
+			return &JSONError{Path: path, Msg: "invalid flag " + strconv.Quote(node.Flag), Err: ErrMalformed}
+		}
+	}
+
+	kv.SetChildren().SetKey(node.Key).SetType(t).SetFlag(flag).SetValue(node.Value)
+
+	for _, c := range children {
+		if err := decodeJSONNode(kv.NewChild(), c, path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func joinJSONPath(path, key string) string {
+	if path == "" {
+		return pathEscaper.Replace(key)
+	}
+
+	return path + string(pathSeparator) + pathEscaper.Replace(key)
+}
@@ -0,0 +1,235 @@
+package kv_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestJSONDecoder(t *testing.T) {
+	suite.Run(t, &JSONDecoderSuite{})
+}
+
+type JSONDecoderSuite struct {
+	Suite
+}
+
+func (s *JSONDecoderSuite) decode(dec *kv.JSONDecoder) kv.KeyValue {
+	root := kv.NewKeyValueRoot("ignored")
+
+	s.Require().NoError(dec.Decode(root))
+
+	return root
+}
+
+func (s *JSONDecoderSuite) TestDecodeTypes() {
+	input := `{"string":"a","int":-1,"big":18446744073709551615,"huge":1844674407370955161500,` +
+		`"float":1.5,"exp":1e21,"bool":true,"null":null,"array":[1,[],{}],"object":{}}`
+
+	expected := kv.NewKeyValueRoot("").
+		AddString("string", "a").
+		AddInt64("int", "-1").
+		AddUint64("big", "18446744073709551615").
+		AddDouble("huge", "1844674407370955161500").
+		AddDouble("float", "1.5").
+		AddDouble("exp", "1e21").
+		AddBool("bool", "true").
+		AddNull("null").
+		AddChild(kv.NewKeyValueArray("array", nil).
+			AddInt64("", "1").
+			AddArray("").
+			AddObject("")).
+		AddObject("object")
+
+	actual := s.decode(kv.NewJSONDecoder(strings.NewReader(input)).Duplicates(kv.JSONDuplicatesLastWins))
+
+	s.Require().True(kv.Equal(expected, actual), "%s", kv.Diff(expected, actual))
+}
+
+func (s *JSONDecoderSuite) TestDecodeDuplicates() {
+	testCases := []struct {
+		TestName   string
+		Duplicates kv.JSONDuplicates
+		Input      string
+		Expected   kv.KeyValue
+	}{
+		{
+			TestName:   "Array",
+			Duplicates: kv.JSONDuplicatesArray,
+			Input:      `{"Ability1":["a","b"],"Roles":[],"Bot":{"Build":"x"},"Ability1":"c"}`,
+			Expected: kv.NewKeyValueRoot("").
+				AddString("Ability1", "a").
+				AddString("Ability1", "b").
+				AddArray("Roles").
+				AddChild(kv.NewKeyValueObject("Bot", nil).AddString("Build", "x")).
+				AddString("Ability1", "c"),
+		},
+		{
+			TestName:   "LastWins",
+			Duplicates: kv.JSONDuplicatesLastWins,
+			Input:      `{"Ability1":"a","Roles":["x"],"Ability1":"b"}`,
+			Expected: kv.NewKeyValueRoot("").
+				AddString("Ability1", "b").
+				AddChild(kv.NewKeyValueArray("Roles", nil).AddString("", "x")),
+		},
+		{
+			TestName:   "Pairs",
+			Duplicates: kv.JSONDuplicatesPairs,
+			Input:      `[["Ability1","a"],["Bot",[["Build","x"]]],["Ability1","b"],["Roles",["x",["y"]]]]`,
+			Expected: kv.NewKeyValueRoot("").
+				AddString("Ability1", "a").
+				AddChild(kv.NewKeyValueObject("Bot", nil).AddString("Build", "x")).
+				AddString("Ability1", "b").
+				AddChild(kv.NewKeyValueArray("Roles", nil).
+					AddString("", "x").
+					AddChild(kv.NewKeyValueArray("", nil).AddString("", "y"))),
+		},
+	}
+
+	for _, testCase := range testCases {
+		s.Run(testCase.TestName, func() {
+			dec := kv.NewJSONDecoder(strings.NewReader(testCase.Input)).Duplicates(testCase.Duplicates)
+			actual := s.decode(dec)
+
+			s.Require().True(kv.Equal(testCase.Expected, actual), "%s", kv.Diff(testCase.Expected, actual))
+		})
+	}
+}
+
+func (s *JSONDecoderSuite) TestRoundTrip() {
+	root := kv.NewKeyValueRoot("").
+		AddString("Model", "axe.vmdl").
+		AddString("Ability1", "axe_berserkers_call").
+		AddString("Ability1", "axe_battle_hunger").
+		AddChild(kv.NewKeyValueObject("Bot", nil).
+			AddString("Build", "<b>").
+			AddString("Build", "\u2028"))
+
+	for _, p := range []kv.JSONDuplicates{kv.JSONDuplicatesArray, kv.JSONDuplicatesPairs} {
+		b := &bytes.Buffer{}
+
+		s.Require().NoError(kv.NewJSONEncoder(b).Duplicates(p).Encode(root))
+
+		actual := s.decode(kv.NewJSONDecoder(b).Duplicates(p))
+
+		s.Require().True(kv.Equal(root, actual, kv.EqualIgnoreOrder), "policy %d: %s", p, kv.Diff(root, actual))
+	}
+}
+
+func (s *JSONDecoderSuite) TestRoundTripAnnotated() {
+	require := s.Require()
+
+	root := kv.NewKeyValueRoot("DOTAHeroes").
+		AddString("String", "a\x00\"").
+		AddInt32("Int32", "-1").
+		AddInt64("Int64", "1").
+		AddUint64("Uint64", "18446744073709551615").
+		AddFloat32("Float32", "1.50").
+		AddColor("Color", "255").
+		AddPointer("Pointer", "0").
+		AddChild(kv.NewKeyValue(kv.TypeWString, "WString", "w", nil)).
+		AddNull("Null").
+		AddBool("Bool", "1").
+		AddDouble("Double", "nan").
+		AddBinary("Binary", "00FF").
+		AddString("Ability1", "a").
+		AddString("Ability1", "b").
+		AddChild(kv.NewKeyValueArray("Array", nil).
+			AddObject("").
+			AddString("", "")).
+		AddObject("")
+
+	root.Child("String").SetFlag(kv.FlagSoundEvent)
+
+	b := &bytes.Buffer{}
+
+	require.NoError(kv.NewJSONEncoder(b).Annotated().Indent("", "\t").Encode(root))
+
+	actual := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewJSONDecoder(b).Annotated().Decode(actual))
+	require.True(kv.Equal(root, actual), "%s", kv.Diff(root, actual))
+
+	for _, c := range actual.Children() {
+		require.Equal(actual, c.Parent())
+	}
+}
+
+func (s *JSONDecoderSuite) TestDecodeStream() {
+	require := s.Require()
+	dec := kv.NewJSONDecoder(strings.NewReader(`{"a":"1"} ["b"]`))
+
+	require.Equal("1", s.decode(dec).Child("a").Value())
+	require.Equal(kv.TypeArray, s.decode(dec).Type())
+	require.Equal(io.EOF, dec.Decode(kv.NewKeyValueEmpty()))
+}
+
+func (s *JSONDecoderSuite) TestDecodeErrors() {
+	testCases := []struct {
+		TestName string
+		Input    string
+		Err      string
+		Target   error
+	}{
+		{
+			TestName: "NotObject",
+			Input:    `{"type":"Object","children":["a"]}`,
+			Err:      `kv: json: node "": malformed data: node is not an object`,
+			Target:   kv.ErrMalformed,
+		},
+		{
+			TestName: "InvalidType",
+			Input:    `{"type":"Object","children":[{"key":"a/b","type":"Float64"}]}`,
+			Err:      `kv: json: node "a\\/b": invalid type: "Float64"`,
+			Target:   kv.ErrInvalidType,
+		},
+		{
+			TestName: "InvalidFlag",
+			Input:    `{"key":"a","type":"String","flag":"x"}`,
+			Err:      `kv: json: node "a": malformed data: invalid flag "x"`,
+			Target:   kv.ErrMalformed,
+		},
+		{
+			TestName: "MissingType",
+			Input:    `{"key":"a","children":[]}`,
+			Err:      `kv: json: node "a": malformed data: missing type`,
+			Target:   kv.ErrMalformed,
+		},
+		{
+			TestName: "UnknownField",
+			Input:    `{"type":"Object","children":[{"key":"a","type":"Object","children":[{"x":1}]}]}`,
+			Err:      `kv: json: node "a": malformed data: unknown field "x"`,
+			Target:   kv.ErrMalformed,
+		},
+		{
+			TestName: "InvalidField",
+			Input:    `{"type":"Int32","value":1}`,
+			Err:      `kv: json: node "": malformed data: invalid field "value"`,
+			Target:   kv.ErrMalformed,
+		},
+	}
+
+	for _, testCase := range testCases {
+		s.Run(testCase.TestName, func() {
+			require := s.Require()
+			err := kv.NewJSONDecoder(strings.NewReader(testCase.Input)).Annotated().Decode(kv.NewKeyValueEmpty())
+
+			require.EqualError(err, testCase.Err)
+			require.True(errors.Is(err, testCase.Target))
+
+			var jsonErr *kv.JSONError
+
+			require.True(errors.As(err, &jsonErr))
+		})
+	}
+
+	err := kv.NewJSONDecoder(strings.NewReader(`{"a":}`)).Decode(kv.NewKeyValueEmpty())
+
+	s.Require().Error(err)
+}
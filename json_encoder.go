@@ -0,0 +1,408 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// JSONDuplicates represents how nodes with duplicate keys are represented in JSON.
+type JSONDuplicates uint8
+
+// JSON duplicate keys policies.
+const (
+	// JSONDuplicatesArray groups the values of nodes with the same key in a JSON array, at the
+	// position of the first node. It's the default policy.
+	JSONDuplicatesArray JSONDuplicates = iota
+	// JSONDuplicatesLastWins keeps the value of the last node with the same key, at the position of
+	// the first node.
+	JSONDuplicatesLastWins
+	// JSONDuplicatesPairs represents Object nodes as ordered JSON arrays of [key, value] pairs,
+	// keeping all nodes in order.
+	JSONDuplicatesPairs
+)
+
+// jsonNode is a node in type-annotated JSON form.
+type jsonNode struct {
+	Key      string      `json:"key,omitempty"`
+	Type     string      `json:"type"`
+	Flag     string      `json:"flag,omitempty"`
+	Value    string      `json:"value,omitempty"`
+	Children []*jsonNode `json:"children,omitempty"`
+}
+
+// JSONEncoder writes KeyValue nodes as JSON to an output stream.
+type JSONEncoder struct {
+	w          io.Writer
+	duplicates JSONDuplicates
+	typed      bool
+	annotated  bool
+	prefix     string
+	indent     string
+}
+
+// NewJSONEncoder returns a new JSON encoder that writes to w.
+func NewJSONEncoder(w io.Writer) *JSONEncoder {
+	return &JSONEncoder{w: w}
+}
+
+// Duplicates sets the policy for nodes with duplicate keys and returns the receiver.
+func (e *JSONEncoder) Duplicates(p JSONDuplicates) *JSONEncoder {
+	e.duplicates = p
+	return e
+}
+
+// Typed makes the encoder write scalars as typed JSON values and returns the receiver.
+//
+// Int32, Int64, Float32, Double, Color and Pointer nodes are written as JSON numbers, Bool nodes as
+// JSON booleans, and Uint64 nodes as JSON strings with the decimal value, to avoid precision loss
+// in JSON parsers that read numbers as 64-bit floats. Float32 and Double values that JSON can't
+// represent (NaN and infinities) are written as strings. By default, all scalars are written as
+// JSON strings with their values.
+func (e *JSONEncoder) Typed() *JSONEncoder {
+	e.typed = true
+	return e
+}
+
+// Annotated makes the encoder write nodes in the lossless type-annotated form and returns the
+// receiver.
+//
+// In the annotated form, every node is a JSON object with the node's key, type name (see
+// Type.String), flag name (see Flag.String) and value, and child nodes are listed in order:
+//
+//   {"key": "DOTAHeroes", "type": "Object", "children": [
+//     {"key": "Version", "type": "Int32", "value": "1"},
+//     {"key": "Model", "type": "String", "flag": "resource", "value": "axe.vmdl"}
+//   ]}
+//
+// Empty keys, flags, values and children are omitted. The duplicates policy and Typed are ignored.
+func (e *JSONEncoder) Annotated() *JSONEncoder {
+	e.annotated = true
+	return e
+}
+
+// Indent makes the encoder indent the output like json.Indent and returns the receiver.
+func (e *JSONEncoder) Indent(prefix, indent string) *JSONEncoder {
+	e.prefix, e.indent = prefix, indent
+	return e
+}
+
+// Encode writes the JSON encoding of kv to the stream, followed by a newline.
+//
+// Unless writing the annotated form, the root node's key is ignored. Object nodes are written as
+// JSON objects (or arrays of pairs, see JSONDuplicatesPairs), Array nodes as JSON arrays and Null
+// nodes as JSON null.
+func (e *JSONEncoder) Encode(kv KeyValue) error {
+	b := &bytes.Buffer{}
+
+	if e.annotated {
+		node, err := newJSONNode(kv)
+
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(b)
+		enc.SetEscapeHTML(false)
+
+		if err := enc.Encode(node); err != nil {
+			return err
+		}
+
+		b.Truncate(b.Len() - 1)
+	} else if err := e.encodeValue(b, kv); err != nil {
+		return err
+	}
+
+	if e.prefix != "" || e.indent != "" {
+		indented := &bytes.Buffer{}
+
+		if err := json.Indent(indented, b.Bytes(), e.prefix, e.indent); err != nil {
+			return err
+		}
+
+		b = indented
+	}
+
+	b.WriteByte('\n')
+
+	_, err := b.WriteTo(e.w)
+
+	return err
+}
+
+func newJSONNode(kv KeyValue) (*jsonNode, error) {
+	if _, ok := TypeFromString(kv.Type().String()); !ok {
+		return nil, newUnsupportedTypeError(kv)
+	}
+
+	node := &jsonNode{
+		Key:   kv.Key(),
+		Type:  kv.Type().String(),
+		Flag:  kv.Flag().String(),
+		Value: kv.Value(),
+	}
+
+	for _, c := range kv.Children() {
+		child, err := newJSONNode(c)
+
+		if err != nil {
+			return nil, err
+		}
+
+		node.Children = append(node.Children, child)
+	}
+
+	return node, nil
+}
+
+func (e *JSONEncoder) encodeValue(b *bytes.Buffer, kv KeyValue) error {
+	switch kv.Type() {
+	case TypeObject:
+		return e.encodeObject(b, kv)
+	case TypeArray:
+		b.WriteByte('[')
+
+		for i, c := range kv.Children() {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			if err := e.encodeValue(b, c); err != nil {
+				return err
+			}
+		}
+
+		b.WriteByte(']')
+	case TypeNull:
+		b.WriteString("null")
+	case TypeString, TypeWString, TypeBinary:
+		writeJSONString(b, kv.Value())
+	case TypeInt32, TypeInt64, TypeUint64, TypeFloat32, TypeDouble, TypeColor, TypePointer, TypeBool:
+		if !e.typed {
+			writeJSONString(b, kv.Value())
+			return nil
+		}
+
+		return e.encodeTyped(b, kv)
+	default:
+		return newUnsupportedTypeError(kv)
+	}
+
+	return nil
+}
+
+func (e *JSONEncoder) encodeObject(b *bytes.Buffer, kv KeyValue) error {
+	if e.duplicates == JSONDuplicatesPairs {
+		b.WriteByte('[')
+
+		for i, c := range kv.Children() {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			b.WriteByte('[')
+			writeJSONString(b, c.Key())
+			b.WriteByte(',')
+
+			if err := e.encodeValue(b, c); err != nil {
+				return err
+			}
+
+			b.WriteByte(']')
+		}
+
+		b.WriteByte(']')
+
+		return nil
+	}
+
+	var keys []string
+
+	groups := map[string][]KeyValue{}
+
+	for _, c := range kv.Children() {
+		if _, ok := groups[c.Key()]; !ok {
+			keys = append(keys, c.Key())
+		}
+
+		groups[c.Key()] = append(groups[c.Key()], c)
+	}
+
+	b.WriteByte('{')
+
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		writeJSONString(b, key)
+		b.WriteByte(':')
+
+		group := groups[key]
+
+		if len(group) == 1 || e.duplicates == JSONDuplicatesLastWins {
+			if err := e.encodeValue(b, group[len(group)-1]); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		b.WriteByte('[')
+
+		for j, c := range group {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+
+			if err := e.encodeValue(b, c); err != nil {
+				return err
+			}
+		}
+
+		b.WriteByte(']')
+	}
+
+	b.WriteByte('}')
+
+	return nil
+}
+
+func (e *JSONEncoder) encodeTyped(b *bytes.Buffer, kv KeyValue) error {
+	var (
+		n   int32
+		err error
+	)
+
+	switch kv.Type() {
+	case TypeInt32:
+		n, err = kv.AsInt32()
+	case TypeColor:
+		n, err = kv.AsColor()
+	case TypePointer:
+		n, err = kv.AsPointer()
+	case TypeInt64:
+		v, err := kv.AsInt64()
+
+		if err != nil {
+			return err
+		}
+
+		b.WriteString(strconv.FormatInt(v, 10))
+
+		return nil
+	case TypeUint64:
+		v, err := kv.AsUint64()
+
+		if err != nil {
+			return err
+		}
+
+		writeJSONString(b, strconv.FormatUint(v, 10))
+
+		return nil
+	case TypeFloat32:
+		v, err := kv.AsFloat32()
+
+		if err != nil {
+			return err
+		}
+
+		writeJSONFloat(b, kv, float64(v), 32)
+
+		return nil
+	case TypeDouble:
+		v, err := kv.AsDouble()
+
+		if err != nil {
+			return err
+		}
+
+		writeJSONFloat(b, kv, v, 64)
+
+		return nil
+	case TypeBool:
+		v, err := kv.AsBool()
+
+		if err != nil {
+			return err
+		}
+
+		b.WriteString(strconv.FormatBool(v))
+
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	b.WriteString(strconv.FormatInt(int64(n), 10))
+
+	return nil
+}
+
+func writeJSONFloat(b *bytes.Buffer, kv KeyValue, f float64, bitSize int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		writeJSONString(b, kv.Value())
+		return
+	}
+
+	b.WriteString(strconv.FormatFloat(f, 'g', -1, bitSize))
+}
+
+const hexDigits = "0123456789abcdef"
+
+// writeJSONString writes s as a JSON string, like encoding/json but without escaping HTML
+// characters.
+func writeJSONString(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case c == '\n':
+				b.WriteString(`\n`)
+			case c == '\r':
+				b.WriteString(`\r`)
+			case c == '\t':
+				b.WriteString(`\t`)
+			case c < 0x20:
+				b.WriteString(`\u00`)
+				b.WriteByte(hexDigits[c>>4])
+				b.WriteByte(hexDigits[c&0xf])
+			default:
+				b.WriteByte(c)
+			}
+
+			i++
+
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+
+		switch {
+		case r == utf8.RuneError && size == 1:
+			b.WriteString(`\ufffd`)
+		case r == '\u2028' || r == '\u2029':
+			b.WriteString(`\u202`)
+			b.WriteByte(hexDigits[r&0xf])
+		default:
+			b.WriteString(s[i : i+size])
+		}
+
+		i += size
+	}
+
+	b.WriteByte('"')
+}
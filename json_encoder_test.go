@@ -0,0 +1,158 @@
+package kv_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestJSONEncoder(t *testing.T) {
+	suite.Run(t, &JSONEncoderSuite{})
+}
+
+type JSONEncoderSuite struct {
+	Suite
+}
+
+func (s *JSONEncoderSuite) hero() kv.KeyValue {
+	return kv.NewKeyValueRoot("npc_dota_hero_axe").
+		AddString("Model", "models/heroes/axe/axe.vmdl").
+		AddString("Ability1", "axe_berserkers_call").
+		AddInt32("AttributeBaseStrength", "25").
+		AddString("Ability1", "axe_battle_hunger").
+		AddChild(kv.NewKeyValueObject("Bot", nil).
+			AddString("Build", "<\"quoted\">\n"))
+}
+
+func (s *JSONEncoderSuite) encode(enc func(*bytes.Buffer) *kv.JSONEncoder, root kv.KeyValue) string {
+	b := &bytes.Buffer{}
+
+	s.Require().NoError(enc(b).Encode(root))
+
+	return b.String()
+}
+
+func (s *JSONEncoderSuite) TestEncodeDuplicates() {
+	testCases := []struct {
+		TestName   string
+		Duplicates kv.JSONDuplicates
+		Expected   string
+	}{
+		{
+			TestName:   "Array",
+			Duplicates: kv.JSONDuplicatesArray,
+			Expected: `{"Model":"models/heroes/axe/axe.vmdl",` +
+				`"Ability1":["axe_berserkers_call","axe_battle_hunger"],` +
+				`"AttributeBaseStrength":"25","Bot":{"Build":"<\"quoted\">\n"}}` + "\n",
+		},
+		{
+			TestName:   "LastWins",
+			Duplicates: kv.JSONDuplicatesLastWins,
+			Expected: `{"Model":"models/heroes/axe/axe.vmdl","Ability1":"axe_battle_hunger",` +
+				`"AttributeBaseStrength":"25","Bot":{"Build":"<\"quoted\">\n"}}` + "\n",
+		},
+		{
+			TestName:   "Pairs",
+			Duplicates: kv.JSONDuplicatesPairs,
+			Expected: `[["Model","models/heroes/axe/axe.vmdl"],["Ability1","axe_berserkers_call"],` +
+				`["AttributeBaseStrength","25"],["Ability1","axe_battle_hunger"],` +
+				`["Bot",[["Build","<\"quoted\">\n"]]]]` + "\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		s.Run(testCase.TestName, func() {
+			actual := s.encode(func(b *bytes.Buffer) *kv.JSONEncoder {
+				return kv.NewJSONEncoder(b).Duplicates(testCase.Duplicates)
+			}, s.hero())
+
+			s.Require().Equal(testCase.Expected, actual)
+		})
+	}
+}
+
+func (s *JSONEncoderSuite) TestEncodeTyped() {
+	require := s.Require()
+
+	root := kv.NewKeyValueRoot("").
+		AddString("string", "1").
+		AddInt32("int32", "-1").
+		AddInt64("int64", "-9223372036854775808").
+		AddUint64("uint64", "18446744073709551615").
+		AddFloat32("float32", "1.5").
+		AddFloat32("nan", "nan").
+		AddColor("color", "255").
+		AddPointer("pointer", "0").
+		AddNull("null").
+		AddBool("bool", "1").
+		AddDouble("double", "1e21").
+		AddBinary("binary", "00ff").
+		AddChild(kv.NewKeyValueArray("array", nil).
+			AddInt32("", "1").
+			AddInt32("", "2"))
+
+	plain := s.encode(func(b *bytes.Buffer) *kv.JSONEncoder { return kv.NewJSONEncoder(b) }, root)
+	typed := s.encode(func(b *bytes.Buffer) *kv.JSONEncoder { return kv.NewJSONEncoder(b).Typed() }, root)
+
+	require.Equal(`{"string":"1","int32":"-1","int64":"-9223372036854775808",`+
+		`"uint64":"18446744073709551615","float32":"1.5","nan":"nan","color":"255","pointer":"0",`+
+		`"null":null,"bool":"1","double":"1e21","binary":"00ff","array":["1","2"]}`+"\n", plain)
+
+	require.Equal(`{"string":"1","int32":-1,"int64":-9223372036854775808,`+
+		`"uint64":"18446744073709551615","float32":1.5,"nan":"nan","color":255,"pointer":0,`+
+		`"null":null,"bool":true,"double":1e+21,"binary":"00ff","array":[1,2]}`+"\n", typed)
+
+	err := kv.NewJSONEncoder(&bytes.Buffer{}).Typed().Encode(kv.NewKeyValueRoot("").AddInt32("int32", "x"))
+
+	require.Error(err)
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+}
+
+func (s *JSONEncoderSuite) TestEncodeIndent() {
+	root := kv.NewKeyValueRoot("").
+		AddString("Model", "axe.vmdl").
+		AddChild(kv.NewKeyValueArray("Roles", nil).AddString("", "Initiator"))
+
+	actual := s.encode(func(b *bytes.Buffer) *kv.JSONEncoder { return kv.NewJSONEncoder(b).Indent("", "  ") }, root)
+
+	s.Require().Equal(`{
+  "Model": "axe.vmdl",
+  "Roles": [
+    "Initiator"
+  ]
+}
+`, actual)
+}
+
+func (s *JSONEncoderSuite) TestEncodeAnnotated() {
+	root := kv.NewKeyValueRoot("DOTAHeroes").
+		AddInt32("Version", "1").
+		AddString("Model", "axe.vmdl").
+		AddChild(kv.NewKeyValueObject("Empty", nil))
+
+	root.Child("Model").SetFlag(kv.FlagResource)
+
+	actual := s.encode(func(b *bytes.Buffer) *kv.JSONEncoder { return kv.NewJSONEncoder(b).Annotated() }, root)
+
+	s.Require().Equal(`{"key":"DOTAHeroes","type":"Object","children":[`+
+		`{"key":"Version","type":"Int32","value":"1"},`+
+		`{"key":"Model","type":"String","flag":"resource","value":"axe.vmdl"},`+
+		`{"key":"Empty","type":"Object"}]}`+"\n", actual)
+}
+
+func (s *JSONEncoderSuite) TestEncodeUnsupportedType() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("").AddChild(kv.NewKeyValue(kv.TypeEnd, "end", "", nil))
+
+	err := kv.NewJSONEncoder(&bytes.Buffer{}).Encode(root)
+
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+
+	err = kv.NewJSONEncoder(&bytes.Buffer{}).Annotated().Encode(root)
+
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+}
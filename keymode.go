@@ -0,0 +1,72 @@
+package kv
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// KeyMode represents how keys are compared when looking up child nodes.
+type KeyMode uint8
+
+// Key comparison modes.
+const (
+	// KeyModeExact compares keys exactly. It's the default mode.
+	KeyModeExact KeyMode = iota
+	// KeyModeCaseInsensitive compares keys under Unicode case-folding, like Valve's own KeyValues
+	// implementation does.
+	KeyModeCaseInsensitive
+)
+
+var keyModeNames = [...]string{
+	KeyModeExact:           "exact",
+	KeyModeCaseInsensitive: "case-insensitive",
+}
+
+// Equal reports whether keys a and b are equal under the mode.
+func (m KeyMode) Equal(a, b string) bool {
+	if m == KeyModeCaseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+
+	return a == b
+}
+
+// String returns the mode name.
+func (m KeyMode) String() string {
+	if int(m) < len(keyModeNames) {
+		return keyModeNames[m]
+	}
+
+	return "KeyMode(" + strconv.Itoa(int(m)) + ")"
+}
+
+// fold returns a canonical form of key under the mode, such that Equal(a, b) if and only if
+// fold(a) == fold(b).
+func (m KeyMode) fold(key string) string {
+	if m != KeyModeCaseInsensitive {
+		return key
+	}
+
+	for i := 0; i < len(key); i++ {
+		if key[i] >= utf8.RuneSelf {
+			return strings.Map(foldRune, key)
+		}
+	}
+
+	return strings.ToUpper(key)
+}
+
+// foldRune returns the smallest rune equivalent to r under Unicode simple case-folding.
+func foldRune(r rune) rune {
+	min := r
+
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < min {
+			min = f
+		}
+	}
+
+	return min
+}
@@ -6,11 +6,16 @@ package kv
 import (
 	"bytes"
 	"encoding"
-	"fmt"
+	"encoding/hex"
 	"strconv"
+	"sync/atomic"
 )
 
 // KeyValue represents a node in a KeyValue tree.
+//
+// A tree is not safe for concurrent modification: methods modifying any of its nodes must not be
+// called concurrently with other methods on the tree. Concurrent read-only use is safe, including
+// lookups of children, which may build a key index.
 type KeyValue interface {
 	// Type returns the node's Type.
 	Type() Type
@@ -36,6 +41,13 @@ type KeyValue interface {
 	AsColor() (int32, error)
 	// AsPointer returns Value as int32 if Type is TypePointer, otherwise returns an error.
 	AsPointer() (int32, error)
+	// AsBool returns Value as bool if Type is TypeBool, otherwise returns an error.
+	AsBool() (bool, error)
+	// AsDouble returns Value as float64 if Type is TypeDouble, otherwise returns an error.
+	AsDouble() (float64, error)
+	// AsBinary returns the hex-encoded Value as bytes if Type is TypeBinary, otherwise returns an
+	// error.
+	AsBinary() ([]byte, error)
 	// SetValue sets the node's Value and returns the receiver.
 	SetValue(value string) KeyValue
 	// SetString sets Value to given string value if Type is TypeString, otherwise returns an error.
@@ -52,22 +64,132 @@ type KeyValue interface {
 	SetColor(int32) error
 	// SetPointer sets Value to given int32 value if Type is TypePointer, otherwise returns an error.
 	SetPointer(int32) error
+	// SetBool sets Value to given bool value if Type is TypeBool, otherwise returns an error.
+	SetBool(bool) error
+	// SetDouble sets Value to given float64 value if Type is TypeDouble, otherwise returns an error.
+	SetDouble(float64) error
+	// SetBinary sets Value to given bytes, hex-encoded, if Type is TypeBinary, otherwise returns an
+	// error.
+	SetBinary([]byte) error
+	// Flag returns the node's KeyValues3 value flag.
+	Flag() Flag
+	// SetFlag sets the node's KeyValues3 value flag and returns the receiver.
+	SetFlag(Flag) KeyValue
+	// Position returns the source position of the node's key, if known.
+	Position() Position
+	// ValuePosition returns the source position of the node's value, if known.
+	ValuePosition() Position
+	// SetPosition sets the source positions of the node's key and value and returns the receiver.
+	SetPosition(key, value Position) KeyValue
+	// Syntax returns the node's source text, if the node was decoded in lossless mode.
+	Syntax() *Syntax
+	// SetSyntax sets the node's source text and returns the receiver.
+	SetSyntax(*Syntax) KeyValue
 	// Parent returns the parent node.
 	Parent() KeyValue
 	// SetParent sets the node's parent node and returns the receiver.
+	//
+	// SetParent only sets the node's parent pointer, it doesn't add the node to the children of
+	// the new parent nor remove it from the children of the previous parent. Use the parent's
+	// AddChild or InsertChild to move a node, and Detach to remove it from its parent.
 	SetParent(KeyValue) KeyValue
 	// Children returns all child nodes
 	Children() []KeyValue
 	// SetChildren sets the node's children and returns the receiver.
+	//
+	// The given nodes are removed from their previous parents, and the previous children that are
+	// not in the given list are left without a parent.
 	SetChildren(...KeyValue) KeyValue
-	// Child finds a child node with the given key.
+	// Child finds a child node with the given key, compared according to the node's KeyMode.
+	//
+	// Lookups in nodes with many children use an index of the children keys, built by the first
+	// lookup and kept up to date as children are added, removed or renamed (see SetChildIndex).
 	Child(key string) KeyValue
+	// ChildrenByKey returns all child nodes with the given key, compared according to the node's
+	// KeyMode, in order.
+	ChildrenByKey(key string) []KeyValue
+	// ChildMode finds a child node with the given key, compared according to the given mode
+	// instead of the node's KeyMode.
+	ChildMode(key string, mode KeyMode) KeyValue
+	// SetChildIndex enables or disables the key index used by lookups of the node's children, and
+	// returns the receiver.
+	//
+	// The index is enabled by default, and built by the first lookup once the node has enough
+	// children for a linear scan to be slower. Disabling it discards the index, saving its memory
+	// in nodes whose children are looked up only a few times.
+	SetChildIndex(enabled bool) KeyValue
+	// KeyMode returns the mode used to compare keys when looking up child nodes (with Child, paths
+	// and queries).
+	//
+	// Unless set with SetKeyMode, a node uses the mode of its parent, and root nodes use
+	// KeyModeExact.
+	KeyMode() KeyMode
+	// SetKeyMode sets the mode used to compare keys when looking up child nodes in the node and in
+	// descendants which don't set their own mode, and returns the receiver.
+	//
+	// The mode doesn't change the keys themselves, so their original spelling is preserved.
+	SetKeyMode(KeyMode) KeyValue
+	// Get finds the node referenced by path (see ParsePath), relative to the receiver.
+	//
+	// Returns a *PathError if a node in the path is missing or is neither an Object nor an Array.
+	Get(path string) (KeyValue, error)
+	// Set sets the type and value of the node referenced by path (see ParsePath), relative to the
+	// receiver, and returns the node.
+	//
+	// Missing nodes in the path are created as Object nodes. Array elements can be appended by
+	// referencing the index following the last element. Returns a *PathError if a node in the path
+	// is neither an Object nor an Array.
+	Set(path string, t Type, value string) (KeyValue, error)
+	// Delete removes the node referenced by path (see ParsePath), relative to the receiver, from
+	// its parent and returns the removed node.
+	//
+	// Returns a *PathError if a node in the path is missing or is neither an Object nor an Array.
+	Delete(path string) (KeyValue, error)
+	// Query evaluates a query (see Query) against the receiver and returns the matched nodes.
+	//
+	// Returns a *QueryError if the query is malformed.
+	Query(query string) ([]QueryMatch, error)
+	// Index returns the child node at the given index, or nil if the index is out of range.
+	//
+	// It's meant for Array nodes, whose children have no keys.
+	Index(i int) KeyValue
 	// NewChild creates an empty child node and returns the child node.
 	NewChild() KeyValue
-	// AddChild adds a child node and returns the receiver.
+	// AddChild adds a child node after the last child and returns the receiver.
+	//
+	// The child is removed from its previous parent first, so adding a node that is already a child
+	// of the receiver moves it to the end.
 	AddChild(KeyValue) KeyValue
+	// InsertChild inserts a child node at index i, shifting the following children, and returns the
+	// receiver.
+	//
+	// The child is removed from its previous parent first, and i is an index in the remaining
+	// children. Indexes below zero insert the child first, and indexes past the last child append
+	// it.
+	InsertChild(i int, c KeyValue) KeyValue
+	// MoveChild moves the child node at index from to index to, shifting the children in between,
+	// and returns the receiver.
+	//
+	// Does nothing if from is out of range. Indexes below zero move the child first, and indexes
+	// past the last child move it last.
+	MoveChild(from, to int) KeyValue
+	// RemoveChild removes the given node from the node's children, if it's a child node, and
+	// returns the receiver. The removed node is left without a parent.
+	RemoveChild(KeyValue) KeyValue
+	// RemoveIndex removes the child node at index i and returns it, or returns nil if the index is
+	// out of range. The removed node is left without a parent.
+	RemoveIndex(i int) KeyValue
+	// Detach removes the node from its parent's children and returns the receiver.
+	Detach() KeyValue
+	// Clone returns a deep copy of the node and its descendants.
+	//
+	// The returned node has no parent and shares no state with the receiver, but keeps the
+	// receiver's KeyMode.
+	Clone() KeyValue
 	// AddObject adds an Object child node and returns the receiver.
 	AddObject(key string) KeyValue
+	// AddArray adds an Array child node and returns the receiver.
+	AddArray(key string) KeyValue
 	// AddString adds a String child node and returns the receiver.
 	AddString(key, value string) KeyValue
 	// AddInt32 adds an Int32 child node and returns the receiver.
@@ -82,6 +204,14 @@ type KeyValue interface {
 	AddColor(key, value string) KeyValue
 	// AddPointer adds a Pointer child node and returns the receiver.
 	AddPointer(key, value string) KeyValue
+	// AddNull adds a Null child node and returns the receiver.
+	AddNull(key string) KeyValue
+	// AddBool adds a Bool child node and returns the receiver.
+	AddBool(key, value string) KeyValue
+	// AddDouble adds a Double child node and returns the receiver.
+	AddDouble(key, value string) KeyValue
+	// AddBinary adds a Binary child node, with hex-encoded value, and returns the receiver.
+	AddBinary(key, value string) KeyValue
 
 	encoding.BinaryMarshaler
 	encoding.BinaryUnmarshaler
@@ -95,6 +225,15 @@ type keyValue struct {
 	value    string
 	parent   KeyValue
 	children []KeyValue
+	flag     Flag
+	keyPos   Position
+	valuePos Position
+	syntax   *Syntax
+	keyMode  *KeyMode
+	// index is the key index of the children (a *childIndex), swapped atomically so that
+	// concurrent lookups building it are safe
+	index   atomic.Value
+	noIndex bool
 
 	vInt32   *int32
 	vFloat32 *float32
@@ -102,15 +241,16 @@ type keyValue struct {
 	vColor   *int32
 	vUint64  *uint64
 	vInt64   *int64
+	vBool    *bool
+	vDouble  *float64
 }
 
 // NewKeyValue creates a KeyValue node.
 func NewKeyValue(t Type, key, value string, parent KeyValue) KeyValue {
 	kv := &keyValue{
-		typ:    t,
-		key:    key,
-		value:  value,
-		parent: parent,
+		typ:   t,
+		key:   key,
+		value: value,
 	}
 
 	if parent != nil {
@@ -135,6 +275,11 @@ func NewKeyValueObject(key string, parent KeyValue) KeyValue {
 	return NewKeyValue(TypeObject, key, "", parent)
 }
 
+// NewKeyValueArray creates a KeyValue node with TypeArray type.
+func NewKeyValueArray(key string, parent KeyValue) KeyValue {
+	return NewKeyValue(TypeArray, key, "", parent)
+}
+
 // NewKeyValueString creates a KeyValue node with TypeString type.
 func NewKeyValueString(key, value string, parent KeyValue) KeyValue {
 	return NewKeyValue(TypeString, key, value, parent)
@@ -170,6 +315,26 @@ func NewKeyValuePointer(key, value string, parent KeyValue) KeyValue {
 	return NewKeyValue(TypePointer, key, value, parent)
 }
 
+// NewKeyValueNull creates a KeyValue node with TypeNull type.
+func NewKeyValueNull(key string, parent KeyValue) KeyValue {
+	return NewKeyValue(TypeNull, key, "", parent)
+}
+
+// NewKeyValueBool creates a KeyValue node with TypeBool type.
+func NewKeyValueBool(key, value string, parent KeyValue) KeyValue {
+	return NewKeyValue(TypeBool, key, value, parent)
+}
+
+// NewKeyValueDouble creates a KeyValue node with TypeDouble type.
+func NewKeyValueDouble(key, value string, parent KeyValue) KeyValue {
+	return NewKeyValue(TypeDouble, key, value, parent)
+}
+
+// NewKeyValueBinary creates a KeyValue node with TypeBinary type and hex-encoded value.
+func NewKeyValueBinary(key, value string, parent KeyValue) KeyValue {
+	return NewKeyValue(TypeBinary, key, value, parent)
+}
+
 func (kv *keyValue) resetValues() {
 	kv.vInt32 = nil
 	kv.vFloat32 = nil
@@ -177,6 +342,8 @@ func (kv *keyValue) resetValues() {
 	kv.vColor = nil
 	kv.vUint64 = nil
 	kv.vInt64 = nil
+	kv.vBool = nil
+	kv.vDouble = nil
 }
 
 func (kv *keyValue) Type() Type { return kv.typ }
@@ -190,6 +357,11 @@ func (kv *keyValue) SetType(t Type) KeyValue {
 func (kv *keyValue) Key() string { return kv.key }
 func (kv *keyValue) SetKey(k string) KeyValue {
 	kv.key = k
+
+	if p, ok := kv.parent.(*keyValue); ok {
+		p.resetChildIndex()
+	}
+
 	return kv
 }
 
@@ -201,9 +373,24 @@ func (kv *keyValue) SetValue(v string) KeyValue {
 	return kv
 }
 
+// typeError returns a TypeError for the given operation on the node.
+//
+// A nil err means a type mismatch.
+func (kv *keyValue) typeError(op string, target Type, err error) *TypeError {
+	e := &TypeError{Op: op, Key: kv.key, Type: kv.typ, Target: target, Err: err}
+
+	if err == nil {
+		e.Err = ErrTypeMismatch
+	} else {
+		e.Value = kv.value
+	}
+
+	return e
+}
+
 func (kv *keyValue) AsString() (string, error) {
 	if kv.typ != TypeString {
-		return "", fmt.Errorf("kv: cannot convert Value of type %s to %s", kv.typ, TypeString)
+		return "", kv.typeError(OpConvert, TypeString, nil)
 	}
 
 	return kv.value, nil
@@ -214,7 +401,7 @@ func (kv *keyValue) asInt32(p **int32) (int32, error) {
 		n, err := strconv.ParseInt(kv.value, 10, 32)
 
 		if err != nil {
-			return 0, err
+			return 0, kv.typeError(OpConvert, kv.typ, err)
 		}
 
 		n32 := int32(n)
@@ -226,7 +413,7 @@ func (kv *keyValue) asInt32(p **int32) (int32, error) {
 
 func (kv *keyValue) AsInt32() (int32, error) {
 	if kv.typ != TypeInt32 {
-		return 0, fmt.Errorf("kv: cannot convert Value of type %s to %s", kv.typ, TypeInt32)
+		return 0, kv.typeError(OpConvert, TypeInt32, nil)
 	}
 
 	return kv.asInt32(&kv.vInt32)
@@ -234,14 +421,14 @@ func (kv *keyValue) AsInt32() (int32, error) {
 
 func (kv *keyValue) AsInt64() (int64, error) {
 	if kv.typ != TypeInt64 {
-		return 0, fmt.Errorf("kv: cannot convert Value of type %s to %s", kv.typ, TypeInt64)
+		return 0, kv.typeError(OpConvert, TypeInt64, nil)
 	}
 
 	if kv.vInt64 == nil {
 		n, err := strconv.ParseInt(kv.value, 10, 64)
 
 		if err != nil {
-			return 0, err
+			return 0, kv.typeError(OpConvert, kv.typ, err)
 		}
 
 		kv.vInt64 = &n
@@ -252,14 +439,14 @@ func (kv *keyValue) AsInt64() (int64, error) {
 
 func (kv *keyValue) AsUint64() (uint64, error) {
 	if kv.typ != TypeUint64 {
-		return 0, fmt.Errorf("kv: cannot convert Value of type %s to %s", kv.typ, TypeUint64)
+		return 0, kv.typeError(OpConvert, TypeUint64, nil)
 	}
 
 	if kv.vUint64 == nil {
 		n, err := strconv.ParseUint(kv.value, 10, 64)
 
 		if err != nil {
-			return 0, err
+			return 0, kv.typeError(OpConvert, kv.typ, err)
 		}
 
 		kv.vUint64 = &n
@@ -270,14 +457,14 @@ func (kv *keyValue) AsUint64() (uint64, error) {
 
 func (kv *keyValue) AsFloat32() (float32, error) {
 	if kv.typ != TypeFloat32 {
-		return 0, fmt.Errorf("kv: cannot convert Value of type %s to %s", kv.typ, TypeFloat32)
+		return 0, kv.typeError(OpConvert, TypeFloat32, nil)
 	}
 
 	if kv.vFloat32 == nil {
 		n, err := strconv.ParseFloat(kv.value, 32)
 
 		if err != nil {
-			return 0, err
+			return 0, kv.typeError(OpConvert, kv.typ, err)
 		}
 
 		n32 := float32(n)
@@ -289,7 +476,7 @@ func (kv *keyValue) AsFloat32() (float32, error) {
 
 func (kv *keyValue) AsColor() (int32, error) {
 	if kv.typ != TypeColor {
-		return 0, fmt.Errorf("kv: cannot convert Value of type %s to %s", kv.typ, TypeColor)
+		return 0, kv.typeError(OpConvert, TypeColor, nil)
 	}
 
 	return kv.asInt32(&kv.vColor)
@@ -297,15 +484,96 @@ func (kv *keyValue) AsColor() (int32, error) {
 
 func (kv *keyValue) AsPointer() (int32, error) {
 	if kv.typ != TypePointer {
-		return 0, fmt.Errorf("kv: cannot convert Value of type %s to %s", kv.typ, TypePointer)
+		return 0, kv.typeError(OpConvert, TypePointer, nil)
 	}
 
 	return kv.asInt32(&kv.vPointer)
 }
 
+func (kv *keyValue) AsBool() (bool, error) {
+	if kv.typ != TypeBool {
+		return false, kv.typeError(OpConvert, TypeBool, nil)
+	}
+
+	if kv.vBool == nil {
+		b, err := strconv.ParseBool(kv.value)
+
+		if err != nil {
+			return false, kv.typeError(OpConvert, kv.typ, err)
+		}
+
+		kv.vBool = &b
+	}
+
+	return *kv.vBool, nil
+}
+
+func (kv *keyValue) AsDouble() (float64, error) {
+	if kv.typ != TypeDouble {
+		return 0, kv.typeError(OpConvert, TypeDouble, nil)
+	}
+
+	if kv.vDouble == nil {
+		n, err := strconv.ParseFloat(kv.value, 64)
+
+		if err != nil {
+			return 0, kv.typeError(OpConvert, kv.typ, err)
+		}
+
+		kv.vDouble = &n
+	}
+
+	return *kv.vDouble, nil
+}
+
+func (kv *keyValue) AsBinary() ([]byte, error) {
+	if kv.typ != TypeBinary {
+		return nil, kv.typeError(OpConvert, TypeBinary, nil)
+	}
+
+	b, err := hex.DecodeString(kv.value)
+
+	if err != nil {
+		return nil, kv.typeError(OpConvert, kv.typ, err)
+	}
+
+	return b, nil
+}
+
+// scalarValue returns the value of the scalar node kv, converted to the Go type of its node type:
+// string, int32, int64, uint64, float32, float64, bool, []byte or nil (for Null nodes).
+func scalarValue(kv KeyValue) (interface{}, error) {
+	switch kv.Type() {
+	case TypeString, TypeWString:
+		return kv.Value(), nil
+	case TypeInt32:
+		return kv.AsInt32()
+	case TypeColor:
+		return kv.AsColor()
+	case TypePointer:
+		return kv.AsPointer()
+	case TypeInt64:
+		return kv.AsInt64()
+	case TypeUint64:
+		return kv.AsUint64()
+	case TypeFloat32:
+		return kv.AsFloat32()
+	case TypeDouble:
+		return kv.AsDouble()
+	case TypeBool:
+		return kv.AsBool()
+	case TypeBinary:
+		return kv.AsBinary()
+	case TypeNull:
+		return nil, nil
+	default:
+		return nil, &TypeError{Op: OpConvert, Key: kv.Key(), Type: kv.Type(), Err: ErrUnsupportedType}
+	}
+}
+
 func (kv *keyValue) SetString(v string) error {
 	if kv.typ != TypeString {
-		return fmt.Errorf("cannot set Value of type %s with value of type %s", kv.typ, TypeString)
+		return kv.typeError(OpSet, TypeString, nil)
 	}
 
 	kv.value = v
@@ -315,7 +583,7 @@ func (kv *keyValue) SetString(v string) error {
 
 func (kv *keyValue) SetInt32(v int32) error {
 	if kv.typ != TypeInt32 {
-		return fmt.Errorf("cannot set Value of type %s with value of type %s", kv.typ, TypeInt32)
+		return kv.typeError(OpSet, TypeInt32, nil)
 	}
 
 	kv.vInt32 = &v
@@ -326,7 +594,7 @@ func (kv *keyValue) SetInt32(v int32) error {
 
 func (kv *keyValue) SetInt64(v int64) error {
 	if kv.typ != TypeInt64 {
-		return fmt.Errorf("cannot set Value of type %s with value of type %s", kv.typ, TypeInt64)
+		return kv.typeError(OpSet, TypeInt64, nil)
 	}
 
 	kv.vInt64 = &v
@@ -337,7 +605,7 @@ func (kv *keyValue) SetInt64(v int64) error {
 
 func (kv *keyValue) SetUint64(v uint64) error {
 	if kv.typ != TypeUint64 {
-		return fmt.Errorf("cannot set Value of type %s with value of type %s", kv.typ, TypeUint64)
+		return kv.typeError(OpSet, TypeUint64, nil)
 	}
 
 	kv.vUint64 = &v
@@ -348,7 +616,7 @@ func (kv *keyValue) SetUint64(v uint64) error {
 
 func (kv *keyValue) SetFloat32(v float32) error {
 	if kv.typ != TypeFloat32 {
-		return fmt.Errorf("cannot set Value of type %s with value of type %s", kv.typ, TypeFloat32)
+		return kv.typeError(OpSet, TypeFloat32, nil)
 	}
 
 	kv.vFloat32 = &v
@@ -359,7 +627,7 @@ func (kv *keyValue) SetFloat32(v float32) error {
 
 func (kv *keyValue) SetColor(v int32) error {
 	if kv.typ != TypeColor {
-		return fmt.Errorf("cannot set Value of type %s with value of type %s", kv.typ, TypeColor)
+		return kv.typeError(OpSet, TypeColor, nil)
 	}
 
 	kv.vColor = &v
@@ -370,7 +638,7 @@ func (kv *keyValue) SetColor(v int32) error {
 
 func (kv *keyValue) SetPointer(v int32) error {
 	if kv.typ != TypePointer {
-		return fmt.Errorf("cannot set Value of type %s with value of type %s", kv.typ, TypePointer)
+		return kv.typeError(OpSet, TypePointer, nil)
 	}
 
 	kv.vPointer = &v
@@ -379,6 +647,59 @@ func (kv *keyValue) SetPointer(v int32) error {
 	return nil
 }
 
+func (kv *keyValue) SetBool(v bool) error {
+	if kv.typ != TypeBool {
+		return kv.typeError(OpSet, TypeBool, nil)
+	}
+
+	kv.vBool = &v
+	kv.value = strconv.FormatBool(v)
+
+	return nil
+}
+
+func (kv *keyValue) SetDouble(v float64) error {
+	if kv.typ != TypeDouble {
+		return kv.typeError(OpSet, TypeDouble, nil)
+	}
+
+	kv.vDouble = &v
+	kv.value = strconv.FormatFloat(v, 'g', -1, 64)
+
+	return nil
+}
+
+func (kv *keyValue) SetBinary(v []byte) error {
+	if kv.typ != TypeBinary {
+		return kv.typeError(OpSet, TypeBinary, nil)
+	}
+
+	kv.value = hex.EncodeToString(v)
+
+	return nil
+}
+
+func (kv *keyValue) Flag() Flag { return kv.flag }
+func (kv *keyValue) SetFlag(f Flag) KeyValue {
+	kv.flag = f
+	return kv
+}
+
+func (kv *keyValue) Position() Position      { return kv.keyPos }
+func (kv *keyValue) ValuePosition() Position { return kv.valuePos }
+func (kv *keyValue) SetPosition(key, value Position) KeyValue {
+	kv.keyPos = key
+	kv.valuePos = value
+
+	return kv
+}
+
+func (kv *keyValue) Syntax() *Syntax { return kv.syntax }
+func (kv *keyValue) SetSyntax(s *Syntax) KeyValue {
+	kv.syntax = s
+	return kv
+}
+
 func (kv *keyValue) Parent() KeyValue { return kv.parent }
 func (kv *keyValue) SetParent(p KeyValue) KeyValue {
 	kv.parent = p
@@ -387,18 +708,71 @@ func (kv *keyValue) SetParent(p KeyValue) KeyValue {
 
 func (kv *keyValue) Children() []KeyValue { return kv.children }
 func (kv *keyValue) SetChildren(children ...KeyValue) KeyValue {
+	for _, c := range kv.children {
+		if c.Parent() == KeyValue(kv) {
+			c.SetParent(nil)
+		}
+	}
+
 	for _, c := range children {
-		c.SetParent(kv)
+		c.Detach().SetParent(kv)
 	}
 
 	kv.children = children
+	kv.resetChildIndex()
 
 	return kv
 }
 
 func (kv *keyValue) Child(key string) KeyValue {
+	return kv.indexedChild(key, kv.KeyMode())
+}
+
+func (kv *keyValue) ChildMode(key string, mode KeyMode) KeyValue {
+	if mode == kv.KeyMode() {
+		return kv.indexedChild(key, mode)
+	}
+
+	return kv.scanChild(key, mode)
+}
+
+func (kv *keyValue) ChildrenByKey(key string) []KeyValue {
+	mode := kv.KeyMode()
+
+	if idx := kv.childIndex(mode); idx != nil {
+		return append([]KeyValue(nil), idx.lookup(key)...)
+	}
+
+	var children []KeyValue
+
 	for _, c := range kv.children {
-		if c.Key() == key {
+		if mode.Equal(c.Key(), key) {
+			children = append(children, c)
+		}
+	}
+
+	return children
+}
+
+// indexedChild finds a child node using the key index, if the node has enough children to be
+// indexed.
+func (kv *keyValue) indexedChild(key string, mode KeyMode) KeyValue {
+	idx := kv.childIndex(mode)
+
+	if idx == nil {
+		return kv.scanChild(key, mode)
+	}
+
+	if children := idx.lookup(key); len(children) > 0 {
+		return children[0]
+	}
+
+	return nil
+}
+
+func (kv *keyValue) scanChild(key string, mode KeyMode) KeyValue {
+	for _, c := range kv.children {
+		if mode.Equal(c.Key(), key) {
 			return c
 		}
 	}
@@ -406,23 +780,180 @@ func (kv *keyValue) Child(key string) KeyValue {
 	return nil
 }
 
+func (kv *keyValue) KeyMode() KeyMode {
+	switch {
+	case kv.keyMode != nil:
+		return *kv.keyMode
+	case kv.parent != nil:
+		return kv.parent.KeyMode()
+	default:
+		return KeyModeExact
+	}
+}
+
+func (kv *keyValue) SetKeyMode(m KeyMode) KeyValue {
+	kv.keyMode = &m
+	return kv
+}
+
+func (kv *keyValue) Index(i int) KeyValue {
+	if i < 0 || i >= len(kv.children) {
+		return nil
+	}
+
+	return kv.children[i]
+}
+
 func (kv *keyValue) NewChild() KeyValue {
 	return NewKeyValue(TypeInvalid, "", "", kv)
 }
 
 func (kv *keyValue) AddChild(c KeyValue) KeyValue {
-	c.SetParent(kv)
+	c.Detach().SetParent(kv)
 
 	kv.children = append(kv.children, c)
 
+	if idx, _ := kv.index.Load().(*childIndex); idx != nil {
+		idx.add(c)
+	}
+
+	return kv
+}
+
+// Children slices are never modified in place by the following methods, so that slices previously
+// returned by Children remain unchanged.
+
+func (kv *keyValue) InsertChild(i int, c KeyValue) KeyValue {
+	c.Detach()
+
+	if i < 0 {
+		i = 0
+	}
+
+	if i > len(kv.children) {
+		i = len(kv.children)
+	}
+
+	children := make([]KeyValue, 0, len(kv.children)+1)
+	children = append(children, kv.children[:i]...)
+	children = append(children, c)
+	children = append(children, kv.children[i:]...)
+
+	c.SetParent(kv)
+
+	kv.children = children
+	kv.resetChildIndex()
+
+	return kv
+}
+
+func (kv *keyValue) MoveChild(from, to int) KeyValue {
+	if c := kv.Index(from); c != nil {
+		kv.InsertChild(to, c)
+	}
+
+	return kv
+}
+
+func (kv *keyValue) RemoveChild(c KeyValue) KeyValue {
+	for i, child := range kv.children {
+		if child == c {
+			kv.RemoveIndex(i)
+			break
+		}
+	}
+
+	return kv
+}
+
+func (kv *keyValue) RemoveIndex(i int) KeyValue {
+	c := kv.Index(i)
+
+	if c == nil {
+		return nil
+	}
+
+	children := make([]KeyValue, 0, len(kv.children)-1)
+	children = append(children, kv.children[:i]...)
+	children = append(children, kv.children[i+1:]...)
+
+	c.SetParent(nil)
+
+	kv.children = children
+	kv.resetChildIndex()
+
+	return c
+}
+
+func (kv *keyValue) Detach() KeyValue {
+	if kv.parent != nil {
+		kv.parent.RemoveChild(kv)
+		kv.parent = nil
+	}
+
 	return kv
 }
 
+func (kv *keyValue) Clone() KeyValue {
+	c := kv.clone()
+
+	if c.keyMode == nil && kv.parent != nil {
+		c.SetKeyMode(kv.KeyMode())
+	}
+
+	return c
+}
+
+func (kv *keyValue) clone() *keyValue {
+	c := &keyValue{
+		typ:      kv.typ,
+		key:      kv.key,
+		value:    kv.value,
+		flag:     kv.flag,
+		keyPos:   kv.keyPos,
+		valuePos: kv.valuePos,
+		noIndex:  kv.noIndex,
+	}
+
+	if kv.syntax != nil {
+		syntax := *kv.syntax
+		c.syntax = &syntax
+	}
+
+	if kv.keyMode != nil {
+		c.SetKeyMode(*kv.keyMode)
+	}
+
+	if len(kv.children) > 0 {
+		c.children = make([]KeyValue, len(kv.children))
+
+		for i, child := range kv.children {
+			c.children[i] = cloneNode(child).SetParent(c)
+		}
+	}
+
+	return c
+}
+
+// cloneNode returns a deep copy of kv, without setting its inherited KeyMode (unlike Clone).
+func cloneNode(kv KeyValue) KeyValue {
+	if kv, ok := kv.(*keyValue); ok {
+		return kv.clone()
+	}
+
+	return kv.Clone()
+}
+
 func (kv *keyValue) AddObject(key string) KeyValue {
 	NewKeyValueObject(key, kv)
 	return kv
 }
 
+func (kv *keyValue) AddArray(key string) KeyValue {
+	NewKeyValueArray(key, kv)
+	return kv
+}
+
 func (kv *keyValue) AddString(key, value string) KeyValue {
 	NewKeyValueString(key, value, kv)
 	return kv
@@ -458,6 +989,26 @@ func (kv *keyValue) AddPointer(key, value string) KeyValue {
 	return kv
 }
 
+func (kv *keyValue) AddNull(key string) KeyValue {
+	NewKeyValueNull(key, kv)
+	return kv
+}
+
+func (kv *keyValue) AddBool(key, value string) KeyValue {
+	NewKeyValueBool(key, value, kv)
+	return kv
+}
+
+func (kv *keyValue) AddDouble(key, value string) KeyValue {
+	NewKeyValueDouble(key, value, kv)
+	return kv
+}
+
+func (kv *keyValue) AddBinary(key, value string) KeyValue {
+	NewKeyValueBinary(key, value, kv)
+	return kv
+}
+
 func (kv *keyValue) MarshalText() ([]byte, error) {
 	b := &bytes.Buffer{}
 
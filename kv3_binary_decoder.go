@@ -0,0 +1,637 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+
+	"github.com/13k/kv-go/internal/lz4"
+	"github.com/13k/kv-go/internal/zstd"
+)
+
+const (
+	kv3BinaryMagicLegacy = 0x03564b56 // "VKV\x03"
+	kv3BinaryMagicV1     = 0x4b563301 // "\x013VK"
+	kv3BinaryMagicMask   = 0xffffff00 // "3VK", with the version in the low byte
+	kv3BinaryTrailer     = 0xffeedd00
+
+	kv3BinaryEncoding = "binary"
+
+	kv3EncodingBinaryUncompressed = "1b860500-f7d8-40c1-ad82-75a48267e714"
+	kv3EncodingBinaryLZ4          = "6847348a-63a1-4f5c-a197-53806fd9b119"
+
+	kv3BinaryCompressionNone uint32 = 0
+	kv3BinaryCompressionLZ4  uint32 = 1
+	kv3BinaryCompressionZstd uint32 = 2
+
+	kv3BinaryGUIDSize = 16
+	kv3BinaryTypeMask = 0x3f
+	kv3BinaryFlagBit  = 0x80
+	kv3BinaryNoString = -1
+)
+
+// KeyValues3 binary node types.
+const (
+	kv3BinaryNull byte = iota + 1
+	kv3BinaryBool
+	kv3BinaryInt64
+	kv3BinaryUint64
+	kv3BinaryDouble
+	kv3BinaryString
+	kv3BinaryBlob
+	kv3BinaryArray
+	kv3BinaryObject
+	kv3BinaryTypedArray
+	kv3BinaryInt32
+	kv3BinaryUint32
+	kv3BinaryTrue
+	kv3BinaryFalse
+	kv3BinaryInt64Zero
+	kv3BinaryInt64One
+	kv3BinaryDoubleZero
+	kv3BinaryDoubleOne
+)
+
+// KV3BinaryDecoder reads and decodes binary-encoded KeyValues3 nodes from an input stream.
+//
+// Two layouts are supported: the legacy "VKV3" layout, uncompressed or LZ4-compressed, and the
+// version 1 "KV3" layout, uncompressed, LZ4 or zstd-compressed, with separate buffers for bytes,
+// 4-byte values, 8-byte values, strings and node types. Valve's block compression encoding of the
+// legacy layout is not supported, and the "KV3" layout versions 2 to 5 (which add compressed binary
+// blobs and further value buffers) return an error matching ErrUnsupportedVersion.
+type KV3BinaryDecoder struct {
+	r      io.Reader
+	header KV3Header
+}
+
+// NewKV3BinaryDecoder returns a new KeyValues3 binary decoder that reads from r.
+func NewKV3BinaryDecoder(r io.Reader) *KV3BinaryDecoder {
+	return &KV3BinaryDecoder{r: r}
+}
+
+// Header returns the header of the decoded data.
+//
+// The encoding name is always "binary", with the encoding GUID as version for the legacy layout.
+// The format name is only known for the generic format.
+func (d *KV3BinaryDecoder) Header() KV3Header {
+	return d.header
+}
+
+// Decode reads the binary-encoded KeyValues3 data from its input and stores its root node in the
+// value pointed to by kv.
+//
+// Node types are mapped as with KV3TextDecoder, except that 32-bit integers are decoded as
+// TypeInt32 (or TypeUint64, for unsigned integers) and binary blobs as TypeBinary nodes, with the
+// hex-encoded bytes as value.
+func (d *KV3BinaryDecoder) Decode(kv KeyValue) error {
+	data, err := ioutil.ReadAll(d.r)
+
+	if err != nil {
+		return err
+	}
+
+	in := &kv3Buffer{data: data}
+	magic, err := in.readUint32()
+
+	if err != nil {
+		return err
+	}
+
+	var r *kv3BinaryReader
+
+	switch magic {
+	case kv3BinaryMagicLegacy:
+		r, err = d.readLegacy(in)
+	case kv3BinaryMagicV1:
+		r, err = d.readV1(in)
+	case kv3BinaryMagicV1 + 1, kv3BinaryMagicV1 + 2, kv3BinaryMagicV1 + 3, kv3BinaryMagicV1 + 4:
+		err = &BinaryFormatError{Err: fmt.Errorf("%w %d", ErrUnsupportedVersion, magic&^kv3BinaryMagicMask)}
+	default:
+		err = &BinaryFormatError{Err: ErrUnsupportedFormat}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	typ, flag, err := r.readType()
+
+	if err != nil {
+		return err
+	}
+
+	kv.SetKey("")
+
+	return r.readValue(kv, typ, flag)
+}
+
+func (d *KV3BinaryDecoder) setHeader(encodingVersion, formatVersion string) {
+	d.header = KV3Header{
+		Encoding:        kv3BinaryEncoding,
+		EncodingVersion: encodingVersion,
+		FormatVersion:   formatVersion,
+	}
+
+	if formatVersion == KV3FormatGenericVersion {
+		d.header.Format = KV3FormatGeneric
+	}
+}
+
+// readLegacy reads the "VKV3" layout, where node types, values and keys are interleaved in a single
+// buffer, following the string table.
+func (d *KV3BinaryDecoder) readLegacy(in *kv3Buffer) (*kv3BinaryReader, error) {
+	encoding, err := in.readGUID()
+
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := in.readGUID()
+
+	if err != nil {
+		return nil, err
+	}
+
+	d.setHeader(encoding, format)
+
+	var buf *kv3Buffer
+
+	switch encoding {
+	case kv3EncodingBinaryUncompressed:
+		buf = in.slice(len(in.data) - in.off)
+	case kv3EncodingBinaryLZ4:
+		size, err := in.readUint32()
+
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := lz4.Decompress(in.data[in.off:], int(size))
+
+		if err != nil {
+			return nil, in.malformed(err)
+		}
+
+		buf = &kv3Buffer{data: data}
+	default:
+		return nil, &BinaryFormatError{Offset: in.offset() - kv3BinaryGUIDSize*2, Err: ErrUnsupportedFormat}
+	}
+
+	r := &kv3BinaryReader{bytes: buf, ints: buf, doubles: buf, types: buf, limit: len(buf.data)}
+
+	if err := r.readStrings(buf); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// readV1 reads the version 1 "KV3" layout.
+//
+// The (optionally compressed) data contains the bytes buffer, the 4-byte values buffer (aligned to 4
+// bytes, starting with the number of strings), the 8-byte values buffer (aligned to 8 bytes), the
+// string table, the node types buffer and a trailer.
+func (d *KV3BinaryDecoder) readV1(in *kv3Buffer) (*kv3BinaryReader, error) {
+	format, err := in.readGUID()
+
+	if err != nil {
+		return nil, err
+	}
+
+	d.setHeader("", format)
+
+	var header [5]uint32
+
+	for i := range header {
+		if header[i], err = in.readUint32(); err != nil {
+			return nil, err
+		}
+	}
+
+	compression, size := header[0], int(header[4])
+	bytesCount, intsCount, doublesCount := int(header[1]), int(header[2]), int(header[3])
+
+	var data *kv3Buffer
+
+	switch compression {
+	case kv3BinaryCompressionNone:
+		data = in.slice(len(in.data) - in.off)
+	case kv3BinaryCompressionLZ4:
+		b, err := lz4.Decompress(in.data[in.off:], size)
+
+		if err != nil {
+			return nil, in.malformed(err)
+		}
+
+		data = &kv3Buffer{data: b}
+	case kv3BinaryCompressionZstd:
+		b, err := zstd.Decompress(in.data[in.off:], size)
+
+		if err != nil {
+			return nil, in.malformed(err)
+		}
+
+		data = &kv3Buffer{data: b}
+	default:
+		return nil, &BinaryFormatError{Offset: in.offset() - 4*int64(len(header)), Err: ErrUnsupportedFormat}
+	}
+
+	if len(data.data) < size {
+		return nil, data.eof()
+	}
+
+	data.data = data.data[:size]
+
+	r := &kv3BinaryReader{limit: size}
+
+	if r.bytes, err = data.next(bytesCount); err != nil {
+		return nil, err
+	}
+
+	if err = data.align(4); err != nil {
+		return nil, err
+	}
+
+	if r.ints, err = data.next(intsCount * 4); err != nil {
+		return nil, err
+	}
+
+	if err = data.align(8); err != nil {
+		return nil, err
+	}
+
+	if r.doubles, err = data.next(doublesCount * 8); err != nil {
+		return nil, err
+	}
+
+	if err = r.readStrings(data); err != nil {
+		return nil, err
+	}
+
+	if r.types, err = data.next(len(data.data) - data.off - 4); err != nil {
+		return nil, err
+	}
+
+	trailer := data.offset()
+
+	if n, err := data.readUint32(); err != nil {
+		return nil, err
+	} else if n != kv3BinaryTrailer {
+		return nil, &BinaryFormatError{
+			Offset: trailer,
+			Err:    fmt.Errorf("%w: invalid trailer 0x%08x", ErrMalformed, n),
+		}
+	}
+
+	return r, nil
+}
+
+// kv3Buffer is a cursor over a section of the input.
+type kv3Buffer struct {
+	data []byte
+	off  int
+	// base is the offset of data in the input (or decompressed data)
+	base int64
+}
+
+func (b *kv3Buffer) offset() int64 {
+	return b.base + int64(b.off)
+}
+
+func (b *kv3Buffer) eof() *BinaryFormatError {
+	return &BinaryFormatError{Offset: b.offset(), Err: io.ErrUnexpectedEOF}
+}
+
+func (b *kv3Buffer) malformed(err error) *BinaryFormatError {
+	return &BinaryFormatError{Offset: b.offset(), Err: fmt.Errorf("%w: %v", ErrMalformed, err)}
+}
+
+func (b *kv3Buffer) read(n int) ([]byte, error) {
+	if n < 0 || n > len(b.data)-b.off {
+		return nil, b.eof()
+	}
+
+	p := b.data[b.off : b.off+n]
+	b.off += n
+
+	return p, nil
+}
+
+// slice returns the next n bytes as a new buffer.
+func (b *kv3Buffer) slice(n int) *kv3Buffer {
+	next := &kv3Buffer{data: b.data[b.off : b.off+n], base: b.offset()}
+	b.off += n
+
+	return next
+}
+
+// next returns the next n bytes as a new buffer, or an error if there are less than n bytes left.
+func (b *kv3Buffer) next(n int) (*kv3Buffer, error) {
+	if n < 0 || n > len(b.data)-b.off {
+		return nil, b.eof()
+	}
+
+	return b.slice(n), nil
+}
+
+// align skips bytes up to the next multiple of n.
+func (b *kv3Buffer) align(n int) error {
+	_, err := b.read((n - b.off%n) % n)
+	return err
+}
+
+func (b *kv3Buffer) readByte() (byte, error) {
+	p, err := b.read(1)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return p[0], nil
+}
+
+func (b *kv3Buffer) readUint32() (uint32, error) {
+	p, err := b.read(4)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(p), nil
+}
+
+func (b *kv3Buffer) readUint64() (uint64, error) {
+	p, err := b.read(8)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(p), nil
+}
+
+func (b *kv3Buffer) readString() (string, error) {
+	i := bytes.IndexByte(b.data[b.off:], binaryDelimString)
+
+	if i < 0 {
+		return "", b.eof()
+	}
+
+	p, _ := b.read(i + 1)
+
+	return string(p[:i]), nil
+}
+
+// readGUID reads a GUID in Microsoft's mixed-endian byte order.
+func (b *kv3Buffer) readGUID() (string, error) {
+	p, err := b.read(kv3BinaryGUIDSize)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(
+		"%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(p),
+		binary.LittleEndian.Uint16(p[4:]),
+		binary.LittleEndian.Uint16(p[6:]),
+		p[8:10],
+		p[10:],
+	), nil
+}
+
+// kv3BinaryReader decodes nodes from the buffers of binary-encoded KeyValues3 data.
+type kv3BinaryReader struct {
+	bytes   *kv3Buffer
+	ints    *kv3Buffer
+	doubles *kv3Buffer
+	types   *kv3Buffer
+	strings []string
+	// limit is the maximum element count of arrays and objects
+	limit int
+}
+
+func (r *kv3BinaryReader) readStrings(buf *kv3Buffer) error {
+	count, err := r.readCount()
+
+	if err != nil {
+		return err
+	}
+
+	r.strings = make([]string, count)
+
+	for i := range r.strings {
+		if r.strings[i], err = buf.readString(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *kv3BinaryReader) readCount() (int, error) {
+	n, err := r.ints.readUint32()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if int64(n) > int64(r.limit) {
+		return 0, r.ints.malformed(fmt.Errorf("invalid count %d", n))
+	}
+
+	return int(n), nil
+}
+
+func (r *kv3BinaryReader) readStringRef() (string, error) {
+	n, err := r.ints.readUint32()
+
+	if err != nil {
+		return "", err
+	}
+
+	id := int(int32(n))
+
+	if id == kv3BinaryNoString {
+		return "", nil
+	}
+
+	if id < 0 || id >= len(r.strings) {
+		return "", r.ints.malformed(fmt.Errorf("invalid string id %d", id))
+	}
+
+	return r.strings[id], nil
+}
+
+func (r *kv3BinaryReader) readType() (byte, Flag, error) {
+	typ, err := r.types.readByte()
+
+	if err != nil {
+		return 0, FlagNone, err
+	}
+
+	if typ&kv3BinaryFlagBit == 0 {
+		return typ, FlagNone, nil
+	}
+
+	f, err := r.types.readByte()
+
+	if err != nil {
+		return 0, FlagNone, err
+	}
+
+	if f > byte(FlagSubClass) {
+		return 0, FlagNone, r.types.malformed(fmt.Errorf("invalid flag 0x%02x", f))
+	}
+
+	return typ & kv3BinaryTypeMask, Flag(f), nil
+}
+
+func (r *kv3BinaryReader) readValue(kv KeyValue, typ byte, flag Flag) error {
+	kv.SetChildren()
+	kv.SetFlag(flag)
+
+	var (
+		t     Type
+		value string
+		err   error
+	)
+
+	switch typ {
+	case kv3BinaryNull:
+		t = TypeNull
+	case kv3BinaryBool, kv3BinaryTrue, kv3BinaryFalse:
+		b := typ == kv3BinaryTrue
+
+		if typ == kv3BinaryBool {
+			var n byte
+			n, err = r.bytes.readByte()
+			b = n != 0
+		}
+
+		t, value = TypeBool, strconv.FormatBool(b)
+	case kv3BinaryInt64, kv3BinaryUint64, kv3BinaryDouble:
+		var n uint64
+
+		n, err = r.doubles.readUint64()
+
+		switch typ {
+		case kv3BinaryInt64:
+			t, value = TypeInt64, strconv.FormatInt(int64(n), 10)
+		case kv3BinaryUint64:
+			t, value = TypeUint64, strconv.FormatUint(n, 10)
+		default:
+			t, value = TypeDouble, strconv.FormatFloat(math.Float64frombits(n), 'g', -1, 64)
+		}
+	case kv3BinaryInt64Zero, kv3BinaryInt64One:
+		t, value = TypeInt64, strconv.Itoa(int(typ-kv3BinaryInt64Zero))
+	case kv3BinaryDoubleZero, kv3BinaryDoubleOne:
+		t, value = TypeDouble, strconv.Itoa(int(typ-kv3BinaryDoubleZero))
+	case kv3BinaryInt32, kv3BinaryUint32:
+		var n uint32
+
+		n, err = r.ints.readUint32()
+
+		if typ == kv3BinaryInt32 {
+			t, value = TypeInt32, strconv.FormatInt(int64(int32(n)), 10)
+		} else {
+			t, value = TypeUint64, strconv.FormatUint(uint64(n), 10)
+		}
+	case kv3BinaryString:
+		t = TypeString
+		value, err = r.readStringRef()
+	case kv3BinaryBlob:
+		var n uint32
+		var p []byte
+
+		if n, err = r.ints.readUint32(); err == nil {
+			p, err = r.bytes.read(int(n))
+		}
+
+		t, value = TypeBinary, hex.EncodeToString(p)
+	case kv3BinaryArray, kv3BinaryTypedArray:
+		kv.SetType(TypeArray).SetValue("")
+		return r.readArray(kv, typ == kv3BinaryTypedArray)
+	case kv3BinaryObject:
+		kv.SetType(TypeObject).SetValue("")
+		return r.readObject(kv)
+	default:
+		return &BinaryFormatError{Offset: r.types.offset() - 1, Type: typ, Err: ErrInvalidType}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	kv.SetType(t).SetValue(value)
+
+	return nil
+}
+
+// readArray reads the elements of an array. The elements of typed arrays share a single type,
+// following the element count, otherwise each element has its own type.
+func (r *kv3BinaryReader) readArray(kv KeyValue, typed bool) error {
+	count, err := r.readCount()
+
+	if err != nil {
+		return err
+	}
+
+	var (
+		typ  byte
+		flag Flag
+	)
+
+	if typed {
+		if typ, flag, err = r.readType(); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < count; i++ {
+		if !typed {
+			if typ, flag, err = r.readType(); err != nil {
+				return err
+			}
+		}
+
+		if err := r.readValue(kv.NewChild(), typ, flag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *kv3BinaryReader) readObject(kv KeyValue) error {
+	count, err := r.readCount()
+
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		key, err := r.readStringRef()
+
+		if err != nil {
+			return err
+		}
+
+		typ, flag, err := r.readType()
+
+		if err != nil {
+			return err
+		}
+
+		if err := r.readValue(kv.NewChild().SetKey(key), typ, flag); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
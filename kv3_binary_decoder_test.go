@@ -0,0 +1,289 @@
+package kv_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestKV3BinaryDecoder(t *testing.T) {
+	suite.Run(t, &KV3BinaryDecoderSuite{})
+}
+
+type KV3BinaryDecoderSuite struct {
+	Suite
+}
+
+func (s *KV3BinaryDecoderSuite) sampleKeyValue() kv.KeyValue {
+	root := kv.NewKeyValueObject("", nil)
+
+	kv.NewKeyValue(kv.TypeString, "string", "hello", root)
+	kv.NewKeyValue(kv.TypeString, "empty", "", root)
+	kv.NewKeyValue(kv.TypeNull, "null", "", root)
+	kv.NewKeyValue(kv.TypeBool, "bool", "true", root)
+	kv.NewKeyValue(kv.TypeBool, "true", "true", root)
+	kv.NewKeyValue(kv.TypeBool, "false", "false", root)
+	kv.NewKeyValue(kv.TypeInt64, "int64", "-5", root)
+	kv.NewKeyValue(kv.TypeUint64, "uint64", "18446744073709551615", root)
+	kv.NewKeyValue(kv.TypeInt32, "int32", "-7", root)
+	kv.NewKeyValue(kv.TypeUint64, "uint32", "4000000000", root)
+	kv.NewKeyValue(kv.TypeDouble, "double", "1.5", root)
+	kv.NewKeyValue(kv.TypeInt64, "zero", "0", root)
+	kv.NewKeyValue(kv.TypeInt64, "one", "1", root)
+	kv.NewKeyValue(kv.TypeDouble, "dzero", "0", root)
+	kv.NewKeyValue(kv.TypeDouble, "done", "1", root)
+	kv.NewKeyValue(kv.TypeBinary, "blob", "deadbeef", root)
+
+	array := kv.NewKeyValue(kv.TypeArray, "array", "", root)
+
+	kv.NewKeyValue(kv.TypeInt64, "", "1", array)
+	kv.NewKeyValue(kv.TypeString, "", "hello", array)
+	kv.NewKeyValueObject("", array).AddString("key", "value")
+
+	typed := kv.NewKeyValue(kv.TypeArray, "typed", "", root)
+
+	kv.NewKeyValue(kv.TypeInt32, "", "1", typed)
+	kv.NewKeyValue(kv.TypeInt32, "", "2", typed)
+	kv.NewKeyValue(kv.TypeInt32, "", "3", typed)
+
+	kv.NewKeyValue(kv.TypeString, "resource", "particles/x.vpcf", root)
+	kv.NewKeyValue(kv.TypeString, "sound", "Hero_Axe.Attack", root)
+
+	return root
+}
+
+func (s *KV3BinaryDecoderSuite) TestDecode() {
+	testCases := []struct {
+		Fixture string
+		Header  kv.KV3Header
+	}{
+		{
+			Fixture: "kv3/sample.legacy.kv3",
+			Header: kv.KV3Header{
+				Encoding:        "binary",
+				EncodingVersion: "1b860500-f7d8-40c1-ad82-75a48267e714",
+				Format:          kv.KV3FormatGeneric,
+				FormatVersion:   kv.KV3FormatGenericVersion,
+			},
+		},
+		{
+			Fixture: "kv3/sample.legacy.lz4.kv3",
+			Header: kv.KV3Header{
+				Encoding:        "binary",
+				EncodingVersion: "6847348a-63a1-4f5c-a197-53806fd9b119",
+				Format:          kv.KV3FormatGeneric,
+				FormatVersion:   kv.KV3FormatGenericVersion,
+			},
+		},
+		{
+			Fixture: "kv3/sample.v1.kv3",
+			Header: kv.KV3Header{
+				Encoding:      "binary",
+				Format:        kv.KV3FormatGeneric,
+				FormatVersion: kv.KV3FormatGenericVersion,
+			},
+		},
+		{
+			Fixture: "kv3/sample.v1.lz4.kv3",
+			Header: kv.KV3Header{
+				Encoding:      "binary",
+				Format:        kv.KV3FormatGeneric,
+				FormatVersion: kv.KV3FormatGenericVersion,
+			},
+		},
+		{
+			Fixture: "kv3/sample.v1.zstd.kv3",
+			Header: kv.KV3Header{
+				Encoding:      "binary",
+				Format:        kv.KV3FormatGeneric,
+				FormatVersion: kv.KV3FormatGenericVersion,
+			},
+		},
+	}
+
+	expected := s.sampleKeyValue()
+
+	for _, testCase := range testCases {
+		s.Run(testCase.Fixture, func() {
+			require := s.Require()
+			actual := kv.NewKeyValueEmpty()
+			dec := kv.NewKV3BinaryDecoder(bytes.NewReader(s.MustReadFixture(testCase.Fixture)))
+
+			require.NoError(dec.Decode(actual))
+			require.Equal(testCase.Header, dec.Header())
+			s.RequireEqualKeyValue(expected, actual)
+			require.Equal(kv.FlagResource, actual.Child("resource").Flag())
+			require.Equal(kv.FlagSoundEvent, actual.Child("sound").Flag())
+			require.Equal(kv.FlagNone, actual.Child("string").Flag())
+		})
+	}
+}
+
+func (s *KV3BinaryDecoderSuite) TestDecodeCompressed() {
+	require := s.Require()
+	expected := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewKV3BinaryDecoder(bytes.NewReader(s.MustReadFixture("kv3/heroes.v1.kv3"))).Decode(expected))
+
+	heroes := expected.Child("heroes")
+
+	require.NotNil(heroes)
+	require.Len(heroes.Children(), 400)
+	require.Equal("npc_dota_hero_17", heroes.Children()[117].Child("name").Value())
+	require.Equal("models/heroes/hero_17/hero_17.vmdl", heroes.Children()[117].Child("model").Value())
+	require.Equal(kv.FlagResource, heroes.Children()[117].Child("model").Flag())
+	require.Equal("305", heroes.Children()[117].Child("speed").Value())
+	require.Equal("false", heroes.Children()[117].Child("enabled").Value())
+
+	for _, fixture := range []string{"kv3/heroes.v1.lz4.kv3", "kv3/heroes.v1.zstd.kv3"} {
+		actual := kv.NewKeyValueEmpty()
+
+		require.NoErrorf(kv.NewKV3BinaryDecoder(bytes.NewReader(s.MustReadFixture(fixture))).Decode(actual), fixture)
+		s.RequireEqualKeyValuef(expected, actual, fixture)
+	}
+}
+
+func (s *KV3BinaryDecoderSuite) TestDecodeErrors() {
+	v1 := s.MustReadFixture("kv3/sample.v1.kv3")
+	legacy := s.MustReadFixture("kv3/sample.legacy.kv3")
+	lz4 := s.MustReadFixture("kv3/sample.v1.lz4.kv3")
+
+	// v1 header: magic (4), format GUID (16), compression, bytes, ints, doubles counts, size (4 each)
+	const v1HeaderSize = 40
+
+	mutate := func(data []byte, f func([]byte)) []byte {
+		data = append([]byte(nil), data...)
+		f(data)
+
+		return data
+	}
+
+	testCases := []struct {
+		TestName string
+		Data     []byte
+		Err      string
+		ErrIs    error
+		Offset   int64
+		Type     byte
+	}{
+		{
+			TestName: "Empty",
+			Data:     []byte{},
+			Err:      "kv: offset 0: unexpected EOF",
+			ErrIs:    io.ErrUnexpectedEOF,
+		},
+		{
+			TestName: "InvalidMagic",
+			Data:     []byte("VKV\x02 binary"),
+			Err:      "kv: offset 0: unsupported format",
+			ErrIs:    kv.ErrUnsupportedFormat,
+		},
+		{
+			TestName: "UnsupportedVersion",
+			Data:     mutate(v1, func(p []byte) { p[0] = 2 }),
+			Err:      "kv: offset 0: unsupported version 2",
+			ErrIs:    kv.ErrUnsupportedVersion,
+		},
+		{
+			TestName: "UnsupportedVersion5",
+			Data:     []byte("\x053VK"),
+			Err:      "kv: offset 0: unsupported version 5",
+			ErrIs:    kv.ErrUnsupportedVersion,
+		},
+		{
+			TestName: "UnknownVersion",
+			Data:     []byte("\x063VK"),
+			Err:      "kv: offset 0: unsupported format",
+			ErrIs:    kv.ErrUnsupportedFormat,
+		},
+		{
+			TestName: "TruncatedHeader",
+			Data:     v1[:30],
+			Err:      "kv: offset 28: unexpected EOF",
+			ErrIs:    io.ErrUnexpectedEOF,
+			Offset:   28,
+		},
+		{
+			TestName: "UnknownCompression",
+			Data: mutate(v1, func(p []byte) {
+				binary.LittleEndian.PutUint32(p[20:], 7)
+			}),
+			Err:    "kv: offset 20: unsupported format",
+			ErrIs:  kv.ErrUnsupportedFormat,
+			Offset: 20,
+		},
+		{
+			TestName: "UnknownEncoding",
+			Data: mutate(legacy, func(p []byte) {
+				p[4] ^= 0xff
+			}),
+			Err:    "kv: offset 4: unsupported format",
+			ErrIs:  kv.ErrUnsupportedFormat,
+			Offset: 4,
+		},
+		{
+			TestName: "TruncatedData",
+			Data:     v1[:len(v1)-10],
+			Err:      "kv: offset 40: unexpected EOF",
+			ErrIs:    io.ErrUnexpectedEOF,
+			Offset:   v1HeaderSize,
+		},
+		{
+			TestName: "InvalidTrailer",
+			Data: mutate(v1, func(p []byte) {
+				p[len(p)-1] = 0
+			}),
+			Err:    "kv: offset 420: malformed data: invalid trailer 0x00eedd00",
+			ErrIs:  kv.ErrMalformed,
+			Offset: 420,
+		},
+		{
+			TestName: "InvalidCompressedData",
+			Data:     lz4[:len(lz4)-20],
+			Err:      "kv: offset 40: malformed data: lz4: corrupt input",
+			ErrIs:    kv.ErrMalformed,
+			Offset:   v1HeaderSize,
+		},
+		{
+			TestName: "OversizedCompressedData",
+			Data: mutate(lz4, func(p []byte) {
+				binary.LittleEndian.PutUint32(p[36:], 0xffffffff)
+			}),
+			Err:    "kv: offset 40: malformed data: lz4: decompressed size mismatch",
+			ErrIs:  kv.ErrMalformed,
+			Offset: v1HeaderSize,
+		},
+		{
+			TestName: "InvalidType",
+			Data: mutate(v1, func(p []byte) {
+				// the node types follow the last string
+				p[bytes.Index(p, []byte("Hero_Axe.Attack\x00"))+16] = 0x3f
+			}),
+			Err:    "kv: offset 392: invalid type byte 0x3f",
+			ErrIs:  kv.ErrInvalidType,
+			Offset: 392,
+			Type:   0x3f,
+		},
+	}
+
+	for _, testCase := range testCases {
+		s.Run(testCase.TestName, func() {
+			require := s.Require()
+			err := kv.NewKV3BinaryDecoder(bytes.NewReader(testCase.Data)).Decode(kv.NewKeyValueEmpty())
+
+			var formatErr *kv.BinaryFormatError
+
+			require.EqualError(err, testCase.Err)
+			require.True(errors.Is(err, testCase.ErrIs))
+			require.True(errors.As(err, &formatErr))
+			require.Equal(testCase.Offset, formatErr.Offset)
+			require.Equal(testCase.Type, formatErr.Type)
+		})
+	}
+}
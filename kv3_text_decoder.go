@@ -0,0 +1,87 @@
+package kv
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/13k/kv-go/parser"
+)
+
+// KV3Header is the header of a KeyValues3 document, identifying its encoding and format.
+type KV3Header = parser.KV3Header
+
+// KV3TextDecoder reads and decodes KeyValues3 text-encoded nodes from an input stream.
+//
+// https://developer.valvesoftware.com/wiki/KeyValues3
+type KV3TextDecoder struct {
+	p      *parser.KV3Parser
+	header KV3Header
+}
+
+// NewKV3TextDecoder returns a new KeyValues3 text decoder that reads from r.
+func NewKV3TextDecoder(r io.Reader) *KV3TextDecoder {
+	return &KV3TextDecoder{p: parser.NewKV3Parser("", r)}
+}
+
+// Header returns the header of the decoded document.
+func (d *KV3TextDecoder) Header() KV3Header {
+	return d.header
+}
+
+// Decode reads the KeyValues3 text-encoded document from its input and stores its root node in the
+// value pointed to by kv.
+//
+// Objects are decoded as TypeObject nodes and arrays as TypeArray nodes, with elements as children
+// with empty keys. Strings are decoded as TypeString, booleans as TypeBool, null as TypeNull,
+// floating point numbers as TypeDouble and integers as TypeInt64 (or TypeUint64, if too large for
+// an int64). The root node has an empty key.
+func (d *KV3TextDecoder) Decode(kv KeyValue) error {
+	header, root, err := d.p.Parse()
+
+	if err != nil {
+		return err
+	}
+
+	d.header = *header
+	d.applyAST(kv, root)
+
+	return nil
+}
+
+func (d *KV3TextDecoder) applyAST(kv KeyValue, node *parser.KV3Node) {
+	flag, _ := FlagFromString(node.Flag)
+
+	kv.SetChildren()
+	kv.SetKey(node.Key)
+	kv.SetPosition(node.Pos, node.ValuePos)
+	kv.SetFlag(flag)
+
+	switch node.Type {
+	case parser.KV3Object:
+		kv.SetType(TypeObject)
+	case parser.KV3Array:
+		kv.SetType(TypeArray)
+	case parser.KV3String:
+		kv.SetType(TypeString)
+	case parser.KV3Bool:
+		kv.SetType(TypeBool)
+	case parser.KV3Null:
+		kv.SetType(TypeNull)
+	case parser.KV3Double:
+		kv.SetType(TypeDouble)
+	case parser.KV3Binary:
+		kv.SetType(TypeBinary)
+	case parser.KV3Int:
+		if _, err := strconv.ParseInt(node.Value, 10, 64); err != nil {
+			kv.SetType(TypeUint64)
+		} else {
+			kv.SetType(TypeInt64)
+		}
+	}
+
+	kv.SetValue(node.Value)
+
+	for _, nodeChild := range node.Children {
+		d.applyAST(kv.NewChild(), nodeChild)
+	}
+}
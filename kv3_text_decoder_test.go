@@ -0,0 +1,287 @@
+package kv_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestKV3TextDecoder(t *testing.T) {
+	suite.Run(t, &KV3TextDecoderSuite{})
+}
+
+type KV3TextDecoderSuite struct {
+	Suite
+}
+
+type kv3TextDecoderDecodeTestCase struct {
+	TestName        string
+	Data            []byte
+	Input           io.Reader
+	Err             string
+	ErrIs           error
+	Expected        kv.KeyValue
+	ExpectedPartial []textDecoderDecodePartialCase
+}
+
+func (s *KV3TextDecoderSuite) TestDecode() {
+	nested := kv.NewKeyValue(kv.TypeArray, "nested", "", nil)
+
+	kv.NewKeyValue(kv.TypeInt64, "", "1", nested)
+	kv.NewKeyValue(kv.TypeDouble, "", "2.0", nested)
+	kv.NewKeyValue(kv.TypeString, "", "three", nested)
+	kv.NewKeyValue(kv.TypeBool, "", "true", nested)
+	kv.NewKeyValue(kv.TypeNull, "", "", nested)
+	kv.NewKeyValue(kv.TypeArray, "", "", nested)
+	kv.NewKeyValueObject("", nested).AddString("key", "value")
+
+	testCases := []kv3TextDecoderDecodeTestCase{
+		{
+			TestName: "EmptyInput",
+			Data:     []byte{},
+			Err:      `kv: <input>:1:1: unexpected EOF`,
+			ErrIs:    kv.ErrUnexpectedEOF,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "MissingHeader",
+			Input:    s.MustOpenFixture("kv3/sample.invalid-header.txt"),
+			Err:      `kv: testdata/kv3/sample.invalid-header.txt:1:1: unexpected token "{"`,
+			ErrIs:    kv.ErrUnexpectedToken,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "InvalidHeader",
+			Data:     []byte(`<!-- kv2 encoding:text -->{}`),
+			Err:      `kv: <input>:1:1: invalid header " kv2 encoding:text "`,
+			ErrIs:    kv.ErrInvalidToken,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "InvalidFlag",
+			Input:    s.MustOpenFixture("kv3/sample.invalid-flag.txt"),
+			Err:      `kv: testdata/kv3/sample.invalid-flag.txt:3:8: unknown flag "unknown"`,
+			ErrIs:    kv.ErrUnexpectedToken,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "MissingAssign",
+			Input:    s.MustOpenFixture("kv3/sample.invalid-missing_assign.txt"),
+			Err:      `kv: testdata/kv3/sample.invalid-missing_assign.txt:3:6: unexpected token "\""`,
+			ErrIs:    kv.ErrUnexpectedToken,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "Incomplete",
+			Input:    s.MustOpenFixture("kv3/sample.invalid-incomplete.txt"),
+			Err:      `kv: testdata/kv3/sample.invalid-incomplete.txt:5:1: unexpected EOF`,
+			ErrIs:    kv.ErrUnexpectedEOF,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "UnterminatedComment",
+			Data:     []byte("<!-- kv3 -->\n{ /* comment }"),
+			Err:      `kv: <input>:2:3: comment not terminated`,
+			ErrIs:    kv.ErrInvalidToken,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "TrailingData",
+			Data:     []byte("<!-- kv3 -->\n{} {}"),
+			Err:      `kv: <input>:2:4: unexpected token "{"`,
+			ErrIs:    kv.ErrUnexpectedToken,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "Binary",
+			Data:     []byte("<!-- kv3 -->\n{ blob = #[ 00 7F\n\tfe ] empty = #[] }"),
+			Expected: kv.NewKeyValueRoot("").AddBinary("blob", "007ffe").AddBinary("empty", ""),
+		},
+		{
+			TestName: "InvalidBinary",
+			Data:     []byte("<!-- kv3 -->\n{ blob = #[ 00 7 ] }"),
+			Err:      `kv: <input>:2:16: unexpected token "7"`,
+			ErrIs:    kv.ErrUnexpectedToken,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "UnterminatedBinary",
+			Data:     []byte("<!-- kv3 -->\n{ blob = #[ 00"),
+			Err:      `kv: <input>:2:15: unexpected EOF`,
+			ErrIs:    kv.ErrUnexpectedEOF,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "Valid",
+			Input:    s.MustOpenFixture("kv3/sample.valid.txt"),
+			Expected: kv.NewKeyValueRoot("").
+				AddString("string", "hello \"world\"\t\\").
+				AddString("quoted key", "value").
+				AddInt64("int", "13").
+				AddInt64("negint", "-13").
+				AddUint64("uint", "18446744073709551615").
+				AddChild(kv.NewKeyValue(kv.TypeDouble, "double", "1.5", nil)).
+				AddChild(kv.NewKeyValue(kv.TypeDouble, "exp", "-2.5e-3", nil)).
+				AddChild(kv.NewKeyValue(kv.TypeBool, "bool", "false", nil)).
+				AddChild(kv.NewKeyValue(kv.TypeNull, "nothing", "", nil)).
+				AddString("multiline", "first line\nsecond \"line\"").
+				AddString("resource", "particles/x.vpcf").
+				AddString("sound", "Hero_Axe.Attack").
+				AddChild(kv.NewKeyValueObject("object", nil).AddChild(nested)).
+				AddChild(kv.NewKeyValueObject("class", nil).AddString("_class", "base")),
+		},
+		{
+			TestName: "SDKEngineTools",
+			Input:    s.MustOpenFixture("kv3/sdkenginetools.txt"),
+			ExpectedPartial: []textDecoderDecodePartialCase{
+				{
+					Path:     nil,
+					Type:     kv.TypeObject,
+					Children: 2,
+				},
+				{
+					Path:     []string{"m_EngineTools"},
+					Type:     kv.TypeArray,
+					Children: 6,
+				},
+				{
+					Path:     []string{"m_ExternalTools"},
+					Type:     kv.TypeArray,
+					Children: 1,
+				},
+				{
+					Path:  []string{"m_ExternalTools", "", "m_Command"},
+					Type:  kv.TypeString,
+					Value: `%1 "%f"`,
+				},
+				{
+					Path:  []string{"m_ExternalTools", "", "m_Replace", ""},
+					Type:  kv.TypeString,
+					Value: `@HKEY_LOCAL_MACHINE\SOFTWARE\Microsoft\Windows\CurrentVersion\App Paths\Photoshop.exe`,
+				},
+				{
+					Path:  []string{"m_ExternalTools", "", "m_bIsPrimaryTool"},
+					Type:  kv.TypeBool,
+					Value: "true",
+				},
+				{
+					Path:     []string{"m_ExternalTools", "", "m_SupportedExts"},
+					Type:     kv.TypeArray,
+					Children: 4,
+				},
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		s.subtestDecode(testCase)
+	}
+}
+
+func (s *KV3TextDecoderSuite) subtestDecode(testCase kv3TextDecoderDecodeTestCase) {
+	s.Run(testCase.TestName, func() {
+		require := s.Require()
+		input := testCase.Input
+
+		if input == nil {
+			input = bytes.NewReader(testCase.Data)
+		}
+
+		if closer, ok := input.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		actual := kv.NewKeyValueEmpty()
+		err := kv.NewKV3TextDecoder(input).Decode(actual)
+
+		if testCase.Err == "" {
+			require.NoError(err)
+		} else {
+			require.EqualError(err, testCase.Err)
+			require.Truef(errors.Is(err, testCase.ErrIs), "expected error to wrap %v", testCase.ErrIs)
+		}
+
+		if testCase.ExpectedPartial == nil {
+			s.RequireEqualKeyValue(testCase.Expected, actual)
+			return
+		}
+
+		for partialCaseIdx, expectedChild := range testCase.ExpectedPartial {
+			child := actual
+
+			for _, key := range expectedChild.Path {
+				child = child.Child(key)
+				require.NotNilf(child, "child index=%d path=%q", partialCaseIdx, expectedChild.Path)
+			}
+
+			require.Equalf(expectedChild.Type, child.Type(), "child index=%d path=%q", partialCaseIdx, expectedChild.Path)
+
+			switch expectedChild.Type {
+			case kv.TypeObject, kv.TypeArray:
+				require.Lenf(child.Children(), expectedChild.Children, "child index=%d path=%q", partialCaseIdx, expectedChild.Path)
+			default:
+				require.Equalf(expectedChild.Value, child.Value(), "child index=%d path=%q", partialCaseIdx, expectedChild.Path)
+			}
+		}
+	})
+}
+
+func (s *KV3TextDecoderSuite) TestDecodeHeader() {
+	require := s.Require()
+	f := s.MustOpenFixture("kv3/sdkenginetools.txt")
+
+	defer f.Close()
+
+	dec := kv.NewKV3TextDecoder(f)
+
+	require.NoError(dec.Decode(kv.NewKeyValueEmpty()))
+
+	expected := kv.KV3Header{
+		Encoding:        "text",
+		EncodingVersion: "e21c7f3c-8a33-41c5-9977-a76d3a32aa0d",
+		Format:          "generic",
+		FormatVersion:   "7412167c-06e9-4698-aff2-e63eb59037e7",
+	}
+
+	require.Equal(expected, dec.Header())
+}
+
+func (s *KV3TextDecoderSuite) TestDecodeFlags() {
+	require := s.Require()
+	f := s.MustOpenFixture("kv3/sample.valid.txt")
+
+	defer f.Close()
+
+	actual := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewKV3TextDecoder(f).Decode(actual))
+
+	require.Equal(kv.FlagNone, actual.Child("string").Flag())
+	require.Equal(kv.FlagResource, actual.Child("resource").Flag())
+	require.Equal(kv.FlagSoundEvent, actual.Child("sound").Flag())
+	require.Equal(kv.FlagSubClass, actual.Child("class").Flag())
+	require.Equal("soundevent", actual.Child("sound").Flag().String())
+}
+
+func (s *KV3TextDecoderSuite) TestDecodePositions() {
+	require := s.Require()
+	f := s.MustOpenFixture("kv3/sample.valid.txt")
+
+	defer f.Close()
+
+	actual := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewKV3TextDecoder(f).Decode(actual))
+
+	fname := s.FixturePath("kv3/sample.valid.txt")
+	child := actual.Child("int")
+
+	require.Equal(kv.Position{Filename: fname, Offset: 150, Line: 3, Column: 1}, actual.Position())
+	require.Equal(kv.Position{Filename: fname, Offset: 209, Line: 6, Column: 2}, child.Position())
+	require.Equal(kv.Position{Filename: fname, Offset: 215, Line: 6, Column: 8}, child.ValuePosition())
+}
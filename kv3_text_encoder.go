@@ -0,0 +1,361 @@
+package kv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Default KeyValues3 header values.
+const (
+	KV3EncodingText         = "text"
+	KV3EncodingTextVersion  = "e21c7f3c-8a33-41c5-9977-a76d3a32aa0d"
+	KV3FormatGeneric        = "generic"
+	KV3FormatGenericVersion = "7412167c-06e9-4698-aff2-e63eb59037e7"
+)
+
+const (
+	kv3TextIndent         = "\t"
+	kv3TextAssign         = " = "
+	kv3TextSeparator      = ","
+	kv3TextFlag           = ":"
+	kv3TextObjectStart    = "{"
+	kv3TextObjectEnd      = "}"
+	kv3TextArrayStart     = "["
+	kv3TextArrayEnd       = "]"
+	kv3TextEmptySpace     = "  "
+	kv3TextMultilineQuote = `"""`
+	kv3TextNull           = "null"
+	kv3TextBinaryStart    = "#["
+)
+
+var kv3TextEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+	"\r", `\r`,
+	"\t", `\t`,
+)
+
+// KV3TextEncoder writes KeyValues3 text-encoded nodes to an output stream.
+//
+// https://developer.valvesoftware.com/wiki/KeyValues3
+type KV3TextEncoder struct {
+	w      *bufio.Writer
+	header KV3Header
+}
+
+// NewKV3TextEncoder returns a new KeyValues3 text encoder that writes to w.
+func NewKV3TextEncoder(w io.Writer) *KV3TextEncoder {
+	return &KV3TextEncoder{w: bufio.NewWriter(w)}
+}
+
+// Header sets the header written before the root node and returns the receiver.
+//
+// Empty fields are written with the default values of the generic format in text encoding
+// (KV3EncodingText, KV3EncodingTextVersion, KV3FormatGeneric and KV3FormatGenericVersion). Versions
+// must be GUIDs, like "7412167c-06e9-4698-aff2-e63eb59037e7".
+func (e *KV3TextEncoder) Header(h KV3Header) *KV3TextEncoder {
+	e.header = h
+	return e
+}
+
+// Encode writes the KeyValues3 text encoding of kv to the stream, as a document with kv as the root
+// node.
+//
+// Nodes are written in the tab-indented layout of Valve tools. The root node's key is ignored.
+// Strings containing line breaks are written as multi-line strings. Flags are written as value
+// prefixes, like `resource:"particles/x.vpcf"`. KeyValue types other than KeyValues3 types are
+// written as the closest KeyValues3 type: Int32, Uint64, Color and Pointer as integers, Float32 as
+// a double and WString as a string. Float32 and Double values are written in decimal notation, as
+// formatted by strconv. NaN and infinite Float32 and Double values and unknown flags can't be
+// written, and return an error matching ErrInvalidValue.
+func (e *KV3TextEncoder) Encode(kv KeyValue) error {
+	header, err := e.formatHeader()
+
+	if err != nil {
+		return err
+	}
+
+	e.w.WriteString(header + "\n")
+
+	if err := e.encodeValue(kv, 0, true); err != nil {
+		return err
+	}
+
+	e.w.WriteString("\n")
+
+	// bufio.Writer errors are sticky, Flush reports any error from previous writes
+	return e.w.Flush()
+}
+
+func (e *KV3TextEncoder) formatHeader() (string, error) {
+	h := e.header
+
+	if h.Encoding == "" {
+		h.Encoding = KV3EncodingText
+	}
+
+	if h.EncodingVersion == "" {
+		h.EncodingVersion = KV3EncodingTextVersion
+	}
+
+	if h.Format == "" {
+		h.Format = KV3FormatGeneric
+	}
+
+	if h.FormatVersion == "" {
+		h.FormatVersion = KV3FormatGenericVersion
+	}
+
+	for _, s := range []string{h.Encoding, h.Format} {
+		if s == "" || strings.ContainsAny(s, " \t\r\n:{}") {
+			return "", fmt.Errorf("kv: invalid kv3 header name %q: %w", s, ErrInvalidValue)
+		}
+	}
+
+	for _, v := range []string{h.EncodingVersion, h.FormatVersion} {
+		if !isGUID(v) {
+			return "", fmt.Errorf("kv: invalid kv3 header version %q: %w", v, ErrInvalidValue)
+		}
+	}
+
+	return fmt.Sprintf(
+		"<!-- kv3 encoding:%s:version{%s} format:%s:version{%s} -->",
+		h.Encoding,
+		h.EncodingVersion,
+		h.Format,
+		h.FormatVersion,
+	), nil
+}
+
+// encodeValue writes the value of kv. lineStart indicates whether the value starts a line, if not
+// objects and arrays are written in a new line.
+func (e *KV3TextEncoder) encodeValue(kv KeyValue, level int, lineStart bool) error {
+	indent := strings.Repeat(kv3TextIndent, level)
+
+	if kv.Flag() != FlagNone {
+		if !kv.Flag().known() {
+			return newInvalidValueError(kv, OpEncode, fmt.Errorf("%w %v", errUnknownFlag, kv.Flag()))
+		}
+
+		e.w.WriteString(kv.Flag().String() + kv3TextFlag)
+		lineStart = false
+	}
+
+	switch kv.Type() {
+	case TypeObject, TypeArray:
+		start, end := kv3TextObjectStart, kv3TextObjectEnd
+
+		if kv.Type() == TypeArray {
+			start, end = kv3TextArrayStart, kv3TextArrayEnd
+		}
+
+		if len(kv.Children()) == 0 {
+			e.w.WriteString(start + kv3TextEmptySpace + end)
+			return nil
+		}
+
+		if !lineStart {
+			e.w.WriteString("\n" + indent)
+		}
+
+		e.w.WriteString(start + "\n")
+
+		for _, c := range kv.Children() {
+			if err := e.encodeChild(kv, c, level+1); err != nil {
+				return err
+			}
+		}
+
+		e.w.WriteString(indent + end)
+
+		return nil
+	}
+
+	s, err := formatKV3Scalar(kv)
+
+	if err != nil {
+		return err
+	}
+
+	e.w.WriteString(s)
+
+	return nil
+}
+
+func (e *KV3TextEncoder) encodeChild(parent, kv KeyValue, level int) error {
+	indent := strings.Repeat(kv3TextIndent, level)
+
+	e.w.WriteString(indent)
+
+	if parent.Type() == TypeArray {
+		if err := e.encodeValue(kv, level, true); err != nil {
+			return err
+		}
+
+		e.w.WriteString(kv3TextSeparator + "\n")
+
+		return nil
+	}
+
+	e.w.WriteString(formatKV3Key(kv.Key()) + kv3TextAssign)
+
+	if err := e.encodeValue(kv, level, false); err != nil {
+		return err
+	}
+
+	e.w.WriteString("\n")
+
+	return nil
+}
+
+func formatKV3Key(key string) string {
+	if key == "" {
+		return quoteKV3(key)
+	}
+
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; !(c == '_' || c == '.' ||
+			(c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')) {
+			return quoteKV3(key)
+		}
+	}
+
+	return key
+}
+
+func quoteKV3(s string) string {
+	return `"` + kv3TextEscaper.Replace(s) + `"`
+}
+
+func formatKV3String(s string) string {
+	if strings.Contains(s, "\n") && !strings.Contains(s, "\r") &&
+		!strings.Contains(s, kv3TextMultilineQuote) {
+		return kv3TextMultilineQuote + "\n" + s + "\n" + kv3TextMultilineQuote
+	}
+
+	return quoteKV3(s)
+}
+
+// formatKV3Double returns the decimal text of a finite floating point value of the given bit size,
+// ensuring it is not read back as an integer.
+func formatKV3Double(f float64, bitSize int) string {
+	s := strconv.FormatFloat(f, 'g', -1, bitSize)
+
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+
+	return s
+}
+
+func formatKV3Scalar(kv KeyValue) (string, error) {
+	switch kv.Type() {
+	case TypeString, TypeWString:
+		return formatKV3String(kv.Value()), nil
+	case TypeNull:
+		return kv3TextNull, nil
+	case TypeBool:
+		b, err := strconv.ParseBool(kv.Value())
+
+		if err != nil {
+			return "", newInvalidValueError(kv, OpEncode, err)
+		}
+
+		return strconv.FormatBool(b), nil
+	case TypeDouble:
+		f, err := strconv.ParseFloat(kv.Value(), 64)
+
+		if err != nil {
+			return "", newInvalidValueError(kv, OpEncode, err)
+		}
+
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", newInvalidValueError(kv, OpEncode, errNonFinite)
+		}
+
+		return formatKV3Double(f, 64), nil
+	case TypeBinary:
+		b, err := kv.AsBinary()
+
+		if err != nil {
+			return "", err
+		}
+
+		return formatKV3Binary(b), nil
+	case TypeFloat32:
+		f, err := kv.AsFloat32()
+
+		if err != nil {
+			return "", err
+		}
+
+		if math.IsNaN(float64(f)) || math.IsInf(float64(f), 0) {
+			return "", newInvalidValueError(kv, OpEncode, errNonFinite)
+		}
+
+		return formatKV3Double(float64(f), 32), nil
+	case TypeInt32:
+		n, err := kv.AsInt32()
+		return strconv.FormatInt(int64(n), 10), err
+	case TypeColor:
+		n, err := kv.AsColor()
+		return strconv.FormatInt(int64(n), 10), err
+	case TypePointer:
+		n, err := kv.AsPointer()
+		return strconv.FormatInt(int64(n), 10), err
+	case TypeInt64:
+		n, err := kv.AsInt64()
+		return strconv.FormatInt(n, 10), err
+	case TypeUint64:
+		n, err := kv.AsUint64()
+		return strconv.FormatUint(n, 10), err
+	default:
+		return "", newUnsupportedTypeError(kv)
+	}
+}
+
+// formatKV3Binary formats bytes as a binary blob, like `#[ 01 02 ]`.
+func formatKV3Binary(b []byte) string {
+	if len(b) == 0 {
+		return kv3TextBinaryStart + kv3TextEmptySpace + kv3TextArrayEnd
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(kv3TextBinaryStart)
+
+	for _, c := range b {
+		fmt.Fprintf(&sb, " %02x", c)
+	}
+
+	sb.WriteString(" " + kv3TextArrayEnd)
+
+	return sb.String()
+}
+
+func isGUID(s string) bool {
+	// xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+	if len(s) != 36 {
+		return false
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", rune(c)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
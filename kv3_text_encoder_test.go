@@ -0,0 +1,208 @@
+package kv_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestKV3TextEncoder(t *testing.T) {
+	suite.Run(t, &KV3TextEncoderSuite{})
+}
+
+type KV3TextEncoderSuite struct {
+	Suite
+}
+
+func (s *KV3TextEncoderSuite) decode(path string) kv.KeyValue {
+	f := s.MustOpenFixture(path)
+
+	defer f.Close()
+
+	root := kv.NewKeyValueEmpty()
+
+	s.Require().NoError(kv.NewKV3TextDecoder(f).Decode(root))
+
+	return root
+}
+
+func (s *KV3TextEncoderSuite) TestEncodeGolden() {
+	testCases := []struct {
+		TestName string
+		Input    string
+		Golden   string
+	}{
+		{
+			TestName: "SDKEngineTools",
+			Input:    "kv3/sdkenginetools.txt",
+			Golden:   "kv3/sdkenginetools.txt",
+		},
+		{
+			TestName: "Valid",
+			Input:    "kv3/sample.valid.txt",
+			Golden:   "kv3/sample.encoded.txt",
+		},
+	}
+
+	for _, testCase := range testCases {
+		s.Run(testCase.TestName, func() {
+			require := s.Require()
+			root := s.decode(testCase.Input)
+			b := &bytes.Buffer{}
+
+			require.NoError(kv.NewKV3TextEncoder(b).Encode(root))
+			require.Equal(string(s.MustReadFixture(testCase.Golden)), b.String())
+
+			decoded := kv.NewKeyValueEmpty()
+
+			require.NoError(kv.NewKV3TextDecoder(bytes.NewReader(b.Bytes())).Decode(decoded))
+			require.True(kv.Equal(root, decoded, kv.EqualNumeric), kv.Diff(root, decoded).String())
+		})
+	}
+}
+
+func (s *KV3TextEncoderSuite) TestEncodeTypes() {
+	require := s.Require()
+
+	root := kv.NewKeyValueRoot("ignored").
+		AddString("multiline", "a\n\"\"\"b").
+		AddString("crlf", "a\r\nb").
+		AddInt32("int32", "-1").
+		AddFloat32("float32", "2").
+		AddColor("color", "255").
+		AddPointer("pointer", "0").
+		AddUint64("uint64", "1").
+		AddChild(kv.NewKeyValue(kv.TypeDouble, "double", "1e21", nil)).
+		AddChild(kv.NewKeyValue(kv.TypeDouble, "hex", "0x1p-2", nil)).
+		AddChild(kv.NewKeyValue(kv.TypeDouble, "hexint", "0x10p0", nil)).
+		AddFloat32("hexfloat32", "0x1.8p1").
+		AddChild(kv.NewKeyValue(kv.TypeBool, "bool", "1", nil)).
+		AddBinary("binary", "00ff10").
+		AddBinary("nobinary", "").
+		AddChild(kv.NewKeyValueObject("empty", nil)).
+		AddChild(kv.NewKeyValue(kv.TypeString, "", "", nil).SetFlag(kv.FlagPanorama))
+
+	//nolint:lll
+	expected := `<!-- kv3 encoding:text:version{e21c7f3c-8a33-41c5-9977-a76d3a32aa0d} format:generic:version{7412167c-06e9-4698-aff2-e63eb59037e7} -->
+{
+	multiline = "a\n\"\"\"b"
+	crlf = "a\r\nb"
+	int32 = -1
+	float32 = 2.0
+	color = 255
+	pointer = 0
+	uint64 = 1
+	double = 1e+21
+	hex = 0.25
+	hexint = 16.0
+	hexfloat32 = 3.0
+	bool = true
+	binary = #[ 00 ff 10 ]
+	nobinary = #[  ]
+	empty = {  }
+	"" = panorama:""
+}
+`
+
+	b := &bytes.Buffer{}
+
+	require.NoError(kv.NewKV3TextEncoder(b).Encode(root))
+	require.Equal(expected, b.String())
+}
+
+func (s *KV3TextEncoderSuite) TestEncodeFlags() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("")
+
+	for f := kv.FlagResource; f <= kv.FlagSubClass; f++ {
+		root.AddChild(kv.NewKeyValue(kv.TypeString, f.String(), "value", nil).SetFlag(f))
+	}
+
+	b := &bytes.Buffer{}
+
+	require.NoError(kv.NewKV3TextEncoder(b).Encode(root))
+	require.Contains(b.String(), `resource_name = resource_name:"value"`)
+
+	decoded := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewKV3TextDecoder(bytes.NewReader(b.Bytes())).Decode(decoded))
+	s.RequireEqualKeyValue(root, decoded)
+
+	unknown := kv.FlagSubClass + 1
+	err := kv.NewKV3TextEncoder(&bytes.Buffer{}).
+		Encode(kv.NewKeyValueRoot("").AddChild(kv.NewKeyValue(kv.TypeString, "K", "V", nil).SetFlag(unknown)))
+
+	require.EqualError(err, `kv: cannot encode Value "V" to String: unknown flag Flag(6)`)
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+}
+
+func (s *KV3TextEncoderSuite) TestEncodeHeader() {
+	require := s.Require()
+	b := &bytes.Buffer{}
+
+	enc := kv.NewKV3TextEncoder(b).Header(kv.KV3Header{
+		Format:        "vpcf26",
+		FormatVersion: "26288658-411e-4f14-b698-2e1e5d00dec6",
+	})
+
+	require.NoError(enc.Encode(kv.NewKeyValueRoot("")))
+	require.Equal(
+		"<!-- kv3 encoding:text:version{e21c7f3c-8a33-41c5-9977-a76d3a32aa0d} "+
+			"format:vpcf26:version{26288658-411e-4f14-b698-2e1e5d00dec6} -->\n{  }\n",
+		b.String(),
+	)
+
+	decoder := kv.NewKV3TextDecoder(bytes.NewReader(b.Bytes()))
+
+	require.NoError(decoder.Decode(kv.NewKeyValueEmpty()))
+	require.Equal("vpcf26", decoder.Header().Format)
+}
+
+func (s *KV3TextEncoderSuite) TestEncodeErrors() {
+	require := s.Require()
+
+	err := kv.NewKV3TextEncoder(&bytes.Buffer{}).
+		Header(kv.KV3Header{FormatVersion: "not-a-guid"}).
+		Encode(kv.NewKeyValueRoot(""))
+
+	require.EqualError(err, `kv: invalid kv3 header version "not-a-guid": invalid value`)
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+
+	err = kv.NewKV3TextEncoder(&bytes.Buffer{}).
+		Encode(kv.NewKeyValueRoot("").AddChild(kv.NewKeyValue(kv.TypeEnd, "K", "", nil)))
+
+	require.EqualError(err, "kv: cannot encode node of type End")
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+
+	err = kv.NewKV3TextEncoder(&bytes.Buffer{}).
+		Encode(kv.NewKeyValueRoot("").AddChild(kv.NewKeyValue(kv.TypeBool, "K", "yes", nil)))
+
+	require.EqualError(err, `kv: cannot encode Value "yes" to Bool: strconv.ParseBool: parsing "yes": invalid syntax`)
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+
+	nonFinite := []struct {
+		Type  kv.Type
+		Value string
+	}{
+		{Type: kv.TypeDouble, Value: "NaN"},
+		{Type: kv.TypeDouble, Value: "+Inf"},
+		{Type: kv.TypeDouble, Value: "-infinity"},
+		{Type: kv.TypeFloat32, Value: "nan"},
+		{Type: kv.TypeFloat32, Value: "-Inf"},
+	}
+
+	for _, testCase := range nonFinite {
+		err = kv.NewKV3TextEncoder(&bytes.Buffer{}).
+			Encode(kv.NewKeyValueRoot("").AddChild(kv.NewKeyValue(testCase.Type, "K", testCase.Value, nil)))
+
+		expected := fmt.Sprintf("kv: cannot encode Value %q to %s: non-finite number", testCase.Value, testCase.Type)
+
+		require.EqualError(err, expected)
+		require.True(errors.Is(err, kv.ErrInvalidValue))
+	}
+}
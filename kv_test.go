@@ -0,0 +1,570 @@
+package kv_test
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestKeyValue(t *testing.T) {
+	suite.Run(t, &KeyValueSuite{})
+}
+
+type KeyValueSuite struct {
+	Suite
+}
+
+func (s *KeyValueSuite) TestArray() {
+	require := s.Require()
+
+	root := kv.NewKeyValueRoot("").AddArray("A")
+	array := root.Child("A")
+
+	require.Equal(kv.TypeArray, array.Type())
+	require.Nil(array.Index(0))
+
+	array.
+		AddString("", "a").
+		AddBool("", "true").
+		AddNull("").
+		AddArray("")
+
+	require.Len(array.Children(), 4)
+	require.Equal("a", array.Index(0).Value())
+	require.Equal(kv.TypeBool, array.Index(1).Type())
+	require.Equal(kv.TypeNull, array.Index(2).Type())
+	require.Equal(kv.TypeArray, array.Index(3).Type())
+	require.Equal(array, array.Index(3).Parent())
+	require.Nil(array.Index(4))
+	require.Nil(array.Index(-1))
+}
+
+func (s *KeyValueSuite) TestBool() {
+	require := s.Require()
+	node := kv.NewKeyValueBool("K", "1", nil)
+
+	b, err := node.AsBool()
+
+	require.NoError(err)
+	require.True(b)
+
+	require.NoError(node.SetBool(false))
+	require.Equal("false", node.Value())
+
+	b, err = node.AsBool()
+
+	require.NoError(err)
+	require.False(b)
+
+	_, err = node.SetValue("maybe").AsBool()
+
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+	require.True(errors.Is(err, strconv.ErrSyntax))
+
+	_, err = kv.NewKeyValueString("K", "true", nil).AsBool()
+
+	require.EqualError(err, `kv: cannot convert Value of type String to Bool`)
+	require.True(errors.Is(err, kv.ErrTypeMismatch))
+
+	err = kv.NewKeyValueString("K", "true", nil).SetBool(true)
+
+	require.True(errors.Is(err, kv.ErrTypeMismatch))
+}
+
+func (s *KeyValueSuite) TestDouble() {
+	require := s.Require()
+	node := kv.NewKeyValueDouble("K", "1.5", nil)
+
+	n, err := node.AsDouble()
+
+	require.NoError(err)
+	require.Equal(1.5, n)
+
+	require.NoError(node.SetDouble(-2.5e-30))
+	require.Equal("-2.5e-30", node.Value())
+
+	n, err = node.AsDouble()
+
+	require.NoError(err)
+	require.Equal(-2.5e-30, n)
+
+	_, err = node.SetValue("1.2.3").AsDouble()
+
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+
+	_, err = kv.NewKeyValueFloat32("K", "1.5", nil).AsDouble()
+
+	require.True(errors.Is(err, kv.ErrTypeMismatch))
+
+	err = kv.NewKeyValueFloat32("K", "1.5", nil).SetDouble(1)
+
+	require.True(errors.Is(err, kv.ErrTypeMismatch))
+}
+
+func (s *KeyValueSuite) TestBinary() {
+	require := s.Require()
+	node := kv.NewKeyValueBinary("K", "00ff", nil)
+
+	b, err := node.AsBinary()
+
+	require.NoError(err)
+	require.Equal([]byte{0x00, 0xff}, b)
+
+	require.NoError(node.SetBinary([]byte{0xde, 0xad}))
+	require.Equal("dead", node.Value())
+
+	_, err = node.SetValue("xyz").AsBinary()
+
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+
+	_, err = kv.NewKeyValueString("K", "00", nil).AsBinary()
+
+	require.True(errors.Is(err, kv.ErrTypeMismatch))
+
+	err = kv.NewKeyValueString("K", "00", nil).SetBinary(nil)
+
+	require.True(errors.Is(err, kv.ErrTypeMismatch))
+}
+
+func (s *KeyValueSuite) TestNull() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("").AddNull("N")
+
+	require.Equal(kv.TypeNull, root.Child("N").Type())
+	require.Equal("", root.Child("N").Value())
+	require.Equal(kv.TypeNull, kv.NewKeyValueNull("N", nil).Type())
+}
+
+func (s *KeyValueSuite) TestKeyMode() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("DOTAHeroes").
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+			AddString("Model", "models/heroes/axe/axe.vmdl"))
+
+	axe := root.Child("npc_dota_hero_axe")
+
+	require.Equal(kv.KeyModeExact, axe.KeyMode())
+	require.Nil(axe.Child("model"))
+	require.Equal("Model", axe.ChildMode("MODEL", kv.KeyModeCaseInsensitive).Key())
+
+	root.SetKeyMode(kv.KeyModeCaseInsensitive)
+
+	require.Equal(kv.KeyModeCaseInsensitive, axe.KeyMode())
+	require.Equal("Model", axe.Child("model").Key())
+	require.Equal(axe, root.Child("NPC_DOTA_HERO_AXE"))
+	require.Nil(axe.ChildMode("model", kv.KeyModeExact))
+
+	axe.SetKeyMode(kv.KeyModeExact)
+
+	require.Nil(axe.Child("model"))
+	require.Equal(axe, root.Child("NPC_DOTA_HERO_AXE"))
+
+	detached := kv.NewKeyValueObject("npc_dota_hero_sven", nil).AddString("Model", "sven.vmdl")
+
+	require.Nil(detached.Child("model"))
+
+	root.AddChild(detached)
+
+	require.Equal("Model", detached.Child("model").Key())
+
+	require.Equal("exact", kv.KeyModeExact.String())
+	require.Equal("case-insensitive", kv.KeyModeCaseInsensitive.String())
+	require.Equal("KeyMode(5)", kv.KeyMode(5).String())
+}
+
+func (s *KeyValueSuite) TestKeyModePaths() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("DOTAHeroes").
+		SetKeyMode(kv.KeyModeCaseInsensitive).
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+			AddString("Model", "models/heroes/axe/axe.vmdl").
+			AddString("AttackRate", "1.7"))
+
+	node, err := root.Get("NPC_Dota_Hero_Axe/model")
+
+	require.NoError(err)
+	require.Equal("Model", node.Key())
+
+	node, err = root.Set("npc_dota_hero_axe/MODEL", kv.TypeString, "axe_alt.vmdl")
+
+	require.NoError(err)
+	require.Equal("Model", node.Key())
+	require.Len(root.Child("npc_dota_hero_axe").Children(), 2)
+
+	matches, err := root.Query("*/attack*")
+
+	require.NoError(err)
+	require.Len(matches, 1)
+	require.Equal("npc_dota_hero_axe/AttackRate", matches[0].Path)
+
+	matches, err = root.Query(`*[model=axe_alt.vmdl]/~"^attack"`)
+
+	require.NoError(err)
+	require.Empty(matches)
+
+	node, err = root.Delete("npc_dota_hero_axe/attackrate")
+
+	require.NoError(err)
+	require.Equal("AttackRate", node.Key())
+
+	data, err := root.MarshalText()
+
+	require.NoError(err)
+	require.Contains(string(data), `"Model"`)
+}
+
+func (s *KeyValueSuite) TestChildIndex() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("items")
+
+	for i := 0; i < 100; i++ {
+		root.AddString("item_"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+
+	root.AddString("item_50", "duplicate")
+
+	require.Equal("50", root.Child("item_50").Value())
+	require.Equal("99", root.Child("item_99").Value())
+	require.Nil(root.Child("item_100"))
+	require.Nil(root.Child("ITEM_50"))
+
+	dups := root.ChildrenByKey("item_50")
+
+	require.Len(dups, 2)
+	require.Equal("50", dups[0].Value())
+	require.Equal("duplicate", dups[1].Value())
+
+	// AddChild
+	root.AddString("item_100", "100")
+
+	require.Equal("100", root.Child("item_100").Value())
+
+	// NewChild + SetKey
+	root.NewChild().SetType(kv.TypeString).SetKey("item_101").SetValue("101")
+
+	require.Equal("101", root.Child("item_101").Value())
+
+	// SetKey
+	root.Child("item_0").SetKey("item_zero")
+
+	require.Nil(root.Child("item_0"))
+	require.Equal("0", root.Child("item_zero").Value())
+
+	// removal
+	_, err := root.Delete("item_50")
+
+	require.NoError(err)
+	require.Equal("duplicate", root.Child("item_50").Value())
+	require.Len(root.ChildrenByKey("item_50"), 1)
+
+	root.SetChildren(root.Children()[:10]...)
+
+	require.Nil(root.Child("item_99"))
+	require.Equal("9", root.Child("item_9").Value())
+
+	for i := 10; i < 100; i++ {
+		root.AddString("Item_"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+
+	// key mode
+	require.Nil(root.Child("item_99"))
+	require.Equal("99", root.ChildMode("item_99", kv.KeyModeCaseInsensitive).Value())
+
+	root.SetKeyMode(kv.KeyModeCaseInsensitive)
+
+	require.Equal("99", root.Child("ITEM_99").Value())
+	require.Equal("9", root.Child("item_9").Value())
+	require.Nil(root.ChildMode("item_99", kv.KeyModeExact))
+	require.Len(root.ChildrenByKey("iTeM_20"), 1)
+
+	// disabled index
+	root.SetChildIndex(false)
+	root.AddString("item_100", "100")
+
+	require.Equal("100", root.Child("ITEM_100").Value())
+	require.Equal("9", root.Child("item_9").Value())
+	require.Len(root.ChildrenByKey("iTeM_20"), 1)
+	require.Equal("100", root.Clone().Child("item_100").Value())
+
+	root.SetChildIndex(true)
+	root.Child("item_100").SetKey("item_hundred")
+
+	require.Nil(root.Child("item_100"))
+	require.Equal("100", root.Child("item_hundred").Value())
+}
+
+func (s *KeyValueSuite) TestChildIndexConcurrent() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("items")
+
+	for i := 0; i < 100; i++ {
+		root.AddString("item_"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+
+	// concurrent lookups build the index, which must not race (with -race)
+	var wg sync.WaitGroup
+
+	values := make([]string, 8)
+
+	for i := range values {
+		i := i
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			values[i] = root.Child("item_" + strconv.Itoa(i)).Value()
+		}()
+	}
+
+	wg.Wait()
+
+	for i, v := range values {
+		require.Equal(strconv.Itoa(i), v)
+	}
+}
+
+func benchmarkChild(b *testing.B, n int, mode kv.KeyMode, scan bool) {
+	root := kv.NewKeyValueRoot("items").SetKeyMode(mode)
+	keys := make([]string, n)
+
+	for i := range keys {
+		keys[i] = "item_" + strconv.Itoa(i)
+		root.AddString(keys[i], strconv.Itoa(i))
+	}
+
+	root.SetChildIndex(!scan)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		key := keys[i%n]
+
+		root.Child(key)
+	}
+}
+
+func BenchmarkChild(b *testing.B) {
+	for _, n := range []int{8, 100, 10000} {
+		for _, mode := range []kv.KeyMode{kv.KeyModeExact, kv.KeyModeCaseInsensitive} {
+			n, mode := n, mode
+			name := strconv.Itoa(n) + "/" + mode.String()
+
+			b.Run("Index/"+name, func(b *testing.B) { benchmarkChild(b, n, mode, false) })
+			b.Run("Scan/"+name, func(b *testing.B) { benchmarkChild(b, n, mode, true) })
+		}
+	}
+}
+
+func (s *KeyValueSuite) keys(kv kv.KeyValue) []string {
+	keys := make([]string, 0, len(kv.Children()))
+
+	for _, c := range kv.Children() {
+		keys = append(keys, c.Key())
+	}
+
+	return keys
+}
+
+func (s *KeyValueSuite) TestInsertChild() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("").AddString("A", "a").AddString("B", "b")
+
+	root.InsertChild(1, kv.NewKeyValueString("C", "c", nil))
+
+	require.Equal([]string{"A", "C", "B"}, s.keys(root))
+	require.Equal(root, root.Child("C").Parent())
+
+	root.InsertChild(-1, kv.NewKeyValueString("D", "d", nil))
+	root.InsertChild(10, kv.NewKeyValueString("E", "e", nil))
+
+	require.Equal([]string{"D", "A", "C", "B", "E"}, s.keys(root))
+
+	// moving within the same parent
+	root.InsertChild(0, root.Child("B"))
+
+	require.Equal([]string{"B", "D", "A", "C", "E"}, s.keys(root))
+
+	// moving from another parent
+	other := kv.NewKeyValueRoot("").AddString("F", "f")
+	f := other.Child("F")
+
+	root.InsertChild(2, f)
+
+	require.Equal([]string{"B", "D", "F", "A", "C", "E"}, s.keys(root))
+	require.Empty(other.Children())
+	require.Equal(root, f.Parent())
+}
+
+func (s *KeyValueSuite) TestMoveChild() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("").AddString("A", "a").AddString("B", "b").AddString("C", "c")
+
+	require.Equal(root, root.MoveChild(0, 2))
+	require.Equal([]string{"B", "C", "A"}, s.keys(root))
+
+	root.MoveChild(2, 1)
+
+	require.Equal([]string{"B", "A", "C"}, s.keys(root))
+
+	root.MoveChild(0, 10)
+
+	require.Equal([]string{"A", "C", "B"}, s.keys(root))
+
+	root.MoveChild(3, 0)
+	root.MoveChild(-1, 0)
+
+	require.Equal([]string{"A", "C", "B"}, s.keys(root))
+
+	for _, c := range root.Children() {
+		require.Equal(root, c.Parent())
+	}
+}
+
+func (s *KeyValueSuite) TestRemoveChild() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("").AddString("A", "a").AddString("B", "b").AddString("A", "a2")
+	children := root.Children()
+	a2 := root.Index(2)
+
+	require.Equal(root, root.RemoveChild(a2))
+	require.Equal([]string{"A", "B"}, s.keys(root))
+	require.Nil(a2.Parent())
+	require.Len(children, 3)
+	require.Equal(a2, children[2])
+
+	root.RemoveChild(a2)
+	root.RemoveChild(kv.NewKeyValueString("B", "b", nil))
+
+	require.Equal([]string{"A", "B"}, s.keys(root))
+
+	b := root.RemoveIndex(1)
+
+	require.Equal("b", b.Value())
+	require.Nil(b.Parent())
+	require.Equal([]string{"A"}, s.keys(root))
+	require.Nil(root.RemoveIndex(1))
+	require.Nil(root.RemoveIndex(-1))
+
+	// removing while iterating
+	root.AddString("B", "b").AddString("C", "c")
+
+	for _, c := range root.Children() {
+		root.RemoveChild(c)
+	}
+
+	require.Empty(root.Children())
+}
+
+func (s *KeyValueSuite) TestDetach() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("").
+		AddChild(kv.NewKeyValueObject("O", nil).AddString("A", "a").AddString("B", "b"))
+
+	a := root.Child("O").Child("A")
+
+	require.Equal(a, a.Detach())
+	require.Nil(a.Parent())
+	require.Equal([]string{"B"}, s.keys(root.Child("O")))
+
+	a.Detach()
+
+	require.Nil(a.Parent())
+
+	// AddChild moves nodes between parents
+	root.AddChild(root.Child("O").Child("B"))
+
+	require.Equal([]string{"O", "B"}, s.keys(root))
+	require.Empty(root.Child("O").Children())
+	require.Equal(root, root.Child("B").Parent())
+
+	// AddChild of an existing child moves it last
+	root.AddChild(root.Child("O"))
+
+	require.Equal([]string{"B", "O"}, s.keys(root))
+}
+
+func (s *KeyValueSuite) TestSetChildrenParents() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("").AddString("A", "a").AddString("B", "b")
+	other := kv.NewKeyValueRoot("").AddString("C", "c")
+	a, b, c := root.Child("A"), root.Child("B"), other.Child("C")
+
+	root.SetChildren(b, c)
+
+	require.Equal([]string{"B", "C"}, s.keys(root))
+	require.Nil(a.Parent())
+	require.Equal(root, b.Parent())
+	require.Equal(root, c.Parent())
+	require.Empty(other.Children())
+}
+
+func (s *KeyValueSuite) TestClone() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("DOTAHeroes").
+		SetKeyMode(kv.KeyModeCaseInsensitive).
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+			AddString("Model", "models/heroes/axe/axe.vmdl").
+			AddChild(kv.NewKeyValueArray("Roles", nil).
+				AddString("", "Initiator")))
+
+	root.Child("npc_dota_hero_axe").Child("Model").SetFlag(kv.FlagResource)
+
+	clone := root.Clone()
+
+	require.True(kv.Equal(root, clone))
+	require.Nil(clone.Parent())
+	require.Equal(kv.KeyModeCaseInsensitive, clone.KeyMode())
+
+	axe := clone.Child("npc_dota_hero_axe")
+
+	require.NotSame(root.Child("npc_dota_hero_axe"), axe)
+	require.Equal(clone, axe.Parent())
+	require.Equal(axe, axe.Child("roles").Parent())
+	require.Equal(kv.FlagResource, axe.Child("Model").Flag())
+
+	// modifying the clone doesn't change the original
+	axe.Child("Model").SetValue("axe.vmdl")
+	axe.Child("Roles").AddString("", "Durable")
+	axe.AddString("AttackRate", "1.7")
+	clone.SetKey("Heroes")
+
+	require.Equal("models/heroes/axe/axe.vmdl", root.Child("npc_dota_hero_axe").Child("Model").Value())
+	require.Len(root.Child("npc_dota_hero_axe").Child("Roles").Children(), 1)
+	require.Len(root.Child("npc_dota_hero_axe").Children(), 2)
+	require.Equal("DOTAHeroes", root.Key())
+	require.False(kv.Equal(root, clone))
+
+	// subtrees keep their inherited key mode
+	sub := root.Child("npc_dota_hero_axe").Clone()
+
+	require.Nil(sub.Parent())
+	require.Equal(kv.KeyModeCaseInsensitive, sub.KeyMode())
+	require.Equal("Model", sub.Child("model").Key())
+}
+
+func (s *KeyValueSuite) TestCloneSyntax() {
+	require := s.Require()
+	root := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewTextDecoder(strings.NewReader(`"root" { "key" "value" } // comment`)).Lossless().Decode(root))
+
+	clone := root.Clone()
+
+	require.Equal(root.Child("key").Syntax(), clone.Child("key").Syntax())
+	require.NotSame(root.Child("key").Syntax(), clone.Child("key").Syntax())
+
+	var orig, cloned bytes.Buffer
+
+	require.NoError(kv.NewTextEncoder(&orig).Encode(root))
+	require.NoError(kv.NewTextEncoder(&cloned).Encode(clone))
+	require.Equal(orig.String(), cloned.String())
+}
@@ -0,0 +1,214 @@
+package kv
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// MapDuplicates represents how nodes with duplicate keys are represented in maps returned by ToMap.
+type MapDuplicates uint8
+
+// Map duplicate keys policies.
+const (
+	// MapDuplicatesSlice maps a key with duplicate nodes to a []interface{} with the values of the
+	// nodes, in order. It's the default policy.
+	MapDuplicatesSlice MapDuplicates = iota
+	// MapDuplicatesFirstWins maps a key with duplicate nodes to the value of the first node.
+	MapDuplicatesFirstWins
+	// MapDuplicatesLastWins maps a key with duplicate nodes to the value of the last node.
+	MapDuplicatesLastWins
+)
+
+// ToMap converts the Object node kv to a map, with an entry per key.
+//
+// Values are converted according to the node types: Object nodes to map[string]interface{}, Array
+// nodes to []interface{}, String and WString nodes to string, Int32, Color and Pointer nodes to
+// int32, Int64 nodes to int64, Uint64 nodes to uint64, Float32 nodes to float32, Double nodes to
+// float64, Bool nodes to bool, Binary nodes to []byte and Null nodes to nil. Flags are discarded.
+//
+// Returns a *TypeError if kv is not an Object node, if a node has an invalid value or if a node has
+// a type that can't be converted.
+func ToMap(kv KeyValue, duplicates MapDuplicates) (map[string]interface{}, error) {
+	if kv.Type() != TypeObject {
+		return nil, &TypeError{
+			Op:     OpConvert,
+			Key:    kv.Key(),
+			Type:   kv.Type(),
+			Target: TypeObject,
+			Err:    ErrTypeMismatch,
+		}
+	}
+
+	return toMap(kv, duplicates)
+}
+
+func toMap(kv KeyValue, duplicates MapDuplicates) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(kv.Children()))
+	counts := make(map[string]int, len(kv.Children()))
+
+	for _, c := range kv.Children() {
+		counts[c.Key()]++
+	}
+
+	for _, c := range kv.Children() {
+		key := c.Key()
+		_, exists := m[key]
+
+		if exists && duplicates == MapDuplicatesFirstWins {
+			continue
+		}
+
+		v, err := toMapValue(c, duplicates)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if counts[key] > 1 && duplicates == MapDuplicatesSlice {
+			values, _ := m[key].([]interface{})
+			m[key] = append(values, v)
+
+			continue
+		}
+
+		m[key] = v
+	}
+
+	return m, nil
+}
+
+func toMapValue(kv KeyValue, duplicates MapDuplicates) (interface{}, error) {
+	switch kv.Type() {
+	case TypeObject:
+		return toMap(kv, duplicates)
+	case TypeArray:
+		values := make([]interface{}, len(kv.Children()))
+
+		for i, c := range kv.Children() {
+			v, err := toMapValue(c, duplicates)
+
+			if err != nil {
+				return nil, err
+			}
+
+			values[i] = v
+		}
+
+		return values, nil
+	default:
+		return scalarValue(kv)
+	}
+}
+
+// FromMap builds a KeyValue tree from the map m and returns its root, an Object node with an empty
+// key.
+//
+// Maps (with string or integer keys) are converted to Object nodes, with a child node per entry
+// sorted by key, and slices and arrays to Array nodes, except for []byte, converted to Binary nodes.
+// Scalars are converted to the closest node types: Go strings to TypeString, int32 (and smaller
+// signed integers) to TypeInt32, int and int64 to TypeInt64, unsigned integers to TypeUint64,
+// float32 to TypeFloat32, float64 to TypeDouble and bool to TypeBool. Pointers and interfaces are
+// converted as the values they point to, and nil values to Null nodes.
+//
+// Returns a *MarshalError if a value has a Go type that can't be converted, like structs or
+// channels. Use Marshal to convert structs.
+func FromMap(m map[string]interface{}) (KeyValue, error) {
+	root := NewKeyValueRoot("")
+
+	if err := fromMapValue(root, reflect.ValueOf(m)); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+func fromMapValue(kv KeyValue, rv reflect.Value) error {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			break
+		}
+
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Invalid, reflect.Ptr, reflect.Interface:
+		kv.SetType(TypeNull)
+	case reflect.String:
+		kv.SetType(TypeString).SetValue(rv.String())
+	case reflect.Bool:
+		kv.SetType(TypeBool).SetValue(strconv.FormatBool(rv.Bool()))
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		kv.SetType(TypeInt32).SetValue(strconv.FormatInt(rv.Int(), 10))
+	case reflect.Int, reflect.Int64:
+		kv.SetType(TypeInt64).SetValue(strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		kv.SetType(TypeUint64).SetValue(strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32:
+		kv.SetType(TypeFloat32).SetValue(strconv.FormatFloat(rv.Float(), 'g', -1, 32))
+	case reflect.Float64:
+		kv.SetType(TypeDouble).SetValue(strconv.FormatFloat(rv.Float(), 'g', -1, 64))
+	case reflect.Map:
+		if rv.IsNil() {
+			kv.SetType(TypeNull)
+			return nil
+		}
+
+		return fromMapEntries(kv.SetType(TypeObject), rv)
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			kv.SetType(TypeNull)
+			return nil
+		}
+
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+
+			return kv.SetType(TypeBinary).SetBinary(b)
+		}
+
+		kv.SetType(TypeArray)
+
+		for i := 0; i < rv.Len(); i++ {
+			if err := fromMapValue(kv.NewChild(), rv.Index(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return &MarshalError{Op: OpMarshal, Key: kv.Key(), GoType: rv.Type(), Err: ErrUnsupportedType}
+	}
+
+	return nil
+}
+
+func fromMapEntries(kv KeyValue, rv reflect.Value) error {
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+
+	entries := make([]entry, 0, rv.Len())
+	iter := rv.MapRange()
+
+	for iter.Next() {
+		key, ok := mapKey(iter.Key())
+
+		if !ok {
+			return &MarshalError{Op: OpMarshal, Key: kv.Key(), GoType: rv.Type(), Err: ErrUnsupportedType}
+		}
+
+		entries = append(entries, entry{key: key, value: iter.Value()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	for _, e := range entries {
+		if err := fromMapValue(kv.NewChild().SetKey(e.key), e.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,196 @@
+package kv_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestMap(t *testing.T) {
+	suite.Run(t, &MapSuite{})
+}
+
+type MapSuite struct {
+	Suite
+}
+
+func (s *MapSuite) hero() kv.KeyValue {
+	return kv.NewKeyValueRoot("npc_dota_hero_axe").
+		AddString("Model", "models/heroes/axe/axe.vmdl").
+		AddString("Ability1", "axe_berserkers_call").
+		AddInt32("AttributeBaseStrength", "25").
+		AddString("Ability1", "axe_battle_hunger").
+		AddChild(kv.NewKeyValueObject("Bot", nil).
+			AddColor("Color", "255").
+			AddPointer("Pointer", "1").
+			AddInt64("Int64", "-1").
+			AddUint64("Uint64", "18446744073709551615").
+			AddFloat32("Float32", "1.5").
+			AddDouble("Double", "2.5").
+			AddBool("Bool", "1").
+			AddBinary("Binary", "00ff").
+			AddNull("Null").
+			AddChild(kv.NewKeyValue(kv.TypeWString, "WString", "w", nil)).
+			AddChild(kv.NewKeyValueArray("Roles", nil).
+				AddString("", "Initiator").
+				AddString("", "Durable")))
+}
+
+func (s *MapSuite) TestToMap() {
+	require := s.Require()
+
+	bot := map[string]interface{}{
+		"Color":   int32(255),
+		"Pointer": int32(1),
+		"Int64":   int64(-1),
+		"Uint64":  uint64(18446744073709551615),
+		"Float32": float32(1.5),
+		"Double":  float64(2.5),
+		"Bool":    true,
+		"Binary":  []byte{0x00, 0xff},
+		"Null":    nil,
+		"WString": "w",
+		"Roles":   []interface{}{"Initiator", "Durable"},
+	}
+
+	testCases := []struct {
+		TestName   string
+		Duplicates kv.MapDuplicates
+		Ability1   interface{}
+	}{
+		{
+			TestName:   "Slice",
+			Duplicates: kv.MapDuplicatesSlice,
+			Ability1:   []interface{}{"axe_berserkers_call", "axe_battle_hunger"},
+		},
+		{
+			TestName:   "FirstWins",
+			Duplicates: kv.MapDuplicatesFirstWins,
+			Ability1:   "axe_berserkers_call",
+		},
+		{
+			TestName:   "LastWins",
+			Duplicates: kv.MapDuplicatesLastWins,
+			Ability1:   "axe_battle_hunger",
+		},
+	}
+
+	for _, testCase := range testCases {
+		m, err := kv.ToMap(s.hero(), testCase.Duplicates)
+
+		require.NoErrorf(err, "case %s", testCase.TestName)
+		require.Equalf(map[string]interface{}{
+			"Model":                 "models/heroes/axe/axe.vmdl",
+			"Ability1":              testCase.Ability1,
+			"AttributeBaseStrength": int32(25),
+			"Bot":                   bot,
+		}, m, "case %s", testCase.TestName)
+	}
+}
+
+func (s *MapSuite) TestToMapErrors() {
+	require := s.Require()
+
+	_, err := kv.ToMap(kv.NewKeyValueString("Model", "axe.vmdl", nil), kv.MapDuplicatesSlice)
+
+	require.EqualError(err, "kv: cannot convert Value of type String to Object")
+	require.True(errors.Is(err, kv.ErrTypeMismatch))
+
+	_, err = kv.ToMap(kv.NewKeyValueRoot("").AddInt32("Version", "x"), kv.MapDuplicatesSlice)
+
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+
+	_, err = kv.ToMap(kv.NewKeyValueRoot("").AddChild(kv.NewKeyValue(kv.TypeEnd, "", "", nil)), kv.MapDuplicatesSlice)
+
+	require.EqualError(err, "kv: cannot convert node of type End")
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+}
+
+func (s *MapSuite) TestFromMap() {
+	require := s.Require()
+	name := "axe"
+
+	root, err := kv.FromMap(map[string]interface{}{
+		"Name":    &name,
+		"Int32":   int32(-1),
+		"Int16":   int16(2),
+		"Int":     3,
+		"Uint8":   uint8(4),
+		"Float32": float32(1.5),
+		"Float64": 2.5,
+		"Bool":    false,
+		"Binary":  []byte{0xca, 0xfe},
+		"Null":    nil,
+		"NilMap":  map[string]int(nil),
+		"Roles":   []string{"Initiator", "Durable"},
+		"Abilities": map[int]interface{}{
+			2: "axe_battle_hunger",
+			1: "axe_berserkers_call",
+		},
+		"Nested": []interface{}{map[string]bool{"b": true, "a": false}, [2]int{1, 2}},
+	})
+
+	require.NoError(err)
+
+	expected := kv.NewKeyValueRoot("").
+		AddChild(kv.NewKeyValueObject("Abilities", nil).
+			AddString("1", "axe_berserkers_call").
+			AddString("2", "axe_battle_hunger")).
+		AddBinary("Binary", "cafe").
+		AddBool("Bool", "false").
+		AddFloat32("Float32", "1.5").
+		AddDouble("Float64", "2.5").
+		AddInt64("Int", "3").
+		AddInt32("Int16", "2").
+		AddInt32("Int32", "-1").
+		AddString("Name", "axe").
+		AddChild(kv.NewKeyValueArray("Nested", nil).
+			AddChild(kv.NewKeyValueObject("", nil).
+				AddBool("a", "false").
+				AddBool("b", "true")).
+			AddChild(kv.NewKeyValueArray("", nil).
+				AddInt64("", "1").
+				AddInt64("", "2"))).
+		AddNull("NilMap").
+		AddNull("Null").
+		AddChild(kv.NewKeyValueArray("Roles", nil).
+			AddString("", "Initiator").
+			AddString("", "Durable")).
+		AddUint64("Uint8", "4")
+
+	require.True(kv.Equal(expected, root), "%s", kv.Diff(expected, root))
+}
+
+func (s *MapSuite) TestFromMapErrors() {
+	require := s.Require()
+
+	_, err := kv.FromMap(map[string]interface{}{"Channel": make(chan int)})
+
+	require.EqualError(err, "kv: cannot marshal Go value of type chan int")
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+
+	_, err = kv.FromMap(map[string]interface{}{"Map": map[float64]string{1: "a"}})
+
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+}
+
+func (s *MapSuite) TestRoundTrip() {
+	require := s.Require()
+	hero := s.hero()
+
+	m, err := kv.ToMap(hero, kv.MapDuplicatesLastWins)
+
+	require.NoError(err)
+
+	root, err := kv.FromMap(m)
+
+	require.NoError(err)
+
+	m2, err := kv.ToMap(root, kv.MapDuplicatesLastWins)
+
+	require.NoError(err)
+	require.Equal(m, m2)
+}
@@ -0,0 +1,425 @@
+package kv
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	tagName      = "kv"
+	tagSkip      = "-"
+	tagOmitEmpty = "omitempty"
+	tagRemain    = "remain"
+)
+
+// Marshaler is the interface implemented by types that can marshal themselves into a KeyValue
+// node.
+//
+// The key of the returned node is replaced by the key of the marshaled field, map entry or element.
+type Marshaler interface {
+	MarshalKV() (KeyValue, error)
+}
+
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+// Marshal returns a KeyValue tree representing v.
+//
+// If v (or a pointer to v, if addressable) implements Marshaler, Marshal calls its MarshalKV
+// method to produce the node. Otherwise:
+//
+// Structs and maps (with string or integer keys) are marshaled as Object nodes, with a child node
+// per exported struct field or map entry. Map entries are sorted by key. Slices and arrays are
+// marshaled as Object nodes with children keyed by their indexes ("0", "1", ...). Pointers and
+// interfaces are marshaled as the values they point to, and nil pointers and interfaces are
+// omitted.
+//
+// Scalars are marshaled to types that both TextEncoder and BinaryEncoder can write: Go int32 (and
+// smaller signed integers) to TypeInt32, int and int64 to TypeInt64, unsigned integers to
+// TypeUint64, float32 and float64 to TypeFloat32, bool to TypeInt32 (0 or 1) and strings to
+// TypeString.
+//
+// Struct fields can be customized with the "kv" tag, which gives the field's key and options,
+// separated by commas:
+//
+//   // Field is marshaled with key "name"
+//   Field string `kv:"name"`
+//   // Field is omitted if it has a zero value
+//   Field int32 `kv:"name,omitempty"`
+//   // Field is ignored
+//   Field string `kv:"-"`
+//   // Field's entries are marshaled as children of the struct's node
+//   Field map[string]string `kv:",remain"`
+//
+// The "remain" option is only valid on map fields (or pointers to maps), and is meant to hold the
+// children with dynamic keys that UnmarshalKeyValue doesn't match to other fields.
+//
+// Fields of embedded structs are marshaled as if they were fields of the outer struct, unless the
+// embedded struct field has a key in its tag.
+//
+// The returned root node has an empty key.
+func Marshal(v interface{}) (KeyValue, error) {
+	rv := reflect.ValueOf(v)
+
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			break
+		}
+
+		rv = rv.Elem()
+	}
+
+	if !rv.IsValid() || ((rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) && rv.IsNil()) {
+		return nil, &MarshalError{Op: OpMarshal, GoType: reflect.TypeOf(v), Err: ErrUnsupportedType}
+	}
+
+	kv := NewKeyValueEmpty()
+
+	if err := marshalValue(kv, rv); err != nil {
+		return nil, err
+	}
+
+	return kv, nil
+}
+
+// marshaler returns rv as a Marshaler, if rv (or a pointer to rv, if addressable) implements it.
+func marshaler(rv reflect.Value) (Marshaler, bool) {
+	if !rv.CanInterface() {
+		return nil, false
+	}
+
+	if rv.Type().Implements(marshalerType) {
+		return rv.Interface().(Marshaler), true
+	}
+
+	if rv.CanAddr() && rv.Addr().Type().Implements(marshalerType) {
+		return rv.Addr().Interface().(Marshaler), true
+	}
+
+	return nil, false
+}
+
+func marshalValue(kv KeyValue, rv reflect.Value) error {
+	if m, ok := marshaler(rv); ok {
+		node, err := m.MarshalKV()
+
+		if err != nil {
+			return err
+		}
+
+		kv.SetType(node.Type()).SetValue(node.Value()).SetFlag(node.Flag()).SetChildren(node.Children()...)
+
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		kv.SetType(TypeString).SetValue(rv.String())
+	case reflect.Bool:
+		value := "0"
+
+		if rv.Bool() {
+			value = "1"
+		}
+
+		kv.SetType(TypeInt32).SetValue(value)
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		kv.SetType(TypeInt32).SetValue(strconv.FormatInt(rv.Int(), 10))
+	case reflect.Int, reflect.Int64:
+		kv.SetType(TypeInt64).SetValue(strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		kv.SetType(TypeUint64).SetValue(strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		kv.SetType(TypeFloat32).SetValue(strconv.FormatFloat(rv.Float(), 'f', -1, 32))
+	case reflect.Struct:
+		return marshalStruct(kv.SetType(TypeObject), rv)
+	case reflect.Map:
+		return marshalMap(kv.SetType(TypeObject), rv)
+	case reflect.Slice, reflect.Array:
+		kv.SetType(TypeObject)
+
+		for i := 0; i < rv.Len(); i++ {
+			if err := marshalChild(kv, strconv.Itoa(i), rv.Index(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return &MarshalError{Op: OpMarshal, Key: kv.Key(), GoType: rv.Type(), Err: ErrUnsupportedType}
+	}
+
+	return nil
+}
+
+// marshalChild adds a child node with the given key representing rv, unless rv is a nil pointer or
+// interface.
+func marshalChild(kv KeyValue, key string, rv reflect.Value) error {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+
+		rv = rv.Elem()
+	}
+
+	return marshalValue(kv.NewChild().SetKey(key), rv)
+}
+
+func marshalStruct(kv KeyValue, rv reflect.Value) error {
+	for _, f := range cachedFields(rv.Type()) {
+		fv, ok := fieldByIndex(rv, f.index, false)
+
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+
+		if f.remain {
+			if err := marshalRemain(kv, fv); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := marshalChild(kv, f.name, fv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// marshalRemain adds the entries of the map field rv with the "remain" option as children of kv.
+func marshalRemain(kv KeyValue, rv reflect.Value) error {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Map {
+		return &MarshalError{Op: OpMarshal, Key: kv.Key(), GoType: rv.Type(), Err: ErrUnsupportedType}
+	}
+
+	return marshalMap(kv, rv)
+}
+
+func marshalMap(kv KeyValue, rv reflect.Value) error {
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+
+	entries := make([]entry, 0, rv.Len())
+	iter := rv.MapRange()
+
+	for iter.Next() {
+		key, ok := mapKey(iter.Key())
+
+		if !ok {
+			return &MarshalError{Op: OpMarshal, Key: kv.Key(), GoType: rv.Type(), Err: ErrUnsupportedType}
+		}
+
+		entries = append(entries, entry{key: key, value: iter.Value()})
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	for _, e := range entries {
+		if err := marshalChild(kv, e.key, e.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mapKey returns the string form of a map key, if it's a string or an integer.
+func mapKey(k reflect.Value) (string, bool) {
+	switch k.Kind() {
+	case reflect.String:
+		return k.String(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), true
+	default:
+		return "", false
+	}
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+
+	return false
+}
+
+// field is a marshaled struct field, possibly promoted from an embedded struct.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	remain    bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+func cachedFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+
+	return f.([]field)
+}
+
+// typeFields returns the marshaled fields of a struct type, including fields promoted from
+// embedded structs. Fields of outer structs take precedence over promoted fields with the same key.
+func typeFields(t reflect.Type) []field {
+	var (
+		fields  []field
+		visited = map[reflect.Type]bool{}
+		names   = map[string]bool{}
+	)
+
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+
+	next := []embedded{{typ: t}}
+
+	for len(next) > 0 {
+		current := next
+		next = nil
+
+		var level []field
+
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+
+			visited[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+				sf := e.typ.Field(i)
+				tag := sf.Tag.Get(tagName)
+
+				if tag == tagSkip {
+					continue
+				}
+
+				name, opts := parseTag(tag)
+				index := append(append([]int(nil), e.index...), i)
+				ft := sf.Type
+
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+
+				if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+					next = append(next, embedded{typ: ft, index: index})
+					continue
+				}
+
+				if sf.PkgPath != "" {
+					continue
+				}
+
+				if name == "" {
+					name = sf.Name
+				}
+
+				level = append(level, field{
+					name:      name,
+					index:     index,
+					omitEmpty: opts.has(tagOmitEmpty),
+					remain:    opts.has(tagRemain),
+				})
+			}
+		}
+
+		for _, f := range level {
+			if !names[f.name] {
+				names[f.name] = true
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool { return lessIndex(fields[i].index, fields[j].index) })
+
+	return fields
+}
+
+// lessIndex sorts fields in declaration order, with promoted fields in place of their embedded
+// struct.
+func lessIndex(a, b []int) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+
+	return len(a) < len(b)
+}
+
+// fieldByIndex returns the nested field of rv with the given index. Nil embedded struct pointers
+// are allocated if alloc is true, otherwise the field is reported as missing.
+func fieldByIndex(rv reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				if !alloc || !rv.CanSet() {
+					return reflect.Value{}, false
+				}
+
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+
+			rv = rv.Elem()
+		}
+
+		rv = rv.Field(x)
+	}
+
+	return rv, true
+}
+
+type tagOptions string
+
+func parseTag(tag string) (string, tagOptions) {
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		return tag[:i], tagOptions(tag[i+1:])
+	}
+
+	return tag, ""
+}
+
+func (o tagOptions) has(name string) bool {
+	for _, opt := range strings.Split(string(o), ",") {
+		if opt == name {
+			return true
+		}
+	}
+
+	return false
+}
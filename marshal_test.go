@@ -0,0 +1,556 @@
+package kv_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestMarshal(t *testing.T) {
+	suite.Run(t, &MarshalSuite{})
+}
+
+type MarshalSuite struct {
+	Suite
+}
+
+type marshalBase struct {
+	ID   int64
+	Name string `kv:"name"`
+}
+
+type marshalHero struct {
+	marshalBase
+
+	Name      string `kv:"hero_name"`
+	Enabled   bool
+	Level     int32             `kv:"level,omitempty"`
+	XP        uint64            `kv:"xp,omitempty"`
+	Speed     float32           `kv:"speed"`
+	Abilities []string          `kv:"abilities"`
+	Stats     map[string]int32  `kv:"stats"`
+	Talent    *marshalTalent    `kv:"talent"`
+	Extra     map[string]string `kv:"extra,omitempty"`
+	Ignored   string            `kv:"-"`
+	ignored   string
+}
+
+type marshalTalent struct {
+	Level int32  `kv:"level"`
+	Name  string `kv:"name"`
+}
+
+func (s *MarshalSuite) TestMarshal() {
+	require := s.Require()
+
+	hero := marshalHero{
+		marshalBase: marshalBase{ID: 1, Name: "npc_dota_hero_axe"},
+		Name:        "Axe",
+		Enabled:     true,
+		XP:          100,
+		Speed:       310.5,
+		Abilities:   []string{"axe_berserkers_call", "axe_culling_blade"},
+		Stats:       map[string]int32{"str": 25, "agi": 20},
+		Ignored:     "ignored",
+		ignored:     "ignored",
+	}
+
+	actual, err := kv.Marshal(&hero)
+
+	require.NoError(err)
+
+	expected := kv.NewKeyValueRoot("").
+		AddInt64("ID", "1").
+		AddString("name", "npc_dota_hero_axe").
+		AddString("hero_name", "Axe").
+		AddInt32("Enabled", "1").
+		AddUint64("xp", "100").
+		AddFloat32("speed", "310.5").
+		AddChild(kv.NewKeyValueObject("abilities", nil).
+			AddString("0", "axe_berserkers_call").
+			AddString("1", "axe_culling_blade")).
+		AddChild(kv.NewKeyValueObject("stats", nil).
+			AddInt32("agi", "20").
+			AddInt32("str", "25"))
+
+	s.RequireEqualKeyValue(expected, actual)
+
+	b := &bytes.Buffer{}
+
+	require.NoError(kv.NewBinaryEncoder(b).Encode(actual.SetKey("hero")))
+}
+
+func (s *MarshalSuite) TestMarshalScalars() {
+	require := s.Require()
+
+	testCases := []struct {
+		Value    interface{}
+		Type     kv.Type
+		Expected string
+	}{
+		{Value: "s", Type: kv.TypeString, Expected: "s"},
+		{Value: false, Type: kv.TypeInt32, Expected: "0"},
+		{Value: int8(-8), Type: kv.TypeInt32, Expected: "-8"},
+		{Value: int32(-32), Type: kv.TypeInt32, Expected: "-32"},
+		{Value: -1, Type: kv.TypeInt64, Expected: "-1"},
+		{Value: int64(-64), Type: kv.TypeInt64, Expected: "-64"},
+		{Value: uint8(8), Type: kv.TypeUint64, Expected: "8"},
+		{Value: uint64(18446744073709551615), Type: kv.TypeUint64, Expected: "18446744073709551615"},
+		{Value: float32(1.5), Type: kv.TypeFloat32, Expected: "1.5"},
+		{Value: 0.1, Type: kv.TypeFloat32, Expected: "0.1"},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := kv.Marshal(testCase.Value)
+
+		require.NoErrorf(err, "%T", testCase.Value)
+		require.Equalf(testCase.Type, actual.Type(), "%T", testCase.Value)
+		require.Equalf(testCase.Expected, actual.Value(), "%T", testCase.Value)
+	}
+}
+
+func (s *MarshalSuite) TestMarshalErrors() {
+	require := s.Require()
+
+	var marshalErr *kv.MarshalError
+
+	_, err := kv.Marshal(struct{ C chan int }{})
+
+	require.EqualError(err, "kv: cannot marshal Go value of type chan int")
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+	require.True(errors.As(err, &marshalErr))
+	require.Equal("C", marshalErr.Key)
+
+	_, err = kv.Marshal(map[bool]string{true: "true"})
+
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+
+	_, err = kv.Marshal(nil)
+
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+
+	_, err = kv.Marshal((*marshalHero)(nil))
+
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+}
+
+func (s *MarshalSuite) TestUnmarshalText() {
+	require := s.Require()
+
+	data := []byte(`"hero"
+{
+	"ID" "1"
+	"name" "npc_dota_hero_axe"
+	"HERO_NAME" "Axe"
+	"Enabled" "1"
+	"level" "25"
+	"speed" "310.5"
+	"abilities"
+	{
+		"1" "axe_berserkers_call"
+		"2" "axe_culling_blade"
+	}
+	"stats"
+	{
+		"str" "25"
+		"agi" "20"
+	}
+	"talent"
+	{
+		"level" "10"
+		"name" "special_bonus_armor_3"
+	}
+	"unknown" "ignored"
+}`)
+
+	var actual marshalHero
+
+	require.NoError(kv.Unmarshal(data, &actual))
+
+	expected := marshalHero{
+		marshalBase: marshalBase{ID: 1, Name: "npc_dota_hero_axe"},
+		Name:        "Axe",
+		Enabled:     true,
+		Level:       25,
+		Speed:       310.5,
+		Abilities:   []string{"axe_berserkers_call", "axe_culling_blade"},
+		Stats:       map[string]int32{"str": 25, "agi": 20},
+		Talent:      &marshalTalent{Level: 10, Name: "special_bonus_armor_3"},
+	}
+
+	require.Equal(expected, actual)
+}
+
+func (s *MarshalSuite) TestUnmarshalBinary() {
+	require := s.Require()
+
+	var actual struct {
+		Status    string `kv:"status"`
+		NumParams int    `kv:"num_params"`
+		GameID    uint64 `kv:"WatchableGameID"`
+		Param1    *int32 `kv:"param1"`
+	}
+
+	require.NoError(kv.Unmarshal(binData1, &actual))
+	require.Equal("#DOTA_RP_LEAGUE_MATCH_PLAYING_AS", actual.Status)
+	require.Equal(3, actual.NumParams)
+	require.Equal(uint64(26628083760328052), actual.GameID)
+	require.NotNil(actual.Param1)
+	require.Equal(int32(8), *actual.Param1)
+}
+
+func (s *MarshalSuite) TestUnmarshalKeyValue() {
+	require := s.Require()
+
+	root := kv.NewKeyValueRoot("").
+		AddChild(kv.NewKeyValueArray("array", nil).
+			AddInt32("", "1").
+			AddDouble("", "2.5").
+			AddNull("")).
+		AddBinary("blob", "dead").
+		AddBool("bool", "true").
+		AddNull("null").
+		AddChild(kv.NewKeyValueObject("object", nil).AddString("key", "value"))
+
+	var generic interface{}
+
+	require.NoError(kv.UnmarshalKeyValue(root, &generic))
+	require.Equal(map[string]interface{}{
+		"array":  []interface{}{int32(1), 2.5, nil},
+		"blob":   []byte{0xde, 0xad},
+		"bool":   true,
+		"null":   nil,
+		"object": map[string]interface{}{"key": "value"},
+	}, generic)
+
+	var typed struct {
+		Array  [2]float64
+		Blob   []byte
+		Bool   bool
+		Null   *string
+		Object map[string]string
+	}
+
+	typed.Null = new(string)
+
+	require.NoError(kv.UnmarshalKeyValue(root, &typed))
+	require.Equal([2]float64{1, 2.5}, typed.Array)
+	require.Equal([]byte{0xde, 0xad}, typed.Blob)
+	require.True(typed.Bool)
+	require.Nil(typed.Null)
+	require.Equal(map[string]string{"key": "value"}, typed.Object)
+
+	var keys map[int]string
+
+	require.NoError(kv.UnmarshalKeyValue(kv.NewKeyValueRoot("").AddString("1", "a").AddString("2", "b"), &keys))
+	require.Equal(map[int]string{1: "a", 2: "b"}, keys)
+}
+
+func (s *MarshalSuite) TestRoundTrip() {
+	require := s.Require()
+
+	expected := marshalHero{
+		marshalBase: marshalBase{ID: 1, Name: "npc_dota_hero_axe"},
+		Name:        "Axe",
+		Level:       25,
+		Speed:       310.5,
+		Abilities:   []string{"axe_berserkers_call"},
+		Stats:       map[string]int32{"str": 25},
+		Talent:      &marshalTalent{Level: 10, Name: "special_bonus_armor_3"},
+		Extra:       map[string]string{"a": "b"},
+	}
+
+	root, err := kv.Marshal(expected)
+
+	require.NoError(err)
+
+	text, err := root.SetKey("hero").MarshalText()
+
+	require.NoError(err)
+
+	var actual marshalHero
+
+	require.NoError(kv.Unmarshal(text, &actual))
+	require.Equal(expected, actual)
+}
+
+func (s *MarshalSuite) TestRemain() {
+	require := s.Require()
+
+	type heroes struct {
+		Version int32                    `kv:"Version"`
+		Heroes  map[string]marshalTalent `kv:",remain"`
+	}
+
+	root := kv.NewKeyValueRoot("").
+		AddInt32("Version", "1").
+		AddChild(kv.NewKeyValueObject("axe", nil).AddInt32("level", "10").AddString("name", "armor")).
+		AddChild(kv.NewKeyValueObject("sven", nil).AddInt32("level", "25"))
+
+	var actual heroes
+
+	require.NoError(kv.UnmarshalKeyValue(root, &actual))
+	require.Equal(heroes{
+		Version: 1,
+		Heroes: map[string]marshalTalent{
+			"axe":  {Level: 10, Name: "armor"},
+			"sven": {Level: 25},
+		},
+	}, actual)
+
+	marshaled, err := kv.Marshal(actual)
+
+	require.NoError(err)
+
+	expected := kv.NewKeyValueRoot("").
+		AddInt32("Version", "1").
+		AddChild(kv.NewKeyValueObject("axe", nil).AddInt32("level", "10").AddString("name", "armor")).
+		AddChild(kv.NewKeyValueObject("sven", nil).AddInt32("level", "25").AddString("name", ""))
+
+	s.RequireEqualKeyValue(expected, marshaled)
+
+	var invalid struct {
+		Rest []string `kv:",remain"`
+	}
+
+	err = kv.UnmarshalKeyValue(root, &invalid)
+
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+
+	_, err = kv.Marshal(invalid)
+
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+}
+
+//nolint:lll
+func (s *MarshalSuite) TestUnmarshalErrors() {
+	require := s.Require()
+
+	var marshalErr *kv.MarshalError
+
+	err := kv.UnmarshalKeyValue(kv.NewKeyValueRoot(""), marshalHero{})
+
+	require.EqualError(err, "kv: cannot unmarshal into Go value of type kv_test.marshalHero: invalid target")
+	require.True(errors.Is(err, kv.ErrInvalidTarget))
+
+	err = kv.UnmarshalKeyValue(kv.NewKeyValueRoot(""), nil)
+
+	require.True(errors.Is(err, kv.ErrInvalidTarget))
+
+	var hero marshalHero
+
+	err = kv.UnmarshalKeyValue(kv.NewKeyValueRoot("").AddString("talent", "x"), &hero)
+
+	require.EqualError(err, `kv: cannot unmarshal node "talent" of type String into Go value of type kv_test.marshalTalent`)
+	require.True(errors.Is(err, kv.ErrTypeMismatch))
+	require.True(errors.As(err, &marshalErr))
+	require.Equal("talent", marshalErr.Key)
+	require.Equal(kv.TypeString, marshalErr.Type)
+	require.Equal(reflect.TypeOf(marshalTalent{}), marshalErr.GoType)
+
+	err = kv.UnmarshalKeyValue(kv.NewKeyValueRoot("").AddString("level", "x"), &hero)
+
+	require.EqualError(err, `kv: cannot unmarshal Value "x" into Go value of type int32: strconv.ParseInt: parsing "x": invalid syntax`)
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+	require.True(errors.Is(err, strconv.ErrSyntax))
+
+	err = kv.UnmarshalKeyValue(kv.NewKeyValueRoot("").AddString("level", "4294967296"), &hero)
+
+	require.True(errors.Is(err, strconv.ErrRange))
+
+	var generic interface{}
+
+	err = kv.UnmarshalKeyValue(kv.NewKeyValueRoot("").AddChild(kv.NewKeyValue(kv.TypeEnd, "end", "", nil)), &generic)
+
+	require.EqualError(err, `kv: cannot unmarshal node "end" of type End into Go value of type interface {}`)
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+	require.True(errors.As(err, &marshalErr))
+
+	err = kv.UnmarshalKeyValue(kv.NewKeyValueRoot("").AddInt32("level", "x"), &generic)
+
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+	require.True(errors.Is(err, strconv.ErrSyntax))
+
+	var ch chan int
+
+	err = kv.UnmarshalKeyValue(kv.NewKeyValueString("K", "V", nil), &ch)
+
+	require.True(errors.Is(err, kv.ErrUnsupportedType))
+
+	err = kv.Unmarshal([]byte(`"K" {`), &hero)
+
+	require.True(errors.Is(err, kv.ErrUnexpectedEOF))
+}
+
+// vector is a space-separated vector, like "1.0 2.0 3.0".
+type vector [3]float32
+
+func (v vector) MarshalKV() (kv.KeyValue, error) {
+	fields := make([]string, len(v))
+
+	for i, n := range v {
+		fields[i] = strconv.FormatFloat(float64(n), 'f', 1, 32)
+	}
+
+	return kv.NewKeyValueString("", strings.Join(fields, " "), nil), nil
+}
+
+func (v *vector) UnmarshalKV(node kv.KeyValue) error {
+	fields := strings.Fields(node.Value())
+
+	if len(fields) != len(v) {
+		return fmt.Errorf("invalid vector %q", node.Value())
+	}
+
+	for i, s := range fields {
+		n, err := strconv.ParseFloat(s, 32)
+
+		if err != nil {
+			return err
+		}
+
+		v[i] = float32(n)
+	}
+
+	return nil
+}
+
+// color is an RGBA color, like "255 128 0 255".
+type color struct {
+	R, G, B, A uint8
+}
+
+func (c *color) MarshalKV() (kv.KeyValue, error) {
+	value := fmt.Sprintf("%d %d %d %d", c.R, c.G, c.B, c.A)
+	return kv.NewKeyValueString("", value, nil), nil
+}
+
+func (c *color) UnmarshalKV(node kv.KeyValue) error {
+	_, err := fmt.Sscanf(node.Value(), "%d %d %d %d", &c.R, &c.G, &c.B, &c.A)
+	return err
+}
+
+// unitCapabilities is a bitflag, like "DOTA_UNIT_CAP_MELEE_ATTACK | DOTA_UNIT_CAP_CAN_BE_DOMINATED".
+type unitCapabilities uint32
+
+const (
+	unitCapMeleeAttack unitCapabilities = 1 << iota
+	unitCapRangedAttack
+	unitCapCanBeDominated
+)
+
+var unitCapabilityNames = []string{
+	"DOTA_UNIT_CAP_MELEE_ATTACK",
+	"DOTA_UNIT_CAP_RANGED_ATTACK",
+	"DOTA_UNIT_CAP_CAN_BE_DOMINATED",
+}
+
+func (f unitCapabilities) MarshalKV() (kv.KeyValue, error) {
+	var names []string
+
+	for i, name := range unitCapabilityNames {
+		if f&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	return kv.NewKeyValueString("", strings.Join(names, " | "), nil), nil
+}
+
+func (f *unitCapabilities) UnmarshalKV(node kv.KeyValue) error {
+	*f = 0
+
+	for _, name := range strings.Split(node.Value(), "|") {
+		name = strings.TrimSpace(name)
+		found := false
+
+		for i, n := range unitCapabilityNames {
+			if n == name {
+				*f |= 1 << i
+				found = true
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("invalid unit capability %q", name)
+		}
+	}
+
+	return nil
+}
+
+type marshalUnit struct {
+	Origin       vector            `kv:"origin"`
+	Angles       *vector           `kv:"angles"`
+	Color        color             `kv:"color"`
+	Capabilities unitCapabilities  `kv:"AttackCapabilities"`
+	Waypoints    []vector          `kv:"waypoints"`
+	Colors       map[string]*color `kv:"colors"`
+}
+
+func (s *MarshalSuite) TestMarshaler() {
+	require := s.Require()
+
+	data := []byte(`"unit" {
+  "origin" "1.0 2.0 3.0"
+  "angles" "0.0 90.0 0.0"
+  "color" "255 128 0 255"
+  "AttackCapabilities" "DOTA_UNIT_CAP_MELEE_ATTACK | DOTA_UNIT_CAP_CAN_BE_DOMINATED"
+  "waypoints" {
+    "0" "0.0 0.0 0.0"
+    "1" "10.0 10.0 0.0"
+  }
+
+  "colors" {
+    "radiant" "0 255 0 255"
+  }
+
+}
+`)
+
+	var actual marshalUnit
+
+	require.NoError(kv.Unmarshal(data, &actual))
+
+	expected := marshalUnit{
+		Origin:       vector{1, 2, 3},
+		Angles:       &vector{0, 90, 0},
+		Color:        color{R: 255, G: 128, A: 255},
+		Capabilities: unitCapMeleeAttack | unitCapCanBeDominated,
+		Waypoints:    []vector{{0, 0, 0}, {10, 10, 0}},
+		Colors:       map[string]*color{"radiant": {G: 255, R: 0, B: 0, A: 255}},
+	}
+
+	require.Equal(expected, actual)
+
+	root, err := kv.Marshal(&actual)
+
+	require.NoError(err)
+
+	text, err := root.SetKey("unit").MarshalText()
+
+	require.NoError(err)
+	require.Equal(string(data), string(text))
+}
+
+func (s *MarshalSuite) TestMarshalerErrors() {
+	require := s.Require()
+
+	var unit marshalUnit
+
+	err := kv.Unmarshal([]byte(`"unit" { "origin" "1.0 2.0" }`), &unit)
+
+	require.EqualError(err, `invalid vector "1.0 2.0"`)
+
+	err = kv.Unmarshal([]byte(`"unit" { "AttackCapabilities" "DOTA_UNIT_CAP_FLY" }`), &unit)
+
+	require.EqualError(err, `invalid unit capability "DOTA_UNIT_CAP_FLY"`)
+}
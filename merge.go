@@ -0,0 +1,168 @@
+package kv
+
+import "strconv"
+
+// MergeStrategy represents how Merge combines nodes.
+type MergeStrategy uint8
+
+// Merge strategies.
+const (
+	// MergeOverride replaces nodes of the destination with the nodes of the source with the same
+	// key, as whole subtrees, and adds nodes missing in the destination.
+	MergeOverride MergeStrategy = iota
+	// MergeDeep is like MergeOverride, but merges Object nodes with the same key recursively, so
+	// the source only overrides the scalars it defines, like a per-hero block over
+	// npc_dota_hero_base.
+	MergeDeep
+	// MergeAppend appends all nodes of the source to the destination, keeping nodes with duplicate
+	// keys, like an #include directive.
+	MergeAppend
+	// MergeFillMissing adds nodes of the source that are missing in the destination and merges
+	// Object nodes with the same key recursively, without changing existing nodes, like a #base
+	// directive.
+	MergeFillMissing
+)
+
+var mergeStrategyNames = [...]string{
+	MergeOverride:    "override",
+	MergeDeep:        "deep",
+	MergeAppend:      "append",
+	MergeFillMissing: "fill-missing",
+}
+
+// String returns the strategy name.
+func (s MergeStrategy) String() string {
+	if int(s) < len(mergeStrategyNames) {
+		return mergeStrategyNames[s]
+	}
+
+	return "MergeStrategy(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Merge merges the children of src into dst according to strategy and returns dst.
+//
+// The children of Object nodes are matched by key (compared according to the KeyMode of dst),
+// with nodes with duplicate keys matched by their order among the nodes with the same key, like in
+// Diff. Array nodes are never merged element by element: MergeAppend appends the elements of a
+// source Array to a destination Array, MergeOverride and MergeDeep replace the destination Array
+// and MergeFillMissing keeps it.
+//
+// If dst and src have different types, MergeOverride and MergeDeep replace dst with src, while
+// MergeAppend and MergeFillMissing leave dst unchanged.
+//
+// Nodes added or replaced in dst are copies of the nodes of src, so src is never modified nor shared
+// with dst. Replaced nodes keep their keys and order in dst, and added nodes are appended.
+func Merge(dst, src KeyValue, strategy MergeStrategy) KeyValue {
+	mergeNode(dst, src, strategy, dst.KeyMode())
+	return dst
+}
+
+func mergeNode(dst, src KeyValue, strategy MergeStrategy, mode KeyMode) {
+	if dst.Type() != src.Type() {
+		if strategy == MergeOverride || strategy == MergeDeep {
+			assignNode(dst, src)
+		}
+
+		return
+	}
+
+	switch dst.Type() {
+	case TypeObject:
+		mergeObject(dst, src, strategy, mode)
+	case TypeArray:
+		switch strategy {
+		case MergeAppend:
+			for _, c := range src.Children() {
+				dst.AddChild(cloneNode(c))
+			}
+		case MergeOverride, MergeDeep:
+			assignNode(dst, src)
+		}
+	default:
+		if strategy == MergeOverride || strategy == MergeDeep {
+			assignNode(dst, src)
+		}
+	}
+}
+
+func mergeObject(dst, src KeyValue, strategy MergeStrategy, mode KeyMode) {
+	if strategy == MergeAppend {
+		for _, c := range src.Children() {
+			dst.AddChild(cloneNode(c))
+		}
+
+		return
+	}
+
+	dstChildren := dst.Children()
+	matches := matchChildKeys(childKeys(dstChildren), childKeys(src.Children()), mode)
+
+	for i, c := range src.Children() {
+		switch {
+		case matches[i] < 0:
+			dst.AddChild(cloneNode(c))
+		case strategy == MergeOverride:
+			assignNode(dstChildren[matches[i]], c)
+		default:
+			mergeNode(dstChildren[matches[i]], c, strategy, mode)
+		}
+	}
+}
+
+func childKeys(children []KeyValue) []string {
+	keys := make([]string, len(children))
+
+	for i, c := range children {
+		keys[i] = c.Key()
+	}
+
+	return keys
+}
+
+// matchChildKeys matches the keys of the children of two Object nodes, compared according to mode,
+// with duplicate keys matched by their order among the keys equal to them. Returns, for each of the
+// src keys, the index of the matching dst key, or -1.
+func matchChildKeys(dst, src []string, mode KeyMode) []int {
+	type occurrence struct {
+		key string
+		n   int
+	}
+
+	counts := map[string]int{}
+	indexes := make(map[occurrence]int, len(dst))
+
+	for i, k := range dst {
+		key := mode.fold(k)
+		indexes[occurrence{key: key, n: counts[key]}] = i
+		counts[key]++
+	}
+
+	counts = map[string]int{}
+	matches := make([]int, len(src))
+
+	for i, k := range src {
+		key := mode.fold(k)
+		o := occurrence{key: key, n: counts[key]}
+		counts[key]++
+
+		if j, ok := indexes[o]; ok {
+			matches[i] = j
+		} else {
+			matches[i] = -1
+		}
+	}
+
+	return matches
+}
+
+// assignNode replaces the type, value, flag and children of dst with copies of those of src,
+// keeping the key, position and parent of dst.
+func assignNode(dst, src KeyValue) {
+	children := make([]KeyValue, len(src.Children()))
+
+	for i, c := range src.Children() {
+		children[i] = cloneNode(c)
+	}
+
+	dst.SetType(src.Type()).SetValue(src.Value()).SetFlag(src.Flag()).SetChildren(children...)
+}
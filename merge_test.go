@@ -0,0 +1,185 @@
+package kv_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestMerge(t *testing.T) {
+	suite.Run(t, &MergeSuite{})
+}
+
+type MergeSuite struct {
+	Suite
+}
+
+func (s *MergeSuite) base() kv.KeyValue {
+	return kv.NewKeyValueObject("npc_dota_hero_base", nil).
+		AddString("Model", "models/error.vmdl").
+		AddString("AttackRate", "1.7").
+		AddString("Ability1", "").
+		AddChild(kv.NewKeyValueObject("Bot", nil).
+			AddString("Loadout", "default").
+			AddString("Build", "default")).
+		AddChild(kv.NewKeyValueArray("Roles", nil).
+			AddString("", "Carry"))
+}
+
+func (s *MergeSuite) hero() kv.KeyValue {
+	return kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+		AddString("Model", "models/heroes/axe/axe.vmdl").
+		AddString("Ability1", "axe_berserkers_call").
+		AddChild(kv.NewKeyValueObject("Bot", nil).
+			AddString("Build", "axe")).
+		AddChild(kv.NewKeyValueArray("Roles", nil).
+			AddString("", "Initiator").
+			AddString("", "Durable")).
+		AddString("Ability2", "axe_battle_hunger")
+}
+
+func (s *MergeSuite) TestMergeDeep() {
+	require := s.Require()
+	src := s.hero()
+	actual := kv.Merge(s.base(), src, kv.MergeDeep)
+
+	expected := kv.NewKeyValueObject("npc_dota_hero_base", nil).
+		AddString("Model", "models/heroes/axe/axe.vmdl").
+		AddString("AttackRate", "1.7").
+		AddString("Ability1", "axe_berserkers_call").
+		AddChild(kv.NewKeyValueObject("Bot", nil).
+			AddString("Loadout", "default").
+			AddString("Build", "axe")).
+		AddChild(kv.NewKeyValueArray("Roles", nil).
+			AddString("", "Initiator").
+			AddString("", "Durable")).
+		AddString("Ability2", "axe_battle_hunger")
+
+	require.True(kv.Equal(expected, actual), kv.Diff(expected, actual).String())
+	require.True(kv.Equal(s.hero(), src))
+
+	// src is not shared
+	actual.Child("Bot").Child("Build").SetValue("changed")
+	actual.Child("Ability2").SetValue("changed")
+
+	require.Equal("axe", src.Child("Bot").Child("Build").Value())
+	require.Equal("axe_battle_hunger", src.Child("Ability2").Value())
+	require.Equal(actual.Child("Bot"), actual.Child("Bot").Child("Build").Parent())
+}
+
+func (s *MergeSuite) TestMergeOverride() {
+	require := s.Require()
+	actual := kv.Merge(s.base(), s.hero(), kv.MergeOverride)
+
+	expected := kv.NewKeyValueObject("npc_dota_hero_base", nil).
+		AddString("Model", "models/heroes/axe/axe.vmdl").
+		AddString("AttackRate", "1.7").
+		AddString("Ability1", "axe_berserkers_call").
+		AddChild(kv.NewKeyValueObject("Bot", nil).
+			AddString("Build", "axe")).
+		AddChild(kv.NewKeyValueArray("Roles", nil).
+			AddString("", "Initiator").
+			AddString("", "Durable")).
+		AddString("Ability2", "axe_battle_hunger")
+
+	require.True(kv.Equal(expected, actual), kv.Diff(expected, actual).String())
+}
+
+func (s *MergeSuite) TestMergeAppend() {
+	require := s.Require()
+	actual := kv.Merge(s.base(), s.hero(), kv.MergeAppend)
+
+	require.Len(actual.Children(), 10)
+	require.Len(actual.ChildrenByKey("Model"), 2)
+	require.Equal("models/error.vmdl", actual.Child("Model").Value())
+	require.Equal("axe_battle_hunger", actual.Index(9).Value())
+
+	roles := kv.Merge(s.base().Child("Roles"), s.hero().Child("Roles"), kv.MergeAppend)
+
+	require.Len(roles.Children(), 3)
+	require.Equal("Durable", roles.Index(2).Value())
+}
+
+func (s *MergeSuite) TestMergeFillMissing() {
+	require := s.Require()
+	actual := kv.Merge(s.hero(), s.base(), kv.MergeFillMissing)
+
+	expected := kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+		AddString("Model", "models/heroes/axe/axe.vmdl").
+		AddString("Ability1", "axe_berserkers_call").
+		AddChild(kv.NewKeyValueObject("Bot", nil).
+			AddString("Build", "axe").
+			AddString("Loadout", "default")).
+		AddChild(kv.NewKeyValueArray("Roles", nil).
+			AddString("", "Initiator").
+			AddString("", "Durable")).
+		AddString("Ability2", "axe_battle_hunger").
+		AddString("AttackRate", "1.7")
+
+	require.True(kv.Equal(expected, actual), kv.Diff(expected, actual).String())
+}
+
+func (s *MergeSuite) TestMergeDuplicates() {
+	require := s.Require()
+	dst := kv.NewKeyValueRoot("").AddString("A", "1").AddString("A", "2").AddString("B", "1")
+	src := kv.NewKeyValueRoot("").AddString("A", "x").AddString("A", "y").AddString("A", "z")
+
+	kv.Merge(dst, src, kv.MergeOverride)
+
+	expected := kv.NewKeyValueRoot("").AddString("A", "x").AddString("A", "y").AddString("B", "1").AddString("A", "z")
+
+	require.True(kv.Equal(expected, dst), kv.Diff(expected, dst).String())
+}
+
+func (s *MergeSuite) TestMergeTypes() {
+	require := s.Require()
+	src := kv.NewKeyValueRoot("").AddString("Bot", "none").AddInt32("AttackRate", "2")
+
+	actual := kv.Merge(s.base(), src, kv.MergeDeep)
+
+	require.Equal(kv.TypeString, actual.Child("Bot").Type())
+	require.Equal("none", actual.Child("Bot").Value())
+	require.Empty(actual.Child("Bot").Children())
+	require.Equal(kv.TypeInt32, actual.Child("AttackRate").Type())
+
+	actual = kv.Merge(s.base(), src, kv.MergeFillMissing)
+
+	require.Equal(kv.TypeObject, actual.Child("Bot").Type())
+	require.Equal(kv.TypeString, actual.Child("AttackRate").Type())
+
+	// roots
+	root := kv.NewKeyValueString("K", "v", nil)
+
+	require.Equal(kv.TypeString, kv.Merge(root, s.base(), kv.MergeFillMissing).Type())
+	require.Equal(kv.TypeObject, kv.Merge(root, s.base(), kv.MergeDeep).Type())
+	require.Equal("K", root.Key())
+	require.Len(root.Children(), 5)
+}
+
+func (s *MergeSuite) TestMergeKeyMode() {
+	require := s.Require()
+	dst := s.base().SetKeyMode(kv.KeyModeCaseInsensitive)
+	src := kv.NewKeyValueRoot("").
+		AddString("model", "axe.vmdl").
+		AddChild(kv.NewKeyValueObject("BOT", nil).AddString("build", "axe"))
+
+	kv.Merge(dst, src, kv.MergeDeep)
+
+	require.Len(dst.Children(), 5)
+	require.Equal("Model", dst.Index(0).Key())
+	require.Equal("axe.vmdl", dst.Index(0).Value())
+	require.Equal("axe", dst.Child("Bot").Child("Build").Value())
+	require.Len(dst.Child("Bot").Children(), 2)
+}
+
+func (s *MergeSuite) TestMergeStrategyString() {
+	require := s.Require()
+
+	require.Equal("override", kv.MergeOverride.String())
+	require.Equal("deep", kv.MergeDeep.String())
+	require.Equal("append", kv.MergeAppend.String())
+	require.Equal("fill-missing", kv.MergeFillMissing.String())
+	require.Equal("MergeStrategy(9)", kv.MergeStrategy(9).String())
+}
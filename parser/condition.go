@@ -0,0 +1,253 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	tokCondStart  rune = '['
+	tokCondEnd    rune = ']'
+	tokCondSymbol rune = '$'
+	tokCondNot    rune = '!'
+	tokCondLParen rune = '('
+	tokCondRParen rune = ')'
+
+	condAnd = "&&"
+	condOr  = "||"
+)
+
+// CondOp represents a Condition's operator.
+type CondOp uint8
+
+// Condition operators.
+const (
+	CondSymbol CondOp = iota
+	CondNot
+	CondAnd
+	CondOr
+)
+
+func (op CondOp) String() string {
+	switch op {
+	case CondSymbol:
+		return "Symbol"
+	case CondNot:
+		return "Not"
+	case CondAnd:
+		return "And"
+	case CondOr:
+		return "Or"
+	default:
+		return fmt.Sprintf("CondOp(%d)", op)
+	}
+}
+
+// Condition is a conditional expression attached to a key or value, like `[$WIN32||!$X360]`.
+//
+// Symbol conditions have Op CondSymbol and the symbol name (without the leading "$") in Symbol.
+// Not conditions have the negated operand in X. And/Or conditions have the operands in X and Y.
+type Condition struct {
+	Op     CondOp
+	Symbol string
+	X      *Condition
+	Y      *Condition
+}
+
+// Eval evaluates the condition, using the defined function to check whether a symbol is defined.
+func (c *Condition) Eval(defined func(symbol string) bool) bool {
+	switch c.Op {
+	case CondSymbol:
+		return defined(c.Symbol)
+	case CondNot:
+		return !c.X.Eval(defined)
+	case CondAnd:
+		return c.X.Eval(defined) && c.Y.Eval(defined)
+	case CondOr:
+		return c.X.Eval(defined) || c.Y.Eval(defined)
+	default:
+		return false
+	}
+}
+
+func (c *Condition) String() string {
+	return string(tokCondStart) + c.expr(CondOr) + string(tokCondEnd)
+}
+
+func (c *Condition) expr(parent CondOp) string {
+	switch c.Op {
+	case CondSymbol:
+		return string(tokCondSymbol) + c.Symbol
+	case CondNot:
+		return string(tokCondNot) + c.X.expr(CondNot)
+	case CondAnd, CondOr:
+		op := condAnd
+
+		if c.Op == CondOr {
+			op = condOr
+		}
+
+		s := c.X.expr(c.Op) + op + c.Y.expr(c.Op)
+
+		// parenthesize when binding looser than the enclosing operator
+		if parent != c.Op && (parent == CondNot || parent == CondAnd) {
+			s = string(tokCondLParen) + s + string(tokCondRParen)
+		}
+
+		return s
+	default:
+		return ""
+	}
+}
+
+// ParseCondition parses a conditional expression.
+//
+// The expression may be enclosed in brackets, like `[$WIN32||$OSX]`, or not, like `$WIN32||$OSX`.
+func ParseCondition(expr string) (*Condition, error) {
+	c, err := parseCondition(expr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func parseCondition(expr string) (*Condition, *SyntaxError) {
+	expr = strings.TrimSpace(expr)
+
+	if strings.HasPrefix(expr, string(tokCondStart)) && strings.HasSuffix(expr, string(tokCondEnd)) {
+		expr = expr[1 : len(expr)-1]
+	}
+
+	p := &condParser{src: expr}
+	c, err := p.parseOr()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if p.skipSpace(); p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+
+	return c, nil
+}
+
+type condParser struct {
+	src string
+	pos int
+}
+
+func (p *condParser) errorf(format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{
+		Pos: Position{Offset: p.pos, Column: p.pos + 1},
+		Msg: fmt.Sprintf("%s %q: ", ErrInvalidCondition, p.src) + fmt.Sprintf(format, args...),
+		Err: ErrInvalidCondition,
+	}
+}
+
+func (p *condParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *condParser) consume(s string) bool {
+	p.skipSpace()
+
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+
+	return false
+}
+
+func (p *condParser) parseOr() (*Condition, *SyntaxError) {
+	x, err := p.parseAnd()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume(condOr) {
+		y, err := p.parseAnd()
+
+		if err != nil {
+			return nil, err
+		}
+
+		x = &Condition{Op: CondOr, X: x, Y: y}
+	}
+
+	return x, nil
+}
+
+func (p *condParser) parseAnd() (*Condition, *SyntaxError) {
+	x, err := p.parseUnary()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for p.consume(condAnd) {
+		y, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		x = &Condition{Op: CondAnd, X: x, Y: y}
+	}
+
+	return x, nil
+}
+
+func (p *condParser) parseUnary() (*Condition, *SyntaxError) {
+	switch {
+	case p.consume(string(tokCondNot)):
+		x, err := p.parseUnary()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &Condition{Op: CondNot, X: x}, nil
+	case p.consume(string(tokCondLParen)):
+		x, err := p.parseOr()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !p.consume(string(tokCondRParen)) {
+			return nil, p.errorf("missing %q", tokCondRParen)
+		}
+
+		return x, nil
+	}
+
+	p.consume(string(tokCondSymbol))
+
+	start := p.pos
+
+	for p.pos < len(p.src) && isCondSymbolRune(rune(p.src[p.pos])) {
+		p.pos++
+	}
+
+	if p.pos == start {
+		if p.pos == len(p.src) {
+			return nil, p.errorf("unexpected end of expression")
+		}
+
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+
+	return &Condition{Op: CondSymbol, Symbol: p.src[start:p.pos]}, nil
+}
+
+func isCondSymbolRune(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
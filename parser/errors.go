@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/13k/kv-go/internal/errlist"
+)
+
+// Sentinel errors wrapped by SyntaxError, for use with errors.Is.
+var (
+	// ErrUnexpectedEOF means that the input ended in the middle of a node.
+	ErrUnexpectedEOF = errors.New("unexpected EOF")
+	// ErrUnexpectedToken means that a token was found where it's not allowed.
+	ErrUnexpectedToken = errors.New("unexpected token")
+	// ErrInvalidToken means that the input contains a malformed token, like an unterminated string.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrInvalidCondition means that a conditional expression is malformed.
+	ErrInvalidCondition = errors.New("invalid condition")
+)
+
+// SyntaxError describes a syntax error in the input.
+type SyntaxError struct {
+	// Pos is the position of the error.
+	Pos Position
+	// Msg is the error description.
+	Msg string
+	// Expected describes the token(s) expected at Pos, if known.
+	Expected string
+	// Actual is the offending token, if any.
+	Actual string
+	// Err is the sentinel error describing the kind of error.
+	Err error
+}
+
+func newUnexpectedEOF(pos Position, expected string) *SyntaxError {
+	return &SyntaxError{
+		Pos:      pos,
+		Msg:      ErrUnexpectedEOF.Error(),
+		Expected: expected,
+		Err:      ErrUnexpectedEOF,
+	}
+}
+
+func newUnexpectedToken(pos Position, expected, actual string) *SyntaxError {
+	return &SyntaxError{
+		Pos:      pos,
+		Msg:      fmt.Sprintf("%s %s", ErrUnexpectedToken, actual),
+		Expected: expected,
+		Actual:   actual,
+		Err:      ErrUnexpectedToken,
+	}
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("kv: %s: %s", e.Pos, e.Msg)
+}
+
+// Unwrap returns the sentinel error describing the kind of error.
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorList is a list of syntax errors, returned by TextParser.Parse in AllErrors mode.
+type ErrorList []*SyntaxError
+
+func (l ErrorList) Error() string {
+	return errlist.Error(len(l), l.at)
+}
+
+// Is reports whether any error in the list matches target.
+func (l ErrorList) Is(target error) bool {
+	return errlist.Is(len(l), l.at, target)
+}
+
+// As finds the first error in the list that matches target, and if so, sets target to that error
+// value and returns true.
+func (l ErrorList) As(target interface{}) bool {
+	return errlist.As(len(l), l.at, target)
+}
+
+func (l ErrorList) at(i int) error {
+	return l[i]
+}
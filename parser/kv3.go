@@ -0,0 +1,674 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	kv3HeaderStart     = "<!--"
+	kv3HeaderEnd       = "-->"
+	kv3HeaderMagic     = "kv3"
+	kv3HeaderEncoding  = "encoding"
+	kv3HeaderFormat    = "format"
+	kv3HeaderVersion   = "version"
+	kv3MultilineQuote  = `"""`
+	kv3LineComment     = "//"
+	kv3BlockComment    = "/*"
+	kv3BlockCommentEnd = "*/"
+	kv3BinaryStart     = "#["
+
+	kv3TokObjectStart byte = '{'
+	kv3TokObjectEnd   byte = '}'
+	kv3TokQuote       byte = '"'
+	kv3TokAssign      byte = '='
+	kv3TokSeparator   byte = ','
+	kv3TokFlag        byte = ':'
+	kv3TokArrayStart  byte = '['
+	kv3TokArrayEnd    byte = ']'
+
+	kv3True  = "true"
+	kv3False = "false"
+	kv3Null  = "null"
+
+	expectedKV3Header = "kv3 header"
+	expectedKV3Key    = `key or "}"`
+	expectedKV3Value  = "value"
+	expectedKV3Byte   = `hex byte or "]"`
+)
+
+// KV3 value flags. Values with other flags are rejected.
+var KV3Flags = []string{
+	"resource",
+	"resource_name",
+	"panorama",
+	"soundevent",
+	"subclass",
+}
+
+// KV3Type represents a KV3Node's type.
+type KV3Type uint8
+
+// KV3 node types.
+const (
+	KV3Null KV3Type = iota
+	KV3Bool
+	KV3Int
+	KV3Double
+	KV3String
+	KV3Array
+	KV3Object
+	KV3Binary
+)
+
+func (t KV3Type) String() string {
+	switch t {
+	case KV3Null:
+		return "Null"
+	case KV3Bool:
+		return "Bool"
+	case KV3Int:
+		return "Int"
+	case KV3Double:
+		return "Double"
+	case KV3String:
+		return "String"
+	case KV3Array:
+		return "Array"
+	case KV3Object:
+		return "Object"
+	case KV3Binary:
+		return "Binary"
+	default:
+		return fmt.Sprintf("KV3Type(%d)", t)
+	}
+}
+
+// KV3Header is the header of a KeyValues3 text document, like
+// `<!-- kv3 encoding:text:version{e21c7f3c-8a33-41c5-9977-a76d3a32aa0d} format:generic:version{7412167c-06e9-4698-aff2-e63eb59037e7} -->`.
+type KV3Header struct {
+	Encoding        string
+	EncodingVersion string
+	Format          string
+	FormatVersion   string
+}
+
+// KV3Node is a KeyValues3 AST node.
+//
+// Array elements have empty keys. Values of Bool, Int and Double nodes are in their text
+// representation, Null nodes have empty values and Binary nodes (`#[ 01 02 ]`) have hex-encoded
+// values.
+type KV3Node struct {
+	Parent   *KV3Node
+	Children []*KV3Node
+	Type     KV3Type
+	Key      string
+	Value    string
+	// Flag is the value flag, like "resource" in `resource:"particles/x.vpcf"`, if any.
+	Flag string
+	// Pos is the position of the node's key (or value, for array elements and the root node).
+	Pos Position
+	// ValuePos is the position of the node's value.
+	ValuePos Position
+}
+
+func (n *KV3Node) addChild(child *KV3Node) *KV3Node {
+	child.Parent = n
+
+	n.Children = append(n.Children, child)
+
+	return child
+}
+
+// KV3Parser is a parser for KeyValues3 in text format.
+type KV3Parser struct {
+	fname string
+	r     io.Reader
+	src   []byte
+	off   int
+	line  int
+	col   int
+}
+
+// NewKV3Parser creates a KV3Parser.
+func NewKV3Parser(fname string, r io.Reader) *KV3Parser {
+	if fname == "" {
+		if n, ok := r.(namer); ok {
+			fname = n.Name()
+		}
+	}
+
+	return &KV3Parser{fname: fname, r: r}
+}
+
+// Parse reads and parses the KeyValues3 text document from the input stream, returning its header
+// and root node.
+func (p *KV3Parser) Parse() (*KV3Header, *KV3Node, error) {
+	src, err := ioutil.ReadAll(p.r)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.src = src
+	p.off = 0
+	p.line = 1
+	p.col = 1
+
+	header, serr := p.parseHeader()
+
+	if serr != nil {
+		return nil, nil, serr
+	}
+
+	root := &KV3Node{}
+
+	if serr = p.parseValue(root); serr != nil {
+		return header, root, serr
+	}
+
+	if serr = p.skipSpace(); serr != nil {
+		return header, root, serr
+	}
+
+	if p.off < len(p.src) {
+		return header, root, p.unexpected(expectedEOF)
+	}
+
+	return header, root, nil
+}
+
+func (p *KV3Parser) pos() Position {
+	return Position{Filename: p.fname, Offset: p.off, Line: p.line, Column: p.col}
+}
+
+func (p *KV3Parser) eof() bool {
+	return p.off >= len(p.src)
+}
+
+func (p *KV3Parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+
+	return p.src[p.off]
+}
+
+func (p *KV3Parser) hasPrefix(s string) bool {
+	return bytes.HasPrefix(p.src[p.off:], []byte(s))
+}
+
+// advance consumes n bytes, keeping track of line and column.
+func (p *KV3Parser) advance(n int) {
+	for ; n > 0 && !p.eof(); n-- {
+		b := p.src[p.off]
+		p.off++
+
+		switch {
+		case b == '\n':
+			p.line++
+			p.col = 1
+		case !utf8.RuneStart(b):
+			// continuation byte, same column
+		default:
+			p.col++
+		}
+	}
+}
+
+func (p *KV3Parser) unexpected(expected string) *SyntaxError {
+	if p.eof() {
+		return newUnexpectedEOF(p.pos(), expected)
+	}
+
+	r, _ := utf8.DecodeRune(p.src[p.off:])
+
+	return newUnexpectedToken(p.pos(), expected, strconv.Quote(string(r)))
+}
+
+// skipSpace skips whitespace and comments.
+func (p *KV3Parser) skipSpace() *SyntaxError {
+	for !p.eof() {
+		switch {
+		case isKV3Space(p.peek()):
+			p.advance(1)
+		case p.hasPrefix(kv3LineComment):
+			for !p.eof() && p.peek() != '\n' {
+				p.advance(1)
+			}
+		case p.hasPrefix(kv3BlockComment):
+			pos := p.pos()
+			end := bytes.Index(p.src[p.off+len(kv3BlockComment):], []byte(kv3BlockCommentEnd))
+
+			if end < 0 {
+				return &SyntaxError{Pos: pos, Msg: "comment not terminated", Err: ErrInvalidToken}
+			}
+
+			p.advance(len(kv3BlockComment) + end + len(kv3BlockCommentEnd))
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (p *KV3Parser) parseHeader() (*KV3Header, *SyntaxError) {
+	if err := p.skipSpace(); err != nil {
+		return nil, err
+	}
+
+	pos := p.pos()
+
+	if !p.hasPrefix(kv3HeaderStart) {
+		return nil, p.unexpected(expectedKV3Header)
+	}
+
+	end := bytes.Index(p.src[p.off:], []byte(kv3HeaderEnd))
+
+	if end < 0 {
+		return nil, newUnexpectedEOF(pos, kv3HeaderEnd)
+	}
+
+	text := string(p.src[p.off+len(kv3HeaderStart) : p.off+end])
+	fields := strings.Fields(text)
+	invalid := &SyntaxError{Pos: pos, Msg: fmt.Sprintf("invalid header %q", text), Err: ErrInvalidToken}
+
+	if len(fields) == 0 || fields[0] != kv3HeaderMagic {
+		return nil, invalid
+	}
+
+	header := &KV3Header{}
+
+	for _, field := range fields[1:] {
+		// name:id:version{guid}
+		parts := strings.SplitN(field, string(kv3TokFlag), 3)
+
+		if len(parts) != 3 {
+			return nil, invalid
+		}
+
+		version := strings.TrimPrefix(parts[2], kv3HeaderVersion)
+
+		if version == parts[2] || !strings.HasPrefix(version, "{") || !strings.HasSuffix(version, "}") {
+			return nil, invalid
+		}
+
+		version = version[1 : len(version)-1]
+
+		switch parts[0] {
+		case kv3HeaderEncoding:
+			header.Encoding = parts[1]
+			header.EncodingVersion = version
+		case kv3HeaderFormat:
+			header.Format = parts[1]
+			header.FormatVersion = version
+		default:
+			return nil, invalid
+		}
+	}
+
+	p.advance(end + len(kv3HeaderEnd))
+
+	return header, nil
+}
+
+func (p *KV3Parser) parseValue(node *KV3Node) *SyntaxError {
+	if err := p.skipSpace(); err != nil {
+		return err
+	}
+
+	node.ValuePos = p.pos()
+
+	if !node.Pos.IsValid() {
+		node.Pos = node.ValuePos
+	}
+
+	switch ch := p.peek(); {
+	case ch == kv3TokObjectStart:
+		return p.parseObject(node)
+	case ch == kv3TokArrayStart:
+		return p.parseArray(node)
+	case ch == kv3TokQuote:
+		s, err := p.parseString()
+
+		if err != nil {
+			return err
+		}
+
+		node.Type = KV3String
+		node.Value = s
+
+		return nil
+	case p.hasPrefix(kv3BinaryStart):
+		return p.parseBinary(node)
+	case ch == '-' || ch == '+' || ch == '.' || isDigit(ch):
+		return p.parseNumber(node)
+	case isKV3IdentByte(ch):
+		return p.parseKeyword(node)
+	default:
+		return p.unexpected(expectedKV3Value)
+	}
+}
+
+func (p *KV3Parser) parseKeyword(node *KV3Node) *SyntaxError {
+	pos := p.pos()
+	ident := p.parseIdent()
+
+	if p.peek() == kv3TokFlag {
+		if node.Flag != "" {
+			return newUnexpectedToken(pos, expectedKV3Value, strconv.Quote(ident))
+		}
+
+		if !isKV3Flag(ident) {
+			return &SyntaxError{
+				Pos:      pos,
+				Msg:      fmt.Sprintf("unknown flag %q", ident),
+				Expected: expectedKV3Value,
+				Actual:   strconv.Quote(ident),
+				Err:      ErrUnexpectedToken,
+			}
+		}
+
+		p.advance(1)
+		node.Flag = ident
+
+		return p.parseValue(node)
+	}
+
+	switch ident {
+	case kv3True, kv3False:
+		node.Type = KV3Bool
+		node.Value = ident
+	case kv3Null:
+		node.Type = KV3Null
+	default:
+		return newUnexpectedToken(pos, expectedKV3Value, strconv.Quote(ident))
+	}
+
+	return nil
+}
+
+func (p *KV3Parser) parseObject(node *KV3Node) *SyntaxError {
+	node.Type = KV3Object
+
+	p.advance(1)
+
+	for {
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+
+		if p.peek() == kv3TokObjectEnd {
+			p.advance(1)
+			return nil
+		}
+
+		child := &KV3Node{Pos: p.pos()}
+
+		switch ch := p.peek(); {
+		case ch == kv3TokQuote:
+			key, err := p.parseString()
+
+			if err != nil {
+				return err
+			}
+
+			child.Key = key
+		case isKV3IdentByte(ch):
+			child.Key = p.parseIdent()
+		default:
+			return p.unexpected(expectedKV3Key)
+		}
+
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+
+		if p.peek() != kv3TokAssign {
+			return p.unexpected(string(kv3TokAssign))
+		}
+
+		p.advance(1)
+
+		if err := p.parseValue(node.addChild(child)); err != nil {
+			return err
+		}
+
+		if err := p.skipSeparator(); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *KV3Parser) parseArray(node *KV3Node) *SyntaxError {
+	node.Type = KV3Array
+
+	p.advance(1)
+
+	for {
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+
+		if p.peek() == kv3TokArrayEnd {
+			p.advance(1)
+			return nil
+		}
+
+		if err := p.parseValue(node.addChild(&KV3Node{})); err != nil {
+			return err
+		}
+
+		if err := p.skipSeparator(); err != nil {
+			return err
+		}
+	}
+}
+
+// parseBinary parses a binary blob, a list of space-separated hex bytes between "#[" and "]".
+func (p *KV3Parser) parseBinary(node *KV3Node) *SyntaxError {
+	node.Type = KV3Binary
+
+	p.advance(len(kv3BinaryStart))
+
+	var b strings.Builder
+
+	for {
+		if err := p.skipSpace(); err != nil {
+			return err
+		}
+
+		if p.peek() == kv3TokArrayEnd {
+			p.advance(1)
+			node.Value = b.String()
+
+			return nil
+		}
+
+		pos := p.pos()
+		start := p.off
+
+		for !p.eof() && !isKV3Space(p.peek()) && p.peek() != kv3TokArrayEnd {
+			p.advance(1)
+		}
+
+		text := string(p.src[start:p.off])
+
+		if len(text) != 2 || !isHexDigit(text[0]) || !isHexDigit(text[1]) {
+			if text == "" {
+				return p.unexpected(expectedKV3Byte)
+			}
+
+			return newUnexpectedToken(pos, expectedKV3Byte, strconv.Quote(text))
+		}
+
+		b.WriteString(strings.ToLower(text))
+	}
+}
+
+// skipSeparator skips an optional "," following a value.
+func (p *KV3Parser) skipSeparator() *SyntaxError {
+	if err := p.skipSpace(); err != nil {
+		return err
+	}
+
+	if p.peek() == kv3TokSeparator {
+		p.advance(1)
+	}
+
+	return nil
+}
+
+func (p *KV3Parser) parseIdent() string {
+	start := p.off
+
+	for !p.eof() && isKV3IdentByte(p.peek()) {
+		p.advance(1)
+	}
+
+	return string(p.src[start:p.off])
+}
+
+func (p *KV3Parser) parseNumber(node *KV3Node) *SyntaxError {
+	pos := p.pos()
+	start := p.off
+	isDouble := false
+
+	if ch := p.peek(); ch == '-' || ch == '+' {
+		p.advance(1)
+	}
+
+	for !p.eof() {
+		ch := p.peek()
+
+		if ch == '.' || ch == 'e' || ch == 'E' {
+			isDouble = true
+		} else if !isDigit(ch) && !((ch == '-' || ch == '+') && isDouble) {
+			break
+		}
+
+		p.advance(1)
+	}
+
+	text := string(p.src[start:p.off])
+
+	if isDouble {
+		if _, err := strconv.ParseFloat(text, 64); err != nil {
+			return newUnexpectedToken(pos, expectedKV3Value, strconv.Quote(text))
+		}
+
+		node.Type = KV3Double
+	} else {
+		if _, err := strconv.ParseInt(text, 10, 64); err != nil {
+			if _, err := strconv.ParseUint(text, 10, 64); err != nil {
+				return newUnexpectedToken(pos, expectedKV3Value, strconv.Quote(text))
+			}
+		}
+
+		node.Type = KV3Int
+	}
+
+	node.Value = text
+
+	return nil
+}
+
+func (p *KV3Parser) parseString() (string, *SyntaxError) {
+	pos := p.pos()
+
+	if p.hasPrefix(kv3MultilineQuote) {
+		p.advance(len(kv3MultilineQuote))
+
+		end := bytes.Index(p.src[p.off:], []byte(kv3MultilineQuote))
+
+		if end < 0 {
+			return "", &SyntaxError{Pos: pos, Msg: "literal not terminated", Err: ErrInvalidToken}
+		}
+
+		s := string(p.src[p.off : p.off+end])
+		p.advance(end + len(kv3MultilineQuote))
+
+		// the line breaks following the opening quotes and preceding the closing quotes are not
+		// part of the string
+		s = strings.TrimPrefix(s, "\r")
+		s = strings.TrimPrefix(s, "\n")
+		s = strings.TrimSuffix(s, "\n")
+		s = strings.TrimSuffix(s, "\r")
+
+		return s, nil
+	}
+
+	p.advance(1)
+
+	var b strings.Builder
+
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", &SyntaxError{Pos: pos, Msg: "literal not terminated", Err: ErrInvalidToken}
+		}
+
+		ch := p.peek()
+		p.advance(1)
+
+		switch ch {
+		case kv3TokQuote:
+			return b.String(), nil
+		case '\\':
+			if p.eof() {
+				continue
+			}
+
+			esc := p.peek()
+			p.advance(1)
+
+			switch esc {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case '\\', '"', '\'':
+				b.WriteByte(esc)
+			default:
+				// unknown escape sequences are kept verbatim
+				b.WriteByte('\\')
+				b.WriteByte(esc)
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+}
+
+func isKV3Flag(s string) bool {
+	for _, f := range KV3Flags {
+		if s == f {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isKV3Space(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func isHexDigit(b byte) bool {
+	return isDigit(b) || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
+
+func isKV3IdentByte(b byte) bool {
+	return b == '_' || b == '.' || isDigit(b) || (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
@@ -13,6 +13,8 @@ type NodeType uint8
 const (
 	Object NodeType = iota
 	Field
+	Base
+	Include
 )
 
 func (t NodeType) String() string {
@@ -21,18 +23,35 @@ func (t NodeType) String() string {
 		return "Object"
 	case Field:
 		return "Field"
+	case Base:
+		return "Base"
+	case Include:
+		return "Include"
 	default:
 		return fmt.Sprintf("NodeType(%d)", t)
 	}
 }
 
 // Node is an AST node.
+//
+// Base and Include nodes represent `#base` and `#include` directives, with the directive in Key and
+// the referenced file name in Value. They're collected in the root node's Directives, in the order
+// they appear in the input.
 type Node struct {
-	Parent   *Node
-	Children []*Node
-	Type     NodeType
-	Key      string
-	Value    string
+	Parent     *Node
+	Children   []*Node
+	Directives []*Node
+	Type       NodeType
+	Key        string
+	Value      string
+	// Pos is the position of the node's key.
+	Pos Position
+	// ValuePos is the position of the node's value (or opening brace, for objects).
+	ValuePos Position
+	// Cond is the conditional expression following the node's value (or key, for objects), if any.
+	Cond *Condition
+	// Syntax is the node's source text, recorded in Lossless mode.
+	Syntax *Syntax
 }
 
 func (n *Node) addChild(child *Node) *Node {
@@ -44,7 +63,15 @@ func (n *Node) addChild(child *Node) *Node {
 }
 
 func (n *Node) String() string {
-	return n.toString(0)
+	var b strings.Builder
+
+	for _, d := range n.Directives {
+		b.WriteString(d.toString(0))
+	}
+
+	b.WriteString(n.toString(0))
+
+	return b.String()
 }
 
 func (n *Node) toString(level int) string {
@@ -56,6 +83,11 @@ func (n *Node) toString(level int) string {
 
 	switch n.Type {
 	case Object:
+		if n.Cond != nil {
+			b.WriteString(n.Cond.String())
+			b.WriteRune(' ')
+		}
+
 		b.WriteRune(tokObjectStart)
 		b.WriteRune('\n')
 
@@ -66,8 +98,14 @@ func (n *Node) toString(level int) string {
 		b.WriteString(indent)
 		b.WriteRune(tokObjectEnd)
 		b.WriteRune('\n')
-	case Field:
+	case Field, Base, Include:
 		b.WriteString(strconv.Quote(n.Value))
+
+		if n.Cond != nil {
+			b.WriteRune(' ')
+			b.WriteString(n.Cond.String())
+		}
+
 		b.WriteRune('\n')
 	}
 
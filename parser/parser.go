@@ -2,7 +2,6 @@
 package parser
 
 import (
-	"fmt"
 	"io"
 	"strings"
 	"text/scanner"
@@ -14,6 +13,16 @@ const (
 	tokObjectEnd   rune = '}'
 	tokQuote       rune = '"'
 	tokComment     rune = '/'
+
+	directiveBase    = "#base"
+	directiveInclude = "#include"
+
+	msgInvalidEscape = "invalid char escape"
+
+	expectedKey      = `key or "}"`
+	expectedValue    = `value or "{"`
+	expectedFilename = "file name"
+	expectedEOF      = "EOF"
 )
 
 var (
@@ -60,14 +69,51 @@ type namer interface {
 	Name() string
 }
 
+// Mode is a set of flags controlling the parser behavior.
+type Mode uint
+
+// Parser modes.
+const (
+	// AllErrors makes the parser recover from syntax errors and report all of them, instead of
+	// stopping at the first one.
+	AllErrors Mode = 1 << iota
+	// Lossless makes the parser record the source text of every node (including comments,
+	// whitespace and quoting style) in Node.Syntax.
+	Lossless
+	// DropDirectives makes the parser leave the source text of `#base` and `#include` directives
+	// (and the rest of their lines, if blank) out of the text recorded in Lossless mode, for callers
+	// replacing directives with the nodes they reference. Directives are still collected in the root
+	// node's Directives.
+	DropDirectives
+)
+
 // TextParser is a parser for KeyValue in text format.
 type TextParser struct {
-	s *scanner.Scanner
+	s    *scanner.Scanner
+	src  *sourceReader
+	mode Mode
+
+	errors  ErrorList
+	scanErr *SyntaxError
+	root    *Node
+	scope   *Node
+	node    *Node
+	// last completed field node, to which a trailing condition is attached
+	last *Node
+	// end offset of the last token recorded in a Syntax, in Lossless mode
+	prevEnd int
+	// Syntax text field receiving the text up to the next line break, in Lossless mode
+	pending *string
+	// text preceding a dropped directive, prepended to the next trivia, in DropDirectives mode
+	carry string
+	// whether the rest of the line of a dropped directive is to be dropped, if blank
+	dropLine bool
 }
 
 // NewTextParser creates a TextParser.
 func NewTextParser(fname string, r io.Reader) *TextParser {
-	s := (&scanner.Scanner{}).Init(r)
+	src := &sourceReader{r: r}
+	s := (&scanner.Scanner{}).Init(src)
 
 	s.Whitespace = 1<<' ' | 1<<'\t' | 1<<'\r' | 1<<'\n'
 	s.Mode = scanner.ScanIdents |
@@ -75,13 +121,7 @@ func NewTextParser(fname string, r io.Reader) *TextParser {
 		scanner.ScanComments |
 		scanner.SkipComments
 
-	s.IsIdentRune = func(ch rune, _ int) bool {
-		return unicode.In(ch, identRanges...) &&
-			ch != tokObjectStart &&
-			ch != tokObjectEnd &&
-			ch != tokQuote &&
-			ch != tokComment
-	}
+	s.IsIdentRune = isIdentRune
 
 	if fname == "" {
 		if n, ok := r.(namer); ok {
@@ -91,86 +131,436 @@ func NewTextParser(fname string, r io.Reader) *TextParser {
 
 	s.Filename = fname
 
-	return &TextParser{s: s}
+	return &TextParser{s: s, src: src}
+}
+
+// Filename returns the name of the file being parsed.
+func (p *TextParser) Filename() string {
+	return p.s.Filename
+}
+
+// SetMode sets the parser mode and returns the receiver.
+//
+// The mode must be set before calling Parse.
+func (p *TextParser) SetMode(mode Mode) *TextParser {
+	p.mode = mode
+	p.src.record = mode&Lossless != 0
+
+	if p.src.record {
+		p.s.Mode &^= scanner.SkipComments
+	} else {
+		p.s.Mode |= scanner.SkipComments
+	}
+
+	return p
 }
 
 // Parse reads parses the text-encoded KeyValue values from the input stream, generating an AST
 // tree.
+//
+// By default, parsing stops at the first error, which is returned as a *SyntaxError. In AllErrors
+// mode, the parser skips invalid tokens and incomplete nodes, resuming at the next key or closing
+// brace, and returns the best-effort tree along with an ErrorList of all errors, including each
+// token after the root node.
 func (p *TextParser) Parse() (*Node, error) {
-	var scanErr error
-
-	root := &Node{}
-	scope := root
-	node := root
+	p.root = &Node{}
+	p.scope = p.root
+	p.node = p.root
+	p.last = nil
+	p.errors = nil
+	p.prevEnd = 0
+	p.pending = nil
+	p.carry = ""
+	p.dropLine = false
 
 	p.s.Error = func(s *scanner.Scanner, msg string) {
-		scanErr = fmt.Errorf("kv: error at %s: %s", s.Pos(), msg)
+		// KeyValue has no notion of invalid escape sequences, unknown ones are kept verbatim
+		if msg == msgInvalidEscape {
+			return
+		}
+
+		p.scanErr = &SyntaxError{Pos: newPosition(s.Pos()), Msg: msg, Err: ErrInvalidToken}
 	}
 
 	for {
-		tok := p.s.Scan()
+		tok := p.scan()
 
 		if tok == scanner.EOF {
-			if node.Type != Object && node.Key != "" && node.Value == "" {
-				return root, fmt.Errorf("kv: %s: unexpected EOF", p.s.Pos())
+			if err := p.parseEOF(); err != nil && !p.recover(err) {
+				return p.root, err
 			}
 
-			if scope != nil {
-				return root, fmt.Errorf("kv: %s: unexpected EOF", p.s.Pos())
-			}
+			p.recordEOF()
 
 			break
 		}
 
-		if scanErr != nil {
-			return root, scanErr
+		if err := p.scanErr; err != nil {
+			p.scanErr = nil
+
+			if !p.recover(err) {
+				return p.root, err
+			}
 		}
 
-		text := p.s.TokenText()
+		if err := p.parseToken(tok); err != nil && !p.recover(err) {
+			return p.root, err
+		}
+	}
 
-		switch {
-		case node.Key == "":
-			switch tok {
-			case tokObjectEnd:
-				scope = scope.Parent
-			case scanner.String, scanner.Ident:
-				node.Key = parseToken(text)
-			default:
-				return root, fmt.Errorf(
-					"kv: %s: unexpected token %s",
-					p.s.Pos(),
-					scanner.TokenString(tok),
-				)
-			}
-		case node.Value == "":
-			switch tok {
-			case tokObjectStart:
-				node.Type = Object
-			case scanner.String:
-				node.Type = Field
-				node.Value = parseToken(text)
-			case scanner.Ident:
-				node.Type = Field
-				node.Value = text
-			default:
-				return root, fmt.Errorf(
-					"kv: %s: unexpected token %s",
-					p.s.Pos(),
-					scanner.TokenString(tok),
-				)
-			}
+	if len(p.errors) > 0 {
+		return p.root, p.errors
+	}
+
+	return p.root, nil
+}
+
+// recover records the error and returns true if in AllErrors mode, otherwise returns false.
+func (p *TextParser) recover(err *SyntaxError) bool {
+	if p.mode&AllErrors == 0 {
+		return false
+	}
+
+	p.errors = append(p.errors, err)
 
-			if node != scope {
-				scope.addChild(node)
+	return true
+}
+
+func (p *TextParser) parseEOF() *SyntaxError {
+	if p.node.Type != Object && p.node.Key != "" && p.node.Value == "" {
+		return newUnexpectedEOF(p.pos(), expectedValue)
+	}
+
+	if p.scope != nil {
+		return newUnexpectedEOF(p.pos(), expectedKey)
+	}
+
+	return nil
+}
+
+func (p *TextParser) parseToken(tok rune) *SyntaxError {
+	if tok == tokCondStart {
+		return p.parseCondition(tok)
+	}
+
+	p.last = nil
+
+	if p.node.Key == "" {
+		return p.parseKey(tok)
+	}
+
+	return p.parseValue(tok)
+}
+
+func (p *TextParser) parseCondition(tok rune) *SyntaxError {
+	// scanning the condition invalidates the scanner position of the '[' token
+	pos := newPosition(p.s.Position)
+	cond, err := p.scanCondition()
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case p.node.Key != "" && p.node.Value == "":
+		p.node.Cond = cond
+	case p.last != nil:
+		p.last.Cond = cond
+		p.last = nil
+	default:
+		return newUnexpectedToken(pos, expectedKey, scanner.TokenString(tok))
+	}
+
+	return nil
+}
+
+func (p *TextParser) parseKey(tok rune) *SyntaxError {
+	text := p.s.TokenText()
+
+	switch tok {
+	case tokObjectEnd:
+		if p.scope == nil {
+			return p.unexpected(tok, expectedEOF)
+		}
+
+		p.recordClosing()
+		p.scope = p.scope.Parent
+	case scanner.String, scanner.Ident:
+		// directives are only recognized unquoted, at the top level
+		if typ, ok := directiveType(tok, text); ok && (p.node == p.root || p.scope == nil) {
+			d, err := p.scanDirective(typ, text)
+
+			if err != nil {
+				return err
 			}
 
-			if node.Type == Object {
-				scope = node
+			p.root.Directives = append(p.root.Directives, d)
+
+			return nil
+		}
+
+		if p.scope == nil {
+			return p.unexpected(tok, expectedEOF)
+		}
+
+		p.node.Key = parseToken(text)
+		p.node.Pos = newPosition(p.s.Position)
+		p.recordKey()
+	case tokObjectStart:
+		if p.scope == nil {
+			return p.unexpected(tok, expectedEOF)
+		}
+
+		err := p.unexpected(tok, expectedKey)
+
+		// recover as an object without key, to keep braces balanced
+		if p.mode&AllErrors != 0 {
+			p.node.Type = Object
+			p.node.Pos = newPosition(p.s.Position)
+			p.node.ValuePos = p.node.Pos
+			p.addNode()
+		}
+
+		return err
+	default:
+		return p.unexpected(tok, expectedKey)
+	}
+
+	return nil
+}
+
+func (p *TextParser) parseValue(tok rune) *SyntaxError {
+	p.node.ValuePos = newPosition(p.s.Position)
+
+	switch tok {
+	case tokObjectStart:
+		p.node.Type = Object
+	case scanner.String:
+		p.node.Type = Field
+		p.node.Value = parseToken(p.s.TokenText())
+	case scanner.Ident:
+		p.node.Type = Field
+		p.node.Value = p.s.TokenText()
+	default:
+		err := p.unexpected(tok, expectedValue)
+
+		// recover by dropping the incomplete node, closing the scope on a closing brace
+		if p.mode&AllErrors != 0 {
+			p.node = &Node{}
+
+			if tok == tokObjectEnd {
+				p.scope = p.scope.Parent
 			}
+		}
+
+		return err
+	}
 
-			node = &Node{}
+	p.recordValue()
+	p.addNode()
+
+	return nil
+}
+
+// addNode adds the current node to the current scope, entering it if it's an object, and starts a
+// new current node.
+func (p *TextParser) addNode() {
+	if p.node != p.scope {
+		p.scope.addChild(p.node)
+	}
+
+	if p.node.Type == Object {
+		p.scope = p.node
+	} else {
+		p.last = p.node
+	}
+
+	p.node = &Node{}
+}
+
+// scan reads the next token, skipping comments.
+func (p *TextParser) scan() rune {
+	for {
+		if tok := p.s.Scan(); tok != scanner.Comment {
+			return tok
+		}
+	}
+}
+
+// trivia returns the source text between the last recorded token and the current token, in
+// Lossless mode.
+//
+// If there's a pending Syntax field, the text up to the first line break is appended to it, and
+// only the remaining text is returned.
+func (p *TextParser) trivia(end int) string {
+	t := string(p.src.buf[p.prevEnd:end])
+	p.prevEnd = end
+
+	if p.dropLine {
+		p.dropLine = false
+
+		if rest := strings.TrimLeft(t, " \t\r"); rest == "" || rest[0] == '\n' {
+			t = strings.TrimPrefix(rest, "\n")
+		}
+	}
+
+	t = p.carry + t
+	p.carry = ""
+
+	if p.pending != nil {
+		if i := strings.IndexByte(t, '\n'); i >= 0 {
+			*p.pending += t[:i+1]
+			t = t[i+1:]
+		}
+
+		p.pending = nil
+	}
+
+	return t
+}
+
+// token returns the current token's source text and marks it as recorded, in Lossless mode.
+func (p *TextParser) token() string {
+	start := p.s.Position.Offset
+	end := p.s.Pos().Offset
+	p.prevEnd = end
+
+	return string(p.src.buf[start:end])
+}
+
+func (p *TextParser) recordKey() {
+	if p.mode&Lossless == 0 {
+		return
+	}
+
+	syn := &Syntax{key: p.node.Key}
+	syn.Leading = p.trivia(p.s.Position.Offset)
+	syn.Key = p.token()
+	p.node.Syntax = syn
+}
+
+func (p *TextParser) recordValue() {
+	syn := p.node.Syntax
+
+	if syn == nil {
+		return
+	}
+
+	syn.value = p.node.Value
+	syn.Separator = p.trivia(p.s.Position.Offset)
+	syn.Value = p.token()
+
+	if p.node.Type == Object {
+		p.pending = &syn.Open
+	} else {
+		p.pending = &syn.Trailing
+	}
+}
+
+func (p *TextParser) recordClosing() {
+	syn := p.scope.Syntax
+
+	if syn == nil {
+		return
+	}
+
+	syn.Closing = p.trivia(p.s.Position.Offset)
+	p.token()
+	p.pending = &syn.Trailing
+}
+
+func (p *TextParser) recordEOF() {
+	if p.mode&Lossless == 0 || p.root.Syntax == nil {
+		return
+	}
+
+	p.root.Syntax.Trailing += p.trivia(len(p.src.buf))
+}
+
+// dropSyntax leaves the source text from offset start to the end of the current token out of the
+// recorded text, in Lossless mode.
+func (p *TextParser) dropSyntax(start int) {
+	p.carry = p.trivia(start)
+	p.prevEnd = p.s.Pos().Offset
+	p.dropLine = true
+}
+
+// pos returns the position immediately after the last read token or character.
+func (p *TextParser) pos() Position {
+	return newPosition(p.s.Pos())
+}
+
+// unexpected returns an error for the last scanned token, at its start position.
+func (p *TextParser) unexpected(tok rune, expected string) *SyntaxError {
+	return newUnexpectedToken(newPosition(p.s.Position), expected, scanner.TokenString(tok))
+}
+
+func directiveType(tok rune, text string) (NodeType, bool) {
+	if tok != scanner.Ident {
+		return 0, false
+	}
+
+	switch {
+	case strings.EqualFold(text, directiveBase):
+		return Base, true
+	case strings.EqualFold(text, directiveInclude):
+		return Include, true
+	default:
+		return 0, false
+	}
+}
+
+// scanDirective reads the file name following a directive token.
+func (p *TextParser) scanDirective(typ NodeType, directive string) (*Node, *SyntaxError) {
+	pos := newPosition(p.s.Position)
+	tok := p.scan()
+
+	switch tok {
+	case scanner.String, scanner.Ident:
+		if p.mode&(Lossless|DropDirectives) == Lossless|DropDirectives {
+			p.dropSyntax(pos.Offset)
 		}
+
+		return &Node{
+			Type:     typ,
+			Key:      directive,
+			Value:    parseToken(p.s.TokenText()),
+			Pos:      pos,
+			ValuePos: newPosition(p.s.Position),
+		}, nil
+	case scanner.EOF:
+		return nil, newUnexpectedEOF(p.pos(), expectedFilename)
+	default:
+		return nil, p.unexpected(tok, expectedFilename)
 	}
+}
+
+// scanCondition reads the raw conditional expression following a '[' token, up to and including the
+// closing ']', and parses it.
+func (p *TextParser) scanCondition() (*Condition, *SyntaxError) {
+	pos := p.pos()
+
+	var b strings.Builder
 
-	return root, nil
+	for {
+		ch := p.s.Next()
+
+		switch ch {
+		case scanner.EOF:
+			return nil, newUnexpectedEOF(p.pos(), string(tokCondEnd))
+		case '\n':
+			return nil, &SyntaxError{Pos: pos, Msg: "condition not terminated", Err: ErrInvalidCondition}
+		case tokCondEnd:
+			cond, err := parseCondition(b.String())
+
+			if err != nil {
+				err.Pos = pos
+				return nil, err
+			}
+
+			return cond, nil
+		}
+
+		b.WriteRune(ch)
+	}
 }
@@ -0,0 +1,96 @@
+package parser_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go/parser"
+)
+
+func TestParser(t *testing.T) {
+	suite.Run(t, &ParserSuite{})
+}
+
+type ParserSuite struct {
+	suite.Suite
+}
+
+func (s *ParserSuite) parse(data string) (*parser.Node, error) {
+	return parser.NewTextParser("", strings.NewReader(data)).Parse()
+}
+
+func (s *ParserSuite) TestParseErrorPositions() {
+	require := s.Require()
+
+	testCases := []struct {
+		TestName string
+		Input    string
+		Line     int
+		Column   int
+		Actual   string
+	}{
+		{
+			TestName: "ObjectEnd",
+			Input:    `"a" { "b" "c" "d" } }`,
+			Line:     1,
+			Column:   19,
+			Actual:   `"}"`,
+		},
+		{
+			TestName: "ConditionWithoutNode",
+			Input:    `"a" { "b" "c" [$WIN32] [$X] }`,
+			Line:     1,
+			Column:   24,
+			Actual:   `"["`,
+		},
+		{
+			TestName: "ConditionWithoutNodeMultiline",
+			Input:    "\"a\"\n{\n\t\"b\" \"c\" [$WIN32]\n\t[$X]\n}",
+			Line:     4,
+			Column:   2,
+			Actual:   `"["`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, err := s.parse(testCase.Input)
+
+		var syntaxErr *parser.SyntaxError
+
+		require.Truef(errors.As(err, &syntaxErr), "case %s", testCase.TestName)
+		require.Truef(errors.Is(err, parser.ErrUnexpectedToken), "case %s", testCase.TestName)
+		require.Equalf(testCase.Line, syntaxErr.Pos.Line, "case %s", testCase.TestName)
+		require.Equalf(testCase.Column, syntaxErr.Pos.Column, "case %s", testCase.TestName)
+		require.Equalf(testCase.Actual, syntaxErr.Actual, "case %s", testCase.TestName)
+	}
+}
+
+func (s *ParserSuite) TestParseConditionAfterUnquotedValue() {
+	require := s.Require()
+	root, err := s.parse("a { b c[$X360] d e[!$PS3] f[$X] { g h } }")
+
+	require.NoError(err)
+	require.Len(root.Children, 3)
+
+	testCases := []struct {
+		Key   string
+		Value string
+		Cond  string
+	}{
+		{Key: "b", Value: "c", Cond: "[$X360]"},
+		{Key: "d", Value: "e", Cond: "[!$PS3]"},
+		{Key: "f", Value: "", Cond: "[$X]"},
+	}
+
+	for i, testCase := range testCases {
+		node := root.Children[i]
+
+		require.Equalf(testCase.Key, node.Key, "child %d", i)
+		require.Equalf(testCase.Value, node.Value, "child %d", i)
+		require.NotNilf(node.Cond, "child %d", i)
+		require.Equalf(testCase.Cond, node.Cond.String(), "child %d", i)
+	}
+}
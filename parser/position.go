@@ -0,0 +1,46 @@
+package parser
+
+import (
+	"fmt"
+	"text/scanner"
+)
+
+// Position is a location in the source.
+//
+// A Position is valid if the line number is > 0.
+type Position struct {
+	Filename string // filename, if any
+	Offset   int    // byte offset, starting at 0
+	Line     int    // line number, starting at 1
+	Column   int    // column number, starting at 1 (character count per line)
+}
+
+func newPosition(p scanner.Position) Position {
+	return Position{
+		Filename: p.Filename,
+		Offset:   p.Offset,
+		Line:     p.Line,
+		Column:   p.Column,
+	}
+}
+
+// IsValid reports whether the position is valid.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns the position formatted as "file:line:column" (or a subset of it, for positions
+// without filename or line information).
+func (p Position) String() string {
+	s := p.Filename
+
+	if s == "" {
+		s = "<input>"
+	}
+
+	if p.IsValid() {
+		s += fmt.Sprintf(":%d:%d", p.Line, p.Column)
+	}
+
+	return s
+}
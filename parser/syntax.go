@@ -0,0 +1,126 @@
+package parser
+
+import (
+	"io"
+	"strings"
+	"unicode"
+)
+
+// Syntax holds the source text of a node, recorded by the parser in Lossless mode.
+//
+// Writing Leading, Key, Separator and Value, followed, for objects, by Open, the source text of the
+// children, Closing and "}", and then Trailing, reproduces the node's source text exactly.
+//
+// The text between two nodes is split at the first line break: text up to and including the line
+// break (like an inline comment) belongs to the Trailing (or Open) text of the preceding node, and
+// the rest (like blank lines, comments and indentation) to the Leading (or Closing) text of the
+// following node.
+type Syntax struct {
+	// Leading is the text preceding the key: whitespace, comments and, for the root node,
+	// directives.
+	Leading string
+	// Key is the raw key token, including quotes if quoted.
+	Key string
+	// Separator is the text between the key and the value, including a condition, for objects.
+	Separator string
+	// Value is the raw value token, including quotes if quoted, or "{" for objects.
+	Value string
+	// Open is the text following "{", for objects.
+	Open string
+	// Closing is the text preceding "}", for objects.
+	Closing string
+	// Trailing is the text following the value (or "}", for objects), including a condition, for
+	// fields.
+	Trailing string
+
+	key   string
+	value string
+}
+
+// IsObject reports whether the syntax is of an object node.
+func (s *Syntax) IsObject() bool {
+	return s.Value == string(tokObjectStart)
+}
+
+// FormatKey returns the raw key token if key is the parsed key, otherwise returns the key
+// formatted in the same quoting style as the raw key token.
+func (s *Syntax) FormatKey(key string) string {
+	if key == s.key {
+		return s.Key
+	}
+
+	return formatToken(key, isQuoted(s.Key))
+}
+
+// FormatValue returns the raw value token if value is the parsed value, otherwise returns the
+// value formatted in the same quoting style as the raw value token.
+func (s *Syntax) FormatValue(value string) string {
+	if value == s.value && !s.IsObject() {
+		return s.Value
+	}
+
+	return formatToken(value, s.IsObject() || isQuoted(s.Value))
+}
+
+func isQuoted(token string) bool {
+	return strings.HasPrefix(token, string(tokQuote))
+}
+
+func formatToken(s string, quoted bool) string {
+	if !quoted && isIdent(s) {
+		return s
+	}
+
+	return Quote(s)
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i, ch := range s {
+		if !isIdentRune(ch, i) {
+			return false
+		}
+	}
+
+	return !strings.ContainsAny(s, "\\")
+}
+
+// isIdentRune reports whether ch can be part of an unquoted token. '[' always starts a condition,
+// even right after an unquoted token.
+func isIdentRune(ch rune, _ int) bool {
+	return unicode.In(ch, identRanges...) &&
+		ch != tokCondStart &&
+		ch != tokObjectStart &&
+		ch != tokObjectEnd &&
+		ch != tokQuote &&
+		ch != tokComment
+}
+
+// Quote returns s as a quoted token, escaping quotes, backslashes, newlines and tabs.
+func Quote(s string) string {
+	for _, esc := range escapeSeqs {
+		s = strings.ReplaceAll(s, esc[1], esc[0])
+	}
+
+	return string(tokQuote) + s + string(tokQuote)
+}
+
+// sourceReader records the data read from a reader, when enabled.
+type sourceReader struct {
+	r      io.Reader
+	buf    []byte
+	record bool
+}
+
+func (r *sourceReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+
+	if r.record {
+		r.buf = append(r.buf, p[:n]...)
+	}
+
+	return n, err
+}
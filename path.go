@@ -0,0 +1,214 @@
+package kv
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	pathSeparator    = '/'
+	pathAltSeparator = '.'
+	pathEscape       = '\\'
+)
+
+var pathEscaper = strings.NewReplacer(
+	string(pathEscape), string(pathEscape)+string(pathEscape),
+	string(pathSeparator), string(pathEscape)+string(pathSeparator),
+	string(pathAltSeparator), string(pathEscape)+string(pathAltSeparator),
+)
+
+// ParsePath splits a path into its (unescaped) keys.
+//
+// Keys in a path are separated by "/" or ".". A backslash escapes a separator or a backslash that
+// is part of a key, like in `Sounds/Hero_Axe\.Attack`. Elements of Array nodes are referenced by
+// their (zero-based) indexes. The empty path has no keys and references the node itself.
+func ParsePath(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	var (
+		keys []string
+		b    strings.Builder
+	)
+
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case pathEscape:
+			i++
+
+			if i == len(path) {
+				return nil, &PathError{Path: path, Err: ErrInvalidPath}
+			}
+
+			switch path[i] {
+			case pathEscape, pathSeparator, pathAltSeparator:
+				b.WriteByte(path[i])
+			default:
+				return nil, &PathError{Path: path, Err: ErrInvalidPath}
+			}
+		case pathSeparator, pathAltSeparator:
+			keys = append(keys, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return append(keys, b.String()), nil
+}
+
+// JoinPath joins keys into a path, escaping separators and backslashes in the keys.
+func JoinPath(keys ...string) string {
+	escaped := make([]string, len(keys))
+
+	for i, k := range keys {
+		escaped[i] = pathEscaper.Replace(k)
+	}
+
+	return strings.Join(escaped, string(pathSeparator))
+}
+
+// pathChild returns the child of kv referenced by key, nil if the child doesn't exist, or an error
+// if kv is neither an Object nor an Array.
+func pathChild(kv KeyValue, key string) (KeyValue, error) {
+	switch kv.Type() {
+	case TypeObject:
+		return kv.Child(key), nil
+	case TypeArray:
+		i, err := strconv.Atoi(key)
+
+		if err != nil {
+			return nil, nil
+		}
+
+		return kv.Index(i), nil
+	default:
+		return nil, ErrNotObject
+	}
+}
+
+// resolvePath returns the node referenced by keys.
+func resolvePath(kv KeyValue, op, path string, keys []string) (KeyValue, error) {
+	node := kv
+	parentKey := kv.Key()
+
+	for _, key := range keys {
+		child, err := pathChild(node, key)
+
+		if err != nil {
+			return nil, &PathError{Op: op, Path: path, Key: parentKey, Err: err}
+		}
+
+		if child == nil {
+			return nil, &PathError{Op: op, Path: path, Key: key, Err: ErrNotFound}
+		}
+
+		node, parentKey = child, key
+	}
+
+	return node, nil
+}
+
+func parsePath(op, path string) ([]string, error) {
+	keys, err := ParsePath(path)
+
+	if err != nil {
+		err.(*PathError).Op = op
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (kv *keyValue) Get(path string) (KeyValue, error) {
+	keys, err := parsePath(OpGet, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return resolvePath(kv, OpGet, path, keys)
+}
+
+func (kv *keyValue) Set(path string, t Type, value string) (KeyValue, error) {
+	keys, err := parsePath(OpSet, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var node KeyValue = kv
+	parentKey := kv.Key()
+
+	for _, key := range keys {
+		child, err := pathChild(node, key)
+
+		if err != nil {
+			return nil, &PathError{Op: OpSet, Path: path, Key: parentKey, Err: err}
+		}
+
+		if child == nil {
+			if node.Type() == TypeArray && key != strconv.Itoa(len(node.Children())) {
+				return nil, &PathError{Op: OpSet, Path: path, Key: key, Err: ErrNotFound}
+			}
+
+			childKey := key
+
+			if node.Type() == TypeArray {
+				childKey = ""
+			}
+
+			child = NewKeyValueObject(childKey, node)
+		}
+
+		node, parentKey = child, key
+	}
+
+	node.SetType(t).SetValue(value)
+
+	if t != TypeObject && t != TypeArray {
+		node.SetChildren()
+	}
+
+	return node, nil
+}
+
+func (kv *keyValue) Delete(path string) (KeyValue, error) {
+	keys, err := parsePath(OpDelete, path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, &PathError{Op: OpDelete, Path: path, Err: ErrInvalidPath}
+	}
+
+	last := len(keys) - 1
+	parent, err := resolvePath(kv, OpDelete, path, keys[:last])
+
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := pathChild(parent, keys[last])
+
+	if err != nil {
+		parentKey := kv.Key()
+
+		if last > 0 {
+			parentKey = keys[last-1]
+		}
+
+		return nil, &PathError{Op: OpDelete, Path: path, Key: parentKey, Err: err}
+	}
+
+	if node == nil {
+		return nil, &PathError{Op: OpDelete, Path: path, Key: keys[last], Err: ErrNotFound}
+	}
+
+	parent.RemoveChild(node)
+
+	return node, nil
+}
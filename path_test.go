@@ -0,0 +1,210 @@
+package kv_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestPath(t *testing.T) {
+	suite.Run(t, &PathSuite{})
+}
+
+type PathSuite struct {
+	Suite
+}
+
+func (s *PathSuite) subject() kv.KeyValue {
+	return kv.NewKeyValueRoot("DOTAHeroes").
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+			AddString("Ability1", "axe_berserkers_call").
+			AddString("Hero_Axe.Attack", "sound").
+			AddString("a/b\\c", "escaped").
+			AddChild(kv.NewKeyValueArray("Roles", nil).
+				AddString("", "Initiator").
+				AddString("", "Durable")))
+}
+
+func (s *PathSuite) TestParsePath() {
+	require := s.Require()
+
+	testCases := []struct {
+		Path     string
+		Expected []string
+	}{
+		{Path: "", Expected: nil},
+		{Path: "a", Expected: []string{"a"}},
+		{Path: "a/b.c", Expected: []string{"a", "b", "c"}},
+		{Path: "a//b", Expected: []string{"a", "", "b"}},
+		{Path: `a\/b\.c\\`, Expected: []string{`a/b.c\`}},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := kv.ParsePath(testCase.Path)
+
+		require.NoErrorf(err, "path %q", testCase.Path)
+		require.Equalf(testCase.Expected, actual, "path %q", testCase.Path)
+	}
+
+	for _, path := range []string{`a\`, `a\b`} {
+		_, err := kv.ParsePath(path)
+
+		require.Truef(errors.Is(err, kv.ErrInvalidPath), "path %q", path)
+	}
+
+	require.Equal(`a/b\.c/d\/e\\`, kv.JoinPath("a", "b.c", `d/e\`))
+
+	keys, err := kv.ParsePath(kv.JoinPath("a", "b.c", `d/e\`))
+
+	require.NoError(err)
+	require.Equal([]string{"a", "b.c", `d/e\`}, keys)
+}
+
+func (s *PathSuite) TestGet() {
+	require := s.Require()
+	root := s.subject()
+
+	testCases := []struct {
+		Path  string
+		Value string
+	}{
+		{Path: "npc_dota_hero_axe/Ability1", Value: "axe_berserkers_call"},
+		{Path: "npc_dota_hero_axe.Ability1", Value: "axe_berserkers_call"},
+		{Path: `npc_dota_hero_axe/Hero_Axe\.Attack`, Value: "sound"},
+		{Path: `npc_dota_hero_axe/a\/b\\c`, Value: "escaped"},
+		{Path: "npc_dota_hero_axe/Roles/1", Value: "Durable"},
+	}
+
+	for _, testCase := range testCases {
+		actual, err := root.Get(testCase.Path)
+
+		require.NoErrorf(err, "path %q", testCase.Path)
+		require.Equalf(testCase.Value, actual.Value(), "path %q", testCase.Path)
+	}
+
+	actual, err := root.Get("")
+
+	require.NoError(err)
+	require.Equal(root, actual)
+}
+
+func (s *PathSuite) TestGetErrors() {
+	require := s.Require()
+	root := s.subject()
+
+	var pathErr *kv.PathError
+
+	_, err := root.Get("npc_dota_hero_axe/Ability2")
+
+	require.EqualError(err, `kv: cannot get "npc_dota_hero_axe/Ability2": key "Ability2": not found`)
+	require.True(errors.Is(err, kv.ErrNotFound))
+	require.True(errors.As(err, &pathErr))
+	require.Equal(kv.OpGet, pathErr.Op)
+	require.Equal("Ability2", pathErr.Key)
+
+	_, err = root.Get("npc_dota_hero_axe/Ability1/Level")
+
+	require.EqualError(err, `kv: cannot get "npc_dota_hero_axe/Ability1/Level": key "Ability1": not an object`)
+	require.True(errors.Is(err, kv.ErrNotObject))
+
+	_, err = root.Get("npc_dota_hero_axe/Roles/2")
+
+	require.True(errors.Is(err, kv.ErrNotFound))
+
+	_, err = root.Get("npc_dota_hero_axe/Roles/first")
+
+	require.True(errors.Is(err, kv.ErrNotFound))
+
+	_, err = root.Get(`npc_dota_hero_axe\`)
+
+	require.EqualError(err, `kv: cannot get "npc_dota_hero_axe\\": invalid path`)
+	require.True(errors.Is(err, kv.ErrInvalidPath))
+}
+
+func (s *PathSuite) TestSet() {
+	require := s.Require()
+	root := s.subject()
+
+	node, err := root.Set("npc_dota_hero_axe/Ability1", kv.TypeString, "axe_battle_hunger")
+
+	require.NoError(err)
+	require.Equal("axe_battle_hunger", node.Value())
+	require.Len(root.Child("npc_dota_hero_axe").Children(), 4)
+
+	node, err = root.Set("npc_dota_hero_sven/Stats/Armor", kv.TypeInt32, "2")
+
+	require.NoError(err)
+	require.Equal(kv.TypeInt32, node.Type())
+
+	stats, err := root.Get("npc_dota_hero_sven/Stats")
+
+	require.NoError(err)
+	require.Equal(kv.TypeObject, stats.Type())
+	require.Equal(node, stats.Child("Armor"))
+	require.Equal(stats, node.Parent())
+
+	node, err = root.Set("npc_dota_hero_axe/Roles/2", kv.TypeString, "Disabler")
+
+	require.NoError(err)
+	require.Equal("", node.Key())
+	require.Len(root.Child("npc_dota_hero_axe").Child("Roles").Children(), 3)
+
+	node, err = root.Set("npc_dota_hero_axe/Roles/0", kv.TypeString, "Carry")
+
+	require.NoError(err)
+	require.Equal("Carry", root.Child("npc_dota_hero_axe").Child("Roles").Index(0).Value())
+	require.Equal(node, root.Child("npc_dota_hero_axe").Child("Roles").Index(0))
+
+	_, err = root.Set("npc_dota_hero_axe/Roles/5", kv.TypeString, "Nuker")
+
+	require.True(errors.Is(err, kv.ErrNotFound))
+
+	_, err = root.Set("npc_dota_hero_axe/Ability1/Level", kv.TypeInt32, "1")
+
+	require.EqualError(err, `kv: cannot set "npc_dota_hero_axe/Ability1/Level": key "Ability1": not an object`)
+	require.True(errors.Is(err, kv.ErrNotObject))
+
+	node, err = root.Set("npc_dota_hero_sven/Stats", kv.TypeString, "none")
+
+	require.NoError(err)
+	require.Empty(node.Children())
+}
+
+func (s *PathSuite) TestDelete() {
+	require := s.Require()
+	root := s.subject()
+
+	node, err := root.Delete("npc_dota_hero_axe/Ability1")
+
+	require.NoError(err)
+	require.Equal("axe_berserkers_call", node.Value())
+	require.Nil(node.Parent())
+	require.Nil(root.Child("npc_dota_hero_axe").Child("Ability1"))
+	require.Len(root.Child("npc_dota_hero_axe").Children(), 3)
+
+	node, err = root.Delete("npc_dota_hero_axe/Roles/0")
+
+	require.NoError(err)
+	require.Equal("Initiator", node.Value())
+	require.Equal("Durable", root.Child("npc_dota_hero_axe").Child("Roles").Index(0).Value())
+
+	_, err = root.Delete("npc_dota_hero_axe/Ability1")
+
+	require.EqualError(err, `kv: cannot delete "npc_dota_hero_axe/Ability1": key "Ability1": not found`)
+	require.True(errors.Is(err, kv.ErrNotFound))
+
+	_, err = root.Delete("npc_dota_hero_axe/Hero_Axe.Attack")
+
+	require.True(errors.Is(err, kv.ErrNotFound))
+
+	_, err = root.Delete(`npc_dota_hero_axe/Hero_Axe\.Attack/sound`)
+
+	require.True(errors.Is(err, kv.ErrNotObject))
+
+	_, err = root.Delete("")
+
+	require.True(errors.Is(err, kv.ErrInvalidPath))
+}
@@ -0,0 +1,13 @@
+package kv
+
+import (
+	"github.com/13k/kv-go/parser"
+)
+
+// Position is a location in the source a node was decoded from.
+//
+// A Position is valid if the line number is > 0.
+type Position = parser.Position
+
+// Syntax is the source text of a node, recorded by a TextDecoder in lossless mode.
+type Syntax = parser.Syntax
@@ -0,0 +1,631 @@
+package kv
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	queryRecursive      = "**"
+	queryRegexp         = '~'
+	queryQuote          = '"'
+	queryPredicateStart = '['
+	queryPredicateEnd   = ']'
+)
+
+// query comparison operators, longest first
+var queryOperators = []string{"!=", "~=", "<=", ">=", "=", "<", ">"}
+
+// QueryMatch is a node matched by a query.
+type QueryMatch struct {
+	// Path is the path of the node (see ParsePath), relative to the node the query was evaluated
+	// against, with the occurrence of duplicate keys in brackets like Change.PathString, as in
+	// `npc_dota_hero_sniper/Ability1[1]`. Querying the path selects the node first, and paths
+	// without occurrences (of first occurring keys) can be used with Get.
+	Path string
+	// Node is the matched node.
+	Node KeyValue
+}
+
+// Query is a compiled query, selecting nodes from a KeyValue tree.
+//
+// A query is a sequence of steps separated by "/" or ".", like a path (see ParsePath). Each step
+// selects nodes relative to the nodes selected by the previous step (starting with the node the
+// query is evaluated against), and is made of a key selector followed by any number of predicates.
+//
+// Key selectors:
+//
+//   Ability1        child nodes with key "Ability1"
+//   Ability*        child nodes with keys matching a glob pattern ("*" and "?")
+//   *               all child nodes
+//   **              the node itself and all its descendants (recursive descent)
+//   "key/with.dot"  child nodes with the given key, quoted (`\"` and `\\` are escaped)
+//   ~"^Ability\d+$" child nodes with keys matching a regular expression, quoted
+//
+// Keys and glob patterns are compared according to the KeyMode of the nodes, while regular
+// expressions are always case-sensitive (use the "(?i)" flag to ignore case).
+//
+// Elements of Array nodes are selected by their indexes, as keys. Outside of quotes, a backslash
+// escapes the following character, like in `Hero_Axe\.Attack` or `\*`.
+//
+// Predicates filter the nodes selected by the key selector:
+//
+//   [1]                 the second node (per parent node, for duplicate keys); [-1] is the last
+//   [Rarity]            nodes with a child at the given path
+//   [Rarity=common]     nodes with a child at the given path with the given value
+//   [=common]           nodes with the given value
+//
+// Values can be compared with "=", "!=", "~=" (regular expression), and "<", "<=", ">", ">="
+// (numeric comparison), and comparisons only match scalar nodes, never Object or Array nodes.
+// Values can be quoted, and unquoted values end at the closing "]".
+//
+// Examples:
+//
+//   *[AttackCapabilities=DOTA_UNIT_CAP_RANGED_ATTACK]
+//   npc_dota_hero_*/Ability*
+//   **/Ability*[~="^axe_"]
+//   items/*[ItemCost>=2000]
+type Query struct {
+	src   string
+	steps []*queryStep
+}
+
+type queryStep struct {
+	recursive  bool
+	key        string
+	pattern    *regexp.Regexp
+	glob       *regexp.Regexp
+	globFold   *regexp.Regexp
+	predicates []*queryPredicate
+}
+
+type queryPredicate struct {
+	index    *int
+	path     string
+	operator string
+	value    string
+	pattern  *regexp.Regexp
+}
+
+// CompileQuery parses a query.
+//
+// Returns a *QueryError if the query is malformed.
+func CompileQuery(query string) (*Query, error) {
+	p := &queryParser{src: query}
+	steps, err := p.parse()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Query{src: query, steps: steps}, nil
+}
+
+// MustCompileQuery is like CompileQuery but panics if the query is malformed.
+func MustCompileQuery(query string) *Query {
+	q, err := CompileQuery(query)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return q
+}
+
+// String returns the source text of the query.
+func (q *Query) String() string {
+	return q.src
+}
+
+// Select evaluates the query against kv and returns the matched nodes, in the order they were
+// found. Each node is matched at most once.
+func (q *Query) Select(kv KeyValue) []QueryMatch {
+	type selection struct {
+		node KeyValue
+		keys []DiffKey
+	}
+
+	current := []selection{{node: kv}}
+
+	for _, step := range q.steps {
+		var (
+			next []selection
+			seen = map[KeyValue]bool{}
+		)
+
+		for _, ctx := range current {
+			var candidates []selection
+
+			add := func(node KeyValue, keys []DiffKey) {
+				candidates = append(candidates, selection{node: node, keys: keys})
+			}
+
+			if step.recursive {
+				walkQuery(ctx.node, ctx.keys, add)
+			} else {
+				keys := queryKeys(ctx.node)
+
+				for i, c := range ctx.node.Children() {
+					if step.matchKey(keys[i].Key, ctx.node.KeyMode()) {
+						add(c, appendQueryKey(ctx.keys, keys[i]))
+					}
+				}
+			}
+
+			for _, pred := range step.predicates {
+				if pred.index != nil {
+					i := *pred.index
+
+					if i < 0 {
+						i += len(candidates)
+					}
+
+					if i < 0 || i >= len(candidates) {
+						candidates = nil
+					} else {
+						candidates = candidates[i : i+1]
+					}
+
+					continue
+				}
+
+				filtered := candidates[:0]
+
+				for _, c := range candidates {
+					if pred.match(c.node) {
+						filtered = append(filtered, c)
+					}
+				}
+
+				candidates = filtered
+			}
+
+			for _, c := range candidates {
+				if !seen[c.node] {
+					seen[c.node] = true
+					next = append(next, c)
+				}
+			}
+		}
+
+		current = next
+	}
+
+	matches := make([]QueryMatch, len(current))
+
+	for i, s := range current {
+		matches[i] = QueryMatch{Path: formatDiffPath(s.keys), Node: s.node}
+	}
+
+	return matches
+}
+
+// walkQuery calls fn with node and all its descendants, in depth-first order.
+func walkQuery(node KeyValue, keys []DiffKey, fn func(KeyValue, []DiffKey)) {
+	fn(node, keys)
+
+	childKeys := queryKeys(node)
+
+	for i, c := range node.Children() {
+		walkQuery(c, appendQueryKey(keys, childKeys[i]), fn)
+	}
+}
+
+// queryKeys returns the path keys of the children of node: their indexes for Array nodes, or their
+// keys and occurrences among the children with the same key (compared according to the KeyMode
+// of node, like the index predicates of queries).
+func queryKeys(node KeyValue) []DiffKey {
+	children := node.Children()
+	keys := make([]DiffKey, len(children))
+
+	if node.Type() == TypeArray {
+		for i := range children {
+			keys[i] = DiffKey{Key: strconv.Itoa(i)}
+		}
+
+		return keys
+	}
+
+	mode := node.KeyMode()
+	counts := make(map[string]int, len(children))
+
+	for i, c := range children {
+		key := mode.fold(c.Key())
+		keys[i] = DiffKey{Key: c.Key(), Occurrence: counts[key]}
+		counts[key]++
+	}
+
+	return keys
+}
+
+func appendKey(keys []string, key string) []string {
+	return append(append(make([]string, 0, len(keys)+1), keys...), key)
+}
+
+func appendQueryKey(keys []DiffKey, key DiffKey) []DiffKey {
+	return append(append(make([]DiffKey, 0, len(keys)+1), keys...), key)
+}
+
+func (s *queryStep) matchKey(key string, mode KeyMode) bool {
+	switch {
+	case s.pattern != nil:
+		return s.pattern.MatchString(key)
+	case s.glob != nil && mode == KeyModeCaseInsensitive:
+		return s.globFold.MatchString(key)
+	case s.glob != nil:
+		return s.glob.MatchString(key)
+	default:
+		return mode.Equal(key, s.key)
+	}
+}
+
+func (p *queryPredicate) match(kv KeyValue) bool {
+	node, err := kv.Get(p.path)
+
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case p.operator == "":
+		return true
+	case node.Type() == TypeObject || node.Type() == TypeArray:
+		return false
+	}
+
+	switch p.operator {
+	case "=":
+		return node.Value() == p.value
+	case "!=":
+		return node.Value() != p.value
+	case "~=":
+		return p.pattern.MatchString(node.Value())
+	}
+
+	a, err := strconv.ParseFloat(node.Value(), 64)
+
+	if err != nil {
+		return false
+	}
+
+	b, err := strconv.ParseFloat(p.value, 64)
+
+	if err != nil {
+		return false
+	}
+
+	switch p.operator {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	default:
+		return a >= b
+	}
+}
+
+// queryParser parses the source text of a query.
+type queryParser struct {
+	src string
+	off int
+}
+
+func (p *queryParser) eof() bool {
+	return p.off >= len(p.src)
+}
+
+func (p *queryParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+
+	return p.src[p.off]
+}
+
+func (p *queryParser) errorf(off int, msg string) *QueryError {
+	return &QueryError{Query: p.src, Offset: off, Msg: msg}
+}
+
+func (p *queryParser) parse() ([]*queryStep, error) {
+	if p.src == "" {
+		return nil, p.errorf(0, "empty query")
+	}
+
+	var steps []*queryStep
+
+	for {
+		step, err := p.parseStep()
+
+		if err != nil {
+			return nil, err
+		}
+
+		steps = append(steps, step)
+
+		if p.eof() {
+			return steps, nil
+		}
+
+		switch p.peek() {
+		case pathSeparator, pathAltSeparator:
+			p.off++
+		default:
+			return nil, p.errorf(p.off, "unexpected "+strconv.Quote(string(p.peek())))
+		}
+	}
+}
+
+func (p *queryParser) parseStep() (*queryStep, error) {
+	step := &queryStep{}
+	start := p.off
+
+	switch {
+	case strings.HasPrefix(p.src[p.off:], queryRecursive) && p.isStepEnd(p.off+len(queryRecursive)):
+		p.off += len(queryRecursive)
+		step.recursive = true
+	case p.peek() == queryQuote:
+		s, err := p.parseQuoted()
+
+		if err != nil {
+			return nil, err
+		}
+
+		step.key = s
+	case p.peek() == queryRegexp:
+		p.off++
+
+		if p.peek() != queryQuote {
+			return nil, p.errorf(p.off, "expected quoted regular expression")
+		}
+
+		s, err := p.parseQuoted()
+
+		if err != nil {
+			return nil, err
+		}
+
+		re, err := regexp.Compile(s)
+
+		if err != nil {
+			return nil, p.errorf(start, err.Error())
+		}
+
+		step.pattern = re
+	default:
+		glob, isGlob := p.parseGlob()
+
+		if isGlob {
+			step.glob = regexp.MustCompile(glob)
+			step.globFold = regexp.MustCompile("(?i)" + glob)
+		} else {
+			step.key = glob
+		}
+	}
+
+	for p.peek() == queryPredicateStart {
+		pred, err := p.parsePredicate()
+
+		if err != nil {
+			return nil, err
+		}
+
+		step.predicates = append(step.predicates, pred)
+	}
+
+	return step, nil
+}
+
+func (p *queryParser) isStepEnd(off int) bool {
+	if off >= len(p.src) {
+		return true
+	}
+
+	switch p.src[off] {
+	case pathSeparator, pathAltSeparator, queryPredicateStart:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseQuoted parses a quoted string, where `\"` and `\\` are escaped.
+func (p *queryParser) parseQuoted() (string, error) {
+	start := p.off
+	p.off++
+
+	var b strings.Builder
+
+	for !p.eof() {
+		c := p.src[p.off]
+		p.off++
+
+		switch c {
+		case queryQuote:
+			return b.String(), nil
+		case pathEscape:
+			if next := p.peek(); next == queryQuote || next == pathEscape {
+				b.WriteByte(next)
+				p.off++
+			} else {
+				b.WriteByte(c)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", p.errorf(start, "unterminated quoted string")
+}
+
+// parseGlob parses an unquoted key, returning either the unescaped key or, if it contains
+// wildcards, the equivalent regular expression.
+func (p *queryParser) parseGlob() (string, bool) {
+	var (
+		key, re strings.Builder
+		isGlob  bool
+	)
+
+	re.WriteByte('^')
+
+	for !p.isStepEnd(p.off) {
+		c := p.src[p.off]
+		p.off++
+
+		switch {
+		case c == pathEscape && !p.eof():
+			c = p.src[p.off]
+			p.off++
+
+			key.WriteByte(c)
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		case c == '*':
+			isGlob = true
+			re.WriteString(".*")
+		case c == '?':
+			isGlob = true
+			re.WriteByte('.')
+		default:
+			key.WriteByte(c)
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	re.WriteByte('$')
+
+	if isGlob {
+		return re.String(), true
+	}
+
+	return key.String(), false
+}
+
+func (p *queryParser) parsePredicate() (*queryPredicate, error) {
+	start := p.off
+	p.off++
+
+	pred := &queryPredicate{}
+	end := p.findPredicateEnd()
+
+	if end < 0 {
+		return nil, p.errorf(start, "unterminated predicate")
+	}
+
+	body := p.src[p.off:end]
+
+	if n, err := strconv.Atoi(body); err == nil {
+		pred.index = &n
+		p.off = end + 1
+
+		return pred, nil
+	}
+
+	// path, up to the operator
+	var path strings.Builder
+
+	for p.off < end {
+		if p.src[p.off] == pathEscape && p.off+1 < end {
+			path.WriteString(p.src[p.off : p.off+2])
+			p.off += 2
+
+			continue
+		}
+
+		if op := p.operatorAt(p.off); op != "" {
+			pred.operator = op
+			p.off += len(op)
+
+			break
+		}
+
+		path.WriteByte(p.src[p.off])
+		p.off++
+	}
+
+	pred.path = path.String()
+
+	if _, err := ParsePath(pred.path); err != nil {
+		return nil, p.errorf(start, "invalid path "+strconv.Quote(pred.path))
+	}
+
+	if pred.operator == "" {
+		if pred.path == "" {
+			return nil, p.errorf(start, "empty predicate")
+		}
+
+		p.off = end + 1
+
+		return pred, nil
+	}
+
+	if p.peek() == queryQuote {
+		s, err := p.parseQuoted()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if p.off != end {
+			return nil, p.errorf(p.off, "unexpected "+strconv.Quote(p.src[p.off:end]))
+		}
+
+		pred.value = s
+	} else {
+		pred.value = strings.NewReplacer(`\]`, "]", `\\`, `\`).Replace(p.src[p.off:end])
+	}
+
+	p.off = end + 1
+
+	if pred.operator == "~=" {
+		re, err := regexp.Compile(pred.value)
+
+		if err != nil {
+			return nil, p.errorf(start, err.Error())
+		}
+
+		pred.pattern = re
+	}
+
+	return pred, nil
+}
+
+// findPredicateEnd returns the offset of the "]" closing the current predicate, skipping escaped
+// characters and quoted strings, or -1 if the predicate is not terminated.
+func (p *queryParser) findPredicateEnd() int {
+	quoted := false
+
+	for i := p.off; i < len(p.src); i++ {
+		switch c := p.src[i]; {
+		case c == pathEscape:
+			i++
+		case c == queryQuote:
+			quoted = !quoted
+		case c == queryPredicateEnd && !quoted:
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (p *queryParser) operatorAt(off int) string {
+	for _, op := range queryOperators {
+		if strings.HasPrefix(p.src[off:], op) {
+			return op
+		}
+	}
+
+	return ""
+}
+
+func (kv *keyValue) Query(query string) ([]QueryMatch, error) {
+	q, err := CompileQuery(query)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return q.Select(kv), nil
+}
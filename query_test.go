@@ -0,0 +1,249 @@
+package kv_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestQuery(t *testing.T) {
+	suite.Run(t, &QuerySuite{})
+}
+
+type QuerySuite struct {
+	Suite
+}
+
+func (s *QuerySuite) subject() kv.KeyValue {
+	return kv.NewKeyValueRoot("DOTAHeroes").
+		AddString("Version", "1").
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+			AddString("AttackCapabilities", "DOTA_UNIT_CAP_MELEE_ATTACK").
+			AddString("Ability1", "axe_berserkers_call").
+			AddString("Ability2", "axe_battle_hunger").
+			AddInt32("ArmorPhysical", "1").
+			AddChild(kv.NewKeyValueArray("Roles", nil).
+				AddString("", "Initiator").
+				AddString("", "Durable"))).
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_drow_ranger", nil).
+			AddString("AttackCapabilities", "DOTA_UNIT_CAP_RANGED_ATTACK").
+			AddString("Ability1", "drow_ranger_frost_arrows").
+			AddInt32("ArmorPhysical", "-1").
+			AddChild(kv.NewKeyValueObject("Stats", nil).
+				AddString("Ability1", "nested"))).
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_sniper", nil).
+			AddString("AttackCapabilities", "DOTA_UNIT_CAP_RANGED_ATTACK").
+			AddString("Ability1", "sniper_shrapnel").
+			AddString("Ability1", "sniper_headshot").
+			AddString("Hero.Sound", "sniper")).
+		AddChild(kv.NewKeyValueObject("npc_dota_units", nil).
+			AddString("Ability1", "unit_ability"))
+}
+
+func (s *QuerySuite) TestSelect() {
+	require := s.Require()
+	root := s.subject()
+
+	testCases := []struct {
+		Query    string
+		Expected []string
+	}{
+		{
+			Query:    "*[AttackCapabilities=DOTA_UNIT_CAP_RANGED_ATTACK]",
+			Expected: []string{"npc_dota_hero_drow_ranger", "npc_dota_hero_sniper"},
+		},
+		{
+			Query: "npc_dota_hero_*/Ability*",
+			Expected: []string{
+				"npc_dota_hero_axe/Ability1",
+				"npc_dota_hero_axe/Ability2",
+				"npc_dota_hero_drow_ranger/Ability1",
+				"npc_dota_hero_sniper/Ability1",
+				"npc_dota_hero_sniper/Ability1[1]",
+			},
+		},
+		{
+			Query: "**/Ability1",
+			Expected: []string{
+				"npc_dota_hero_axe/Ability1",
+				"npc_dota_hero_drow_ranger/Ability1",
+				"npc_dota_hero_drow_ranger/Stats/Ability1",
+				"npc_dota_hero_sniper/Ability1",
+				"npc_dota_hero_sniper/Ability1[1]",
+				"npc_dota_units/Ability1",
+			},
+		},
+		{
+			Query:    `**/~"^Ability\d$"[~="^axe_"]`,
+			Expected: []string{"npc_dota_hero_axe/Ability1", "npc_dota_hero_axe/Ability2"},
+		},
+		{
+			Query:    "npc_dota_hero_sniper/Ability1[1]",
+			Expected: []string{"npc_dota_hero_sniper/Ability1[1]"},
+		},
+		{
+			Query:    "*/Ability1[-1]",
+			Expected: []string{"npc_dota_hero_axe/Ability1", "npc_dota_hero_drow_ranger/Ability1", "npc_dota_hero_sniper/Ability1[1]", "npc_dota_units/Ability1"}, //nolint:lll
+		},
+		{
+			Query:    "*/Ability1[2]",
+			Expected: nil,
+		},
+		{
+			Query:    "npc_dota_hero_axe/Roles/*",
+			Expected: []string{"npc_dota_hero_axe/Roles/0", "npc_dota_hero_axe/Roles/1"},
+		},
+		{
+			Query:    "npc_dota_hero_axe.Roles.1",
+			Expected: []string{"npc_dota_hero_axe/Roles/1"},
+		},
+		{
+			Query:    "*[Stats/Ability1]",
+			Expected: []string{"npc_dota_hero_drow_ranger"},
+		},
+		{
+			Query:    "*[ArmorPhysical>=0]",
+			Expected: []string{"npc_dota_hero_axe"},
+		},
+		{
+			Query:    "*[ArmorPhysical<0]",
+			Expected: []string{"npc_dota_hero_drow_ranger"},
+		},
+		{
+			Query:    `*[AttackCapabilities!="DOTA_UNIT_CAP_RANGED_ATTACK"]`,
+			Expected: []string{"npc_dota_hero_axe"},
+		},
+		{
+			Query:    `npc_dota_hero_sniper/Hero\.Sound`,
+			Expected: []string{`npc_dota_hero_sniper/Hero\.Sound`},
+		},
+		{
+			Query:    `npc_dota_hero_sniper/"Hero.Sound"`,
+			Expected: []string{`npc_dota_hero_sniper/Hero\.Sound`},
+		},
+		{
+			Query:    "npc_dota_hero_?xe",
+			Expected: []string{"npc_dota_hero_axe"},
+		},
+		{
+			Query:    "**/**[=sniper_headshot]",
+			Expected: []string{"npc_dota_hero_sniper/Ability1[1]"},
+		},
+		{
+			Query:    `npc_dota_hero_axe/*[=""]`,
+			Expected: nil,
+		},
+		{
+			Query:    "*[!=x]",
+			Expected: []string{"Version"},
+		},
+		{
+			Query:    "*[Stats!=x]",
+			Expected: nil,
+		},
+		{
+			Query:    "npc_dota_hero_lina/*",
+			Expected: nil,
+		},
+	}
+
+	for _, testCase := range testCases {
+		matches, err := root.Query(testCase.Query)
+
+		require.NoErrorf(err, "query %q", testCase.Query)
+
+		var actual []string
+
+		for _, m := range matches {
+			actual = append(actual, m.Path)
+
+			// querying the path selects the matched node first
+			selected, err := root.Query(m.Path)
+
+			require.NoErrorf(err, "query %q", testCase.Query)
+			require.NotEmptyf(selected, "query %q", testCase.Query)
+			require.Truef(selected[0].Node == m.Node, "query %q: path %q", testCase.Query, m.Path)
+		}
+
+		require.Equalf(testCase.Expected, actual, "query %q", testCase.Query)
+	}
+}
+
+func (s *QuerySuite) TestSelectDuplicates() {
+	require := s.Require()
+	root := s.subject()
+
+	matches := kv.MustCompileQuery("npc_dota_hero_sniper/Ability1").Select(root)
+
+	require.Len(matches, 2)
+	require.Equal("sniper_shrapnel", matches[0].Node.Value())
+	require.Equal("sniper_headshot", matches[1].Node.Value())
+	require.Equal("npc_dota_hero_sniper/Ability1", matches[0].Path)
+	require.Equal("npc_dota_hero_sniper/Ability1[1]", matches[1].Path)
+
+	node, err := root.Get(matches[0].Path)
+
+	require.NoError(err)
+	require.True(node == matches[0].Node)
+
+	// occurrences are counted according to the KeyMode
+	root.Child("npc_dota_hero_sniper").AddString("ABILITY1", "sniper_assassinate").SetKeyMode(kv.KeyModeCaseInsensitive)
+
+	matches = kv.MustCompileQuery("npc_dota_hero_sniper/ability1").Select(root)
+
+	require.Len(matches, 3)
+	require.Equal("npc_dota_hero_sniper/ABILITY1[2]", matches[2].Path)
+	require.Equal("sniper_assassinate", kv.MustCompileQuery(matches[2].Path).Select(root)[0].Node.Value())
+
+	matches = kv.MustCompileQuery("**/**/npc_dota_hero_axe").Select(root)
+
+	require.Len(matches, 1)
+
+	matches = kv.MustCompileQuery("**").Select(root)
+
+	require.Equal("", matches[0].Path)
+	require.Equal(root, matches[0].Node)
+}
+
+func (s *QuerySuite) TestCompileErrors() {
+	require := s.Require()
+
+	testCases := []struct {
+		Query string
+		Error string
+	}{
+		{Query: "", Error: `kv: invalid query "": offset 0: empty query`},
+		{Query: "*[Ability1", Error: `kv: invalid query "*[Ability1": offset 1: unterminated predicate`},
+		{Query: `"Ability1`, Error: `kv: invalid query "\"Ability1": offset 0: unterminated quoted string`},
+		{Query: `~Ability1`, Error: `kv: invalid query "~Ability1": offset 1: expected quoted regular expression`},
+		{Query: `*[]`, Error: `kv: invalid query "*[]": offset 1: empty predicate`},
+		{Query: `*[="a"c]`, Error: `kv: invalid query "*[=\"a\"c]": offset 6: unexpected "c"`},
+		{Query: `*[1]x`, Error: `kv: invalid query "*[1]x": offset 4: unexpected "x"`},
+		{Query: `*[Ability\x]`, Error: `kv: invalid query "*[Ability\\x]": offset 1: invalid path "Ability\\x"`},
+	}
+
+	for _, testCase := range testCases {
+		_, err := kv.CompileQuery(testCase.Query)
+
+		require.EqualErrorf(err, testCase.Error, "query %q", testCase.Query)
+		require.Truef(errors.Is(err, kv.ErrInvalidQuery), "query %q", testCase.Query)
+
+		var queryErr *kv.QueryError
+
+		require.Truef(errors.As(err, &queryErr), "query %q", testCase.Query)
+	}
+
+	_, err := kv.CompileQuery(`~"("`)
+
+	require.True(errors.Is(err, kv.ErrInvalidQuery))
+
+	_, err = kv.CompileQuery(`*[~="("]`)
+
+	require.True(errors.Is(err, kv.ErrInvalidQuery))
+
+	require.Panics(func() { kv.MustCompileQuery("") })
+	require.Equal("**/Ability1", kv.MustCompileQuery("**/Ability1").String())
+}
@@ -0,0 +1,32 @@
+package kv
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Resolver opens files referenced by `#base` and `#include` directives.
+//
+// Names are slash-separated paths relative to the directory of the file being decoded by the
+// TextDecoder (directives in included files are resolved relative to the included file's
+// directory).
+type Resolver interface {
+	Resolve(name string) (io.ReadCloser, error)
+}
+
+// ResolverFunc is an adapter to allow the use of ordinary functions as Resolver.
+type ResolverFunc func(name string) (io.ReadCloser, error)
+
+// Resolve calls f(name).
+func (f ResolverFunc) Resolve(name string) (io.ReadCloser, error) {
+	return f(name)
+}
+
+// DirResolver is a Resolver that opens files from the local file system, rooted at a directory.
+type DirResolver string
+
+// Resolve opens the named file relative to the directory.
+func (dir DirResolver) Resolve(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(dir), filepath.FromSlash(name)))
+}
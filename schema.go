@@ -0,0 +1,440 @@
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema describes the expected types, values and children of KeyValue nodes.
+//
+// The zero value accepts any node, and every field adds a constraint. Value constraints (Range,
+// Enum and Pattern) apply to the text values of scalar nodes, so they can validate trees decoded by
+// a TextDecoder without type inference.
+type Schema struct {
+	// Types are the allowed node types. Any type is allowed if empty.
+	Types []Type
+	// Range is the allowed range of numeric values. Values that aren't numbers are violations.
+	Range *Range
+	// Enum lists the allowed values.
+	Enum []string
+	// Pattern is a regular expression that values must match.
+	Pattern *regexp.Regexp
+	// Keys describes the children of Object nodes.
+	Keys []KeySchema
+	// Strict makes children of Object nodes that are not described by Keys violations.
+	Strict bool
+	// Items describes the elements of Array nodes.
+	Items *Schema
+}
+
+// Range is an inclusive range of numbers. Use math.Inf for unbounded ranges.
+type Range struct {
+	Min, Max float64
+}
+
+// KeySchema describes the children of Object nodes with a given key, or with keys matching a
+// pattern.
+type KeySchema struct {
+	// Key is the key of the children.
+	Key string
+	// Pattern is a pattern of keys, used instead of Key if not empty. A "*" matches any sequence of
+	// characters and a "?" matches any single character, like in "npc_dota_hero_*".
+	Pattern string
+	// Required makes the absence of children with the key (or matching the pattern) a violation.
+	Required bool
+	// Repeated allows multiple children with the same key.
+	Repeated bool
+	// Schema describes the children. Children are not validated if nil.
+	Schema *Schema
+}
+
+// Validate validates the KeyValue tree kv against the schema.
+//
+// Returns a ValidationErrorList with all violations, in tree order, or nil if kv conforms to the
+// schema. Keys of children are compared according to the KeyMode of their parents, and children
+// described by both a KeySchema with a key and a KeySchema with a pattern are validated by the
+// former.
+func (s *Schema) Validate(kv KeyValue) error {
+	var errs ValidationErrorList
+
+	validateNode(&errs, kv, s, nil)
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func validateNode(errs *ValidationErrorList, kv KeyValue, s *Schema, keys []string) {
+	errorf := func(format string, args ...interface{}) {
+		errs.add(kv, keys, fmt.Sprintf(format, args...))
+	}
+
+	if len(s.Types) > 0 && !hasType(s.Types, kv.Type()) {
+		names := make([]string, len(s.Types))
+
+		for i, t := range s.Types {
+			names[i] = t.String()
+		}
+
+		errorf("type %s, expected %s", kv.Type(), strings.Join(names, " or "))
+
+		return
+	}
+
+	switch kv.Type() {
+	case TypeObject:
+		validateObject(errs, kv, s, keys)
+	case TypeArray:
+		if s.Items != nil {
+			for i, c := range kv.Children() {
+				validateNode(errs, c, s.Items, appendKey(keys, strconv.Itoa(i)))
+			}
+		}
+	case TypeNull:
+	default:
+		if _, err := scalarValue(kv); err != nil {
+			errorf("invalid %s value %q", kv.Type(), kv.Value())
+			return
+		}
+
+		if s.Range != nil {
+			n, err := strconv.ParseFloat(kv.Value(), 64)
+
+			switch {
+			case (err != nil && !errors.Is(err, strconv.ErrRange)) || math.IsNaN(n):
+				errorf("value %q is not a number", kv.Value())
+			case n < s.Range.Min || n > s.Range.Max:
+				errorf("value %q out of range [%g, %g]", kv.Value(), s.Range.Min, s.Range.Max)
+			}
+		}
+
+		if len(s.Enum) > 0 && !hasString(s.Enum, kv.Value()) {
+			quoted := make([]string, len(s.Enum))
+
+			for i, v := range s.Enum {
+				quoted[i] = strconv.Quote(v)
+			}
+
+			errorf("value %q, expected one of %s", kv.Value(), strings.Join(quoted, ", "))
+		}
+
+		if s.Pattern != nil && !s.Pattern.MatchString(kv.Value()) {
+			errorf("value %q doesn't match pattern %q", kv.Value(), s.Pattern)
+		}
+	}
+}
+
+func validateObject(errs *ValidationErrorList, kv KeyValue, s *Schema, keys []string) {
+	mode := kv.KeyMode()
+	matches := make([]int, len(s.Keys))
+	seen := make(map[string]bool, len(kv.Children()))
+
+	for _, c := range kv.Children() {
+		childKeys := appendKey(keys, c.Key())
+		i := matchKeySchema(s.Keys, c.Key(), mode)
+
+		if i < 0 {
+			if s.Strict {
+				errs.add(c, childKeys, "unknown key")
+			}
+
+			continue
+		}
+
+		ks := s.Keys[i]
+		matches[i]++
+
+		if folded := strconv.Itoa(i) + "/" + mode.fold(c.Key()); seen[folded] && !ks.Repeated {
+			errs.add(c, childKeys, "duplicate key")
+		} else {
+			seen[folded] = true
+		}
+
+		if ks.Schema != nil {
+			validateNode(errs, c, ks.Schema, childKeys)
+		}
+	}
+
+	for i, ks := range s.Keys {
+		if !ks.Required || matches[i] > 0 {
+			continue
+		}
+
+		msg := "missing required key " + strconv.Quote(ks.Key)
+
+		if ks.Pattern != "" {
+			msg = "missing key matching " + strconv.Quote(ks.Pattern)
+		}
+
+		errs.add(kv, keys, msg)
+	}
+}
+
+// matchKeySchema returns the index of the KeySchema describing key, or -1. Key schemas with keys
+// take precedence over key schemas with patterns.
+func matchKeySchema(schemas []KeySchema, key string, mode KeyMode) int {
+	for i, ks := range schemas {
+		if ks.Pattern == "" && mode.Equal(ks.Key, key) {
+			return i
+		}
+	}
+
+	for i, ks := range schemas {
+		if ks.Pattern != "" && matchGlob(ks.Pattern, key, mode) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// matchGlob reports whether key matches the glob pattern, comparing characters according to mode.
+func matchGlob(pattern, key string, mode KeyMode) bool {
+	// star and next are the positions in pattern and key of the last "*" and of the next key
+	// character it would match, to backtrack to.
+	p, k, star, next := 0, 0, -1, 0
+
+	for k < len(key) {
+		if p < len(pattern) {
+			pc, pn := utf8.DecodeRuneInString(pattern[p:])
+			kc, kn := utf8.DecodeRuneInString(key[k:])
+
+			switch {
+			case pc == '*':
+				star, next = p, k
+				p += pn
+
+				continue
+			case pc == '?' || pc == kc || (mode == KeyModeCaseInsensitive && foldRune(pc) == foldRune(kc)):
+				p += pn
+				k += kn
+
+				continue
+			}
+		}
+
+		if star < 0 {
+			return false
+		}
+
+		_, n := utf8.DecodeRuneInString(key[next:])
+		next += n
+		p, k = star+1, next
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+func hasType(types []Type, t Type) bool {
+	for _, u := range types {
+		if u == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseSchema parses a Schema from its KeyValue representation, the Object node kv.
+//
+// Schema properties are children of kv with the following keys:
+//
+//   "type"     an allowed type name, as returned by Type.String (can be repeated)
+//   "min"      the minimum numeric value
+//   "max"      the maximum numeric value
+//   "enum"     an allowed value (can be repeated)
+//   "pattern"  a regular expression that values must match
+//   "strict"   whether unknown keys are violations (a boolean, like "1" or "true")
+//   "items"    an Object node with the schema of Array elements
+//   "keys"     an Object node with the KeySchemas of children, keyed by key
+//   "patterns" an Object node with the KeySchemas of children, keyed by pattern
+//
+// A KeySchema is an Object node with schema properties, and optionally "required" and "repeated"
+// booleans, or a field with a type name, as a shorthand for a schema with that type:
+//
+//   "HeroSchema"
+//   {
+//     "keys" { "Version" "String" }
+//     "patterns"
+//     {
+//       "npc_dota_hero_*"
+//       {
+//         "type" "Object"
+//         "keys"
+//         {
+//           "Model" { "required" "1" "pattern" "^models/.+vmdl$" }
+//           "AttackRate" { "min" "0" "max" "10" }
+//         }
+//       }
+//     }
+//   }
+//
+// Returns a *SchemaError if kv is not a valid schema.
+func ParseSchema(kv KeyValue) (*Schema, error) {
+	return parseSchema(kv, nil)
+}
+
+func parseSchema(kv KeyValue, keys []string) (*Schema, error) {
+	if kv.Type() != TypeObject {
+		return nil, newSchemaError(keys, "not an object")
+	}
+
+	s := &Schema{Range: &Range{Min: math.Inf(-1), Max: math.Inf(1)}}
+	hasRange := false
+
+	for _, c := range kv.Children() {
+		childKeys := appendKey(keys, c.Key())
+
+		errorf := func(format string, args ...interface{}) error {
+			return newSchemaError(childKeys, format, args...)
+		}
+
+		switch c.Key() {
+		case "type":
+			t, ok := TypeFromString(c.Value())
+
+			if !ok {
+				return nil, errorf("unknown type %q", c.Value())
+			}
+
+			s.Types = append(s.Types, t)
+		case "min", "max":
+			n, err := strconv.ParseFloat(c.Value(), 64)
+
+			if err != nil {
+				return nil, errorf("invalid number %q", c.Value())
+			}
+
+			if c.Key() == "min" {
+				s.Range.Min = n
+			} else {
+				s.Range.Max = n
+			}
+
+			hasRange = true
+		case "enum":
+			s.Enum = append(s.Enum, c.Value())
+		case "pattern":
+			re, err := regexp.Compile(c.Value())
+
+			if err != nil {
+				return nil, errorf("invalid pattern: %v", err)
+			}
+
+			s.Pattern = re
+		case "strict":
+			b, err := strconv.ParseBool(c.Value())
+
+			if err != nil {
+				return nil, errorf("invalid boolean %q", c.Value())
+			}
+
+			s.Strict = b
+		case "items":
+			items, err := parseSchema(c, childKeys)
+
+			if err != nil {
+				return nil, err
+			}
+
+			s.Items = items
+		case "keys", "patterns":
+			if c.Type() != TypeObject {
+				return nil, errorf("not an object")
+			}
+
+			for _, k := range c.Children() {
+				ks, err := parseKeySchema(k, appendKey(childKeys, k.Key()))
+
+				if err != nil {
+					return nil, err
+				}
+
+				if c.Key() == "patterns" {
+					ks.Key, ks.Pattern = "", k.Key()
+				}
+
+				s.Keys = append(s.Keys, ks)
+			}
+		default:
+			return nil, errorf("unknown property")
+		}
+	}
+
+	if !hasRange {
+		s.Range = nil
+	}
+
+	return s, nil
+}
+
+func parseKeySchema(kv KeyValue, keys []string) (KeySchema, error) {
+	ks := KeySchema{Key: kv.Key()}
+
+	if kv.Type() != TypeObject {
+		t, ok := TypeFromString(kv.Value())
+
+		if !ok {
+			return ks, newSchemaError(keys, "unknown type %q", kv.Value())
+		}
+
+		ks.Schema = &Schema{Types: []Type{t}}
+
+		return ks, nil
+	}
+
+	props := NewKeyValueRoot(kv.Key())
+
+	for _, c := range kv.Children() {
+		var flag *bool
+
+		switch c.Key() {
+		case "required":
+			flag = &ks.Required
+		case "repeated":
+			flag = &ks.Repeated
+		default:
+			props.AddChild(cloneNode(c))
+			continue
+		}
+
+		b, err := strconv.ParseBool(c.Value())
+
+		if err != nil {
+			return ks, newSchemaError(appendKey(keys, c.Key()), "invalid boolean %q", c.Value())
+		}
+
+		*flag = b
+	}
+
+	s, err := parseSchema(props, keys)
+
+	if err != nil {
+		return ks, err
+	}
+
+	ks.Schema = s
+
+	return ks, nil
+}
@@ -0,0 +1,312 @@
+package kv_test
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+)
+
+func TestSchema(t *testing.T) {
+	suite.Run(t, &SchemaSuite{})
+}
+
+type SchemaSuite struct {
+	Suite
+}
+
+func (s *SchemaSuite) decode(path string) kv.KeyValue {
+	f := s.MustOpenFixture(path)
+
+	defer f.Close()
+
+	root := kv.NewKeyValueEmpty()
+
+	s.Require().NoError(kv.NewTextDecoder(f).Decode(root))
+
+	return root
+}
+
+func (s *SchemaSuite) heroSchema() *kv.Schema {
+	return &kv.Schema{
+		Types:  []kv.Type{kv.TypeObject},
+		Strict: true,
+		Keys: []kv.KeySchema{
+			{
+				Key:      "Version",
+				Required: true,
+				Schema:   &kv.Schema{Enum: []string{"1"}},
+			},
+			{
+				Pattern:  "npc_dota_hero_*",
+				Required: true,
+				Schema: &kv.Schema{
+					Types: []kv.Type{kv.TypeObject},
+					Keys: []kv.KeySchema{
+						{Key: "Model", Required: true, Schema: &kv.Schema{Pattern: regexp.MustCompile(`^models/.+[.]vmdl$`)}},
+						{Key: "AttackRate", Schema: &kv.Schema{Range: &kv.Range{Min: 0, Max: 10}}},
+						{Key: "ArmorPhysical", Schema: &kv.Schema{Range: &kv.Range{Min: -10, Max: math.Inf(1)}}},
+						{Key: "Role", Repeated: true},
+						{Key: "Bot", Schema: &kv.Schema{Types: []kv.Type{kv.TypeObject}}},
+						{Key: "Speed", Schema: &kv.Schema{Types: []kv.Type{kv.TypeInt32, kv.TypeFloat32}}},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (s *SchemaSuite) TestValidate() {
+	require := s.Require()
+
+	data := `"DOTAHeroes"
+{
+	"Version" "2"
+	"npc_dota_hero_axe"
+	{
+		"Model" "models/heroes/axe/axe.vmdl"
+		"AttackRate" "1.7"
+		"ArmorPhysical" "-1"
+		"Role" "Initiator"
+		"Role" "Durable"
+	}
+	"npc_dota_hero_sven"
+	{
+		"Model" "models/heroes/sven/sven.mdl"
+		"AttackRate" "fast"
+		"ArmorPhysical" "-11"
+		"Bot" "1"
+		"Bot" { }
+		"Speed" "300"
+	}
+	"NPC_Dota_Hero_Zuus"
+	{
+		"AttackRate" "1e400"
+	}
+	"npc_dota_units" { }
+}`
+
+	root := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewTextDecoder(strings.NewReader(data)).Decode(root))
+
+	err := s.heroSchema().Validate(root)
+
+	var errs kv.ValidationErrorList
+
+	require.True(errors.As(err, &errs))
+
+	messages := make([]string, len(errs))
+
+	for i, e := range errs {
+		messages[i] = e.Error()
+	}
+
+	require.Equal([]string{
+		`kv: <input>:3:2: node "Version": value "2", expected one of "1"`,
+		`kv: <input>:14:3: node "npc_dota_hero_sven/Model": value "models/heroes/sven/sven.mdl" doesn't match pattern "^models/.+[.]vmdl$"`, //nolint:lll
+		`kv: <input>:15:3: node "npc_dota_hero_sven/AttackRate": value "fast" is not a number`,
+		`kv: <input>:16:3: node "npc_dota_hero_sven/ArmorPhysical": value "-11" out of range [-10, +Inf]`,
+		`kv: <input>:17:3: node "npc_dota_hero_sven/Bot": type String, expected Object`,
+		`kv: <input>:18:3: node "npc_dota_hero_sven/Bot": duplicate key`,
+		`kv: <input>:19:3: node "npc_dota_hero_sven/Speed": type String, expected Int32 or Float32`,
+		`kv: <input>:21:2: node "NPC_Dota_Hero_Zuus": unknown key`,
+		`kv: <input>:25:2: node "npc_dota_units": unknown key`,
+	}, messages)
+
+	require.EqualError(err, messages[0]+" (and 8 more errors)")
+
+	var validationErr *kv.ValidationError
+
+	require.True(errors.As(err, &validationErr))
+	require.Same(errs[0], validationErr)
+	require.False(errors.Is(err, kv.ErrUnexpectedToken))
+
+	// case-insensitive keys
+	root.SetKeyMode(kv.KeyModeCaseInsensitive)
+
+	errs = s.heroSchema().Validate(root).(kv.ValidationErrorList)
+
+	require.Len(errs, 10)
+	require.Equal(
+		`kv: <input>:23:3: node "NPC_Dota_Hero_Zuus/AttackRate": value "1e400" out of range [0, 10]`,
+		errs[7].Error(),
+	)
+	require.Equal(`kv: <input>:21:2: node "NPC_Dota_Hero_Zuus": missing required key "Model"`, errs[8].Error())
+}
+
+func (s *SchemaSuite) TestValidateValid() {
+	require := s.Require()
+	root := kv.NewKeyValueRoot("DOTAHeroes").
+		AddString("Version", "1").
+		AddChild(kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+			AddString("Model", "models/heroes/axe/axe.vmdl").
+			AddFloat32("AttackRate", "1.7").
+			AddInt32("Speed", "290").
+			AddString("Extra", "1"))
+
+	require.NoError(s.heroSchema().Validate(root))
+	require.NoError((&kv.Schema{}).Validate(root))
+
+	err := s.heroSchema().Validate(kv.NewKeyValueRoot("DOTAHeroes"))
+
+	require.EqualError(err, `kv: node "": missing required key "Version" (and 1 more errors)`)
+	require.Equal(`kv: node "": missing key matching "npc_dota_hero_*"`, err.(kv.ValidationErrorList)[1].Error())
+}
+
+func (s *SchemaSuite) TestValidateValues() {
+	require := s.Require()
+
+	schema := &kv.Schema{
+		Items: &kv.Schema{
+			Types: []kv.Type{kv.TypeInt32, kv.TypeNull},
+			Range: &kv.Range{Min: 0, Max: 100},
+		},
+	}
+
+	root := kv.NewKeyValueArray("", nil).
+		AddInt32("", "1").
+		AddInt32("", "101").
+		AddInt32("", "x").
+		AddNull("").
+		AddString("", "1")
+
+	err := schema.Validate(root)
+
+	require.Len(err, 3)
+	require.Equal(`kv: node "1": value "101" out of range [0, 100]`, err.(kv.ValidationErrorList)[0].Error())
+	require.Equal(`kv: node "2": invalid Int32 value "x"`, err.(kv.ValidationErrorList)[1].Error())
+	require.Equal(`kv: node "4": type String, expected Int32 or Null`, err.(kv.ValidationErrorList)[2].Error())
+
+	root = kv.NewKeyValueString("", "NaN", nil)
+
+	err = (&kv.Schema{Range: &kv.Range{Min: 0, Max: 1}}).Validate(root)
+
+	require.EqualError(err, `kv: node "": value "NaN" is not a number`)
+}
+
+func (s *SchemaSuite) TestKeyPatterns() {
+	require := s.Require()
+
+	schema := &kv.Schema{
+		Strict: true,
+		Keys: []kv.KeySchema{
+			{Pattern: "Ability?"},
+			{Pattern: "*_bonus_*", Repeated: true},
+			{Pattern: "λ*"},
+		},
+	}
+
+	root := kv.NewKeyValueRoot("").
+		AddString("Ability1", "").
+		AddString("Ability2", "").
+		AddString("Ability10", "").
+		AddString("special_bonus_armor", "").
+		AddString("special_bonus_armor", "").
+		AddString("_bonus_", "").
+		AddString("bonus", "").
+		AddString("λx", "").
+		AddString("Λx", "")
+
+	err := schema.Validate(root)
+
+	require.Len(err, 3)
+	require.Equal(`kv: node "Ability10": unknown key`, err.(kv.ValidationErrorList)[0].Error())
+	require.Equal(`kv: node "bonus": unknown key`, err.(kv.ValidationErrorList)[1].Error())
+	require.Equal(`kv: node "Λx": unknown key`, err.(kv.ValidationErrorList)[2].Error())
+
+	err = schema.Validate(root.SetKeyMode(kv.KeyModeCaseInsensitive))
+
+	require.Len(err, 3)
+	require.Equal(`kv: node "Λx": duplicate key`, err.(kv.ValidationErrorList)[2].Error())
+}
+
+func (s *SchemaSuite) TestParseSchema() {
+	require := s.Require()
+	schema, err := kv.ParseSchema(s.decode("schema/heroes.txt"))
+
+	require.NoError(err)
+	require.Equal([]kv.Type{kv.TypeObject}, schema.Types)
+	require.True(schema.Strict)
+	require.Len(schema.Keys, 2)
+	require.Equal("Version", schema.Keys[0].Key)
+	require.True(schema.Keys[0].Required)
+	require.Equal([]string{"1"}, schema.Keys[0].Schema.Enum)
+	require.Equal("", schema.Keys[1].Key)
+	require.Equal("npc_dota_hero_*", schema.Keys[1].Pattern)
+
+	hero := schema.Keys[1].Schema
+
+	require.Len(hero.Keys, 6)
+	require.Equal(`^models/.+[.]vmdl$`, hero.Keys[0].Schema.Pattern.String())
+	require.Equal([]string{"0", "1"}, hero.Keys[1].Schema.Enum)
+	require.Equal(&kv.Range{Min: 0, Max: 10}, hero.Keys[2].Schema.Range)
+	require.Equal(&kv.Range{Min: -10, Max: math.Inf(1)}, hero.Keys[3].Schema.Range)
+	require.Nil(hero.Keys[0].Schema.Range)
+	require.Equal([]kv.Type{kv.TypeString}, hero.Keys[5].Schema.Types)
+
+	require.NoError(schema.Validate(s.decode("npc_heroes.txt")))
+}
+
+func (s *SchemaSuite) TestParseSchemaErrors() {
+	testCases := []struct {
+		TestName string
+		Input    string
+		Err      string
+	}{
+		{
+			TestName: "NotObject",
+			Input:    `"Schema" { "items" "1" }`,
+			Err:      `kv: invalid schema: node "items": not an object`,
+		},
+		{
+			TestName: "UnknownProperty",
+			Input:    `"Schema" { "keys" { "Model" { "typ" "String" } } }`,
+			Err:      `kv: invalid schema: node "keys/Model/typ": unknown property`,
+		},
+		{
+			TestName: "UnknownType",
+			Input:    `"Schema" { "type" "Float64" }`,
+			Err:      `kv: invalid schema: node "type": unknown type "Float64"`,
+		},
+		{
+			TestName: "UnknownShorthandType",
+			Input:    `"Schema" { "patterns" { "*" "float" } }`,
+			Err:      `kv: invalid schema: node "patterns/*": unknown type "float"`,
+		},
+		{
+			TestName: "InvalidNumber",
+			Input:    `"Schema" { "min" "zero" }`,
+			Err:      `kv: invalid schema: node "min": invalid number "zero"`,
+		},
+		{
+			TestName: "InvalidBoolean",
+			Input:    `"Schema" { "keys" { "Model" { "required" "yes" } } }`,
+			Err:      `kv: invalid schema: node "keys/Model/required": invalid boolean "yes"`,
+		},
+		{
+			TestName: "InvalidPattern",
+			Input:    `"Schema" { "pattern" "(" }`,
+			Err:      "kv: invalid schema: node \"pattern\": invalid pattern: error parsing regexp: missing closing ): `(`",
+		},
+	}
+
+	for _, testCase := range testCases {
+		s.Run(testCase.TestName, func() {
+			require := s.Require()
+			root := kv.NewKeyValueEmpty()
+
+			require.NoError(kv.NewTextDecoder(strings.NewReader(testCase.Input)).Decode(root))
+
+			_, err := kv.ParseSchema(root)
+
+			require.EqualError(err, testCase.Err)
+			require.True(errors.Is(err, kv.ErrInvalidSchema))
+		})
+	}
+}
@@ -0,0 +1,271 @@
+// Code generated by kvgen. DO NOT EDIT.
+
+package structgen_test
+
+type DOTAHeroes struct {
+	Version int32                  `kv:"Version"`
+	Entries map[string]NpcDotaHero `kv:",remain"`
+}
+
+type NpcDotaHero struct {
+	Model                          string                          `kv:"Model"`
+	SoundSet                       string                          `kv:"SoundSet,omitempty"`
+	Enabled                        int32                           `kv:"Enabled"`
+	Level                          int32                           `kv:"Level,omitempty"`
+	BotImplemented                 int32                           `kv:"BotImplemented,omitempty"`
+	NewHero                        int32                           `kv:"NewHero,omitempty"`
+	HeroPool1                      int32                           `kv:"HeroPool1,omitempty"`
+	HeroUnlockOrder                int32                           `kv:"HeroUnlockOrder,omitempty"`
+	CMEnabled                      int32                           `kv:"CMEnabled"`
+	CMTournamentIgnore             int32                           `kv:"CMTournamentIgnore,omitempty"`
+	NewPlayerEnable                int32                           `kv:"new_player_enable,omitempty"`
+	Legs                           int32                           `kv:"Legs,omitempty"`
+	Ability1                       string                          `kv:"Ability1"`
+	Ability2                       string                          `kv:"Ability2"`
+	Ability3                       string                          `kv:"Ability3"`
+	Ability4                       string                          `kv:"Ability4"`
+	Ability5                       string                          `kv:"Ability5"`
+	Ability6                       string                          `kv:"Ability6"`
+	Ability7                       string                          `kv:"Ability7,omitempty"`
+	Ability8                       string                          `kv:"Ability8,omitempty"`
+	Ability9                       string                          `kv:"Ability9,omitempty"`
+	AbilityTalentStart             int32                           `kv:"AbilityTalentStart,omitempty"`
+	ArmorPhysical                  float32                         `kv:"ArmorPhysical"`
+	MagicalResistance              int32                           `kv:"MagicalResistance,omitempty"`
+	AttackCapabilities             string                          `kv:"AttackCapabilities"`
+	BaseAttackSpeed                int32                           `kv:"BaseAttackSpeed,omitempty"`
+	AttackDamageMin                int32                           `kv:"AttackDamageMin"`
+	AttackDamageMax                int32                           `kv:"AttackDamageMax"`
+	AttackDamageType               string                          `kv:"AttackDamageType,omitempty"`
+	AttackRate                     float32                         `kv:"AttackRate"`
+	AttackAnimationPoint           float32                         `kv:"AttackAnimationPoint"`
+	AttackAcquisitionRange         int32                           `kv:"AttackAcquisitionRange"`
+	AttackRange                    int32                           `kv:"AttackRange"`
+	ProjectileModel                string                          `kv:"ProjectileModel,omitempty"`
+	ProjectileSpeed                int32                           `kv:"ProjectileSpeed,omitempty"`
+	AttributePrimary               string                          `kv:"AttributePrimary"`
+	AttributeBaseStrength          int32                           `kv:"AttributeBaseStrength"`
+	AttributeStrengthGain          float32                         `kv:"AttributeStrengthGain"`
+	AttributeBaseIntelligence      int32                           `kv:"AttributeBaseIntelligence"`
+	AttributeIntelligenceGain      float32                         `kv:"AttributeIntelligenceGain"`
+	AttributeBaseAgility           int32                           `kv:"AttributeBaseAgility"`
+	AttributeAgilityGain           float32                         `kv:"AttributeAgilityGain"`
+	BountyXP                       int32                           `kv:"BountyXP,omitempty"`
+	BountyGoldMin                  int32                           `kv:"BountyGoldMin,omitempty"`
+	BountyGoldMax                  int32                           `kv:"BountyGoldMax,omitempty"`
+	BoundsHullName                 string                          `kv:"BoundsHullName,omitempty"`
+	RingRadius                     int32                           `kv:"RingRadius,omitempty"`
+	MovementCapabilities           string                          `kv:"MovementCapabilities,omitempty"`
+	MovementSpeed                  int32                           `kv:"MovementSpeed"`
+	MovementTurnRate               float32                         `kv:"MovementTurnRate"`
+	HasAggressiveStance            int32                           `kv:"HasAggressiveStance,omitempty"`
+	StatusHealth                   int32                           `kv:"StatusHealth,omitempty"`
+	StatusMana                     int32                           `kv:"StatusMana,omitempty"`
+	StatusManaRegen                float32                         `kv:"StatusManaRegen,omitempty"`
+	TeamName                       string                          `kv:"TeamName,omitempty"`
+	CombatClassAttack              string                          `kv:"CombatClassAttack,omitempty"`
+	CombatClassDefend              string                          `kv:"CombatClassDefend,omitempty"`
+	UnitRelationshipClass          string                          `kv:"UnitRelationshipClass,omitempty"`
+	VisionDaytimeRange             int32                           `kv:"VisionDaytimeRange,omitempty"`
+	VisionNighttimeRange           int32                           `kv:"VisionNighttimeRange,omitempty"`
+	HasInventory                   int32                           `kv:"HasInventory,omitempty"`
+	VoiceBackgroundSound           string                          `kv:"VoiceBackgroundSound,omitempty"`
+	HealthBarOffset                int32                           `kv:"HealthBarOffset,omitempty"`
+	IdleExpression                 string                          `kv:"IdleExpression,omitempty"`
+	IdleSoundLoop                  string                          `kv:"IdleSoundLoop,omitempty"`
+	AbilityDraftDisabled           int32                           `kv:"AbilityDraftDisabled,omitempty"`
+	ARDMDisabled                   int32                           `kv:"ARDMDisabled,omitempty"`
+	HUD                            *HUD                            `kv:"HUD,omitempty"`
+	HeroID                         int32                           `kv:"HeroID,omitempty"`
+	Role                           string                          `kv:"Role,omitempty"`
+	Rolelevels                     string                          `kv:"Rolelevels,omitempty"`
+	Complexity                     int32                           `kv:"Complexity,omitempty"`
+	Team                           string                          `kv:"Team,omitempty"`
+	ModelScale                     float32                         `kv:"ModelScale,omitempty"`
+	VersusScale                    string                          `kv:"VersusScale,omitempty"`
+	HeroGlowColor                  string                          `kv:"HeroGlowColor,omitempty"`
+	PickSound                      string                          `kv:"PickSound,omitempty"`
+	BanSound                       string                          `kv:"BanSound,omitempty"`
+	NameAliases                    string                          `kv:"NameAliases,omitempty"`
+	WorkshopGuideName              string                          `kv:"workshop_guide_name,omitempty"`
+	LastHitChallengeRival          string                          `kv:"LastHitChallengeRival,omitempty"`
+	HeroSelectSoundEffect          string                          `kv:"HeroSelectSoundEffect,omitempty"`
+	GibType                        string                          `kv:"GibType,omitempty"`
+	Ability10                      string                          `kv:"Ability10,omitempty"`
+	Ability11                      string                          `kv:"Ability11,omitempty"`
+	Ability12                      string                          `kv:"Ability12,omitempty"`
+	Ability13                      string                          `kv:"Ability13,omitempty"`
+	Ability14                      string                          `kv:"Ability14,omitempty"`
+	Ability15                      string                          `kv:"Ability15,omitempty"`
+	Ability16                      string                          `kv:"Ability16,omitempty"`
+	Ability17                      string                          `kv:"Ability17,omitempty"`
+	StatusHealthRegen              float32                         `kv:"StatusHealthRegen,omitempty"`
+	ParticleFolder                 string                          `kv:"particle_folder,omitempty"`
+	GameSoundsFile                 string                          `kv:"GameSoundsFile,omitempty"`
+	VoiceFile                      string                          `kv:"VoiceFile,omitempty"`
+	RenderablePortrait             *RenderablePortrait             `kv:"RenderablePortrait,omitempty"`
+	ItemSlots                      map[int]ItemSlotsEntry          `kv:"ItemSlots,omitempty"`
+	Bot                            *Bot                            `kv:"Bot,omitempty"`
+	LoadoutScale                   float32                         `kv:"LoadoutScale,omitempty"`
+	SpectatorLoadoutScale          float32                         `kv:"SpectatorLoadoutScale,omitempty"`
+	AttackSpeedActivityModifiers   *AttackSpeedActivityModifiers   `kv:"AttackSpeedActivityModifiers,omitempty"`
+	MovementSpeedActivityModifiers *MovementSpeedActivityModifiers `kv:"MovementSpeedActivityModifiers,omitempty"`
+	NoCombine                      int32                           `kv:"NoCombine,omitempty"`
+	GibTintColor                   string                          `kv:"GibTintColor,omitempty"`
+	AbilityDraftIgnoreCount        int32                           `kv:"AbilityDraftIgnoreCount,omitempty"`
+	AbilityPreview                 *AbilityPreview                 `kv:"AbilityPreview,omitempty"`
+	HeroPool2                      int32                           `kv:"HeroPool2,omitempty"`
+	Press                          int32                           `kv:"Press,omitempty"`
+	Precache                       *Precache                       `kv:"precache,omitempty"`
+	AbilityDraftAbilities          *AbilityDraftAbilities          `kv:"AbilityDraftAbilities,omitempty"`
+	Ability18                      string                          `kv:"Ability18,omitempty"`
+	Ability19                      string                          `kv:"Ability19,omitempty"`
+	Ability20                      string                          `kv:"Ability20,omitempty"`
+	Ability21                      string                          `kv:"Ability21,omitempty"`
+	Ability22                      string                          `kv:"Ability22,omitempty"`
+	Model1                         string                          `kv:"Model1,omitempty"`
+	Model2                         string                          `kv:"Model2,omitempty"`
+	Model3                         string                          `kv:"Model3,omitempty"`
+	BotForceSelection              int32                           `kv:"BotForceSelection,omitempty"`
+	AbilityLayout                  int32                           `kv:"AbilityLayout,omitempty"`
+	AnimationTransitions           *AnimationTransitions           `kv:"animation_transitions,omitempty"`
+	Persona                        map[int]PersonaEntry            `kv:"Persona,omitempty"`
+	Ability23                      string                          `kv:"Ability23,omitempty"`
+	Ability24                      string                          `kv:"Ability24,omitempty"`
+	AlternateLoadoutScale          float32                         `kv:"AlternateLoadoutScale,omitempty"`
+	MaxModelScaleMultiplier        float32                         `kv:"MaxModelScaleMultiplier,omitempty"`
+	AttackRangeActivityModifiers   *AttackRangeActivityModifiers   `kv:"AttackRangeActivityModifiers,omitempty"`
+	ReleaseTimestamp               int32                           `kv:"ReleaseTimestamp,omitempty"`
+}
+
+type HUD struct {
+	StatusHUD StatusHUD `kv:"StatusHUD"`
+}
+
+type StatusHUD struct {
+	StatusStrength  StatusStrength  `kv:"StatusStrength"`
+	StatusAgility   StatusAgility   `kv:"StatusAgility"`
+	StatusIntellect StatusIntellect `kv:"StatusIntellect"`
+}
+
+type StatusStrength struct {
+	LocalizeToken string `kv:"LocalizeToken"`
+	Parameters    string `kv:"Parameters"`
+	HUDName       string `kv:"HUDName"`
+}
+
+type StatusAgility struct {
+	LocalizeToken string `kv:"LocalizeToken"`
+	Parameters    string `kv:"Parameters"`
+	HUDName       string `kv:"HUDName"`
+}
+
+type StatusIntellect struct {
+	LocalizeToken string `kv:"LocalizeToken"`
+	Parameters    string `kv:"Parameters"`
+	HUDName       string `kv:"HUDName"`
+}
+
+type RenderablePortrait struct {
+	Particles map[string]interface{} `kv:"Particles,omitempty"`
+}
+
+type ItemSlotsEntry struct {
+	SlotIndex                 int32          `kv:"SlotIndex"`
+	SlotName                  string         `kv:"SlotName"`
+	SlotText                  string         `kv:"SlotText"`
+	TextureWidth              int32          `kv:"TextureWidth,omitempty"`
+	TextureHeight             int32          `kv:"TextureHeight,omitempty"`
+	MaxPolygonsLOD0           int32          `kv:"MaxPolygonsLOD0,omitempty"`
+	MaxPolygonsLOD1           int32          `kv:"MaxPolygonsLOD1,omitempty"`
+	NoImport                  int32          `kv:"no_import,omitempty"`
+	DisplayInLoadout          int32          `kv:"DisplayInLoadout,omitempty"`
+	GeneratesUnits            map[int]string `kv:"GeneratesUnits,omitempty"`
+	LoadoutPreviewMode        string         `kv:"LoadoutPreviewMode,omitempty"`
+	CanBeUsedAsGeneratingSlot int32          `kv:"CanBeUsedAsGeneratingSlot,omitempty"`
+	MaxBonesLOD0              int32          `kv:"MaxBonesLOD0,omitempty"`
+	MaxBonesLOD1              int32          `kv:"MaxBonesLOD1,omitempty"`
+	ShowItemOnGeneratedUnits  int32          `kv:"ShowItemOnGeneratedUnits,omitempty"`
+}
+
+type Bot struct {
+	HeroType         string            `kv:"HeroType"`
+	LaningInfo       LaningInfo        `kv:"LaningInfo"`
+	SupportsEasyMode int32             `kv:"SupportsEasyMode,omitempty"`
+	Loadout          map[string]string `kv:"Loadout,omitempty"`
+	Build            map[int]string    `kv:"Build,omitempty"`
+	AggressionFactor float32           `kv:"AggressionFactor,omitempty"`
+}
+
+type LaningInfo struct {
+	SoloDesire      int32 `kv:"SoloDesire"`
+	RequiresBabysit int32 `kv:"RequiresBabysit"`
+	ProvidesBabysit int32 `kv:"ProvidesBabysit"`
+	SurvivalRating  int32 `kv:"SurvivalRating"`
+	RequiresFarm    int32 `kv:"RequiresFarm"`
+	ProvidesSetup   int32 `kv:"ProvidesSetup"`
+	RequiresSetup   int32 `kv:"RequiresSetup"`
+}
+
+type AttackSpeedActivityModifiers struct {
+	Fast      int32 `kv:"fast"`
+	Faster    int32 `kv:"faster,omitempty"`
+	Fastest   int32 `kv:"fastest,omitempty"`
+	SuperFast int32 `kv:"super_fast,omitempty"`
+}
+
+type MovementSpeedActivityModifiers struct {
+	Jog      int32 `kv:"jog,omitempty"`
+	Run      int32 `kv:"run,omitempty"`
+	Walk     int32 `kv:"walk,omitempty"`
+	RunFast  int32 `kv:"run_fast,omitempty"`
+	FastRun  int32 `kv:"fast_run,omitempty"`
+	None     int32 `kv:"<none>,omitempty"`
+	RunHaste int32 `kv:"run_haste,omitempty"`
+}
+
+type AbilityPreview struct {
+	Resource string `kv:"resource"`
+	Movie    string `kv:"movie"`
+}
+
+type Precache struct {
+	Model    string `kv:"model"`
+	Particle string `kv:"particle,omitempty"`
+}
+
+type AbilityDraftAbilities struct {
+	Ability1 string `kv:"Ability1"`
+	Ability2 string `kv:"Ability2"`
+	Ability3 string `kv:"Ability3"`
+	Ability6 string `kv:"Ability6,omitempty"`
+	Ability4 string `kv:"Ability4,omitempty"`
+}
+
+type AnimationTransitions struct {
+	ACTDOTARUN  ACTDOTARUN  `kv:"ACT_DOTA_RUN"`
+	ACTDOTAIDLE ACTDOTAIDLE `kv:"ACT_DOTA_IDLE"`
+}
+
+type ACTDOTARUN struct {
+	Regular    float32 `kv:"regular"`
+	Aggressive float32 `kv:"aggressive,omitempty"`
+}
+
+type ACTDOTAIDLE struct {
+	Regular    float32 `kv:"regular"`
+	Aggressive float32 `kv:"aggressive,omitempty"`
+}
+
+type PersonaEntry struct {
+	Name  string `kv:"name"`
+	Model string `kv:"Model"`
+}
+
+type AttackRangeActivityModifiers struct {
+	AttackNormalRange  int32 `kv:"attack_normal_range,omitempty"`
+	AttackLongRange    int32 `kv:"attack_long_range"`
+	AttackClosestRange int32 `kv:"attack_closest_range,omitempty"`
+	AttackCloseRange   int32 `kv:"attack_close_range,omitempty"`
+	AttackMediumRange  int32 `kv:"attack_medium_range,omitempty"`
+}
@@ -0,0 +1,193 @@
+package structgen
+
+import (
+	"github.com/13k/kv-go"
+)
+
+// kind is the kind of the values of a shape, ordered so that numeric kinds widen to greater
+// numeric kinds.
+type kind uint8
+
+const (
+	// kindNone is the kind of shapes of Null nodes only.
+	kindNone kind = iota
+	kindBool
+	kindInt32
+	kindInt64
+	kindUint64
+	kindFloat32
+	kindFloat64
+	kindString
+	kindBinary
+	kindObject
+	kindArray
+	// kindAny is the kind of shapes of nodes of incompatible kinds.
+	kindAny
+)
+
+var goTypes = [...]string{
+	kindNone:    "interface{}",
+	kindBool:    "bool",
+	kindInt32:   "int32",
+	kindInt64:   "int64",
+	kindUint64:  "uint64",
+	kindFloat32: "float32",
+	kindFloat64: "float64",
+	kindString:  "string",
+	kindBinary:  "[]byte",
+	kindAny:     "interface{}",
+}
+
+func (k kind) numeric() bool {
+	return k >= kindInt32 && k <= kindFloat64
+}
+
+func (k kind) scalar() bool {
+	return k >= kindBool && k <= kindBinary
+}
+
+// shape is the inferred structure of one or more nodes.
+type shape struct {
+	kind kind
+	// count is the number of nodes merged into the shape.
+	count int
+	// fields are the children of Object nodes, in order of first appearance.
+	fields []*field
+	index  map[string]*field
+	// items is the shape of the elements of Array nodes.
+	items *shape
+}
+
+// field is the shape of the children of Object nodes with a given key.
+type field struct {
+	key string
+	// count is the number of Object nodes with children with the key.
+	count int
+	shape *shape
+}
+
+func newShape(k kind) *shape {
+	return &shape{kind: k, index: map[string]*field{}}
+}
+
+// shapeOf returns the shape of the KeyValue tree kv.
+func shapeOf(kv kv.KeyValue) *shape {
+	s := newShape(nodeKind(kv))
+	s.count = 1
+
+	switch s.kind {
+	case kindObject:
+		for _, c := range kv.Children() {
+			f, ok := s.index[c.Key()]
+
+			if !ok {
+				f = &field{key: c.Key(), count: 1, shape: newShape(kindNone)}
+				s.index[c.Key()] = f
+				s.fields = append(s.fields, f)
+			}
+
+			f.shape.merge(shapeOf(c))
+		}
+	case kindArray:
+		s.items = newShape(kindNone)
+
+		for _, c := range kv.Children() {
+			s.items.merge(shapeOf(c))
+		}
+	}
+
+	return s
+}
+
+func nodeKind(node kv.KeyValue) kind {
+	switch node.Type() {
+	case kv.TypeObject:
+		return kindObject
+	case kv.TypeArray:
+		return kindArray
+	case kv.TypeNull:
+		return kindNone
+	case kv.TypeBool:
+		return kindBool
+	case kv.TypeInt32, kv.TypeColor, kv.TypePointer:
+		return kindInt32
+	case kv.TypeInt64:
+		return kindInt64
+	case kv.TypeUint64:
+		return kindUint64
+	case kv.TypeFloat32:
+		return kindFloat32
+	case kv.TypeDouble:
+		return kindFloat64
+	case kv.TypeBinary:
+		return kindBinary
+	default:
+		return kindString
+	}
+}
+
+// merge merges the shape o into s.
+func (s *shape) merge(o *shape) {
+	s.count += o.count
+
+	switch {
+	case o.kind == kindNone:
+		return
+	case s.kind == kindNone:
+		s.kind = o.kind
+	case s.kind != o.kind:
+		s.kind = mergeKinds(s.kind, o.kind)
+	}
+
+	switch s.kind {
+	case kindObject:
+		if o.kind != kindObject {
+			return
+		}
+
+		for _, of := range o.fields {
+			f, ok := s.index[of.key]
+
+			if !ok {
+				f = &field{key: of.key, shape: newShape(kindNone)}
+				s.index[of.key] = f
+				s.fields = append(s.fields, f)
+			}
+
+			f.count += of.count
+			f.shape.merge(of.shape)
+		}
+	case kindArray:
+		if o.kind != kindArray {
+			return
+		}
+
+		if s.items == nil {
+			s.items = newShape(kindNone)
+		}
+
+		s.items.merge(o.items)
+	}
+}
+
+// mergeKinds returns the kind of values of both kinds a and b. Numeric kinds widen to the smallest
+// kind that can represent both (integers larger than 32 bits and floats widen to float64), other
+// scalars to strings, and any other kinds to kindAny.
+func mergeKinds(a, b kind) kind {
+	if a > b {
+		a, b = b, a
+	}
+
+	switch {
+	case a.numeric() && b.numeric():
+		if b == kindInt64 || (b == kindFloat32 && a == kindInt32) {
+			return b
+		}
+
+		return kindFloat64
+	case a.scalar() && b.scalar():
+		return kindString
+	default:
+		return kindAny
+	}
+}
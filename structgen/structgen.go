@@ -0,0 +1,451 @@
+// Package structgen generates Go type declarations from sample KeyValue trees.
+//
+// The generated types have "kv" struct tags and can be used with kv.Unmarshal and kv.Marshal.
+// Command kvgen wraps the package, generating types from KeyValue files.
+package structgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/13k/kv-go"
+)
+
+const (
+	// DefaultMinMapKeys is the default minimum number of dynamic keys of an Object node for them to
+	// be typed as a map.
+	DefaultMinMapKeys = 5
+	// mapSimilarity is the minimum similarity of Object children to be typed as a map.
+	mapSimilarity = 0.5
+	// rareKeyFrequency is the maximum average frequency of the keys of Object nodes typed as maps.
+	rareKeyFrequency = 0.25
+	// remainField is the name of struct fields with the "remain" option.
+	remainField = "Entries"
+)
+
+var (
+	// ErrNoSamples means that Generate was called without samples.
+	ErrNoSamples = errors.New("structgen: no samples")
+	// ErrNotObject means that the root node of a sample is not an Object node.
+	ErrNotObject = errors.New("structgen: root node is not an Object")
+)
+
+// Generator infers Go types from sample KeyValue trees and generates their declarations.
+//
+// The shapes of all samples, and of all children with the same key of the Object nodes at the same
+// path, are merged, so a type describes every node it was inferred from:
+//
+// Object nodes are typed as structs, with a field per child key, in order of first appearance.
+// Fields of children missing from some of the nodes have the "omitempty" tag option, and are
+// pointers if they're structs. Keys repeated in an Object node are typed as single fields, which
+// receive the last value.
+//
+// Object nodes with only integer keys (like "0", "1", ...) are typed as maps with int keys, and
+// Object nodes with at least MinMapKeys keys which are each found in only a few of the nodes (like
+// item names) as maps with string keys. Object children with dynamic keys, like "npc_dota_hero_axe"
+// and "npc_dota_hero_sven", are detected when an Object node has at least MinMapKeys Object
+// children with similar keys of their own. If these are all the children, the node is typed as a
+// map with string keys, otherwise as a struct with a map field with the "remain" tag option that
+// receives them.
+//
+// Scalar nodes are typed after their node type: int32 for TypeInt32 (and TypeColor and
+// TypePointer), int64 for TypeInt64, uint64 for TypeUint64, float32 for TypeFloat32, float64 for
+// TypeDouble, bool for TypeBool, []byte for TypeBinary and string for string types. Numeric types of
+// the same field widen to the smallest type that can represent all values (or float64), and other
+// mixed scalar types to string. Fields of both scalar and Object (or Array) nodes are typed as
+// interface{}.
+//
+// Text samples should be decoded with kv.TextDecoder.InferTypes, so that numeric fields are typed
+// as numbers.
+type Generator struct {
+	pkg        string
+	name       string
+	minMapKeys int
+	root       *shape
+	rootKey    string
+}
+
+// New returns a new Generator of declarations in package pkg.
+func New(pkg string) *Generator {
+	return &Generator{pkg: pkg, minMapKeys: DefaultMinMapKeys}
+}
+
+// Type sets the name of the type of the root nodes and returns the receiver.
+//
+// By default, the name is derived from the key of the first sample's root node.
+func (g *Generator) Type(name string) *Generator {
+	g.name = name
+	return g
+}
+
+// MinMapKeys sets the minimum number of dynamic keys of an Object node for them to be typed as a
+// map, and returns the receiver. The default is DefaultMinMapKeys.
+func (g *Generator) MinMapKeys(n int) *Generator {
+	g.minMapKeys = n
+	return g
+}
+
+// Add adds the KeyValue tree root as a sample and returns the receiver.
+func (g *Generator) Add(root kv.KeyValue) *Generator {
+	s := shapeOf(root)
+
+	if g.root == nil {
+		g.root = s
+		g.rootKey = root.Key()
+	} else {
+		g.root.merge(s)
+	}
+
+	return g
+}
+
+// Generate returns the formatted Go source of the declarations of the types of the samples.
+//
+// Returns ErrNoSamples if no samples were added, or ErrNotObject if a sample is not an Object node.
+func (g *Generator) Generate() ([]byte, error) {
+	if g.root == nil {
+		return nil, ErrNoSamples
+	}
+
+	if g.root.kind != kindObject {
+		return nil, ErrNotObject
+	}
+
+	name := g.name
+
+	if name == "" {
+		name = goName(g.rootKey)
+	}
+
+	e := &emitter{minMapKeys: g.minMapKeys, rootName: name, types: map[string]*decl{}}
+
+	if typ := e.goType(g.root, name, ""); typ != name {
+		e.declare(name, "", typ, 0)
+	}
+
+	sort.Slice(e.decls, func(i, j int) bool { return e.decls[i].order < e.decls[j].order })
+
+	b := &bytes.Buffer{}
+
+	fmt.Fprintf(b, "// Code generated by kvgen. DO NOT EDIT.\n\npackage %s\n", g.pkg)
+
+	for _, d := range e.decls {
+		fmt.Fprintf(b, "\ntype %s %s\n", d.name, d.typ)
+	}
+
+	src, err := format.Source(b.Bytes())
+
+	if err != nil {
+		return nil, fmt.Errorf("structgen: %w", err)
+	}
+
+	return src, nil
+}
+
+// decl is a generated type declaration.
+type decl struct {
+	name string
+	typ  string
+	// order is the position of the declaration in the output.
+	order int
+}
+
+// emitter generates the declarations of the types of a shape.
+type emitter struct {
+	minMapKeys int
+	rootName   string
+	decls      []*decl
+	types      map[string]*decl
+	order      int
+}
+
+func (e *emitter) next() int {
+	e.order++
+	return e.order
+}
+
+// goType returns the Go type of shape s, declaring the types of Object nodes. Name is the preferred
+// name of declared types, and parent is the name of the type containing it.
+func (e *emitter) goType(s *shape, name, parent string) string {
+	switch s.kind {
+	case kindObject:
+		return e.objectType(s, name, parent)
+	case kindArray:
+		return "[]" + e.goType(s.items, name+"Item", parent)
+	default:
+		return goTypes[s.kind]
+	}
+}
+
+func (e *emitter) objectType(s *shape, name, parent string) string {
+	if len(s.fields) == 0 {
+		return "map[string]interface{}"
+	}
+
+	if integerKeys(s.fields) {
+		return "map[int]" + e.goType(mergeFields(s.fields), name+"Entry", name)
+	}
+
+	if e.rareKeys(s) {
+		return "map[string]" + e.elemType(s.fields, name)
+	}
+
+	dynamic := e.dynamicFields(s)
+
+	if len(dynamic) == len(s.fields) {
+		return "map[string]" + e.elemType(dynamic, name)
+	}
+
+	order := e.next()
+	names := map[string]bool{}
+	b := &strings.Builder{}
+
+	b.WriteString("struct {\n")
+
+	for _, f := range s.fields {
+		if !taggable(f.key) || containsField(dynamic, f) {
+			continue
+		}
+
+		typ := e.goType(f.shape, goName(f.key), name)
+		tag := f.key
+
+		if f.count < s.count {
+			if f.shape.kind == kindObject && !strings.HasPrefix(typ, "map[") {
+				typ = "*" + typ
+			}
+
+			tag += ",omitempty"
+		}
+
+		fmt.Fprintf(b, "%s %s `kv:%s`\n", uniqueName(names, goName(f.key)), typ, strconv.Quote(tag))
+	}
+
+	if len(dynamic) > 0 {
+		typ := "map[string]" + e.elemType(dynamic, name)
+		fmt.Fprintf(b, "%s %s `kv:\",remain\"`\n", uniqueName(names, remainField), typ)
+	}
+
+	b.WriteString("}")
+
+	return e.declare(name, parent, b.String(), order)
+}
+
+// elemType returns the Go type of the map elements of the dynamic fields of the type named parent.
+func (e *emitter) elemType(dynamic []*field, parent string) string {
+	name := goName(commonPrefix(dynamic))
+
+	if name == "X" {
+		name = parent + "Entry"
+	}
+
+	return e.goType(mergeFields(dynamic), name, parent)
+}
+
+// declare declares a type with the given preferred name and returns its name.
+//
+// If the name is taken by a different type, the declaration is named after its parent, or numbered.
+// Identical types with the same preferred name are declared once. The root type name is never
+// taken by other types.
+func (e *emitter) declare(name, parent, typ string, order int) string {
+	candidates := []string{name}
+
+	if parent != "" {
+		candidates = append(candidates, parent+name)
+	}
+
+	for i := 2; ; i++ {
+		for _, c := range candidates {
+			if parent != "" && c == e.rootName {
+				continue
+			}
+
+			if d, ok := e.types[c]; ok {
+				if d.typ == typ {
+					return c
+				}
+
+				continue
+			}
+
+			d := &decl{name: c, typ: typ, order: order}
+			e.types[c] = d
+			e.decls = append(e.decls, d)
+
+			return c
+		}
+
+		candidates = []string{name + strconv.Itoa(i)}
+	}
+}
+
+// dynamicFields returns the Object fields of s with dynamic keys, or nil.
+//
+// Fields are dynamic if there are at least minMapKeys Object fields with similar keys: the average
+// fraction of the other Object fields which have each of their keys is at least mapSimilarity.
+func (e *emitter) dynamicFields(s *shape) []*field {
+	var objects []*field
+
+	for _, f := range s.fields {
+		if f.shape.kind == kindObject && len(f.shape.fields) > 0 && taggable(f.key) {
+			objects = append(objects, f)
+		}
+	}
+
+	if len(objects) < 2 || len(objects) < e.minMapKeys {
+		return nil
+	}
+
+	freq := map[string]int{}
+
+	for _, f := range objects {
+		for _, sf := range f.shape.fields {
+			freq[sf.key]++
+		}
+	}
+
+	similarity := 0.0
+
+	for _, f := range objects {
+		n := 0
+
+		for _, sf := range f.shape.fields {
+			n += freq[sf.key] - 1
+		}
+
+		similarity += float64(n) / float64(len(f.shape.fields)*(len(objects)-1))
+	}
+
+	if similarity/float64(len(objects)) < mapSimilarity {
+		return nil
+	}
+
+	return objects
+}
+
+// rareKeys reports whether s has at least minMapKeys keys, and each node merged into s has on
+// average less than rareKeyFrequency of them, like the item names of build guides.
+func (e *emitter) rareKeys(s *shape) bool {
+	if s.count < 2 || len(s.fields) < e.minMapKeys {
+		return false
+	}
+
+	n := 0
+
+	for _, f := range s.fields {
+		n += f.count
+	}
+
+	return float64(n)/float64(len(s.fields)*s.count) < rareKeyFrequency
+}
+
+// mergeFields returns the merged shape of fields.
+func mergeFields(fields []*field) *shape {
+	s := newShape(kindNone)
+
+	for _, f := range fields {
+		s.merge(f.shape)
+	}
+
+	return s
+}
+
+func containsField(fields []*field, f *field) bool {
+	for _, g := range fields {
+		if g == f {
+			return true
+		}
+	}
+
+	return false
+}
+
+// integerKeys reports whether the keys of all fields are integers, in canonical form.
+func integerKeys(fields []*field) bool {
+	for _, f := range fields {
+		if n, err := strconv.Atoi(f.key); err != nil || strconv.Itoa(n) != f.key {
+			return false
+		}
+	}
+
+	return true
+}
+
+// commonPrefix returns the common prefix of the keys of fields, up to the last non-alphanumeric
+// character, like "npc_dota_hero" for "npc_dota_hero_axe" and "npc_dota_hero_sven".
+func commonPrefix(fields []*field) string {
+	prefix := fields[0].key
+
+	for _, f := range fields[1:] {
+		i := 0
+
+		for i < len(prefix) && i < len(f.key) && prefix[i] == f.key[i] {
+			i++
+		}
+
+		prefix = prefix[:i]
+	}
+
+	i := strings.LastIndexFunc(prefix, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	if i < 0 {
+		return ""
+	}
+
+	return prefix[:i]
+}
+
+// taggable reports whether key can be written in a "kv" struct tag.
+func taggable(key string) bool {
+	return key != "" && key != "-" && !strings.ContainsAny(key, ",`")
+}
+
+// goName returns an exported Go identifier for key, in camel case.
+func goName(key string) string {
+	b := &strings.Builder{}
+	upper := true
+
+	for _, r := range key {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+
+		b.WriteRune(r)
+	}
+
+	name := b.String()
+
+	if r, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(r) {
+		name = "X" + name
+	}
+
+	return name
+}
+
+// uniqueName returns name, numbered if it's in names, and adds it to names.
+func uniqueName(names map[string]bool, name string) string {
+	unique := name
+
+	for i := 2; names[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+
+	names[unique] = true
+
+	return unique
+}
@@ -0,0 +1,238 @@
+package structgen_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/13k/kv-go"
+	"github.com/13k/kv-go/structgen"
+)
+
+//go:generate go run ../cmd/kvgen -pkg structgen_test -o heroes_kv_test.go ../testdata/npc_heroes.txt
+
+func TestStructgen(t *testing.T) {
+	suite.Run(t, &StructgenSuite{})
+}
+
+type StructgenSuite struct {
+	suite.Suite
+}
+
+func (s *StructgenSuite) decode(data string) kv.KeyValue {
+	root := kv.NewKeyValueEmpty()
+
+	s.Require().NoError(kv.NewTextDecoder(strings.NewReader(data)).InferTypes().Decode(root))
+
+	return root
+}
+
+// source returns src with single quotes replaced by backquotes, which can't be written in raw
+// strings.
+func source(src string) string {
+	return strings.ReplaceAll(src, "'", "`")
+}
+
+func (s *StructgenSuite) TestGenerate() {
+	require := s.Require()
+
+	units := s.decode(`"Units"
+{
+	"Version" "1"
+	"npc_dota_creep_melee"
+	{
+		"Model" "models/creeps/melee.vmdl"
+		"Health" "550"
+		"Armor" "2"
+		"max_speed" "325"
+		"MaxSpeed" "325"
+		"a,b" "skipped"
+		"Bounty" { "Min" "30" "Max" "40" }
+		"Abilities" { "1" "creep_bash" "2" "creep_evasion" }
+		"Mixed" "x"
+	}
+	"npc_dota_creep_ranged"
+	{
+		"Model" "models/creeps/ranged.vmdl"
+		"Health" "300"
+		"Armor" "0.5"
+		"Experience" "4294967296"
+		"Mixed" { "x" "1" }
+	}
+}`)
+
+	siege := s.decode(`"Units"
+{
+	"Version" "2.5"
+	"npc_dota_creep_siege"
+	{
+		"Model" "models/creeps/siege.vmdl"
+		"Health" "875"
+		"Armor" "0"
+		"Experience" "-1"
+		"Bounty" { "Min" "66" }
+	}
+}`)
+
+	src, err := structgen.New("units").MinMapKeys(2).Add(units).Add(siege).Generate()
+
+	require.NoError(err)
+	require.Equal(source(`// Code generated by kvgen. DO NOT EDIT.
+
+package units
+
+type Units struct {
+	Version float32                 'kv:"Version"'
+	Entries map[string]NpcDotaCreep 'kv:",remain"'
+}
+
+type NpcDotaCreep struct {
+	Model      string         'kv:"Model"'
+	Health     int32          'kv:"Health"'
+	Armor      float32        'kv:"Armor"'
+	MaxSpeed   int32          'kv:"max_speed,omitempty"'
+	MaxSpeed2  int32          'kv:"MaxSpeed,omitempty"'
+	Bounty     *Bounty        'kv:"Bounty,omitempty"'
+	Abilities  map[int]string 'kv:"Abilities,omitempty"'
+	Mixed      interface{}    'kv:"Mixed,omitempty"'
+	Experience int64          'kv:"Experience,omitempty"'
+}
+
+type Bounty struct {
+	Min int32 'kv:"Min"'
+	Max int32 'kv:"Max,omitempty"'
+}
+`), string(src))
+}
+
+func (s *StructgenSuite) TestGenerateTypes() {
+	require := s.Require()
+
+	root := kv.NewKeyValueRoot("").
+		AddBool("bool", "true").
+		AddUint64("uint64", "1").
+		AddDouble("double", "0.5").
+		AddBinary("binary", "cafe").
+		AddNull("null").
+		AddChild(kv.NewKeyValueArray("array", nil).AddInt32("", "1").AddFloat32("", "1.5")).
+		AddChild(kv.NewKeyValueArray("objects", nil).
+			AddChild(kv.NewKeyValueObject("", nil).AddString("key", "a")).
+			AddChild(kv.NewKeyValueObject("", nil).AddNull("key"))).
+		AddChild(kv.NewKeyValueObject("empty", nil)).
+		AddChild(kv.NewKeyValueObject("a", nil).AddChild(kv.NewKeyValueObject("bot", nil).AddInt32("x", "1"))).
+		AddChild(kv.NewKeyValueObject("b", nil).AddChild(kv.NewKeyValueObject("bot", nil).AddInt32("y", "1"))).
+		AddChild(kv.NewKeyValueObject("c", nil).AddChild(kv.NewKeyValueObject("bot", nil).AddInt32("x", "2")))
+
+	src, err := structgen.New("types").Type("Types").Add(root).Generate()
+
+	require.NoError(err)
+	require.Equal(source(`// Code generated by kvgen. DO NOT EDIT.
+
+package types
+
+type Types struct {
+	Bool    bool                   'kv:"bool"'
+	Uint64  uint64                 'kv:"uint64"'
+	Double  float64                'kv:"double"'
+	Binary  []byte                 'kv:"binary"'
+	Null    interface{}            'kv:"null"'
+	Array   []float32              'kv:"array"'
+	Objects []ObjectsItem          'kv:"objects"'
+	Empty   map[string]interface{} 'kv:"empty"'
+	A       A                      'kv:"a"'
+	B       B                      'kv:"b"'
+	C       C                      'kv:"c"'
+}
+
+type ObjectsItem struct {
+	Key string 'kv:"key"'
+}
+
+type A struct {
+	Bot Bot 'kv:"bot"'
+}
+
+type Bot struct {
+	X int32 'kv:"x"'
+}
+
+type B struct {
+	Bot BBot 'kv:"bot"'
+}
+
+type BBot struct {
+	Y int32 'kv:"y"'
+}
+
+type C struct {
+	Bot Bot 'kv:"bot"'
+}
+`), string(src))
+}
+
+func (s *StructgenSuite) TestGenerateErrors() {
+	require := s.Require()
+
+	_, err := structgen.New("main").Generate()
+
+	require.True(errors.Is(err, structgen.ErrNoSamples))
+
+	_, err = structgen.New("main").Add(kv.NewKeyValueString("Version", "1", nil)).Generate()
+
+	require.True(errors.Is(err, structgen.ErrNotObject))
+
+	_, err = structgen.New("").Add(kv.NewKeyValueRoot("Units")).Generate()
+
+	require.Error(err)
+}
+
+func (s *StructgenSuite) TestGenerateHeroes() {
+	require := s.Require()
+	data, err := ioutil.ReadFile("../testdata/npc_heroes.txt")
+
+	require.NoError(err)
+
+	expected, err := ioutil.ReadFile("heroes_kv_test.go")
+
+	require.NoError(err)
+
+	root := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewTextDecoder(bytes.NewReader(data)).InferTypes().Decode(root))
+
+	src, err := structgen.New("structgen_test").Add(root).Generate()
+
+	require.NoError(err)
+	require.Equal(string(expected), string(src), "heroes_kv_test.go is outdated, run go generate")
+
+	var heroes DOTAHeroes
+
+	require.NoError(kv.Unmarshal(data, &heroes))
+	require.Equal(int32(1), heroes.Version)
+	require.Len(heroes.Entries, 121)
+
+	axe := heroes.Entries["npc_dota_hero_axe"]
+
+	require.Equal("models/heroes/axe/axe.vmdl", axe.Model)
+	require.Equal("axe_berserkers_call", axe.Ability1)
+	require.Equal(float32(1.7), axe.AttackRate)
+	require.Equal("weapon", axe.ItemSlots[0].SlotName)
+	require.Equal("ITEM_CORE", axe.Bot.Loadout["item_blink"])
+
+	marshaled, err := kv.Marshal(heroes)
+
+	require.NoError(err)
+
+	b := &bytes.Buffer{}
+
+	require.NoError(kv.NewBinaryEncoder(b).Encode(marshaled.SetKey("DOTAHeroes")))
+
+	var actual DOTAHeroes
+
+	require.NoError(kv.Unmarshal(b.Bytes(), &actual))
+	require.Equal(heroes, actual)
+}
@@ -2,13 +2,23 @@ package kv
 
 import (
 	"io"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/13k/kv-go/parser"
 )
 
 // TextDecoder reads and decodes text-encoded KeyValue nodes from an input stream.
 type TextDecoder struct {
-	p *parser.TextParser
+	p        *parser.TextParser
+	mode     parser.Mode
+	symbols  map[string]bool
+	resolver Resolver
+	keyMode  KeyMode
+	infer    bool
+	types    TypeMap
+	patterns []typePattern
 }
 
 // NewTextDecoder returns a new text decoder that reads from r.
@@ -16,35 +26,267 @@ func NewTextDecoder(r io.Reader) *TextDecoder {
 	return &TextDecoder{p: parser.NewTextParser("", r)}
 }
 
+// Conditionals enables evaluation of conditional expressions (like `[$WIN32||$OSX]`) against the
+// given set of defined symbols and returns the receiver.
+//
+// Symbols can be given with or without the leading "$". Nodes whose condition evaluates to false
+// are dropped from the decoded tree. By default, conditions are not evaluated and all nodes are
+// kept.
+func (d *TextDecoder) Conditionals(symbols ...string) *TextDecoder {
+	d.symbols = make(map[string]bool, len(symbols))
+
+	for _, sym := range symbols {
+		d.symbols[strings.TrimPrefix(sym, "$")] = true
+	}
+
+	return d
+}
+
+// Directives enables resolution of `#base` and `#include` directives, opening the referenced files
+// with r, and returns the receiver.
+//
+// The root children of an #include'd file are appended to the root node. The nodes of a #base file
+// are merged recursively into the root node, adding only keys that are missing (compared according
+// to the KeyMode of the node given to Decode). Directives found in resolved files are resolved as
+// well, and a cycle of directives is reported as an error.
+//
+// By default, directives are parsed but ignored.
+func (d *TextDecoder) Directives(r Resolver) *TextDecoder {
+	d.resolver = r
+	return d
+}
+
+// AllErrors makes the decoder recover from syntax errors and returns the receiver.
+//
+// When recovering, Decode skips invalid tokens and incomplete nodes, stores the best-effort tree in
+// the given KeyValue and returns an ErrorList with all errors found.
+func (d *TextDecoder) AllErrors() *TextDecoder {
+	d.mode |= parser.AllErrors
+	return d
+}
+
+// Lossless makes the decoder record the source text of every node (comments, whitespace and
+// quoting style) and returns the receiver.
+//
+// A TextEncoder writes the recorded source text of nodes back as is, so decoding and encoding an
+// unmodified tree reproduces the input exactly, and modifying a node only changes its own text.
+//
+// With Directives, the text of the resolved directives is not recorded, and the nodes added from
+// the referenced files are written without any recorded text, so that encoding the tree writes the
+// resolved document.
+func (d *TextDecoder) Lossless() *TextDecoder {
+	d.mode |= parser.Lossless
+	return d
+}
+
+// InferTypes makes the decoder infer the types of fields from the syntax of their values (see
+// InferType) and returns the receiver.
+//
+// Fields typed by a TypeMap given to Types are not inferred.
+func (d *TextDecoder) InferTypes() *TextDecoder {
+	d.infer = true
+	return d
+}
+
+// Types makes the decoder decode the fields with paths in m as the mapped types and returns the
+// receiver.
+//
+// Keys are compared according to the KeyMode of the node given to Decode. Only fields are typed, so
+// paths of Object nodes are ignored.
+func (d *TextDecoder) Types(m TypeMap) *TextDecoder {
+	d.types = m
+	return d
+}
+
 // Decode reads the next text-encoded KeyValue node from its input and stores it in the value
 // pointed to by kv.
 //
-// The parser makes no assumptions regarding field types, so all fields are of type TypeString.
+// The text format makes no distinction between field types, so by default all fields are of type
+// TypeString. With InferTypes or Types, fields are decoded as typed nodes, with their values kept as
+// written. Returns a *TypeError if a field value can't be parsed as the type given by a TypeMap, in
+// which case the field is decoded as TypeString, or a *PathError if a path of the TypeMap is
+// malformed.
 func (d *TextDecoder) Decode(kv KeyValue) error {
-	root, err := d.p.Parse()
+	patterns, err := d.types.compile()
 
 	if err != nil {
 		return err
 	}
 
-	applyAST(kv, root)
+	d.patterns = patterns
+	d.keyMode = kv.KeyMode()
+
+	mode := d.mode
+
+	// resolved directives are replaced by the referenced nodes, so their text is not kept
+	if d.resolver != nil {
+		mode |= parser.DropDirectives
+	}
+
+	root, err := d.p.SetMode(mode).Parse()
+
+	if err != nil {
+		if _, ok := err.(ErrorList); ok {
+			_ = d.applyAST(kv, root, nil)
+		}
+
+		return err
+	}
+
+	if d.resolver != nil {
+		name := path.Base(filepath.ToSlash(d.p.Filename()))
+
+		if err := d.resolveDirectives(root, ".", []string{name}); err != nil {
+			return err
+		}
+	}
+
+	return d.applyAST(kv, root, nil)
+}
+
+// resolveDirectives resolves the directives of the root node of a file located in dir.
+//
+// stack contains the names of the files being resolved, used to detect cycles.
+func (d *TextDecoder) resolveDirectives(root *parser.Node, dir string, stack []string) error {
+	for _, directive := range root.Directives {
+		name := path.Join(dir, strings.ReplaceAll(directive.Value, `\`, "/"))
+
+		for _, s := range stack {
+			if s == name {
+				return &DirectiveError{
+					Pos:       directive.Pos,
+					Directive: directive.Key,
+					Name:      name,
+					Chain:     stack,
+					Err:       ErrDirectiveCycle,
+				}
+			}
+		}
+
+		included, err := d.parseFile(name)
+
+		if err != nil {
+			if _, ok := err.(*SyntaxError); !ok {
+				err = &DirectiveError{Pos: directive.Pos, Directive: directive.Key, Name: name, Err: err}
+			}
+
+			return err
+		}
+
+		next := append(stack[:len(stack):len(stack)], name)
+
+		if err := d.resolveDirectives(included, path.Dir(name), next); err != nil {
+			return err
+		}
+
+		switch directive.Type {
+		case parser.Include:
+			for _, c := range included.Children {
+				c.Parent = root
+				root.Children = append(root.Children, c)
+			}
+		case parser.Base:
+			mergeBaseAST(root, included, d.keyMode)
+		}
+	}
 
 	return nil
 }
 
-func applyAST(kv KeyValue, node *parser.Node) {
+func (d *TextDecoder) parseFile(name string) (*parser.Node, error) {
+	r, err := d.resolver.Resolve(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	return parser.NewTextParser(name, r).Parse()
+}
+
+// mergeBaseAST recursively adds the children of base which are missing in node, matching keys like
+// Merge with MergeFillMissing.
+func mergeBaseAST(node, base *parser.Node, mode KeyMode) {
+	children := node.Children
+	matches := matchChildKeys(astKeys(children), astKeys(base.Children), mode)
+
+	for i, baseChild := range base.Children {
+		switch {
+		case matches[i] < 0:
+			baseChild.Parent = node
+			node.Children = append(node.Children, baseChild)
+		case children[matches[i]].Type == parser.Object && baseChild.Type == parser.Object:
+			mergeBaseAST(children[matches[i]], baseChild, mode)
+		}
+	}
+}
+
+func astKeys(nodes []*parser.Node) []string {
+	keys := make([]string, len(nodes))
+
+	for i, n := range nodes {
+		keys[i] = n.Key
+	}
+
+	return keys
+}
+
+func (d *TextDecoder) defined(symbol string) bool {
+	return d.symbols[symbol]
+}
+
+func (d *TextDecoder) keep(node *parser.Node) bool {
+	return d.symbols == nil || node.Cond == nil || node.Cond.Eval(d.defined)
+}
+
+// applyAST stores node in kv. Keys are the keys of the path of node, relative to the root node.
+//
+// Returns the first error typing a field, after storing all nodes.
+func (d *TextDecoder) applyAST(kv KeyValue, node *parser.Node, keys []string) error {
+	var err error
+
 	kv.SetChildren()
 	kv.SetKey(node.Key)
+	kv.SetPosition(node.Pos, node.ValuePos)
+	kv.SetSyntax(node.Syntax)
 
 	switch node.Type {
 	case parser.Object:
 		kv.SetType(TypeObject)
 
 		for _, nodeChild := range node.Children {
-			applyAST(kv.NewChild(), nodeChild)
+			if !d.keep(nodeChild) {
+				continue
+			}
+
+			childKeys := append(keys[:len(keys):len(keys)], nodeChild.Key)
+
+			if childErr := d.applyAST(kv.NewChild(), nodeChild, childKeys); err == nil {
+				err = childErr
+			}
 		}
 	case parser.Field:
-		kv.SetType(TypeString)
+		kv.SetType(d.fieldType(node.Value, keys))
 		kv.SetValue(node.Value)
+
+		if _, err = scalarValue(kv); err != nil {
+			kv.SetType(TypeString)
+		}
+	}
+
+	return err
+}
+
+// fieldType returns the type of a field with the given value and path keys.
+func (d *TextDecoder) fieldType(value string, keys []string) Type {
+	if t, ok := lookupType(d.patterns, keys, d.keyMode); ok {
+		return t
 	}
+
+	if d.infer {
+		return InferType(value)
+	}
+
+	return TypeString
 }
@@ -2,7 +2,11 @@ package kv_test
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -22,6 +26,8 @@ type textDecoderDecodeTestCase struct {
 	TestName        string
 	Data            []byte
 	Input           io.Reader
+	Symbols         []string
+	Resolver        kv.Resolver
 	Err             string
 	Expected        kv.KeyValue
 	ExpectedPartial []textDecoderDecodePartialCase
@@ -57,13 +63,13 @@ func (s *TextDecoderSuite) TestDecode() {
 		{
 			TestName: "MissingKey",
 			Input:    s.MustOpenFixture("sample.invalid-missing_key.txt"),
-			Err:      `kv: testdata/sample.invalid-missing_key.txt:3:4: unexpected token "{"`,
+			Err:      `kv: testdata/sample.invalid-missing_key.txt:3:3: unexpected token "{"`,
 			Expected: kv.NewKeyValueEmpty(),
 		},
 		{
 			TestName: "MissingValue",
 			Input:    s.MustOpenFixture("sample.invalid-missing_value.txt"),
-			Err:      `kv: testdata/sample.invalid-missing_value.txt:7:4: unexpected token "}"`,
+			Err:      `kv: testdata/sample.invalid-missing_value.txt:7:3: unexpected token "}"`,
 			Expected: kv.NewKeyValueEmpty(),
 		},
 		{
@@ -101,12 +107,105 @@ func (s *TextDecoderSuite) TestDecode() {
 						AddString("3c", "three"),
 				),
 		},
+		{
+			TestName: "ConditionalsIgnored",
+			Input:    s.MustOpenFixture("sample.conditionals.txt"),
+			Expected: kv.NewKeyValueRoot("root").
+				AddString("common", "1").
+				AddString("platform", "windows").
+				AddString("platform", "osx").
+				AddString("desktop", "1").
+				AddString("console", "1").
+				AddString("grouped", "1").
+				AddChild(
+					kv.NewKeyValueObject("settings", nil).
+						AddString("key", "x360"),
+				).
+				AddChild(
+					kv.NewKeyValueObject("settings", nil).
+						AddString("key", "pc").
+						AddString("key", "other"),
+				),
+		},
+		{
+			TestName: "ConditionalsWin32",
+			Input:    s.MustOpenFixture("sample.conditionals.txt"),
+			Symbols:  []string{"$WIN32"},
+			Expected: kv.NewKeyValueRoot("root").
+				AddString("common", "1").
+				AddString("platform", "windows").
+				AddString("desktop", "1").
+				AddString("grouped", "1").
+				AddChild(
+					kv.NewKeyValueObject("settings", nil).
+						AddString("key", "pc"),
+				),
+		},
+		{
+			TestName: "ConditionalsX360",
+			Input:    s.MustOpenFixture("sample.conditionals.txt"),
+			Symbols:  []string{"X360"},
+			Expected: kv.NewKeyValueRoot("root").
+				AddString("common", "1").
+				AddString("console", "1").
+				AddChild(
+					kv.NewKeyValueObject("settings", nil).
+						AddString("key", "x360"),
+				),
+		},
+		{
+			TestName: "ConditionalsInvalid",
+			Data:     []byte(`"root" { "key" "value" [$WIN32||] }`),
+			Err:      `kv: <input>:1:25: invalid condition "$WIN32||": unexpected end of expression`,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "DirectivesIgnored",
+			Input:    s.MustOpenFixture("directives/main.txt"),
+			Expected: kv.NewKeyValueRoot("DOTAHeroes").
+				AddChild(
+					kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+						AddString("Model", "models/heroes/axe/axe.vmdl"),
+				),
+		},
+		{
+			TestName: "Directives",
+			Input:    s.MustOpenFixture("directives/main.txt"),
+			Resolver: kv.DirResolver(s.FixturePath("directives")),
+			Expected: kv.NewKeyValueRoot("DOTAHeroes").
+				AddChild(
+					kv.NewKeyValueObject("npc_dota_hero_axe", nil).
+						AddString("Model", "models/heroes/axe/axe.vmdl").
+						AddString("AttackRate", "1.7"),
+				).
+				AddString("Version", "1").
+				AddChild(
+					kv.NewKeyValueObject("npc_dota_hero_zuus", nil).
+						AddString("Model", "models/heroes/zeus/zeus.vmdl"),
+				),
+		},
+		{
+			TestName: "DirectivesCycle",
+			Input:    s.MustOpenFixture("directives/cycle_a.txt"),
+			Resolver: kv.DirResolver(s.FixturePath("directives")),
+			Err:      `kv: cycle_b.txt:1:1: #base cycle: cycle_a.txt -> cycle_b.txt -> cycle_a.txt`,
+			Expected: kv.NewKeyValueEmpty(),
+		},
+		{
+			TestName: "DirectivesMissingFile",
+			Data:     []byte(`#include "missing.txt" "root" { "key" "value" }`),
+			Resolver: kv.ResolverFunc(func(name string) (io.ReadCloser, error) {
+				return nil, fmt.Errorf("cannot open %s", name)
+			}),
+			Err:      `kv: <input>:1:1: #include "missing.txt": cannot open missing.txt`,
+			Expected: kv.NewKeyValueEmpty(),
+		},
 		// no multi-line support yet
 		{
 			TestName: "MultilineValue",
 			Input:    s.MustOpenFixture("addon_english.txt"),
 			Expected: kv.NewKeyValueEmpty(),
-			Err:      `kv: error at testdata/addon_english.txt:12:96: literal not terminated`,
+			Err:      `kv: testdata/addon_english.txt:12:95: literal not terminated`,
 		},
 		{
 			TestName: "AddonInfo",
@@ -228,6 +327,15 @@ func (s *TextDecoderSuite) subtestDecode(testCase textDecoderDecodeTestCase) {
 		}
 
 		dec := kv.NewTextDecoder(input)
+
+		if testCase.Symbols != nil {
+			dec.Conditionals(testCase.Symbols...)
+		}
+
+		if testCase.Resolver != nil {
+			dec.Directives(testCase.Resolver)
+		}
+
 		actual := kv.NewKeyValueEmpty()
 		err := dec.Decode(actual)
 
@@ -286,3 +394,403 @@ func (s *TextDecoderSuite) subtestDecode(testCase textDecoderDecodeTestCase) {
 		}
 	})
 }
+
+func (s *TextDecoderSuite) TestDecodePositions() {
+	require := s.Require()
+	f := s.MustOpenFixture("addoninfo.txt")
+
+	defer f.Close()
+
+	actual := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewTextDecoder(f).Decode(actual))
+
+	fname := s.FixturePath("addoninfo.txt")
+
+	require.Equal(kv.Position{Filename: fname, Offset: 0, Line: 1, Column: 1}, actual.Position())
+	require.Equal(kv.Position{Filename: fname, Offset: 12, Line: 2, Column: 1}, actual.ValuePosition())
+
+	child := actual.Child("siege02").Child("MaxPlayers")
+
+	require.Equal(kv.Position{Filename: fname, Offset: 30, Line: 5, Column: 3}, child.Position())
+	require.Equal(kv.Position{Filename: fname, Offset: 44, Line: 5, Column: 17}, child.ValuePosition())
+	require.Equal("testdata/addoninfo.txt:5:17", child.ValuePosition().String())
+}
+
+func (s *TextDecoderSuite) TestDecodePositionsDirectives() {
+	require := s.Require()
+	f := s.MustOpenFixture("directives/main.txt")
+
+	defer f.Close()
+
+	actual := kv.NewKeyValueEmpty()
+	dec := kv.NewTextDecoder(f).Directives(kv.DirResolver(s.FixturePath("directives")))
+
+	require.NoError(dec.Decode(actual))
+
+	axe := actual.Child("npc_dota_hero_axe")
+
+	require.Equal("testdata/directives/main.txt:7:3", axe.Child("Model").Position().String())
+	require.Equal("heroes/base.txt:7:3", axe.Child("AttackRate").Position().String())
+	require.Equal("heroes/defaults.txt:3:2", actual.Child("Version").Position().String())
+	require.Equal("extra.txt:3:2", actual.Child("npc_dota_hero_zuus").Position().String())
+}
+
+func (s *TextDecoderSuite) TestDecodeDirectivesKeyMode() {
+	require := s.Require()
+
+	files := map[string]string{
+		"base.txt": `"DOTAHeroes" { "NPC_Dota_Hero_Axe" { "model" "base.vmdl" "AttackRate" "1.7" } }`,
+	}
+
+	resolver := kv.ResolverFunc(func(name string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(files[name])), nil
+	})
+
+	data := `#base "base.txt" "DOTAHeroes" { "npc_dota_hero_axe" { "Model" "axe.vmdl" } }`
+
+	actual := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewTextDecoder(strings.NewReader(data)).Directives(resolver).Decode(actual))
+	require.Len(actual.Children(), 2)
+
+	actual = kv.NewKeyValueEmpty().SetKeyMode(kv.KeyModeCaseInsensitive)
+
+	require.NoError(kv.NewTextDecoder(strings.NewReader(data)).Directives(resolver).Decode(actual))
+	require.Len(actual.Children(), 1)
+
+	axe := actual.Child("npc_dota_hero_axe")
+
+	require.Equal("npc_dota_hero_axe", axe.Key())
+	require.Len(axe.Children(), 2)
+	require.Equal("Model", axe.Child("model").Key())
+	require.Equal("axe.vmdl", axe.Child("model").Value())
+	require.Equal("1.7", axe.Child("attackrate").Value())
+}
+
+func (s *TextDecoderSuite) TestDecodeDirectivesDuplicates() {
+	require := s.Require()
+
+	base := `"R" { "k" "b1" "k" "b2" "o" { "z" "1" } "o" { "w" "1" } }`
+	data := `"R" { "k" "m1" "o" { "x" "1" } "o" { "y" "1" } }`
+
+	files := map[string]string{"base.txt": base}
+
+	resolver := kv.ResolverFunc(func(name string) (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(files[name])), nil
+	})
+
+	actual := kv.NewKeyValueEmpty()
+
+	dec := kv.NewTextDecoder(strings.NewReader(`#base "base.txt" ` + data)).Directives(resolver)
+
+	require.NoError(dec.Decode(actual))
+
+	expected := kv.NewKeyValueObject("R", nil).
+		AddString("k", "m1").
+		AddChild(kv.NewKeyValueObject("o", nil).AddString("x", "1").AddString("z", "1")).
+		AddChild(kv.NewKeyValueObject("o", nil).AddString("y", "1").AddString("w", "1")).
+		AddString("k", "b2")
+
+	require.True(kv.Equal(expected, actual), kv.Diff(expected, actual).String())
+
+	// same result as merging the decoded files
+	dst := kv.NewKeyValueEmpty()
+	src := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewTextDecoder(strings.NewReader(data)).Decode(dst))
+	require.NoError(kv.NewTextDecoder(strings.NewReader(base)).Decode(src))
+
+	merged := kv.Merge(dst, src, kv.MergeFillMissing)
+
+	require.True(kv.Equal(merged, actual), kv.Diff(merged, actual).String())
+}
+
+func (s *TextDecoderSuite) TestDecodeErrors() {
+	require := s.Require()
+	f := s.MustOpenFixture("sample.invalid-missing_key.txt")
+
+	defer f.Close()
+
+	err := kv.NewTextDecoder(f).Decode(kv.NewKeyValueEmpty())
+
+	var syntaxErr *kv.SyntaxError
+
+	require.True(errors.As(err, &syntaxErr))
+	require.True(errors.Is(err, kv.ErrUnexpectedToken))
+	require.Equal(3, syntaxErr.Pos.Line)
+	require.Equal(3, syntaxErr.Pos.Column)
+	require.Equal(`key or "}"`, syntaxErr.Expected)
+	require.Equal(`"{"`, syntaxErr.Actual)
+
+	err = kv.NewTextDecoder(bytes.NewReader(nil)).Decode(kv.NewKeyValueEmpty())
+
+	require.True(errors.Is(err, kv.ErrUnexpectedEOF))
+
+	f = s.MustOpenFixture("directives/cycle_a.txt")
+
+	defer f.Close()
+
+	err = kv.NewTextDecoder(f).
+		Directives(kv.DirResolver(s.FixturePath("directives"))).
+		Decode(kv.NewKeyValueEmpty())
+
+	var directiveErr *kv.DirectiveError
+
+	require.True(errors.As(err, &directiveErr))
+	require.True(errors.Is(err, kv.ErrDirectiveCycle))
+	require.Equal("cycle_a.txt", directiveErr.Name)
+	require.Equal([]string{"cycle_a.txt", "cycle_b.txt"}, directiveErr.Chain)
+}
+
+func (s *TextDecoderSuite) TestDecodeAllErrors() {
+	require := s.Require()
+	f := s.MustOpenFixture("sample.invalid-many.txt")
+
+	defer f.Close()
+
+	actual := kv.NewKeyValueEmpty()
+	err := kv.NewTextDecoder(f).AllErrors().Decode(actual)
+
+	var errList kv.ErrorList
+
+	require.True(errors.As(err, &errList))
+	require.True(errors.Is(err, kv.ErrUnexpectedToken))
+	require.True(errors.Is(err, kv.ErrInvalidCondition))
+	require.False(errors.Is(err, kv.ErrInvalidToken))
+
+	var syntaxErr *kv.SyntaxError
+
+	require.True(errors.As(err, &syntaxErr))
+	require.Same(errList[0], syntaxErr)
+	require.EqualError(err, `kv: testdata/sample.invalid-many.txt:4:2: unexpected token "{" (and 4 more errors)`)
+
+	var messages []string
+
+	for _, e := range errList {
+		messages = append(messages, e.Error())
+	}
+
+	require.Equal([]string{
+		`kv: testdata/sample.invalid-many.txt:4:2: unexpected token "{"`,
+		`kv: testdata/sample.invalid-many.txt:7:14: invalid condition "$WIN32||": unexpected end of expression`,
+		`kv: testdata/sample.invalid-many.txt:11:7: unexpected token "="`,
+		`kv: testdata/sample.invalid-many.txt:14:2: unexpected token "}"`,
+		`kv: testdata/sample.invalid-many.txt:16:1: unexpected EOF`,
+	}, messages)
+
+	expected := kv.NewKeyValueRoot("root").
+		AddString("key", "value").
+		AddChild(
+			kv.NewKeyValueObject("", nil).
+				AddString("orphan", "value"),
+		).
+		AddString("cond", "1").
+		AddChild(
+			kv.NewKeyValueObject("nested", nil).
+				AddString("a", "1").
+				AddString("c", "3"),
+		).
+		AddString("after", "value")
+
+	s.RequireEqualKeyValue(expected, actual)
+}
+
+func (s *TextDecoderSuite) TestDecodeAllErrorsAfterRoot() {
+	require := s.Require()
+
+	testCases := []struct {
+		TestName string
+		Input    string
+		Expected []string
+	}{
+		{
+			TestName: "ClosingBrace",
+			Input:    `"a" { "b" "c" "d" } }`,
+			Expected: []string{
+				`kv: <input>:1:19: unexpected token "}"`,
+				`kv: <input>:1:21: unexpected token "}"`,
+			},
+		},
+		{
+			TestName: "Nodes",
+			Input:    `"a" { } "b" { "c" "d" }`,
+			Expected: []string{
+				`kv: <input>:1:9: unexpected token String`,
+				`kv: <input>:1:13: unexpected token "{"`,
+				`kv: <input>:1:15: unexpected token String`,
+				`kv: <input>:1:19: unexpected token String`,
+				`kv: <input>:1:23: unexpected token "}"`,
+			},
+		},
+	}
+
+	for _, testCase := range testCases {
+		err := kv.NewTextDecoder(strings.NewReader(testCase.Input)).AllErrors().Decode(kv.NewKeyValueEmpty())
+
+		var errList kv.ErrorList
+
+		require.Truef(errors.As(err, &errList), "case %s", testCase.TestName)
+
+		var messages []string
+
+		for _, e := range errList {
+			messages = append(messages, e.Error())
+		}
+
+		require.Equalf(testCase.Expected, messages, "case %s", testCase.TestName)
+	}
+}
+
+func (s *TextDecoderSuite) TestDecodeAllErrorsValid() {
+	f := s.MustOpenFixture("addoninfo.txt")
+
+	defer f.Close()
+
+	s.Require().NoError(kv.NewTextDecoder(f).AllErrors().Decode(kv.NewKeyValueEmpty()))
+}
+
+func (s *TextDecoderSuite) TestInferType() {
+	testCases := map[string]kv.Type{
+		"0":                     kv.TypeInt32,
+		"-2147483648":           kv.TypeInt32,
+		"007":                   kv.TypeInt32,
+		"2147483648":            kv.TypeInt64,
+		"-9223372036854775809":  kv.TypeString,
+		"18446744073709551615":  kv.TypeUint64,
+		"18446744073709551616":  kv.TypeString,
+		"1.5":                   kv.TypeFloat32,
+		"-.5":                   kv.TypeFloat32,
+		"1.":                    kv.TypeFloat32,
+		"2e-3":                  kv.TypeFloat32,
+		"1E+10":                 kv.TypeFloat32,
+		"1e39":                  kv.TypeString,
+		"":                      kv.TypeString,
+		"-":                     kv.TypeString,
+		".":                     kv.TypeString,
+		"1e":                    kv.TypeString,
+		"+1":                    kv.TypeString,
+		"0x10":                  kv.TypeString,
+		"1_000":                 kv.TypeString,
+		"inf":                   kv.TypeString,
+		"NaN":                   kv.TypeString,
+		"1 2":                   kv.TypeString,
+		"models/heroes/axe.mdl": kv.TypeString,
+	}
+
+	for value, expected := range testCases {
+		s.Require().Equalf(expected, kv.InferType(value), "value %q", value)
+	}
+}
+
+func (s *TextDecoderSuite) TestDecodeInferTypes() {
+	require := s.Require()
+	data := `"DOTAHeroes" { "npc_dota_hero_axe" { "AttackRate" "1.7" "ArmorPhysical" "-1" "Model" "axe.vmdl" } }`
+
+	actual := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewTextDecoder(strings.NewReader(data)).InferTypes().Decode(actual))
+
+	axe := actual.Child("npc_dota_hero_axe")
+
+	require.Equal(kv.TypeObject, axe.Type())
+	require.Equal(kv.TypeFloat32, axe.Child("AttackRate").Type())
+	require.Equal("1.7", axe.Child("AttackRate").Value())
+	require.Equal(kv.TypeInt32, axe.Child("ArmorPhysical").Type())
+	require.Equal(kv.TypeString, axe.Child("Model").Type())
+}
+
+func (s *TextDecoderSuite) TestDecodeTypes() {
+	require := s.Require()
+	data := `"DOTAHeroes" {
+		"Version" "1"
+		"npc_dota_hero_axe" { "AttackRate" "1.7" "Ability1" "1" "MovementSpeed" "290" "Model" "1" }
+		"npc_dota_hero_sven" { "AttackRate" "1.8" "Ability1" "2" "MovementSpeed" "310" }
+	}`
+
+	types := kv.TypeMap{
+		"version":                          kv.TypeUint64,
+		"*/AttackRate":                     kv.TypeFloat32,
+		"*/Ability1":                       kv.TypeString,
+		"npc_dota_hero_axe/Ability1":       kv.TypeInt64,
+		"npc_dota_hero_axe":                kv.TypeInt32,
+		"npc_dota_hero_sven/MovementSpeed": kv.TypeColor,
+	}
+
+	actual := kv.NewKeyValueEmpty().SetKeyMode(kv.KeyModeCaseInsensitive)
+
+	require.NoError(kv.NewTextDecoder(strings.NewReader(data)).Types(types).InferTypes().Decode(actual))
+
+	axe := actual.Child("npc_dota_hero_axe")
+	sven := actual.Child("npc_dota_hero_sven")
+
+	require.Equal(kv.TypeUint64, actual.Child("Version").Type())
+	require.Equal(kv.TypeObject, axe.Type())
+	require.Equal(kv.TypeFloat32, axe.Child("AttackRate").Type())
+	require.Equal(kv.TypeInt64, axe.Child("Ability1").Type())
+	require.Equal(kv.TypeInt32, axe.Child("MovementSpeed").Type())
+	require.Equal(kv.TypeInt32, axe.Child("Model").Type())
+	require.Equal(kv.TypeString, sven.Child("Ability1").Type())
+	require.Equal(kv.TypeColor, sven.Child("MovementSpeed").Type())
+
+	actual = kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewTextDecoder(strings.NewReader(data)).Types(types).Decode(actual))
+	require.Equal(kv.TypeString, actual.Child("Version").Type())
+	require.Equal(kv.TypeString, actual.Child("npc_dota_hero_axe").Child("MovementSpeed").Type())
+	require.Equal(kv.TypeFloat32, actual.Child("npc_dota_hero_axe").Child("AttackRate").Type())
+}
+
+func (s *TextDecoderSuite) TestDecodeTypesErrors() {
+	require := s.Require()
+	data := `"DOTAHeroes" { "npc_dota_hero_axe" { "AttackRate" "fast" "Model" "axe.vmdl" "Armor" "x" } }`
+
+	actual := kv.NewKeyValueEmpty()
+	types := kv.TypeMap{"*/AttackRate": kv.TypeFloat32, "*/Armor": kv.TypeInt32}
+	err := kv.NewTextDecoder(strings.NewReader(data)).Types(types).Decode(actual)
+
+	require.EqualError(err, `kv: cannot convert Value "fast" to Float32: `+
+		`strconv.ParseFloat: parsing "fast": invalid syntax`)
+	require.True(errors.Is(err, kv.ErrInvalidValue))
+
+	axe := actual.Child("npc_dota_hero_axe")
+
+	require.Len(axe.Children(), 3)
+	require.Equal(kv.TypeString, axe.Child("AttackRate").Type())
+	require.Equal(kv.TypeString, axe.Child("Armor").Type())
+
+	err = kv.NewTextDecoder(strings.NewReader(data)).Types(kv.TypeMap{`a\`: kv.TypeInt32}).Decode(actual)
+
+	require.True(errors.Is(err, kv.ErrInvalidPath))
+}
+
+func (s *TextDecoderSuite) TestDecodeInferTypesBinary() {
+	require := s.Require()
+	f := s.MustOpenFixture("npc_heroes.txt")
+
+	defer f.Close()
+
+	root := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewTextDecoder(f).InferTypes().Decode(root))
+
+	axe := root.Child("npc_dota_hero_axe")
+
+	require.NotNil(axe)
+
+	b := &bytes.Buffer{}
+
+	require.NoError(kv.NewBinaryEncoder(b).Encode(root))
+
+	decoded := kv.NewKeyValueEmpty()
+
+	require.NoError(kv.NewBinaryDecoder(b).Decode(decoded))
+	require.True(kv.Equal(root, decoded, kv.EqualNumeric), "%s", kv.Diff(root, decoded))
+
+	axe = decoded.Child("npc_dota_hero_axe")
+
+	require.Equal(kv.TypeInt32, axe.Child("HeroID").Type())
+	require.Equal(kv.TypeFloat32, axe.Child("ModelScale").Type())
+	require.Equal(kv.TypeString, axe.Child("Rolelevels").Type())
+	require.Equal(kv.TypeString, axe.Child("Model").Type())
+}
@@ -12,6 +12,10 @@ const (
 	textIndent      = "  "
 	textObjectStart = "{"
 	textObjectEnd   = "}"
+
+	textSyntaxIndent    = "\t"
+	textSyntaxSeparator = "\t"
+	textSyntaxEmpty     = `""`
 )
 
 // TextEncoder writes text-encoded KeyValue nodes to an output stream.
@@ -25,14 +29,26 @@ func NewTextEncoder(w io.Writer) *TextEncoder {
 }
 
 // Encode writes the KeyValue text encoding of kv to the stream.
+//
+// If kv has recorded source text (see TextDecoder.Lossless), the source text of each node is
+// written back as is. Modified keys and values are written in the original quoting style, and nodes
+// without source text are formatted with the indentation of their siblings.
 func (e *TextEncoder) Encode(kv KeyValue) error {
+	if kv.Syntax() != nil {
+		if err := e.encodeSyntax(kv, ""); err != nil {
+			return err
+		}
+
+		return e.w.Flush()
+	}
+
 	return e.encode(kv, 0)
 }
 
 func (e *TextEncoder) encode(kv KeyValue, level int) error {
 	switch kv.Type() {
-	case TypeInvalid, TypeEnd:
-		return fmt.Errorf("kv: cannot encode nodes of type %s", kv.Type())
+	case TypeInvalid, TypeEnd, TypeArray:
+		return newUnsupportedTypeError(kv)
 	}
 
 	indent := strings.Repeat(textIndent, level)
@@ -81,3 +97,86 @@ func (e *TextEncoder) encodeObject(kv KeyValue, indent string, level int) error
 
 	return nil
 }
+
+func (e *TextEncoder) encodeSyntax(kv KeyValue, indent string) error {
+	switch kv.Type() {
+	case TypeInvalid, TypeEnd, TypeArray:
+		return newUnsupportedTypeError(kv)
+	}
+
+	syn := kv.Syntax()
+
+	if syn == nil || syn.IsObject() != (kv.Type() == TypeObject) {
+		syn = newTextSyntax(kv, indent)
+	} else {
+		indent = lastLine(syn.Leading)
+	}
+
+	if _, err := e.w.WriteString(syn.Leading + syn.FormatKey(kv.Key()) + syn.Separator); err != nil {
+		return err
+	}
+
+	if kv.Type() == TypeObject {
+		if _, err := e.w.WriteString(syn.Value + syn.Open); err != nil {
+			return err
+		}
+
+		childIndent := indent + textSyntaxIndent
+
+		for _, c := range kv.Children() {
+			if cs := c.Syntax(); cs != nil {
+				childIndent = lastLine(cs.Leading)
+				break
+			}
+		}
+
+		for _, c := range kv.Children() {
+			if err := e.encodeSyntax(c, childIndent); err != nil {
+				return err
+			}
+		}
+
+		if _, err := e.w.WriteString(syn.Closing + textObjectEnd); err != nil {
+			return err
+		}
+	} else if _, err := e.w.WriteString(syn.FormatValue(kv.Value())); err != nil {
+		return err
+	}
+
+	_, err := e.w.WriteString(syn.Trailing)
+
+	return err
+}
+
+// newTextSyntax creates the source text for a node without recorded source text, or whose type
+// changed.
+func newTextSyntax(kv KeyValue, indent string) *Syntax {
+	syn := &Syntax{
+		Leading:   indent,
+		Key:       textSyntaxEmpty,
+		Separator: textSyntaxSeparator,
+		Value:     textSyntaxEmpty,
+		Trailing:  "\n",
+	}
+
+	if kv.Type() == TypeObject {
+		syn.Separator = "\n" + indent
+		syn.Value = textObjectStart
+		syn.Open = "\n"
+		syn.Closing = indent
+	}
+
+	return syn
+}
+
+// lastLine returns the text after the last line break if it's only whitespace, otherwise returns
+// an empty string.
+func lastLine(s string) string {
+	s = s[strings.LastIndexByte(s, '\n')+1:]
+
+	if strings.TrimSpace(s) != "" {
+		return ""
+	}
+
+	return s
+}
@@ -2,6 +2,7 @@ package kv_test
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -29,12 +30,17 @@ func (s *TextEncoderSuite) TestEncode() {
 		{
 			Subject:  kv.NewKeyValue(kv.TypeEnd, "", "", nil),
 			Expected: nil,
-			Err:      "kv: cannot encode nodes of type End",
+			Err:      "kv: cannot encode node of type End",
 		},
 		{
 			Subject:  kv.NewKeyValue(kv.TypeInvalid, "", "", nil),
 			Expected: nil,
-			Err:      "kv: cannot encode nodes of type Invalid",
+			Err:      "kv: cannot encode node of type Invalid",
+		},
+		{
+			Subject:  kv.NewKeyValueRoot("K").AddChild(kv.NewKeyValue(kv.TypeArray, "A", "", nil)),
+			Expected: nil,
+			Err:      "kv: cannot encode node of type Array",
 		},
 		{
 			Subject:  kv.NewKeyValueString("K", "S", nil),
@@ -154,3 +160,140 @@ func (s *TextEncoderSuite) TestEncode() {
 		require.Equalf(expected, actual, "test case %d", testCaseIdx)
 	}
 }
+
+func (s *TextEncoderSuite) decodeLossless(path string) kv.KeyValue {
+	f := s.MustOpenFixture(path)
+
+	defer f.Close()
+
+	root := kv.NewKeyValueEmpty()
+
+	s.Require().NoError(kv.NewTextDecoder(f).Lossless().Decode(root))
+
+	return root
+}
+
+func (s *TextEncoderSuite) encode(root kv.KeyValue) []byte {
+	b := &bytes.Buffer{}
+
+	s.Require().NoError(kv.NewTextEncoder(b).Encode(root))
+
+	return b.Bytes()
+}
+
+func (s *TextEncoderSuite) TestEncodeLossless() {
+	fixtures := []string{
+		"addoninfo.txt",
+		"gameinfo.gi",
+		"localconfig.vdf",
+		"npc_heroes.txt",
+		"panorama_english.txt",
+		"publish_data.txt",
+		"sample.conditionals.txt",
+		"sample.valid.txt",
+		"directives/main.txt",
+	}
+
+	for _, fixture := range fixtures {
+		s.Run(fixture, func() {
+			root := s.decodeLossless(fixture)
+
+			s.Require().Equal(string(s.MustReadFixture(fixture)), string(s.encode(root)))
+		})
+	}
+}
+
+func (s *TextEncoderSuite) TestEncodeLosslessDirectives() {
+	require := s.Require()
+	resolver := kv.DirResolver(s.FixturePath("directives"))
+
+	testCases := []struct {
+		TestName string
+		Input    string
+		Expected string
+	}{
+		{
+			TestName: "Main",
+			Input:    string(s.MustReadFixture("directives/main.txt")),
+			Expected: `"DOTAHeroes"
+{
+	"npc_dota_hero_axe"
+	{
+		"Model"	"models/heroes/axe/axe.vmdl"
+		"AttackRate"	"1.7"
+	}
+	"Version"	"1"
+	"npc_dota_hero_zuus"
+	{
+		"Model"	"models/heroes/zeus/zeus.vmdl"
+	}
+}
+`,
+		},
+		{
+			TestName: "Comments",
+			Input:    "// base\n#base \"extra.txt\" \n\n// root\n\"DOTAHeroes\"\n{\n}\n#include \"extra.txt\"\n// end\n",
+			Expected: "// base\n\n// root\n\"DOTAHeroes\"\n{\n" +
+				"\t\"npc_dota_hero_zuus\"\n\t{\n\t\t\"Model\"\t\"models/heroes/zeus/zeus.vmdl\"\n\t}\n" +
+				"\t\"npc_dota_hero_zuus\"\n\t{\n\t\t\"Model\"\t\"models/heroes/zeus/zeus.vmdl\"\n\t}\n" +
+				"}\n// end\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		root := kv.NewKeyValueEmpty()
+
+		require.NoErrorf(
+			kv.NewTextDecoder(strings.NewReader(testCase.Input)).Lossless().Directives(resolver).Decode(root),
+			"case %s", testCase.TestName,
+		)
+
+		actual := s.encode(root)
+
+		require.Equalf(testCase.Expected, string(actual), "case %s", testCase.TestName)
+
+		// the output is the resolved document, decoding it (with directives) gives the same tree
+		decoded := kv.NewKeyValueEmpty()
+
+		require.NoErrorf(
+			kv.NewTextDecoder(bytes.NewReader(actual)).Directives(resolver).Decode(decoded),
+			"case %s", testCase.TestName,
+		)
+
+		s.RequireEqualKeyValue(root, decoded)
+	}
+}
+
+func (s *TextEncoderSuite) TestEncodeLosslessModified() {
+	require := s.Require()
+	root := s.decodeLossless("gameinfo.gi")
+	hammer := root.Child("Hammer")
+
+	require.NoError(hammer.Child("DefaultTextureScale").SetString("0.5"))
+
+	root.Child("game").SetValue("Dota 2 Reborn")
+	root.Child("MaterialEditor").SetKey("Material Editor")
+	hammer.AddString("NewKey", "new value")
+	hammer.AddChild(kv.NewKeyValueObject("NewObject", nil).AddString("nested", "1"))
+
+	expected := string(s.MustReadFixture("gameinfo.gi"))
+	expected = strings.Replace(expected, "\tgame \t\t\"Dota 2\"\n", "\tgame \t\t\"Dota 2 Reborn\"\n", 1)
+	expected = strings.Replace(expected, "\tMaterialEditor\n", "\t\"Material Editor\"\n", 1)
+	expected = strings.Replace(
+		expected,
+		"\"0.250000\"",
+		"\"0.5\"",
+		1,
+	)
+	expected = strings.Replace(
+		expected,
+		"\t\t\"TileGridBlendDefaultColor\"\t\"0 255 0\"\n\t}\n",
+		"\t\t\"TileGridBlendDefaultColor\"\t\"0 255 0\"\n"+
+			"\t\t\"NewKey\"\t\"new value\"\n"+
+			"\t\t\"NewObject\"\n\t\t{\n\t\t\t\"nested\"\t\"1\"\n\t\t}\n"+
+			"\t}\n",
+		1,
+	)
+
+	require.Equal(expected, string(s.encode(root)))
+}
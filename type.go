@@ -1,5 +1,7 @@
 package kv
 
+import "strconv"
+
 //go:generate stringer -type Type -trimprefix Type
 
 // Type represents a KeyValue's node type.
@@ -21,6 +23,17 @@ const (
 	TypeInt64                   // 0x0a
 )
 
+// KeyValues3 types.
+//
+// These types have no representation in binary format.
+const (
+	TypeNull   Type = iota + 0x10 // 0x10
+	TypeBool                      // 0x11
+	TypeDouble                    // 0x12
+	TypeArray                     // 0x13
+	TypeBinary                    // 0x14
+)
+
 // TypeFromByte converts a byte from binary format to a Type.
 //
 // Returns TypeInvalid if the given byte is not a valid Type.
@@ -62,3 +75,123 @@ func (t Type) Byte() byte {
 		return 0
 	}
 }
+
+// types lists the valid node types.
+var types = [...]Type{
+	TypeObject,
+	TypeString,
+	TypeInt32,
+	TypeFloat32,
+	TypePointer,
+	TypeWString,
+	TypeColor,
+	TypeUint64,
+	TypeInt64,
+	TypeNull,
+	TypeBool,
+	TypeDouble,
+	TypeArray,
+	TypeBinary,
+}
+
+// TypeFromString converts a type name, as returned by Type.String, to a Type.
+//
+// Returns TypeInvalid and false if the given name is not a valid node type.
+func TypeFromString(s string) (Type, bool) {
+	for _, t := range types {
+		if t.String() == s {
+			return t, true
+		}
+	}
+
+	return TypeInvalid, false
+}
+
+// InferType returns the node type suggested by the syntax of a text value: TypeInt32, TypeInt64 or
+// TypeUint64 for decimal integers (the first type that can represent the value), TypeFloat32 for
+// decimal numbers with a fractional part or an exponent, like "1.5" or "2e-3", and TypeString for
+// anything else, including integers out of range of all integer types.
+func InferType(value string) Type {
+	integer, ok := scanNumber(value)
+
+	if !ok {
+		return TypeString
+	}
+
+	if !integer {
+		if _, err := strconv.ParseFloat(value, 32); err != nil {
+			return TypeString
+		}
+
+		return TypeFloat32
+	}
+
+	if _, err := strconv.ParseInt(value, 10, 32); err == nil {
+		return TypeInt32
+	}
+
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return TypeInt64
+	}
+
+	if _, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return TypeUint64
+	}
+
+	return TypeString
+}
+
+// scanNumber reports whether s is a decimal number (an optional minus sign, digits with an optional
+// fractional part and an optional exponent) and whether it's an integer.
+func scanNumber(s string) (integer, ok bool) {
+	i := 0
+
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+
+	digits := scanDigits(s[i:])
+	i += digits
+	integer = true
+
+	if i < len(s) && s[i] == '.' {
+		integer = false
+		i++
+		n := scanDigits(s[i:])
+		digits += n
+		i += n
+	}
+
+	if digits == 0 {
+		return false, false
+	}
+
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		integer = false
+		i++
+
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+
+		n := scanDigits(s[i:])
+
+		if n == 0 {
+			return false, false
+		}
+
+		i += n
+	}
+
+	return integer, i == len(s)
+}
+
+func scanDigits(s string) int {
+	i := 0
+
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+
+	return i
+}
@@ -0,0 +1,78 @@
+package kv
+
+import "sort"
+
+// typeMapWildcard is the key of a TypeMap path that matches any key.
+const typeMapWildcard = "*"
+
+// TypeMap maps paths of nodes to node types, to type the nodes decoded by TextDecoder.
+//
+// Paths are in the format of ParsePath, relative to the decoded root node, and a "*" key matches
+// any key, like in `*/AttackRate`. When multiple paths match a node, the most specific one is used:
+// of two paths, the one with a literal key where the other has a wildcard first.
+type TypeMap map[string]Type
+
+// typePattern is a parsed TypeMap path.
+type typePattern struct {
+	keys []string
+	t    Type
+}
+
+// compile parses the paths of the map. Patterns are sorted from the most to the least specific.
+func (m TypeMap) compile() ([]typePattern, error) {
+	patterns := make([]typePattern, 0, len(m))
+
+	for path, t := range m {
+		keys, err := ParsePath(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, typePattern{keys: keys, t: t})
+	}
+
+	sort.Slice(patterns, func(i, j int) bool {
+		a, b := patterns[i].keys, patterns[j].keys
+
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if aw, bw := a[k] == typeMapWildcard, b[k] == typeMapWildcard; aw != bw {
+				return bw
+			}
+
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+
+		return len(a) < len(b)
+	})
+
+	return patterns, nil
+}
+
+// lookupType returns the type of the most specific pattern matching path, comparing keys according
+// to mode.
+func lookupType(patterns []typePattern, path []string, mode KeyMode) (Type, bool) {
+	for _, p := range patterns {
+		if p.match(path, mode) {
+			return p.t, true
+		}
+	}
+
+	return TypeInvalid, false
+}
+
+func (p typePattern) match(path []string, mode KeyMode) bool {
+	if len(p.keys) != len(path) {
+		return false
+	}
+
+	for i, key := range p.keys {
+		if key != typeMapWildcard && !mode.Equal(key, path[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -19,15 +19,22 @@ func _() {
 	_ = x[TypeUint64-7]
 	_ = x[TypeEnd-8]
 	_ = x[TypeInt64-10]
+	_ = x[TypeNull-16]
+	_ = x[TypeBool-17]
+	_ = x[TypeDouble-18]
+	_ = x[TypeArray-19]
+	_ = x[TypeBinary-20]
 }
 
 const (
 	_Type_name_0 = "InvalidObjectStringInt32Float32PointerWStringColorUint64End"
 	_Type_name_1 = "Int64"
+	_Type_name_2 = "NullBoolDoubleArrayBinary"
 )
 
 var (
 	_Type_index_0 = [...]uint8{0, 7, 13, 19, 24, 31, 38, 45, 50, 56, 59}
+	_Type_index_2 = [...]uint8{0, 4, 8, 14, 19, 25}
 )
 
 func (i Type) String() string {
@@ -37,6 +44,9 @@ func (i Type) String() string {
 		return _Type_name_0[_Type_index_0[i]:_Type_index_0[i+1]]
 	case i == 10:
 		return _Type_name_1
+	case 16 <= i && i <= 20:
+		i -= 16
+		return _Type_name_2[_Type_index_2[i]:_Type_index_2[i+1]]
 	default:
 		return "Type(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
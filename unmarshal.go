@@ -0,0 +1,398 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Unmarshaler is the interface implemented by types that can unmarshal a KeyValue node into
+// themselves.
+type Unmarshaler interface {
+	UnmarshalKV(KeyValue) error
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// Unmarshal decodes the KeyValue data and stores the result in the value pointed to by v.
+//
+// The data is decoded with BinaryDecoder if it starts with a binary type byte, otherwise with
+// TextDecoder. See UnmarshalKeyValue for how nodes are stored in v.
+func Unmarshal(data []byte, v interface{}) error {
+	kv := NewKeyValueEmpty()
+
+	var err error
+
+	if len(data) > 0 && data[0] <= TypeEnd.Byte() {
+		err = NewBinaryDecoder(bytes.NewReader(data)).Decode(kv)
+	} else {
+		err = NewTextDecoder(bytes.NewReader(data)).Decode(kv)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return UnmarshalKeyValue(kv, v)
+}
+
+// UnmarshalKeyValue stores the value of the KeyValue tree kv in the value pointed to by v.
+//
+// If the value (or a pointer to it) implements Unmarshaler, UnmarshalKeyValue calls its UnmarshalKV
+// method with the node, except for Null nodes. Otherwise, UnmarshalKeyValue uses the inverse of
+// the mappings used by Marshal, allocating pointers, maps and slices as needed:
+//
+// Object nodes are stored in structs, with child nodes matched to fields by key (preferring an
+// exact match, but also accepting a case-insensitive match), and in maps, with a map entry per
+// child node. Child nodes without a matching field are stored in the map field with the "remain"
+// tag option, if any, or ignored. Object and Array nodes are stored in slices and arrays, with an
+// element per child node, in order, regardless of keys.
+//
+// Scalar nodes are stored in Go scalars by parsing the node's value, regardless of the node's type,
+// so that values decoded from text (which are all strings) can be stored in numeric and bool
+// fields. Binary nodes are stored in byte slices. Null nodes set the Go value to its zero value.
+//
+// Values stored in interface{} values are typed after the node type: map[string]interface{} for
+// Object nodes, []interface{} for Array nodes, and string, int32, int64, uint64, float32, float64,
+// bool or []byte for scalar nodes.
+func UnmarshalKeyValue(kv KeyValue, v interface{}) error {
+	rv := reflect.ValueOf(v)
+
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return &MarshalError{Op: OpUnmarshal, GoType: reflect.TypeOf(v), Err: ErrInvalidTarget}
+	}
+
+	return unmarshalValue(kv, rv.Elem())
+}
+
+func unmarshalValue(kv KeyValue, rv reflect.Value) error {
+	if kv.Type() == TypeNull {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+
+	if rv.CanAddr() && rv.Addr().CanInterface() {
+		if u, ok := rv.Addr().Interface().(Unmarshaler); ok {
+			return u.UnmarshalKV(kv)
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+
+		return unmarshalValue(kv, rv.Elem())
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return newUnmarshalError(kv, rv.Type(), ErrUnsupportedType)
+		}
+
+		value, err := unmarshalInterface(kv)
+
+		if err != nil {
+			return err
+		}
+
+		if value == nil {
+			rv.Set(reflect.Zero(rv.Type()))
+		} else {
+			rv.Set(reflect.ValueOf(value))
+		}
+
+		return nil
+	case reflect.Struct:
+		if kv.Type() != TypeObject {
+			return newUnmarshalError(kv, rv.Type(), ErrTypeMismatch)
+		}
+
+		return unmarshalStruct(kv, rv)
+	case reflect.Map:
+		if kv.Type() != TypeObject {
+			return newUnmarshalError(kv, rv.Type(), ErrTypeMismatch)
+		}
+
+		return unmarshalMap(kv, rv)
+	case reflect.Slice:
+		if kv.Type() == TypeBinary && rv.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := hex.DecodeString(kv.Value())
+
+			if err != nil {
+				return newUnmarshalError(kv, rv.Type(), err)
+			}
+
+			rv.SetBytes(b)
+
+			return nil
+		}
+
+		if kv.Type() != TypeObject && kv.Type() != TypeArray {
+			return newUnmarshalError(kv, rv.Type(), ErrTypeMismatch)
+		}
+
+		children := kv.Children()
+		rv.Set(reflect.MakeSlice(rv.Type(), len(children), len(children)))
+
+		for i, c := range children {
+			if err := unmarshalValue(c, rv.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case reflect.Array:
+		if kv.Type() != TypeObject && kv.Type() != TypeArray {
+			return newUnmarshalError(kv, rv.Type(), ErrTypeMismatch)
+		}
+
+		children := kv.Children()
+
+		for i := 0; i < rv.Len(); i++ {
+			if i >= len(children) {
+				rv.Index(i).Set(reflect.Zero(rv.Type().Elem()))
+				continue
+			}
+
+			if err := unmarshalValue(children[i], rv.Index(i)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if kv.Type() == TypeObject || kv.Type() == TypeArray {
+		return newUnmarshalError(kv, rv.Type(), ErrTypeMismatch)
+	}
+
+	return unmarshalScalar(kv, rv)
+}
+
+func unmarshalScalar(kv KeyValue, rv reflect.Value) error {
+	value := kv.Value()
+
+	switch rv.Kind() {
+	case reflect.String:
+		rv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return newUnmarshalError(kv, rv.Type(), err)
+		}
+
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, rv.Type().Bits())
+
+		if err != nil {
+			return newUnmarshalError(kv, rv.Type(), err)
+		}
+
+		rv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(value, 10, rv.Type().Bits())
+
+		if err != nil {
+			return newUnmarshalError(kv, rv.Type(), err)
+		}
+
+		rv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, rv.Type().Bits())
+
+		if err != nil {
+			return newUnmarshalError(kv, rv.Type(), err)
+		}
+
+		rv.SetFloat(n)
+	default:
+		return newUnmarshalError(kv, rv.Type(), ErrUnsupportedType)
+	}
+
+	return nil
+}
+
+func unmarshalStruct(kv KeyValue, rv reflect.Value) error {
+	fields := cachedFields(rv.Type())
+
+	for _, c := range kv.Children() {
+		f := findField(fields, c.Key())
+
+		if f == nil {
+			continue
+		}
+
+		fv, ok := fieldByIndex(rv, f.index, true)
+
+		if !ok {
+			continue
+		}
+
+		if f.remain {
+			if err := unmarshalRemain(kv, c, fv); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := unmarshalValue(c, fv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findField returns the field matching key or, if no field matches, the field with the "remain"
+// option, if any.
+func findField(fields []field, key string) *field {
+	for i := range fields {
+		if !fields[i].remain && fields[i].name == key {
+			return &fields[i]
+		}
+	}
+
+	for i := range fields {
+		if !fields[i].remain && strings.EqualFold(fields[i].name, key) {
+			return &fields[i]
+		}
+	}
+
+	for i := range fields {
+		if fields[i].remain {
+			return &fields[i]
+		}
+	}
+
+	return nil
+}
+
+// unmarshalRemain stores the child node c of kv as an entry of the map field rv with the "remain"
+// option.
+func unmarshalRemain(kv, c KeyValue, rv reflect.Value) error {
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() != reflect.Map || !isMapKey(rv.Type().Key()) {
+		return newUnmarshalError(kv, rv.Type(), ErrUnsupportedType)
+	}
+
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMap(rv.Type()))
+	}
+
+	return unmarshalMapEntry(c, rv)
+}
+
+func unmarshalMap(kv KeyValue, rv reflect.Value) error {
+	if !isMapKey(rv.Type().Key()) {
+		return newUnmarshalError(kv, rv.Type(), ErrUnsupportedType)
+	}
+
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMap(rv.Type()))
+	}
+
+	for _, c := range kv.Children() {
+		if err := unmarshalMapEntry(c, rv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unmarshalMapEntry stores the node c as the entry of the map rv keyed by the node's key.
+func unmarshalMapEntry(c KeyValue, rv reflect.Value) error {
+	t := rv.Type()
+	key := reflect.New(t.Key()).Elem()
+
+	if err := unmarshalScalar(NewKeyValueString(c.Key(), c.Key(), nil), key); err != nil {
+		return err
+	}
+
+	elem := reflect.New(t.Elem()).Elem()
+
+	if err := unmarshalValue(c, elem); err != nil {
+		return err
+	}
+
+	rv.SetMapIndex(key, elem)
+
+	return nil
+}
+
+// isMapKey reports whether t is a supported map key type: a string or an integer.
+func isMapKey(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	default:
+		return false
+	}
+}
+
+// unmarshalInterface returns the value of a node typed after the node's type.
+func unmarshalInterface(kv KeyValue) (interface{}, error) {
+	switch kv.Type() {
+	case TypeObject:
+		m := make(map[string]interface{}, len(kv.Children()))
+
+		for _, c := range kv.Children() {
+			value, err := unmarshalInterface(c)
+
+			if err != nil {
+				return nil, err
+			}
+
+			m[c.Key()] = value
+		}
+
+		return m, nil
+	case TypeArray:
+		s := make([]interface{}, 0, len(kv.Children()))
+
+		for _, c := range kv.Children() {
+			value, err := unmarshalInterface(c)
+
+			if err != nil {
+				return nil, err
+			}
+
+			s = append(s, value)
+		}
+
+		return s, nil
+	default:
+		value, err := scalarValue(kv)
+
+		if errors.Is(err, ErrUnsupportedType) {
+			return nil, newUnmarshalError(kv, interfaceType, ErrUnsupportedType)
+		}
+
+		return value, err
+	}
+}
+
+func newUnmarshalError(kv KeyValue, t reflect.Type, err error) *MarshalError {
+	e := &MarshalError{Op: OpUnmarshal, Key: kv.Key(), Type: kv.Type(), GoType: t, Err: err}
+
+	if err != ErrTypeMismatch && err != ErrUnsupportedType {
+		e.Value = kv.Value()
+	}
+
+	return e
+}